@@ -0,0 +1,188 @@
+package dnssd
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AddrPolicy selects the addresses of a network interface,
+// which are advertised in A and AAAA records.
+type AddrPolicy func(iface *net.Interface, ips []net.IP) []net.IP
+
+// Policies returns a policy, which applies all policies in order.
+func Policies(policies ...AddrPolicy) AddrPolicy {
+	return func(iface *net.Interface, ips []net.IP) []net.IP {
+		for _, p := range policies {
+			ips = p(iface, ips)
+		}
+		return ips
+	}
+}
+
+// ExcludeLinkLocal is a policy, which excludes link-local addresses.
+func ExcludeLinkLocal(iface *net.Interface, ips []net.IP) []net.IP {
+	return filterIPs(ips, func(ip net.IP) bool {
+		return !ip.IsLinkLocalUnicast()
+	})
+}
+
+// ExcludeTemporary is a policy, which excludes temporary IPv6 addresses (RFC8981).
+// Temporary addresses are only detected on Linux. They are cached until the network
+// interfaces change, or for at most one minute.
+func ExcludeTemporary(iface *net.Interface, ips []net.IP) []net.IP {
+	temporary := temporaryAddrs.lookup(iface)
+	if len(temporary) == 0 {
+		return ips
+	}
+
+	return filterIPs(ips, func(ip net.IP) bool {
+		return !temporary[ip.String()]
+	})
+}
+
+// PreferGlobal is a policy, which excludes link-local IPv6 addresses,
+// if the interface has a global unicast IPv6 address.
+func PreferGlobal(iface *net.Interface, ips []net.IP) []net.IP {
+	hasGlobal := false
+	for _, ip := range ips {
+		if ip.To4() == nil && ip.IsGlobalUnicast() {
+			hasGlobal = true
+			break
+		}
+	}
+
+	if !hasGlobal {
+		return ips
+	}
+
+	return filterIPs(ips, func(ip net.IP) bool {
+		return ip.To4() != nil || !ip.IsLinkLocalUnicast()
+	})
+}
+
+// InSubnets returns a policy, which only selects addresses in subnets.
+func InSubnets(subnets ...*net.IPNet) AddrPolicy {
+	return func(iface *net.Interface, ips []net.IP) []net.IP {
+		return filterIPs(ips, func(ip net.IP) bool {
+			for _, subnet := range subnets {
+				if subnet.Contains(ip) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
+// IPv4Only is a policy, which only selects IPv4 addresses.
+func IPv4Only(iface *net.Interface, ips []net.IP) []net.IP {
+	return filterIPs(ips, func(ip net.IP) bool {
+		return ip.To4() != nil
+	})
+}
+
+// IPv6Only is a policy, which only selects IPv6 addresses.
+func IPv6Only(iface *net.Interface, ips []net.IP) []net.IP {
+	return filterIPs(ips, func(ip net.IP) bool {
+		return ip.To4() == nil
+	})
+}
+
+// PerInterface returns a policy, which applies the policies of the network interfaces
+// by name, e.g. IPv4Only for "eth0" and IPv6Only for "wpan0". The names may be patterns
+// like "wlan*" (see path.Match). If multiple patterns match an interface name, the policy
+// of the longest pattern is applied. The addresses of other interfaces are not changed.
+func PerInterface(policies map[string]AddrPolicy) AddrPolicy {
+	// The patterns are ordered, so that the same policy is always applied.
+	var patterns []string
+	for name := range policies {
+		patterns = append(patterns, name)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	return func(iface *net.Interface, ips []net.IP) []net.IP {
+		if iface == nil {
+			return ips
+		}
+
+		if p, ok := policies[iface.Name]; ok {
+			return p(iface, ips)
+		}
+
+		for _, name := range patterns {
+			if ifaceNameMatch(name, iface.Name) {
+				return policies[name](iface, ips)
+			}
+		}
+
+		return ips
+	}
+}
+
+// temporaryAddrsMaxAge is the duration after which the cached
+// temporary addresses of a network interface are looked up again.
+const temporaryAddrsMaxAge = time.Minute
+
+// temporaryAddrs caches the temporary addresses of the network interfaces,
+// because looking them up is expensive and addresses are selected for every
+// response. The cache is reset when network interfaces change.
+var temporaryAddrs = &temporaryCache{}
+
+type temporaryCache struct {
+	mutex sync.Mutex
+	addrs map[int]temporaryEntry
+}
+
+type temporaryEntry struct {
+	ips map[string]bool
+	at  time.Time
+}
+
+// lookup returns the cached temporary addresses of iface,
+// or looks them up if they are not cached or too old.
+func (c *temporaryCache) lookup(iface *net.Interface) map[string]bool {
+	if iface == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if e, ok := c.addrs[iface.Index]; ok && now.Sub(e.at) < temporaryAddrsMaxAge {
+		return e.ips
+	}
+
+	if c.addrs == nil {
+		c.addrs = map[int]temporaryEntry{}
+	}
+	ips := temporaryIPs(iface)
+	c.addrs[iface.Index] = temporaryEntry{ips: ips, at: now}
+
+	return ips
+}
+
+// reset clears the cache, e.g. when the network interfaces changed.
+func (c *temporaryCache) reset() {
+	c.mutex.Lock()
+	c.addrs = nil
+	c.mutex.Unlock()
+}
+
+func filterIPs(ips []net.IP, fn func(ip net.IP) bool) []net.IP {
+	result := []net.IP{}
+	for _, ip := range ips {
+		if fn(ip) {
+			result = append(result, ip)
+		}
+	}
+
+	return result
+}
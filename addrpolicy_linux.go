@@ -0,0 +1,33 @@
+package dnssd
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// ifaFTemporary is the flag of temporary IPv6 addresses (IFA_F_TEMPORARY).
+const ifaFTemporary = 0x01
+
+// temporaryIPs returns the temporary IPv6 addresses of iface.
+func temporaryIPs(iface *net.Interface) map[string]bool {
+	link, err := netlink.LinkByIndex(iface.Index)
+	if err != nil {
+		return nil
+	}
+
+	addrs, err := netlink.AddrList(link, syscall.AF_INET6)
+	if err != nil {
+		return nil
+	}
+
+	result := map[string]bool{}
+	for _, addr := range addrs {
+		if addr.Flags&ifaFTemporary != 0 && addr.IPNet != nil {
+			result[addr.IP.String()] = true
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package dnssd
+
+import (
+	"net"
+)
+
+// temporaryIPs returns nil, because temporary addresses can't be detected.
+func temporaryIPs(iface *net.Interface) map[string]bool {
+	return nil
+}
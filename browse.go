@@ -1,12 +1,19 @@
 package dnssd
 
 import (
-	"github.com/brutella/dnssd/log"
 	"github.com/miekg/dns"
 
 	"context"
 	"fmt"
+	"log/slog"
 	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // BrowseEntry represents a discovered service instance.
@@ -18,7 +25,56 @@ type BrowseEntry struct {
 	Name      string
 	Type      string
 	Domain    string
-	Text      map[string]string
+
+	// Text are the attributes of the TXT record with keys in the case
+	// in which they were received. Use LookupText to get a value
+	// by its case-insensitive key. (RFC6763 6.4)
+	Text map[string]string
+
+	// Addrs are the addresses of IPs. Link-local IPv6 addresses have
+	// the name of the network interface as zone, e.g. "fe80::1%en0".
+	Addrs []netip.Addr
+
+	// Iface is the network interface at which the service was found,
+	// and IfIndex its index. Iface is nil, if the interface is unknown.
+	Iface   *net.Interface
+	IfIndex int
+
+	// TTL is the time to live of the service records when the entry was found,
+	// and ExpiresAt the time when the records expire without being refreshed.
+	TTL       time.Duration
+	ExpiresAt time.Time
+
+	// TextFlags are the keys of boolean attributes in the
+	// TXT record, which are present without value.
+	TextFlags []string
+
+	// IfaceNames are the names of the network interfaces at which the service was found.
+	// Entries deduplicated by instance list every interface, others only IfaceName.
+	IfaceNames []string
+
+	// Records are the received PTR, SRV, TXT, A, AAAA and NSEC records of the service,
+	// e.g. to inspect vendor-specific data. The records must not be modified.
+	Records []dns.RR
+}
+
+// zonedAddrs returns ips as addresses. The zone of link-local
+// IPv6 addresses is the name of the network interface.
+func zonedAddrs(ips []net.IP, ifaceName string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, ip := range ips {
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		if addr.Is6() && (addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast()) {
+			addr = addr.WithZone(ifaceName)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	return addrs
 }
 
 // AddFunc is called when a service instance was found.
@@ -27,7 +83,64 @@ type AddFunc func(BrowseEntry)
 // RmvFunc is called when a service instance disappared.
 type RmvFunc func(BrowseEntry)
 
-// LookupType browses for service instances.
+// UpdFunc is called when the TXT records, port or ip addresses
+// of a found service instance changed.
+type UpdFunc func(BrowseEntry)
+
+// newBrowseEntry returns the entry of srv at the network interface with the name ifaceName.
+func newBrowseEntry(srv *Service, ifaceName string, ips []net.IP, iface *net.Interface) BrowseEntry {
+	e := BrowseEntry{
+		IPs:        ips,
+		Addrs:      zonedAddrs(ips, ifaceName),
+		Host:       srv.Host,
+		Port:       srv.Port,
+		IfaceName:  ifaceName,
+		Name:       srv.Name,
+		Type:       srv.Type,
+		Domain:     srv.Domain,
+		Text:       srv.Text,
+		TextFlags:  srv.TextFlags,
+		TTL:        srv.TTL,
+		ExpiresAt:  srv.expiration,
+		IfaceNames: []string{ifaceName},
+		Records:    srv.records,
+	}
+
+	if iface != nil {
+		e.Iface = iface
+		e.IfIndex = iface.Index
+	}
+
+	return e
+}
+
+// isBrowseEntryChanged returns true, if the TXT records, host, port
+// or ip addresses of this and that are different.
+func isBrowseEntryChanged(this, that BrowseEntry) bool {
+	if this.Host != that.Host || this.Port != that.Port {
+		return true
+	}
+
+	if !reflect.DeepEqual(this.Text, that.Text) || !reflect.DeepEqual(this.TextFlags, that.TextFlags) {
+		return true
+	}
+
+	if len(this.IPs) != len(that.IPs) || len(this.IfaceNames) != len(that.IfaceNames) {
+		return true
+	}
+
+	for _, ip := range this.IPs {
+		if !containsIP(that.IPs, ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LookupType browses for service instances until ctx is done.
+// If the deadline of ctx expires after service instances were found,
+// no error is returned.
 func LookupType(ctx context.Context, service string, add AddFunc, rmv RmvFunc) (err error) {
 	conn, err := newMDNSConn()
 	if err != nil {
@@ -35,10 +148,11 @@ func LookupType(ctx context.Context, service string, add AddFunc, rmv RmvFunc) (
 	}
 	defer conn.close()
 
-	return lookupType(ctx, service, conn, add, rmv)
+	return lookupType(ctx, service, conn, add, nil, rmv)
 }
 
 // LookupTypeAtInterface browses for service instances at specific network interfaces.
+// Queries are only sent at and responses only accepted from these interfaces.
 func LookupTypeAtInterfaces(ctx context.Context, service string, add AddFunc, rmv RmvFunc, ifaces ...string) (err error) {
 	conn, err := newMDNSConn(ifaces...)
 	if err != nil {
@@ -46,14 +160,80 @@ func LookupTypeAtInterfaces(ctx context.Context, service string, add AddFunc, rm
 	}
 	defer conn.close()
 
-	return lookupType(ctx, service, conn, add, rmv, ifaces...)
+	return lookupType(ctx, service, conn, add, nil, rmv, ifaces...)
+}
+
+// LookupTypeWithConn browses for service instances like LookupTypeAtInterfaces
+// using conn, e.g. a SharedConn which is also used by a responder.
+// The connection is not closed when the lookup is done.
+func LookupTypeWithConn(ctx context.Context, conn MDNSConn, service string, add AddFunc, rmv RmvFunc, ifaces ...string) (err error) {
+	return lookupType(ctx, service, conn, add, nil, rmv, ifaces...)
+}
+
+// LookupTypeWithUpdates browses for service instances like LookupTypeAtInterfaces
+// and calls upd when the TXT records, port or ip addresses of a found service instance change.
+// If no interfaces are specified, all multicast interfaces are used.
+func LookupTypeWithUpdates(ctx context.Context, service string, add AddFunc, upd UpdFunc, rmv RmvFunc, ifaces ...string) (err error) {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	return lookupType(ctx, service, conn, add, upd, rmv, ifaces...)
+}
+
+// BrowseOptions are the options of LookupTypeWithOptions.
+type BrowseOptions struct {
+	// Ifaces are the names of the network interfaces at which is browsed.
+	// If empty, all multicast interfaces are used.
+	Ifaces []string
+
+	// Network is "udp4" or "udp6" to browse only via IPv4 or IPv6.
+	// If empty, both are used.
+	Network string
+
+	// QueryInterval is the time between the first two queries. The interval
+	// is doubled after every query until it reaches sixty minutes. (RFC6762 5.2)
+	// If zero, only one query is sent. Intervals less than one second are increased to one second.
+	QueryInterval time.Duration
+
+	// FirstQueryDelay is the time before the first query is sent, e.g. a random
+	// delay of 20-120 ms, when many hosts start browsing at the same time. (RFC6762 5.2)
+	FirstQueryDelay time.Duration
+
+	// DisableIPLookups disables the queries for missing A and AAAA records
+	// of found service instances. Service instances are only reported
+	// with the addresses, which are received with their SRV records.
+	DisableIPLookups bool
+}
+
+// queryInterval returns the time between the first two queries, or zero.
+func (o BrowseOptions) queryInterval() time.Duration {
+	if o.QueryInterval > 0 && o.QueryInterval < time.Second {
+		return time.Second
+	}
+
+	return o.QueryInterval
+}
+
+// LookupTypeWithOptions browses for service instances like LookupTypeWithUpdates
+// with the options opts. upd may be nil.
+func LookupTypeWithOptions(ctx context.Context, service string, add AddFunc, upd UpdFunc, rmv RmvFunc, opts BrowseOptions) error {
+	conn, err := newMDNSConnWithOptions(ConnOptions{Ifaces: opts.Ifaces, Network: opts.Network})
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	return lookupTypeWithOptions(ctx, service, conn, add, upd, rmv, opts)
 }
 
 // ServiceInstanceName returns the service instance name
 // in the form of <instance name>.<service>.<domain>.
 // (Note the trailing dot.)
 func (e BrowseEntry) EscapedServiceInstanceName() string {
-	return fmt.Sprintf("%s.%s.%s.", escape.Replace(e.Name), e.Type, e.Domain)
+	return fmt.Sprintf("%s.%s.%s.", EscapeInstanceName(e.Name), e.Type, e.Domain)
 }
 
 // ServiceInstanceName returns the same as `ServiceInstanceName()`
@@ -62,9 +242,144 @@ func (e BrowseEntry) ServiceInstanceName() string {
 	return fmt.Sprintf("%s.%s.%s.", e.Name, e.Type, e.Domain)
 }
 
-func lookupType(ctx context.Context, service string, conn MDNSConn, add AddFunc, rmv RmvFunc, ifaces ...string) (err error) {
+// URL returns the URL of the service, e.g. "http://Computer.local:8080/admin"
+// for a "_http._tcp" service. The host is the host name of the service
+// in the domain of the service, or the first address, if the host name is unknown. The path is the value of
+// the "path" TXT attribute. If scheme is empty, it is the service name of
+// the service type, e.g. "http". URL returns nil, if the host is unknown.
+func (e BrowseEntry) URL(scheme string) *url.URL {
+	if scheme == "" {
+		scheme = strings.TrimPrefix(strings.SplitN(e.Type, ".", 2)[0], "_")
+	}
+
+	var host string
+	if e.Host != "" {
+		host = fmt.Sprintf("%s.%s", e.Host, strings.TrimSuffix(e.Domain, "."))
+	} else {
+		addrs := e.Addrs
+		if len(addrs) == 0 {
+			addrs = zonedAddrs(e.IPs, e.IfaceName)
+		}
+		if len(addrs) == 0 {
+			return nil
+		}
+		host = addrs[0].String()
+	}
+
+	// The port is omitted, if it is the default port of the scheme.
+	if !(scheme == "http" && e.Port == 80) && !(scheme == "https" && e.Port == 443) && e.Port != 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(e.Port))
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	u := &url.URL{Scheme: scheme, Host: host, Path: "/"}
+	if path, ok := LookupText(e.Text, "path"); ok && path != "" {
+		path, query, _ := strings.Cut(path, "?")
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		u.Path, u.RawQuery = path, query
+	}
+
+	return u
+}
+
+func lookupType(ctx context.Context, service string, conn MDNSConn, add AddFunc, upd UpdFunc, rmv RmvFunc, ifaces ...string) (err error) {
+	return lookupTypeWithOptions(ctx, service, conn, add, upd, rmv, BrowseOptions{Ifaces: ifaces})
+}
+
+func lookupTypeWithOptions(ctx context.Context, service string, conn MDNSConn, add AddFunc, upd UpdFunc, rmv RmvFunc, opts BrowseOptions) (err error) {
 	var cache = NewCache()
+	cache.clock = clockFrom(ctx)
+	logger := loggerFrom(ctx).With("service", service)
+	ifaces := opts.Ifaces
+
+	readCtx, readCancel := context.WithCancel(ctx)
+	defer readCancel()
+
+	ch := conn.Read(readCtx)
 
+	m := browseQuery(service)
+	qs := make(chan *Query)
+	send := func(delay time.Duration) {
+		go func() {
+			if delay > 0 {
+				select {
+				case <-cache.clock.After(delay):
+				case <-readCtx.Done():
+					return
+				}
+			}
+
+			for _, iface := range netnsOf(conn).multicastInterfaces(ifaces...) {
+				iface := iface
+				q := &Query{msg: m, iface: iface}
+				select {
+				case qs <- q:
+				case <-readCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+	send(opts.FirstQueryDelay)
+
+	// retry receives a value when the query is repeated.
+	var retry <-chan time.Time
+	interval := opts.queryInterval()
+	if interval > 0 {
+		retry = cache.clock.After(opts.FirstQueryDelay + interval)
+	}
+
+	tb := &typeBrowser{service: service, add: add, upd: upd, rmv: rmv, noAddrs: opts.DisableIPLookups}
+	// network interfaces at which messages were received by name
+	seenIfaces := map[string]*net.Interface{}
+	expiry := &expiryTimer{cache: cache}
+	for {
+		expiry.reset()
+		select {
+		case q := <-qs:
+			logger.Debug("Send browsing query", "iface", q.IfaceName(), "msg", q.msg)
+			if err := conn.SendQuery(q); err != nil {
+				logger.Debug("Sending browsing query failed", "iface", q.IfaceName(), "err", err)
+			}
+
+		case <-retry:
+			send(0)
+			interval = nextQueryInterval(interval)
+			retry = cache.clock.After(interval)
+
+		case req := <-ch:
+			if !acceptsIface(ifaces, req.iface) {
+				break
+			}
+			logger.Debug("Receive message", "iface", req.IfaceName(), "peer", req.from, "msg", req.msg)
+			if req.iface != nil {
+				seenIfaces[req.iface.Name] = req.iface
+			}
+			events := cache.updateDelta(req)
+			tb.apply(events, seenIfaces)
+			tb.followUp(conn, cache, events, req.iface, ifaces, logger)
+
+		case <-expiry.C:
+			tb.apply(expiry.expire(), seenIfaces)
+
+		case <-ctx.Done():
+			return lookupErr(ctx, len(tb.es) > 0)
+		}
+	}
+}
+
+// acceptsIface returns true, if messages received at iface are accepted by a lookup
+// at the network interfaces ifaces, or at all interfaces if ifaces is empty.
+// Messages from unknown interfaces are accepted.
+func acceptsIface(ifaces []string, iface *net.Interface) bool {
+	return iface == nil || containsIfaces(iface.Name, ifaces)
+}
+
+// browseQuery returns a query for service instances of service.
+func browseQuery(service string) *dns.Msg {
 	m := new(dns.Msg)
 	m.Question = []dns.Question{
 		dns.Question{
@@ -77,82 +392,223 @@ func lookupType(ctx context.Context, service string, conn MDNSConn, add AddFunc,
 	// m.Answer = ...
 	// m.Authoritive = false // because our answers are *believes*
 
-	readCtx, readCancel := context.WithCancel(ctx)
-	defer readCancel()
+	return m
+}
 
-	ch := conn.Read(readCtx)
+// typeBrowser keeps track of the found service instances of one service type.
+type typeBrowser struct {
+	service string
+	add     AddFunc
+	upd     UpdFunc
+	rmv     RmvFunc
 
-	qs := make(chan *Query)
-	go func() {
-		for _, iface := range MulticastInterfaces(ifaces...) {
-			iface := iface
-			q := &Query{msg: m, iface: iface}
-			qs <- q
-		}
-	}()
+	// es stores the found entries by service instance name.
+	es map[string][]*BrowseEntry
 
-	es := []*BrowseEntry{}
-	for {
-		select {
-		case q := <-qs:
-			log.Debug.Printf("Send browsing query at %s\n%s\n", q.IfaceName(), q.msg)
-			if err := conn.SendQuery(q); err != nil {
-				log.Debug.Println("SendQuery:", err)
-			}
+	// questions for missing records, which were already sent
+	// and are not answered yet
+	asked map[string]bool
 
-		case req := <-ch:
-			log.Debug.Printf("Receive message at %s\n%s\n", req.IfaceName(), req.msg)
-			cache.UpdateFrom(req)
-			for _, srv := range cache.Services() {
-				if srv.ServiceName() != service {
-					continue
-				}
+	// dedupe is true, if a service instance is reported
+	// only once for all network interfaces.
+	dedupe bool
+
+	// noAddrs is true, if missing addresses are not queried.
+	noAddrs bool
+}
+
+// entries returns the browse entries of srv. Without deduplication
+// there is one entry per network interface at which srv was found.
+func (tb *typeBrowser) entries(srv *Service, seenIfaces map[string]*net.Interface) []BrowseEntry {
+	var names []string
+	for ifaceName := range srv.ifaceIPs {
+		names = append(names, ifaceName)
+	}
+	sort.Strings(names)
 
-				for ifaceName, ips := range srv.ifaceIPs {
-					var found = false
-					for _, e := range es {
-						if e.Name == srv.Name && e.IfaceName == ifaceName {
-							found = true
-							break
-						}
-					}
-					if !found {
-						e := BrowseEntry{
-							IPs:       ips,
-							Host:      srv.Host,
-							Port:      srv.Port,
-							IfaceName: ifaceName,
-							Name:      srv.Name,
-							Type:      srv.Type,
-							Domain:    srv.Domain,
-							Text:      srv.Text,
-						}
-						es = append(es, &e)
-						add(e)
-					}
+	var es []BrowseEntry
+	for _, ifaceName := range names {
+		ips := srv.ifaceIPs[ifaceName]
+		if tb.dedupe && len(es) > 0 {
+			e := &es[0]
+			e.IfaceNames = append(e.IfaceNames, ifaceName)
+			for _, ip := range ips {
+				if !containsIP(e.IPs, ip) {
+					e.IPs = append(e.IPs, ip)
 				}
 			}
+			e.Addrs = append(e.Addrs, zonedAddrs(ips, ifaceName)...)
+			continue
+		}
 
-			tmp := []*BrowseEntry{}
-			for _, e := range es {
-				var found = false
-				for _, srv := range cache.Services() {
-					if srv.ServiceInstanceName() == e.ServiceInstanceName() {
-						found = true
-						break
-					}
-				}
+		// Copy ips to not modify the cached addresses when merging.
+		es = append(es, newBrowseEntry(srv, ifaceName, append([]net.IP{}, ips...), seenIfaces[ifaceName]))
+	}
 
-				if found {
-					tmp = append(tmp, e)
-				} else {
-					// TODO
-					rmv(*e)
-				}
+	return es
+}
+
+// update compares the found service instances with the services in cache
+// and calls the add, update and remove functions for the differences.
+func (tb *typeBrowser) update(cache *Cache, seenIfaces map[string]*net.Interface) {
+	cached := map[string]bool{}
+	for _, srv := range cache.Services() {
+		if srv.ServiceName() != tb.service {
+			continue
+		}
+
+		cached[srv.ServiceInstanceName()] = true
+		tb.report(srv, seenIfaces)
+	}
+
+	for name := range tb.es {
+		if !cached[name] {
+			tb.remove(name)
+		}
+	}
+}
+
+// apply calls the add, update and remove functions for the service
+// instances in events, which are the changes of a cache update.
+// Unlike update, only the changed service instances are compared.
+func (tb *typeBrowser) apply(events []CacheEvent, seenIfaces map[string]*net.Interface) {
+	for _, ev := range events {
+		srv := ev.Service
+		if srv.ServiceName() != tb.service {
+			continue
+		}
+
+		if ev.Kind == BrowseRemove {
+			tb.remove(srv.ServiceInstanceName())
+		} else {
+			tb.report(&srv, seenIfaces)
+		}
+	}
+}
+
+// report calls the add and update functions for the entries of srv,
+// which are new or different from the found entries.
+func (tb *typeBrowser) report(srv *Service, seenIfaces map[string]*net.Interface) {
+	if tb.es == nil {
+		tb.es = map[string][]*BrowseEntry{}
+	}
+
+	name := srv.ServiceInstanceName()
+	for _, e := range tb.entries(srv, seenIfaces) {
+		e := e
+
+		var found *BrowseEntry
+		for _, existing := range tb.es[name] {
+			if tb.dedupe || existing.IfaceName == e.IfaceName {
+				found = existing
+				break
 			}
-			es = tmp
-		case <-ctx.Done():
-			return ctx.Err()
+		}
+
+		if found == nil {
+			tb.es[name] = append(tb.es[name], &e)
+			tb.add(e)
+		} else if isBrowseEntryChanged(*found, e) {
+			*found = e
+			if tb.upd != nil {
+				tb.upd(e)
+			}
+		}
+	}
+}
+
+// remove calls the remove function for the found entries of
+// the service instance with the service instance name name.
+func (tb *typeBrowser) remove(name string) {
+	for _, e := range tb.es[name] {
+		tb.rmv(*e)
+	}
+	delete(tb.es, name)
+}
+
+// followUpQuery returns a query for the missing records of the service instances in events,
+// which are the changes of a cache update, or nil if no records are missing. Service instances
+// without SRV record are queried for SRV and TXT records, and hosts without addresses for A and
+// AAAA records. Every question is sent only once as long as the records are missing.
+func (tb *typeBrowser) followUpQuery(cache *Cache, events []CacheEvent) *dns.Msg {
+	if tb.asked == nil {
+		tb.asked = map[string]bool{}
+	}
+
+	var qs []dns.Question
+	ask := func(name string, qtype uint16) {
+		if cache.hasNoRecord(name, qtype) {
+			// The record doesn't exist. (RFC6762 6.1)
+			return
+		}
+
+		q := dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET}
+		if key := q.String(); !tb.asked[key] {
+			qs = append(qs, q)
+			tb.asked[key] = true
+		}
+	}
+	// forget allows to ask again, when the records are missing again.
+	forget := func(name string, qtypes ...uint16) {
+		for _, qtype := range qtypes {
+			q := dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET}
+			delete(tb.asked, q.String())
+		}
+	}
+
+	for _, ev := range events {
+		srv := ev.Service
+		if srv.ServiceName() != tb.service {
+			continue
+		}
+
+		switch {
+		case ev.Kind == BrowseRemove:
+			forget(srv.EscapedServiceInstanceName(), dns.TypeSRV, dns.TypeTXT)
+			if srv.Host != "" {
+				forget(srv.Hostname(), dns.TypeA, dns.TypeAAAA)
+			}
+		case srv.Host == "":
+			ask(srv.EscapedServiceInstanceName(), dns.TypeSRV)
+			ask(srv.EscapedServiceInstanceName(), dns.TypeTXT)
+		case len(srv.IPs) == 0 && !tb.noAddrs:
+			forget(srv.EscapedServiceInstanceName(), dns.TypeSRV, dns.TypeTXT)
+			ask(srv.Hostname(), dns.TypeA)
+			ask(srv.Hostname(), dns.TypeAAAA)
+		default:
+			forget(srv.EscapedServiceInstanceName(), dns.TypeSRV, dns.TypeTXT)
+			forget(srv.Hostname(), dns.TypeA, dns.TypeAAAA)
+		}
+	}
+
+	if len(qs) == 0 {
+		return nil
+	}
+
+	m := new(dns.Msg)
+	m.Question = qs
+
+	return m
+}
+
+// followUp sends a query for the missing records of the service instances in events
+// at the network interface iface, or at every interface if iface is nil.
+func (tb *typeBrowser) followUp(conn MDNSConn, cache *Cache, events []CacheEvent, iface *net.Interface, ifaces []string, logger *slog.Logger) {
+	m := tb.followUpQuery(cache, events)
+	if m == nil {
+		return
+	}
+
+	targets := []*net.Interface{iface}
+	if iface == nil {
+		targets = netnsOf(conn).multicastInterfaces(ifaces...)
+	}
+
+	for _, iface := range targets {
+		q := &Query{msg: m, iface: iface}
+		logger.Debug("Send follow-up query", "iface", q.IfaceName(), "msg", q.msg)
+		if err := conn.SendQuery(q); err != nil {
+			logger.Debug("Sending follow-up query failed", "iface", q.IfaceName(), "err", err)
 		}
 	}
 }
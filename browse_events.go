@@ -0,0 +1,72 @@
+package dnssd
+
+import (
+	"context"
+)
+
+// BrowseEventKind is the kind of a browse event.
+type BrowseEventKind int
+
+const (
+	// BrowseAdd is the kind of events for found service instances.
+	BrowseAdd BrowseEventKind = iota
+
+	// BrowseUpdate is the kind of events for changed service instances.
+	BrowseUpdate
+
+	// BrowseRemove is the kind of events for disappeared service instances.
+	BrowseRemove
+)
+
+func (k BrowseEventKind) String() string {
+	switch k {
+	case BrowseAdd:
+		return "Add"
+	case BrowseUpdate:
+		return "Update"
+	case BrowseRemove:
+		return "Remove"
+	default:
+		return "Unknown"
+	}
+}
+
+// BrowseEvent is sent when a service instance was found, changed or disappeared.
+type BrowseEvent struct {
+	Kind  BrowseEventKind
+	Entry BrowseEntry
+}
+
+// Browse browses for service instances at the network interfaces ifaces,
+// or at all multicast interfaces if none are specified.
+// The returned channel receives events until ctx is done, then it is closed.
+func Browse(ctx context.Context, service string, ifaces ...string) (<-chan BrowseEvent, error) {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan BrowseEvent)
+	go func() {
+		defer conn.close()
+		browse(ctx, service, conn, ch, ifaces...)
+	}()
+
+	return ch, nil
+}
+
+// browse sends browse events to ch until ctx is done and closes ch.
+func browse(ctx context.Context, service string, conn MDNSConn, ch chan<- BrowseEvent, ifaces ...string) {
+	defer close(ch)
+
+	send := func(kind BrowseEventKind) func(BrowseEntry) {
+		return func(e BrowseEntry) {
+			select {
+			case ch <- BrowseEvent{Kind: kind, Entry: e}:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	lookupType(ctx, service, conn, send(BrowseAdd), send(BrowseUpdate), send(BrowseRemove), ifaces...)
+}
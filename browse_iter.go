@@ -0,0 +1,31 @@
+//go:build go1.23
+
+package dnssd
+
+import (
+	"context"
+	"iter"
+)
+
+// BrowseSeq returns a sequence of browse events for service instances at the
+// network interfaces ifaces, or at all multicast interfaces if none are specified.
+// The sequence ends when ctx is done or the loop is stopped.
+// If browsing can't be started, the sequence yields only the error.
+func BrowseSeq(ctx context.Context, service string, ifaces ...string) iter.Seq2[BrowseEvent, error] {
+	return func(yield func(BrowseEvent, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		ch, err := Browse(ctx, service, ifaces...)
+		if err != nil {
+			yield(BrowseEvent{}, err)
+			return
+		}
+
+		for e := range ch {
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package dnssd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Browser browses for multiple service types on one connection
+// and shares one cache between them.
+// Service types can be added and removed while the browser is running.
+type Browser struct {
+	// DedupeByInstance merges the entries of a service instance found at multiple
+	// network interfaces into one entry, which contains the ip addresses and the
+	// names of all interfaces. It must be set before service types are added.
+	DedupeByInstance bool
+
+	conn   MDNSConn
+	ifaces []string
+	cache  *Cache
+
+	mutex     sync.Mutex
+	types     map[string]*typeBrowser
+	isRunning bool
+	logger    *slog.Logger
+
+	// discover is true, if service types are discovered
+	// via the meta-query and browsed with add and rmv.
+	discover bool
+	add      AddFunc
+	rmv      RmvFunc
+
+	// network interfaces at which messages were received by name
+	seenIfaces map[string]*net.Interface
+}
+
+// NewBrowser returns a browser, which sends queries at the network
+// interfaces ifaces, or at all multicast interfaces if none are specified.
+func NewBrowser(ifaces ...string) (*Browser, error) {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBrowser(conn, ifaces...), nil
+}
+
+// NewBrowserWithConn returns a browser, which uses conn, e.g. a SharedConn
+// which is also used by a responder. The connection is closed when Run returns.
+func NewBrowserWithConn(conn MDNSConn, ifaces ...string) *Browser {
+	return newBrowser(conn, ifaces...)
+}
+
+func newBrowser(conn MDNSConn, ifaces ...string) *Browser {
+	return &Browser{
+		conn:       conn,
+		ifaces:     ifaces,
+		cache:      NewCache(),
+		types:      map[string]*typeBrowser{},
+		logger:     defaultLogger,
+		seenIfaces: map[string]*net.Interface{},
+	}
+}
+
+// Add starts browsing for service instances of the service type,
+// e.g. "_hap._tcp.local.". upd may be nil.
+func (b *Browser) Add(service string, add AddFunc, upd UpdFunc, rmv RmvFunc) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.types[service]; ok {
+		return fmt.Errorf("already browsing for %s", service)
+	}
+
+	b.addType(service, add, upd, rmv)
+
+	return nil
+}
+
+// addType adds a service type while the mutex is locked.
+func (b *Browser) addType(service string, add AddFunc, upd UpdFunc, rmv RmvFunc) {
+	tb := &typeBrowser{service: service, add: add, upd: upd, rmv: rmv, dedupe: b.DedupeByInstance}
+	b.types[service] = tb
+
+	if b.isRunning {
+		// Report already cached service instances.
+		tb.update(b.cache, b.seenIfaces)
+		go b.query(service)
+	}
+}
+
+// Cache returns the cache of the browser, e.g. to list the cached services.
+func (b *Browser) Cache() *Cache {
+	return b.cache
+}
+
+// Remove stops browsing for service instances of the service type.
+func (b *Browser) Remove(service string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.types, service)
+}
+
+// Run sends queries for the added service types and receives responses until ctx is done.
+// The connection of the browser is closed when Run returns.
+func (b *Browser) Run(ctx context.Context) error {
+	defer b.conn.Close()
+
+	b.mutex.Lock()
+	b.isRunning = true
+	b.logger = loggerFrom(ctx)
+	b.cache.clock = clockFrom(ctx)
+	for service := range b.types {
+		go b.query(service)
+	}
+	if b.discover {
+		go b.query(metaQueryName)
+	}
+	b.mutex.Unlock()
+
+	readCtx, readCancel := context.WithCancel(ctx)
+	defer readCancel()
+
+	ch := b.conn.Read(readCtx)
+	expiry := &expiryTimer{cache: b.cache}
+	for {
+		expiry.reset()
+		select {
+		case req := <-ch:
+			if !acceptsIface(b.ifaces, req.iface) {
+				break
+			}
+			b.mutex.Lock()
+			b.logger.Debug("Receive message", "iface", req.IfaceName(), "peer", req.from, "msg", req.msg)
+			if req.iface != nil {
+				b.seenIfaces[req.iface.Name] = req.iface
+			}
+			events := b.cache.updateDelta(req)
+			if b.discover {
+				for _, service := range serviceTypes(req.msg) {
+					if _, ok := b.types[service]; !ok {
+						b.logger.Debug("Discovered service type", "service", service)
+						b.addType(service, b.add, nil, b.rmv)
+					}
+				}
+			}
+			for _, tb := range b.types {
+				tb.apply(events, b.seenIfaces)
+				tb.followUp(b.conn, b.cache, events, req.iface, b.ifaces, b.logger)
+			}
+			b.mutex.Unlock()
+
+		case <-expiry.C:
+			b.mutex.Lock()
+			events := expiry.expire()
+			for _, tb := range b.types {
+				tb.apply(events, b.seenIfaces)
+			}
+			b.mutex.Unlock()
+
+		case <-ctx.Done():
+			b.mutex.Lock()
+			b.isRunning = false
+			b.mutex.Unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+// query sends a query for service instances of service at every network interface.
+func (b *Browser) query(service string) {
+	m := browseQuery(service)
+	for _, iface := range netnsOf(b.conn).multicastInterfaces(b.ifaces...) {
+		q := &Query{msg: m, iface: iface}
+		b.logger.Debug("Send browsing query", "service", service, "iface", q.IfaceName(), "msg", q.msg)
+		if err := b.conn.SendQuery(q); err != nil {
+			b.logger.Debug("Sending browsing query failed", "service", service, "iface", q.IfaceName(), "err", err)
+		}
+	}
+}
+
+// metaQueryName is the name used to enumerate the
+// service types on the local network. (RFC6763 9)
+const metaQueryName = "_services._dns-sd._udp.local."
+
+// serviceTypes returns the service types in the answers of msg
+// to a meta-query, e.g. "_hap._tcp.local.".
+func serviceTypes(msg *dns.Msg) []string {
+	var types []string
+	for _, rr := range msg.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok && strings.EqualFold(ptr.Hdr.Name, metaQueryName) && ptr.Hdr.Ttl > 0 {
+			types = append(types, ptr.Ptr)
+		}
+	}
+
+	return types
+}
+
+// BrowseAll enumerates the service types on the local network
+// and browses for service instances of every discovered type.
+// The type of an instance is available as Type of the entry.
+// If no interfaces are specified, all multicast interfaces are used.
+func BrowseAll(ctx context.Context, add AddFunc, rmv RmvFunc, ifaces ...string) error {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return err
+	}
+
+	return browseAll(ctx, conn, add, rmv, ifaces...)
+}
+
+func browseAll(ctx context.Context, conn MDNSConn, add AddFunc, rmv RmvFunc, ifaces ...string) error {
+	b := newBrowser(conn, ifaces...)
+	b.discover = true
+	b.add = add
+	b.rmv = rmv
+
+	return b.Run(ctx)
+}
+
+// ServicesOfHost browses for the service instances of every service type on the
+// local network like BrowseAll, and returns the instances of the host hostname,
+// e.g. "Computer" or "Computer.local.", which were found when ctx is done.
+// If the deadline of ctx expires after instances were found, they are returned without error.
+func ServicesOfHost(ctx context.Context, hostname string, ifaces ...string) ([]BrowseEntry, error) {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return nil, err
+	}
+
+	return servicesOfHost(ctx, conn, hostname, ifaces...)
+}
+
+func servicesOfHost(ctx context.Context, conn MDNSConn, hostname string, ifaces ...string) ([]BrowseEntry, error) {
+	found := map[string]BrowseEntry{}
+	key := func(e BrowseEntry) string {
+		return e.EscapedServiceInstanceName() + e.IfaceName
+	}
+
+	add := func(e BrowseEntry) {
+		if isEntryOfHost(e, hostname) {
+			found[key(e)] = e
+		}
+	}
+	rmv := func(e BrowseEntry) {
+		delete(found, key(e))
+	}
+
+	if err := browseAll(ctx, conn, add, rmv, ifaces...); err != ctx.Err() {
+		return nil, err
+	}
+
+	es := make([]BrowseEntry, 0, len(found))
+	for _, e := range found {
+		es = append(es, e)
+	}
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].EscapedServiceInstanceName() != es[j].EscapedServiceInstanceName() {
+			return es[i].EscapedServiceInstanceName() < es[j].EscapedServiceInstanceName()
+		}
+		return es[i].IfaceName < es[j].IfaceName
+	})
+
+	return es, lookupErr(ctx, len(es) > 0)
+}
+
+// isEntryOfHost returns true, if e is a service instance of the host hostname.
+// The hostname is compared with the domain of e, if it has more than one label.
+func isEntryOfHost(e BrowseEntry, hostname string) bool {
+	if labels := splitLabels(hostname); len(labels) == 1 {
+		return strings.EqualFold(e.Host, labels[0])
+	}
+
+	return strings.EqualFold(fmt.Sprintf("%s.%s.", e.Host, e.Domain), dns.Fqdn(hostname))
+}
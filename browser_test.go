@@ -3,18 +3,18 @@ package dnssd
 import (
 	"context"
 	"fmt"
+	"github.com/miekg/dns"
 	"net"
+	"net/netip"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 )
 
 func TestBrowse(t *testing.T) {
-	testIface, _ := net.InterfaceByName("lo0")
-	if testIface == nil {
-		testIface, _ = net.InterfaceByName("lo")
-	}
+	testIface, _ := LoopbackInterface()
 	if testIface == nil {
 		t.Fatal("can not find the local interface")
 	}
@@ -89,3 +89,829 @@ func TestBrowse(t *testing.T) {
 		})
 	}
 }
+
+func TestZonedAddrs(t *testing.T) {
+	ips := []net.IP{
+		net.IP{192, 168, 0, 10},
+		net.ParseIP("fe80::1"),
+		net.ParseIP("2001:db8::1"),
+	}
+
+	addrs := zonedAddrs(ips, "en0")
+	if is, want := len(addrs), 3; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	for i, want := range []string{"192.168.0.10", "fe80::1%en0", "2001:db8::1"} {
+		if is := addrs[i].String(); is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+}
+
+func TestLookupTypeUpdate(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+		Text: map[string]string{"version": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	response := func(srv Service) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{PTR(srv), SRV(srv), TXT(srv)}
+		for _, a := range A(srv, testIface) {
+			msg.Answer = append(msg.Answer, a)
+		}
+		return msg
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn := newTestConn()
+	added := make(chan BrowseEntry, 1)
+	updated := make(chan BrowseEntry, 1)
+	go lookupType(ctx, sv.ServiceName(), conn, func(e BrowseEntry) {
+		added <- e
+	}, func(e BrowseEntry) {
+		updated <- e
+	}, func(e BrowseEntry) {})
+
+	conn.in <- response(sv)
+	select {
+	case <-added:
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+
+	sv.Text = map[string]string{"version": "2"}
+	conn.in <- response(sv)
+	select {
+	case e := <-updated:
+		if is, want := e.Text["version"], "2"; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+}
+
+func TestLookupTypeExpiry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn := newTestConn()
+	removed := make(chan BrowseEntry, 1)
+	go lookupType(ctx, "_asdf._tcp.local.", conn, func(BrowseEntry) {}, nil, func(e BrowseEntry) {
+		removed <- e
+	})
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{
+		&dns.PTR{Hdr: dns.RR_Header{Name: "_asdf._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 1}, Ptr: "Test._asdf._tcp.local."},
+		&dns.SRV{Hdr: dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 1}, Target: "Computer.local.", Port: 1234},
+		&dns.A{Hdr: dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 1}, A: net.IP{192, 168, 0, 1}},
+	}
+	conn.in <- msg
+
+	// The service is removed when it expires, without receiving further messages.
+	select {
+	case e := <-removed:
+		if is, want := e.Name, "Test"; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+}
+
+func TestBrowseEvents(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{PTR(sv), SRV(sv), TXT(sv)}
+	for _, a := range A(sv, testIface) {
+		msg.Answer = append(msg.Answer, a)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn := newTestConn()
+	ch := make(chan BrowseEvent)
+	go browse(ctx, sv.ServiceName(), conn, ch)
+
+	conn.in <- msg
+	select {
+	case e := <-ch:
+		if is, want := e.Kind, BrowseAdd; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+
+		if is, want := e.Entry.Name, sv.Name; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestBrowserMultipleTypes(t *testing.T) {
+	var msgs []*dns.Msg
+	var types []string
+	for _, typ := range []string{"_asdf._tcp", "_qwer._tcp"} {
+		sv, err := NewService(Config{
+			Name: "Test",
+			Type: typ,
+			Host: "Computer",
+			Port: 1234,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sv.ifaceIPs = map[string][]net.IP{
+			testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+		}
+
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{PTR(sv), SRV(sv), TXT(sv)}
+		for _, a := range A(sv, testIface) {
+			msg.Answer = append(msg.Answer, a)
+		}
+		msgs = append(msgs, msg)
+		types = append(types, sv.ServiceName())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn := newTestConn()
+	b := newBrowser(conn)
+
+	added := make(chan BrowseEntry, 2)
+	for _, typ := range types {
+		if err := b.Add(typ, func(e BrowseEntry) {
+			added <- e
+		}, nil, func(e BrowseEntry) {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.Add(types[0], func(BrowseEntry) {}, nil, func(BrowseEntry) {}); err == nil {
+		t.Fatal("expected error for duplicate type")
+	}
+
+	go b.Run(ctx)
+
+	found := map[string]bool{}
+	for _, msg := range msgs {
+		conn.in <- msg
+		select {
+		case e := <-added:
+			found[e.Type] = true
+		case <-ctx.Done():
+			t.Fatal("timeout")
+		}
+	}
+
+	if is, want := len(found), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestBrowseAll(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn := newTestConn()
+	added := make(chan BrowseEntry, 1)
+	go browseAll(ctx, conn, func(e BrowseEntry) {
+		added <- e
+	}, func(e BrowseEntry) {})
+
+	meta := new(dns.Msg)
+	meta.Response = true
+	meta.Answer = []dns.RR{DNSSDServicesPTR(sv)}
+	conn.in <- meta
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{PTR(sv), SRV(sv), TXT(sv)}
+	for _, a := range A(sv, testIface) {
+		msg.Answer = append(msg.Answer, a)
+	}
+	conn.in <- msg
+
+	select {
+	case e := <-added:
+		if is, want := e.Type, "_asdf._tcp"; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+}
+
+func TestLookupTypeAtInterfaces(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{PTR(sv), SRV(sv), TXT(sv)}
+	for _, a := range A(sv, testIface) {
+		msg.Answer = append(msg.Answer, a)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// Responses from other interfaces are ignored.
+	conn := newTestConn()
+	added := make(chan BrowseEntry, 1)
+	go lookupType(ctx, sv.ServiceName(), conn, func(e BrowseEntry) {
+		added <- e
+	}, nil, func(BrowseEntry) {}, testIface.Name+"-other")
+
+	conn.in <- msg
+	select {
+	case e := <-added:
+		t.Fatalf("unexpected entry %v", e)
+	case <-ctx.Done():
+	}
+}
+
+func TestLookupTypeQueryInterval(t *testing.T) {
+	ifaces := MulticastInterfaces()
+	if len(ifaces) == 0 {
+		t.Skip("no multicast interface")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	clock := &gateClock{gate: make(chan time.Time)}
+	ctx = WithClock(ctx, clock)
+
+	conn := newTestConn()
+	opts := BrowseOptions{Ifaces: []string{ifaces[0].Name}, QueryInterval: time.Second}
+	go lookupTypeWithOptions(ctx, "_asdf._tcp.local.", conn, func(BrowseEntry) {}, nil, func(BrowseEntry) {}, opts)
+
+	next := func() {
+		select {
+		case msg := <-conn.out:
+			if is, want := msg.Question[0].Qtype, dns.TypePTR; is != want {
+				t.Fatalf("is=%v want=%v", is, want)
+			}
+		case <-ctx.Done():
+			t.Fatal("timeout")
+		}
+	}
+
+	next()
+
+	// The query is repeated after the interval.
+	clock.gate <- time.Now()
+	next()
+}
+
+func TestServicesOfHost(t *testing.T) {
+	var msgs []*dns.Msg
+	for _, cfg := range []Config{
+		{Name: "Test", Type: "_asdf._tcp", Host: "Computer", Port: 1234},
+		{Name: "Other", Type: "_asdf._tcp", Host: "Other", Port: 1234},
+	} {
+		sv, err := NewService(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sv.ifaceIPs = map[string][]net.IP{
+			testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+		}
+
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{DNSSDServicesPTR(sv), PTR(sv), SRV(sv), TXT(sv)}
+		for _, a := range A(sv, testIface) {
+			msg.Answer = append(msg.Answer, a)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	conn := newTestConn()
+	go func() {
+		for _, msg := range msgs {
+			conn.in <- msg
+		}
+	}()
+
+	es, err := servicesOfHost(ctx, conn, "Computer.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(es), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := es[0].Name, "Test"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestBrowseFollowUpQueries(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn := newTestConn()
+	go lookupType(ctx, sv.ServiceName(), conn, func(BrowseEntry) {}, nil, func(BrowseEntry) {}, testIface.Name)
+
+	next := func(qtype uint16) *dns.Msg {
+		for {
+			select {
+			case msg := <-conn.out:
+				if len(msg.Question) > 0 && msg.Question[0].Qtype == qtype {
+					return msg
+				}
+			case <-ctx.Done():
+				t.Fatal("timeout")
+			}
+		}
+	}
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{PTR(sv)}
+	conn.in <- msg
+
+	q := next(dns.TypeSRV)
+	if is, want := len(q.Question), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+	if is, want := q.Question[0].Name, sv.EscapedServiceInstanceName(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	msg = new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{SRV(sv), TXT(sv)}
+	conn.in <- msg
+
+	q = next(dns.TypeA)
+	if is, want := q.Question[0].Name, sv.Hostname(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestBrowseFollowUpNegativeCache(t *testing.T) {
+	srv := newService("Test._asdf._tcp.local.")
+	srv.Host = "Computer"
+	srv.expiration = time.Now().Add(time.Minute)
+
+	cache := NewCache()
+	cache.services[srv.EscapedServiceInstanceName()] = srv
+
+	events := []CacheEvent{{Kind: BrowseAdd, Service: *srv}}
+	tb := &typeBrowser{service: srv.ServiceName()}
+	if m := tb.followUpQuery(cache, events); m == nil || len(m.Question) != 2 {
+		t.Fatalf("unexpected follow-up query %v", m)
+	}
+
+	// The host has only an IPv4 address.
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.NSEC{
+			Hdr:        dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 120},
+			NextDomain: "Computer.local.",
+			TypeBitMap: []uint16{dns.TypeA},
+		},
+	}
+	cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+
+	tb = &typeBrowser{service: srv.ServiceName()}
+	m := tb.followUpQuery(cache, events)
+	if is, want := len(m.Question), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := m.Question[0].Qtype, dns.TypeA; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// A received AAAA record invalidates the NSEC record.
+	msg.Answer = []dns.RR{
+		&dns.AAAA{
+			Hdr:  dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 120},
+			AAAA: net.ParseIP("fe80::1"),
+		},
+	}
+	cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+
+	if cache.hasNoRecord("Computer.local.", dns.TypeAAAA) {
+		t.Fatal("expected AAAA record to exist")
+	}
+}
+
+func TestBrowseFollowUpDelta(t *testing.T) {
+	cache := NewCache()
+	a := newService("A._asdf._tcp.local.")
+	a.expiration = time.Now().Add(time.Minute)
+	cache.services[a.EscapedServiceInstanceName()] = a
+	b := newService("B._asdf._tcp.local.")
+	b.expiration = time.Now().Add(time.Minute)
+	cache.services[b.EscapedServiceInstanceName()] = b
+
+	// Only the changed service instances are queried.
+	tb := &typeBrowser{service: a.ServiceName()}
+	m := tb.followUpQuery(cache, []CacheEvent{{Kind: BrowseAdd, Service: *b}})
+	if m == nil {
+		t.Fatal("expected follow-up query")
+	}
+
+	for _, q := range m.Question {
+		if is, want := q.Name, b.EscapedServiceInstanceName(); is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+
+	// Questions are not repeated while the records are missing.
+	if m := tb.followUpQuery(cache, []CacheEvent{{Kind: BrowseUpdate, Service: *b}}); m != nil {
+		t.Fatalf("unexpected follow-up query %v", m)
+	}
+
+	// The questions are asked again after the service instance was removed.
+	tb.followUpQuery(cache, []CacheEvent{{Kind: BrowseRemove, Service: *b}})
+	if m := tb.followUpQuery(cache, []CacheEvent{{Kind: BrowseAdd, Service: *b}}); m == nil || len(m.Question) != 2 {
+		t.Fatalf("unexpected follow-up query %v", m)
+	}
+}
+
+func TestDedupeByInstance(t *testing.T) {
+	srv := newService("Test._asdf._tcp.local.")
+	srv.Host = "Computer"
+	srv.Port = 1234
+	srv.expiration = time.Now().Add(time.Minute)
+	srv.ifaceIPs = map[string][]net.IP{
+		"en0": []net.IP{net.IP{192, 168, 0, 1}},
+		"en1": []net.IP{net.IP{10, 0, 0, 1}},
+	}
+
+	cache := NewCache()
+	cache.services[srv.EscapedServiceInstanceName()] = srv
+
+	var es []BrowseEntry
+	tb := &typeBrowser{
+		service: srv.ServiceName(),
+		add:     func(e BrowseEntry) { es = append(es, e) },
+		rmv:     func(BrowseEntry) {},
+		dedupe:  true,
+	}
+	tb.update(cache, map[string]*net.Interface{})
+
+	if is, want := len(es), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+	if is, want := len(es[0].IPs), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+	if is, want := fmt.Sprint(es[0].IfaceNames), "[en0 en1]"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+	if is, want := len(srv.ifaceIPs["en0"]), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	es = nil
+	tb = &typeBrowser{service: srv.ServiceName(), add: tb.add, rmv: tb.rmv}
+	tb.update(cache, map[string]*net.Interface{})
+	if is, want := len(es), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestTypeBrowserApply(t *testing.T) {
+	clock := &fixedClock{now: time.Now()}
+	cache := NewCache()
+	cache.clock = clock
+
+	var adds, upds, rmvs []BrowseEntry
+	tb := &typeBrowser{
+		service: "_asdf._tcp.local.",
+		add:     func(e BrowseEntry) { adds = append(adds, e) },
+		upd:     func(e BrowseEntry) { upds = append(upds, e) },
+		rmv:     func(e BrowseEntry) { rmvs = append(rmvs, e) },
+	}
+
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.PTR{Hdr: dns.RR_Header{Name: "_asdf._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120}, Ptr: "Test._asdf._tcp.local."},
+		&dns.SRV{Hdr: dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120}, Target: "Computer.local.", Port: 1234},
+		&dns.A{Hdr: dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120}, A: net.IP{192, 168, 0, 1}},
+	}
+	tb.apply(cache.updateDelta(&Request{msg: msg, iface: testIface}), map[string]*net.Interface{})
+
+	if is, want := len(adds), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// Records of other service types don't change the found entries.
+	msg.Answer = []dns.RR{
+		&dns.PTR{Hdr: dns.RR_Header{Name: "_other._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120}, Ptr: "Other._other._tcp.local."},
+	}
+	tb.apply(cache.updateDelta(&Request{msg: msg, iface: testIface}), map[string]*net.Interface{})
+
+	msg.Answer = []dns.RR{
+		&dns.TXT{Hdr: dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120}, Txt: []string{"key=value"}},
+	}
+	tb.apply(cache.updateDelta(&Request{msg: msg, iface: testIface}), map[string]*net.Interface{})
+
+	if is, want := len(adds), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+	if is, want := len(upds), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+	if is, want := upds[0].Text["key"], "value"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The service is removed when its records expire.
+	clock.now = clock.now.Add(3 * time.Minute)
+	tb.apply(cache.updateDelta(&Request{msg: new(dns.Msg), iface: testIface}), map[string]*net.Interface{})
+
+	if is, want := len(rmvs), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+	if is, want := len(tb.es), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+// TestTypeBrowserSameIPAtInterfaces tests that a service is reported at
+// every interface, even if it has the same address at both interfaces.
+func TestTypeBrowserSameIPAtInterfaces(t *testing.T) {
+	cache := NewCache()
+
+	var adds []BrowseEntry
+	tb := &typeBrowser{
+		service: "_asdf._tcp.local.",
+		add:     func(e BrowseEntry) { adds = append(adds, e) },
+		upd:     func(BrowseEntry) {},
+		rmv:     func(BrowseEntry) {},
+	}
+
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.PTR{Hdr: dns.RR_Header{Name: "_asdf._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120}, Ptr: "Test._asdf._tcp.local."},
+		&dns.SRV{Hdr: dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120}, Target: "Computer.local.", Port: 1234},
+		&dns.A{Hdr: dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120}, A: net.IP{192, 168, 0, 1}},
+	}
+
+	for _, name := range []string{"en0", "en1"} {
+		iface := &net.Interface{Name: name}
+		tb.apply(cache.updateDelta(&Request{msg: msg, iface: iface}), map[string]*net.Interface{})
+	}
+
+	var names []string
+	for _, e := range adds {
+		names = append(names, e.IfaceName)
+	}
+
+	if is, want := names, []string{"en0", "en1"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestBrowseEntryRecords(t *testing.T) {
+	cache := NewCache()
+	var es []BrowseEntry
+	tb := &typeBrowser{
+		service: "_asdf._tcp.local.",
+		add:     func(e BrowseEntry) { es = append(es, e) },
+		upd:     func(e BrowseEntry) { es = append(es, e) },
+		rmv:     func(BrowseEntry) {},
+	}
+
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.PTR{Hdr: dns.RR_Header{Name: "_asdf._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120}, Ptr: "Test._asdf._tcp.local."},
+		&dns.SRV{Hdr: dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET | 1<<15, Ttl: 120}, Target: "Computer.local.", Port: 1234},
+		&dns.TXT{Hdr: dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120}, Txt: []string{"vendor=acme"}},
+		&dns.A{Hdr: dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120}, A: net.IP{192, 168, 0, 1}},
+		&dns.NSEC{Hdr: dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 120}, NextDomain: "Computer.local.", TypeBitMap: []uint16{dns.TypeA}},
+	}
+	tb.apply(cache.updateDelta(&Request{msg: msg, iface: testIface}), map[string]*net.Interface{})
+
+	// A changed TXT record replaces the previous one.
+	msg.Answer = []dns.RR{
+		&dns.TXT{Hdr: dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120}, Txt: []string{"vendor=other"}},
+	}
+	tb.apply(cache.updateDelta(&Request{msg: msg, iface: testIface}), map[string]*net.Interface{})
+
+	if is, want := len(es), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	var types []uint16
+	var txt *dns.TXT
+	for _, rr := range es[1].Records {
+		types = append(types, rr.Header().Rrtype)
+		if rr, ok := rr.(*dns.TXT); ok {
+			txt = rr
+		}
+		if is, want := rr.Header().Class, uint16(dns.ClassINET); is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+
+	if is, want := len(types), 5; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := txt.Txt[0], "vendor=other"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func BenchmarkDedupeByInstance(b *testing.B) {
+	const n = 1000
+
+	cache := NewCache()
+	for i := 0; i < n; i++ {
+		srv := newService(fmt.Sprintf("Test %d._asdf._tcp.local.", i))
+		srv.Host = fmt.Sprintf("Computer-%d", i)
+		srv.Port = 1234
+		srv.expiration = time.Now().Add(time.Hour)
+		srv.ifaceIPs = map[string][]net.IP{
+			"en0": []net.IP{net.IP{192, 168, byte(i >> 8), byte(i)}},
+			"en1": []net.IP{net.IP{10, 0, byte(i >> 8), byte(i)}},
+		}
+		cache.services[srv.EscapedServiceInstanceName()] = srv
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tb := &typeBrowser{
+			service: "_asdf._tcp.local.",
+			add:     func(BrowseEntry) {},
+			rmv:     func(BrowseEntry) {},
+			dedupe:  true,
+		}
+		tb.update(cache, map[string]*net.Interface{})
+
+		if is, want := len(tb.es), n; is != want {
+			b.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+}
+
+func BenchmarkTypeBrowserApply(b *testing.B) {
+	const n = 1000
+
+	cache := NewCache()
+	tb := &typeBrowser{
+		service: "_asdf._tcp.local.",
+		add:     func(BrowseEntry) {},
+		upd:     func(BrowseEntry) {},
+		rmv:     func(BrowseEntry) {},
+	}
+
+	msgs := make([]*dns.Msg, n)
+	for i := 0; i < n; i++ {
+		instance := fmt.Sprintf("Test %d._asdf._tcp.local.", i)
+		host := fmt.Sprintf("Computer-%d.local.", i)
+		msg := new(dns.Msg)
+		msg.Answer = []dns.RR{
+			&dns.PTR{Hdr: dns.RR_Header{Name: "_asdf._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 3600}, Ptr: instance},
+			&dns.SRV{Hdr: dns.RR_Header{Name: instance, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 3600}, Target: host, Port: 1234},
+			&dns.A{Hdr: dns.RR_Header{Name: host, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: net.IP{192, 168, byte(i >> 8), byte(i)}},
+		}
+		tb.apply(cache.updateDelta(&Request{msg: msg, iface: testIface}), map[string]*net.Interface{})
+
+		msgs[i] = new(dns.Msg)
+		msgs[i].Answer = []dns.RR{
+			&dns.TXT{Hdr: dns.RR_Header{Name: instance, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 3600}},
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		txt := msgs[i%n].Answer[0].(*dns.TXT)
+		txt.Txt = []string{fmt.Sprintf("i=%d", i)}
+		tb.apply(cache.updateDelta(&Request{msg: msgs[i%n], iface: testIface}), map[string]*net.Interface{})
+	}
+}
+
+func TestBrowseEntryURL(t *testing.T) {
+	tests := []struct {
+		entry  BrowseEntry
+		scheme string
+		want   string
+	}{
+		{BrowseEntry{Host: "Computer", Domain: "local", Port: 8080, Type: "_http._tcp", Text: map[string]string{"path": "/admin"}}, "", "http://Computer.local:8080/admin"},
+		{BrowseEntry{Host: "Computer", Domain: "local", Port: 443, Type: "_https._tcp", Text: map[string]string{"Path": "index.html?a=b"}}, "", "https://Computer.local/index.html?a=b"},
+		{BrowseEntry{Host: "Computer", Domain: "local", Port: 80, Type: "_http._tcp"}, "", "http://Computer.local/"},
+		{BrowseEntry{Port: 631, Type: "_ipp._tcp", Addrs: []netip.Addr{netip.MustParseAddr("192.168.0.10")}}, "", "ipp://192.168.0.10:631/"},
+		{BrowseEntry{Port: 8080, Type: "_http._tcp", IPs: []net.IP{net.ParseIP("fe80::1")}, IfaceName: "en0"}, "", "http://[fe80::1%25en0]:8080/"},
+		{BrowseEntry{Port: 80, Type: "_http._tcp", Addrs: []netip.Addr{netip.MustParseAddr("2001:db8::1")}}, "", "http://[2001:db8::1]/"},
+		{BrowseEntry{Host: "Computer", Domain: "local", Port: 8443, Type: "_http._tcp"}, "https", "https://Computer.local:8443/"},
+	}
+
+	for _, test := range tests {
+		if is, want := test.entry.URL(test.scheme).String(), test.want; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+
+	if u := (BrowseEntry{Port: 80, Type: "_http._tcp"}).URL(""); u != nil {
+		t.Fatalf("unexpected URL %v", u)
+	}
+}
+
+func TestBrowseEntryURLFromCache(t *testing.T) {
+	cache := NewCache()
+
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.PTR{Hdr: dns.RR_Header{Name: "_http._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120}, Ptr: "Test._http._tcp.local."},
+		&dns.SRV{Hdr: dns.RR_Header{Name: "Test._http._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120}, Target: "Computer.local.", Port: 8080},
+		&dns.TXT{Hdr: dns.RR_Header{Name: "Test._http._tcp.local.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120}, Txt: []string{"path=/admin"}},
+		&dns.A{Hdr: dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120}, A: net.IP{192, 168, 0, 1}},
+	}
+	cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+
+	srvs := cache.Services()
+	if is, want := len(srvs), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	e := newBrowseEntry(srvs[0], testIface.Name, srvs[0].IPs, testIface)
+	if is, want := e.URL("").String(), "http://Computer.local:8080/admin"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
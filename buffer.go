@@ -0,0 +1,39 @@
+package dnssd
+
+import (
+	"sync"
+)
+
+// bufferPool stores buffers for sent and received packets, which are reused
+// to reduce allocations on busy networks.
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, MaxMessageSize)
+		return &b
+	},
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *[]byte {
+	b := bufferPool.Get().(*[]byte)
+	*b = (*b)[:0]
+
+	return b
+}
+
+// putBuffer returns b to the pool. Large buffers are not reused.
+func putBuffer(b *[]byte) {
+	if cap(*b) > 65536 {
+		return
+	}
+
+	bufferPool.Put(b)
+}
+
+// copyBuffer returns a buffer from the pool with a copy of b.
+func copyBuffer(b []byte) *[]byte {
+	buf := getBuffer()
+	*buf = append(*buf, b...)
+
+	return buf
+}
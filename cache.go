@@ -3,25 +3,57 @@ package dnssd
 import (
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
 // Cache stores services in memory.
+// The methods of a cache can be called from multiple goroutines.
 type Cache struct {
+	mutex    sync.RWMutex
 	services map[string]*Service
+	clock    Clock
+
+	// hosts indexes the services by lowercased hostname,
+	// so that address records are only matched against the services of the host.
+	hosts map[string]map[*Service]struct{}
+
+	// subscribers receive the events of the cache (see Subscribe).
+	subscribers map[*cacheSubscriber]struct{}
+
+	// negative stores the record types, which exist for a lowercased name
+	// according to NSEC records. Other types don't exist. (RFC6762 6.1)
+	negative map[string]*negativeEntry
+
+	// next is not after the earliest expiration time of the cached services
+	// and negative entries, so that they are only searched when one of them
+	// may have expired. It is zero if nothing is cached.
+	next time.Time
+}
+
+// negativeEntry is the list of existing record types of a name.
+type negativeEntry struct {
+	types      []uint16
+	expiration time.Time
 }
 
 // NewCache returns a new in-memory cache.
 func NewCache() *Cache {
 	return &Cache{
 		services: make(map[string]*Service),
+		clock:    realClock{},
+		hosts:    make(map[string]map[*Service]struct{}),
+		negative: make(map[string]*negativeEntry),
 	}
 }
 
 // Services returns a list of stored services.
 func (c *Cache) Services() []*Service {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
 	tmp := []*Service{}
 	for _, s := range c.services {
 		tmp = append(tmp, s)
@@ -29,19 +61,120 @@ func (c *Cache) Services() []*Service {
 	return tmp
 }
 
+// Lookup returns the cached service with the service instance name instance,
+// e.g. "Printer._ipp._tcp.local.". The name is compared case-insensitively.
+// Expired services are not returned.
+func (c *Cache) Lookup(instance string) (Service, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	srv, ok := c.services[canonicalName(dns.Fqdn(instance))]
+	if !ok {
+		for _, s := range c.services {
+			if strings.EqualFold(s.EscapedServiceInstanceName(), canonicalName(dns.Fqdn(instance))) {
+				srv, ok = s, true
+				break
+			}
+		}
+	}
+
+	if !ok || c.clock.Now().After(srv.expiration) {
+		return Service{}, false
+	}
+
+	return srv.snapshot(), true
+}
+
+// ByType returns the cached services of the service type service,
+// e.g. "_ipp._tcp.local.", sorted by service instance name.
+// Expired services are not returned.
+func (c *Cache) ByType(service string) []Service {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var srvs []Service
+	for _, srv := range c.services {
+		if strings.EqualFold(srv.ServiceName(), dns.Fqdn(service)) && !c.clock.Now().After(srv.expiration) {
+			srvs = append(srvs, srv.snapshot())
+		}
+	}
+	sortServices(srvs)
+
+	return srvs
+}
+
+// Snapshot returns copies of all cached services, sorted by service instance name.
+// Expired services are not returned.
+func (c *Cache) Snapshot() []Service {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var srvs []Service
+	for _, srv := range c.services {
+		if !c.clock.Now().After(srv.expiration) {
+			srvs = append(srvs, srv.snapshot())
+		}
+	}
+	sortServices(srvs)
+
+	return srvs
+}
+
+// sortServices sorts srvs by service instance name.
+func sortServices(srvs []Service) {
+	sort.Slice(srvs, func(i, j int) bool {
+		return srvs[i].EscapedServiceInstanceName() < srvs[j].EscapedServiceInstanceName()
+	})
+}
+
 // UpdateFrom updates the cache from resource records in msg.
 // TODO consider the cache-flush bit to make records as to be deleted in one second
 func (c *Cache) UpdateFrom(req *Request) (adds []*Service, rmvs []*Service) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	adds, before, rmvs := c.update(req, len(c.subscribers) > 0)
+	if len(c.subscribers) > 0 {
+		c.publish(c.events(adds, before, rmvs))
+	}
+
+	return adds, rmvs
+}
+
+// updateDelta updates the cache like UpdateFrom and returns the events for
+// the services, which were added, changed or removed by the update.
+func (c *Cache) updateDelta(req *Request) []CacheEvent {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	events := c.events(c.update(req, true))
+	c.publish(events)
+
+	return events
+}
+
+// update updates the cache from the records in req while the cache is locked.
+// If track is true, before contains the services before they were changed.
+func (c *Cache) update(req *Request, track bool) (adds []*Service, before map[*Service]Service, rmvs []*Service) {
 	answers := filterRecords(req, nil)
 	sort.Sort(byType(answers))
 
+	before = map[*Service]Service{}
+	touch := func(srv *Service) {
+		if _, ok := before[srv]; !ok && track {
+			before[srv] = srv.snapshot()
+		}
+	}
+
 	for _, answer := range answers {
+		c.updateNegative(answer)
+
 		switch rr := answer.(type) {
 		case *dns.PTR:
 			ttl := time.Duration(rr.Hdr.Ttl) * time.Second
 
 			var entry *Service
-			if e, ok := c.services[rr.Ptr]; !ok {
+			if e, ok := c.services[canonicalName(rr.Ptr)]; !ok {
 				if ttl == 0 {
 					// Ignore new records with no ttl
 					break
@@ -54,12 +187,13 @@ func (c *Cache) UpdateFrom(req *Request) (adds []*Service, rmvs []*Service) {
 			}
 
 			entry.TTL = ttl
-			entry.expiration = time.Now().Add(ttl)
+			c.setExpiration(entry, c.clock.Now().Add(ttl))
+			entry.setRecord(rr)
 
 		case *dns.SRV:
 			ttl := time.Duration(rr.Hdr.Ttl) * time.Second
 			var entry *Service
-			if e, ok := c.services[rr.Hdr.Name]; !ok {
+			if e, ok := c.services[canonicalName(rr.Hdr.Name)]; !ok {
 				if ttl == 0 {
 					// Ignore new records with no ttl
 					break
@@ -69,50 +203,46 @@ func (c *Cache) UpdateFrom(req *Request) (adds []*Service, rmvs []*Service) {
 				c.services[entry.EscapedServiceInstanceName()] = entry
 			} else {
 				entry = e
+				touch(entry)
 			}
 
-			entry.SetHostname(rr.Target)
+			c.setHostname(entry, rr.Target)
 			entry.TTL = ttl
-			entry.expiration = time.Now().Add(ttl)
+			c.setExpiration(entry, c.clock.Now().Add(ttl))
 			entry.Port = int(rr.Port)
+			entry.setRecord(rr)
 
 		case *dns.A:
-			for _, entry := range c.services {
-				if entry.Hostname() == rr.Hdr.Name {
-					entry.addIP(rr.A, req.iface)
-				}
+			for entry := range c.hosts[strings.ToLower(rr.Hdr.Name)] {
+				touch(entry)
+				entry.addIP(rr.A, req.iface)
+				entry.setRecord(rr)
 			}
 
 		case *dns.AAAA:
-			for _, entry := range c.services {
-				if entry.Hostname() == rr.Hdr.Name {
-					entry.addIP(rr.AAAA, req.iface)
-				}
+			for entry := range c.hosts[strings.ToLower(rr.Hdr.Name)] {
+				touch(entry)
+				entry.addIP(rr.AAAA, req.iface)
+				entry.setRecord(rr)
 			}
 
 		case *dns.TXT:
-			if entry, ok := c.services[rr.Hdr.Name]; ok {
-				text := make(map[string]string)
-				for _, txt := range rr.Txt {
-					elems := strings.SplitN(txt, "=", 2)
-					if len(elems) == 2 {
-						key := elems[0]
-						value := elems[1]
-
-						// Don't override existing keys
-						// TODO make txt records case insensitive
-						if _, ok := text[key]; !ok {
-							text[key] = value
-						}
-
-						text[key] = value
-					}
-				}
-
-				entry.Text = text
+			if entry, ok := c.services[canonicalName(rr.Hdr.Name)]; ok {
+				touch(entry)
+				entry.Text, entry.TextFlags = parseText(rr.Txt)
 				entry.TTL = time.Duration(rr.Hdr.Ttl) * time.Second
-				entry.expiration = time.Now().Add(entry.TTL)
+				c.setExpiration(entry, c.clock.Now().Add(entry.TTL))
+				entry.setRecord(rr)
+			}
+
+		case *dns.NSEC:
+			if entry, ok := c.services[canonicalName(rr.Hdr.Name)]; ok {
+				entry.setRecord(rr)
 			}
+			for entry := range c.hosts[strings.ToLower(rr.Hdr.Name)] {
+				entry.setRecord(rr)
+			}
+
 		default:
 			// ignore
 		}
@@ -124,19 +254,170 @@ func (c *Cache) UpdateFrom(req *Request) (adds []*Service, rmvs []*Service) {
 	return
 }
 
+// events returns the events for the added, changed and removed services.
+func (c *Cache) events(adds []*Service, before map[*Service]Service, rmvs []*Service) []CacheEvent {
+	var events []CacheEvent
+	removed := map[*Service]bool{}
+	for _, srv := range rmvs {
+		removed[srv] = true
+	}
+
+	added := map[*Service]bool{}
+	for _, srv := range adds {
+		added[srv] = true
+		if !removed[srv] {
+			events = append(events, CacheEvent{Kind: BrowseAdd, Service: srv.snapshot()})
+		}
+	}
+
+	for srv, old := range before {
+		if !added[srv] && !removed[srv] && isServiceChanged(old, *srv) {
+			events = append(events, CacheEvent{Kind: BrowseUpdate, Service: srv.snapshot()})
+		}
+	}
+
+	for _, srv := range rmvs {
+		events = append(events, CacheEvent{Kind: BrowseRemove, Service: srv.snapshot()})
+	}
+
+	return events
+}
+
+// setExpiration sets the expiration time of the cached service srv.
+func (c *Cache) setExpiration(srv *Service, expiration time.Time) {
+	srv.expiration = expiration
+	c.expiresAt(expiration)
+}
+
+// expiresAt updates the next expiration time with an entry, which expires at expiration.
+func (c *Cache) expiresAt(expiration time.Time) {
+	if c.next.IsZero() || expiration.Before(c.next) {
+		c.next = expiration
+	}
+}
+
 func (c *Cache) removeExpired() []*Service {
+	now := c.clock.Now()
+	if c.next.IsZero() || !now.After(c.next) {
+		// No service has expired yet.
+		return nil
+	}
+
 	var outdated []*Service
-	var services = c.services
-	for key, srv := range services {
-		if time.Now().After(srv.expiration) {
+	var next time.Time
+	for key, srv := range c.services {
+		if now.After(srv.expiration) {
 			outdated = append(outdated, srv)
 			delete(c.services, key)
+			c.unindex(srv)
+		} else if next.IsZero() || srv.expiration.Before(next) {
+			next = srv.expiration
 		}
 	}
 
+	for name, e := range c.negative {
+		if now.After(e.expiration) {
+			delete(c.negative, name)
+		} else if next.IsZero() || e.expiration.Before(next) {
+			next = e.expiration
+		}
+	}
+	c.next = next
+
 	return outdated
 }
 
+// updateNegative stores the record types of NSEC records, and removes
+// stored types of a name, if a record of another type is received.
+func (c *Cache) updateNegative(rr dns.RR) {
+	name := strings.ToLower(rr.Header().Name)
+	nsec, ok := rr.(*dns.NSEC)
+	if !ok {
+		if e, ok := c.negative[name]; ok && !containsType(e.types, rr.Header().Rrtype) {
+			delete(c.negative, name)
+		}
+		return
+	}
+
+	// Only the restricted form of NSEC records is used by mDNS. (RFC6762 6.1)
+	if !strings.EqualFold(nsec.NextDomain, nsec.Hdr.Name) {
+		return
+	}
+
+	if nsec.Hdr.Ttl == 0 {
+		delete(c.negative, name)
+		return
+	}
+
+	e := &negativeEntry{
+		types:      append([]uint16(nil), nsec.TypeBitMap...),
+		expiration: c.clock.Now().Add(time.Duration(nsec.Hdr.Ttl) * time.Second),
+	}
+	c.negative[name] = e
+	c.expiresAt(e.expiration)
+}
+
+// hasNoRecord returns true, if a NSEC record indicated,
+// that there is no record of type qtype for name.
+func (c *Cache) hasNoRecord(name string, qtype uint16) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	e, ok := c.negative[strings.ToLower(name)]
+	if !ok || c.clock.Now().After(e.expiration) {
+		return false
+	}
+
+	return !containsType(e.types, qtype)
+}
+
+func containsType(types []uint16, t uint16) bool {
+	for _, typ := range types {
+		if typ == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setHostname sets the hostname of srv and updates the hostname index.
+func (c *Cache) setHostname(srv *Service, hostname string) {
+	c.unindex(srv)
+	srv.SetHostname(hostname)
+	c.index(srv)
+}
+
+// index adds srv to the hostname index.
+func (c *Cache) index(srv *Service) {
+	if srv.Host == "" {
+		return
+	}
+
+	name := strings.ToLower(srv.Hostname())
+	srvs, ok := c.hosts[name]
+	if !ok {
+		srvs = map[*Service]struct{}{}
+		c.hosts[name] = srvs
+	}
+	srvs[srv] = struct{}{}
+}
+
+// unindex removes srv from the hostname index.
+func (c *Cache) unindex(srv *Service) {
+	if srv.Host == "" {
+		return
+	}
+
+	name := strings.ToLower(srv.Hostname())
+	if srvs, ok := c.hosts[name]; ok {
+		delete(srvs, srv)
+		if len(srvs) == 0 {
+			delete(c.hosts, name)
+		}
+	}
+}
+
 type byType []dns.RR
 
 func (a byType) Len() int      { return len(a) }
@@ -159,7 +440,7 @@ func (a byType) Less(i, j int) bool {
 // - A and AAAA records for the same hostname as in defined by the service
 // - SRV records related to the same service instance name
 func filterRecords(req *Request, service *Service) []dns.RR {
-	if req.iface != nil && service != nil && len(service.Ifaces) > 0 {
+	if req.iface != nil && service != nil && (len(service.Ifaces) > 0 || service.ifaceFilter != nil) {
 		if !service.IsVisibleAtInterface(req.iface.Name) {
 			// Ignore records if the request coming from an ignored interface.
 			return []dns.RR{}
@@ -169,7 +450,7 @@ func filterRecords(req *Request, service *Service) []dns.RR {
 	var all []dns.RR
 	all = append(all, req.msg.Answer...)
 	all = append(all, req.msg.Ns...)
-	all = append(all, req.msg.Extra...)
+	all = append(all, withoutOPT(req.msg.Extra)...)
 
 	if service == nil {
 		return all
@@ -183,7 +464,7 @@ func filterRecords(req *Request, service *Service) []dns.RR {
 				// Ignore records coming from ourself
 				continue
 			}
-			if rr.Hdr.Name != service.EscapedServiceInstanceName() {
+			if !strings.EqualFold(canonicalName(rr.Hdr.Name), service.EscapedServiceInstanceName()) {
 				// Ignore records from other service instances
 				continue
 			}
@@ -0,0 +1,140 @@
+package dnssd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// CacheEvent is sent when a service was added to, changed in or removed from a cache.
+type CacheEvent struct {
+	Kind    BrowseEventKind
+	Service Service
+}
+
+// cacheSubscriber queues the events of a cache, so that updating the cache never blocks.
+type cacheSubscriber struct {
+	ch chan CacheEvent
+
+	mutex  sync.Mutex
+	queue  []CacheEvent
+	notify chan struct{}
+}
+
+// Subscribe returns a channel, which receives an event for every service, which is
+// added to, changed in or removed from the cache, until ctx is done. Then the channel
+// is closed. Multiple subscribers can receive the events of one cache,
+// e.g. the cache of a Resolver or Browser.
+func (c *Cache) Subscribe(ctx context.Context) <-chan CacheEvent {
+	s := &cacheSubscriber{
+		ch:     make(chan CacheEvent),
+		notify: make(chan struct{}, 1),
+	}
+
+	c.mutex.Lock()
+	if c.subscribers == nil {
+		c.subscribers = map[*cacheSubscriber]struct{}{}
+	}
+	c.subscribers[s] = struct{}{}
+	c.mutex.Unlock()
+
+	go func() {
+		s.run(ctx)
+		c.mutex.Lock()
+		delete(c.subscribers, s)
+		c.mutex.Unlock()
+		close(s.ch)
+	}()
+
+	return s.ch
+}
+
+func (s *cacheSubscriber) push(events []CacheEvent) {
+	s.mutex.Lock()
+	s.queue = append(s.queue, events...)
+	s.mutex.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *cacheSubscriber) run(ctx context.Context) {
+	for {
+		s.mutex.Lock()
+		if len(s.queue) == 0 {
+			s.mutex.Unlock()
+			select {
+			case <-s.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		e := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mutex.Unlock()
+
+		select {
+		case s.ch <- e:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// publish sends events to the subscribers of the cache.
+// The cache must be locked.
+func (c *Cache) publish(events []CacheEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	for s := range c.subscribers {
+		s.push(events)
+	}
+}
+
+// isServiceChanged returns true, if the properties of this and that
+// which are received from other hosts, or the interfaces at which
+// their addresses are received, are different.
+func isServiceChanged(this, that Service) bool {
+	if this.Host != that.Host || this.Port != that.Port {
+		return true
+	}
+
+	if !reflect.DeepEqual(this.Text, that.Text) || !reflect.DeepEqual(this.TextFlags, that.TextFlags) {
+		return true
+	}
+
+	if len(this.IPs) != len(that.IPs) {
+		return true
+	}
+
+	for _, ip := range this.IPs {
+		if !containsIP(that.IPs, ip) {
+			return true
+		}
+	}
+
+	// The same addresses may be received at other interfaces.
+	if len(this.ifaceIPs) != len(that.ifaceIPs) {
+		return true
+	}
+
+	for name, ips := range this.ifaceIPs {
+		others, ok := that.ifaceIPs[name]
+		if !ok || len(ips) != len(others) {
+			return true
+		}
+
+		for _, ip := range ips {
+			if !containsIP(others, ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
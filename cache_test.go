@@ -0,0 +1,296 @@
+package dnssd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCacheHostnameIndex(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	cache := NewCache()
+	cache.clock = clock
+
+	srv := func(host string) *dns.SRV {
+		return &dns.SRV{
+			Hdr:    dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120},
+			Target: host,
+			Port:   1234,
+		}
+	}
+	a := func(host string, ip net.IP) *dns.A {
+		return &dns.A{
+			Hdr: dns.RR_Header{Name: host, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120},
+			A:   ip,
+		}
+	}
+	update := func(rrs ...dns.RR) {
+		msg := new(dns.Msg)
+		msg.Answer = rrs
+		cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+	}
+
+	update(srv("Computer.local."), a("computer.local.", net.IP{192, 168, 0, 1}))
+	if is, want := len(cache.hosts["computer.local."]), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The service moved to another host.
+	update(srv("Other.local."))
+	if _, ok := cache.hosts["computer.local."]; ok {
+		t.Fatal("expected old hostname to be removed from the index")
+	}
+
+	update(a("Computer.local.", net.IP{192, 168, 0, 2}), a("Other.local.", net.IP{192, 168, 0, 3}))
+	ips := cache.services["Test._asdf._tcp.local."].IPs
+	if is, want := len(ips), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := ips[1].String(), "192.168.0.3"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// Expired services are removed from the index.
+	clock.now = clock.now.Add(time.Hour)
+	update()
+	if is, want := len(cache.hosts), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	cache := NewCache()
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: "B._asdf._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120},
+			Target: "Computer.local.",
+			Port:   1234,
+		},
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: "A._asdf._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120},
+			Target: "Computer.local.",
+			Port:   1234,
+		},
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: "C._other._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120},
+			Target: "Computer.local.",
+			Port:   1234,
+		},
+		&dns.A{
+			Hdr: dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120},
+			A:   net.IP{192, 168, 0, 1},
+		},
+	}
+	cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+
+	srv, ok := cache.Lookup("a._asdf._tcp.local")
+	if !ok {
+		t.Fatal("expected service")
+	}
+
+	if is, want := srv.Name, "A"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The returned service is a copy.
+	srv.IPsAtInterface(testIface)[0] = net.IP{10, 0, 0, 1}
+	if is, want := cache.services["A._asdf._tcp.local."].IPsAtInterface(testIface)[0].String(), "192.168.0.1"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	srvs := cache.ByType("_asdf._tcp.local.")
+	if is, want := len(srvs), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srvs[0].Name, "A"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(cache.Snapshot()), 3; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestCacheSubscribe(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	cache := NewCache()
+	cache.clock = clock
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	subs := []<-chan CacheEvent{cache.Subscribe(ctx), cache.Subscribe(ctx)}
+
+	srv := &dns.SRV{
+		Hdr:    dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120},
+		Target: "Computer.local.",
+		Port:   1234,
+	}
+	txt := &dns.TXT{
+		Hdr: dns.RR_Header{Name: "Test._asdf._tcp.local.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+		Txt: []string{"key=value"},
+	}
+	update := func(rrs ...dns.RR) {
+		msg := new(dns.Msg)
+		msg.Answer = rrs
+		cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+	}
+
+	update(srv, txt)
+	// Unchanged records don't cause an update event.
+	update(srv)
+	txt.Txt = []string{"key=other"}
+	update(txt)
+	clock.now = clock.now.Add(time.Hour)
+	update()
+
+	for _, ch := range subs {
+		for _, want := range []BrowseEventKind{BrowseAdd, BrowseUpdate, BrowseRemove} {
+			select {
+			case e := <-ch:
+				if is := e.Kind; is != want {
+					t.Fatalf("is=%v want=%v", is, want)
+				}
+				if is, want := e.Service.Name, "Test"; is != want {
+					t.Fatalf("is=%v want=%v", is, want)
+				}
+				if want == BrowseUpdate {
+					if is, want := e.Service.Text["key"], "other"; is != want {
+						t.Fatalf("is=%v want=%v", is, want)
+					}
+				}
+			case <-ctx.Done():
+				t.Fatal("timeout")
+			}
+		}
+	}
+
+	cancel()
+	for _, ch := range subs {
+		for range ch {
+		}
+	}
+}
+
+func BenchmarkCacheUpdate(b *testing.B) {
+	const n = 1000
+
+	msgs := make([]*dns.Msg, n)
+	for i := range msgs {
+		sv, err := NewService(Config{
+			Name: fmt.Sprintf("Test %d", i),
+			Type: "_asdf._tcp",
+			Host: fmt.Sprintf("Computer-%d", i),
+			Port: 1234,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		sv.ifaceIPs = map[string][]net.IP{
+			testIface.Name: []net.IP{net.IP{192, 168, byte(i >> 8), byte(i)}},
+		}
+
+		msg := new(dns.Msg)
+		msg.Answer = []dns.RR{PTR(sv), SRV(sv), TXT(sv)}
+		for _, a := range A(sv, testIface) {
+			msg.Answer = append(msg.Answer, a)
+		}
+		msgs[i] = msg
+	}
+
+	cache := NewCache()
+	for _, msg := range msgs {
+		cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.UpdateFrom(&Request{msg: msgs[i%n], iface: testIface})
+	}
+}
+
+func TestCacheNextExpiration(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: start}
+	cache := NewCache()
+	cache.clock = clock
+
+	ptr := func(instance string, ttl uint32) *dns.PTR {
+		return &dns.PTR{
+			Hdr: dns.RR_Header{Name: "_asdf._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl},
+			Ptr: instance,
+		}
+	}
+	update := func(rrs ...dns.RR) {
+		msg := new(dns.Msg)
+		msg.Answer = rrs
+		cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+	}
+
+	if _, ok := cache.nextExpiration(); ok {
+		t.Fatal("unexpected expiration of empty cache")
+	}
+
+	update(ptr("A._asdf._tcp.local.", 10), ptr("B._asdf._tcp.local.", 20))
+	if at, _ := cache.nextExpiration(); !at.Equal(start.Add(10 * time.Second)) {
+		t.Fatalf("is=%v want=%v", at, start.Add(10*time.Second))
+	}
+
+	// The next expiration is updated when the services are searched.
+	update(ptr("A._asdf._tcp.local.", 30))
+	clock.now = start.Add(15 * time.Second)
+	update()
+	if at, _ := cache.nextExpiration(); !at.Equal(start.Add(20 * time.Second)) {
+		t.Fatalf("is=%v want=%v", at, start.Add(20*time.Second))
+	}
+
+	clock.now = start.Add(time.Minute)
+	update()
+	if is, want := len(cache.services), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if _, ok := cache.nextExpiration(); ok {
+		t.Fatal("unexpected expiration of empty cache")
+	}
+}
+
+func TestCacheNegativeExpire(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: start}
+	cache := NewCache()
+	cache.clock = clock
+
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.NSEC{
+			Hdr:        dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 120},
+			NextDomain: "Computer.local.",
+			TypeBitMap: []uint16{dns.TypeA},
+		},
+	}
+	cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+
+	if !cache.hasNoRecord("Computer.local.", dns.TypeAAAA) {
+		t.Fatal("expected AAAA record to not exist")
+	}
+
+	if at, _ := cache.nextExpiration(); !at.Equal(start.Add(120 * time.Second)) {
+		t.Fatalf("is=%v want=%v", at, start.Add(120*time.Second))
+	}
+
+	// Expired entries are removed.
+	clock.now = start.Add(time.Hour)
+	cache.expireDelta()
+	if is, want := len(cache.negative), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
@@ -0,0 +1,134 @@
+package dnssd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// cacheFileVersion is the version of the format written by Cache.Save.
+const cacheFileVersion = 1
+
+// cacheFile is the format of a saved cache.
+type cacheFile struct {
+	Version  int             `json:"version"`
+	Services []cachedService `json:"services"`
+}
+
+// cachedService is a saved service.
+type cachedService struct {
+	Name       string              `json:"name"`
+	Type       string              `json:"type"`
+	Domain     string              `json:"domain"`
+	Host       string              `json:"host,omitempty"`
+	Port       int                 `json:"port,omitempty"`
+	Text       map[string]string   `json:"text,omitempty"`
+	TextFlags  []string            `json:"textFlags,omitempty"`
+	IPs        []net.IP            `json:"ips,omitempty"`
+	IfaceIPs   map[string][]net.IP `json:"ifaceIPs,omitempty"`
+	Expiration time.Time           `json:"expiration"`
+}
+
+// Save writes the services of the cache, which are not expired, as JSON to w.
+// The expiration time of every service is saved, so that Load only restores
+// services whose records are still valid.
+func (c *Cache) Save(w io.Writer) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := c.clock.Now()
+	f := cacheFile{Version: cacheFileVersion, Services: []cachedService{}}
+	for _, srv := range c.services {
+		if !srv.expiration.After(now) {
+			continue
+		}
+
+		f.Services = append(f.Services, cachedService{
+			Name:       srv.Name,
+			Type:       srv.Type,
+			Domain:     srv.Domain,
+			Host:       srv.Host,
+			Port:       srv.Port,
+			Text:       srv.Text,
+			TextFlags:  srv.TextFlags,
+			IPs:        srv.IPs,
+			IfaceIPs:   srv.ifaceIPs,
+			Expiration: srv.expiration,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(f)
+}
+
+// Load reads services, which were written by Save, from r into the cache.
+// Expired services are skipped and the TTL of the restored services is
+// the remaining time until they expire. Services which are already in the
+// cache are only replaced, if the loaded service expires later.
+func (c *Cache) Load(r io.Reader) error {
+	var f cacheFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return err
+	}
+
+	if f.Version != cacheFileVersion {
+		return fmt.Errorf("unsupported cache version %d", f.Version)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var events []CacheEvent
+	now := c.clock.Now()
+	for _, cs := range f.Services {
+		if !cs.Expiration.After(now) {
+			continue
+		}
+
+		srv := &Service{
+			Name:       cs.Name,
+			Type:       cs.Type,
+			Domain:     cs.Domain,
+			Host:       cs.Host,
+			Port:       cs.Port,
+			Text:       cs.Text,
+			TextFlags:  cs.TextFlags,
+			IPs:        cs.IPs,
+			Ifaces:     []string{},
+			ifaceIPs:   cs.IfaceIPs,
+			TTL:        cs.Expiration.Sub(now).Truncate(time.Second),
+			expiration: cs.Expiration,
+		}
+
+		if srv.Text == nil {
+			srv.Text = map[string]string{}
+		}
+
+		if srv.IPs == nil {
+			srv.IPs = []net.IP{}
+		}
+
+		if srv.ifaceIPs == nil {
+			srv.ifaceIPs = map[string][]net.IP{}
+		}
+
+		kind := BrowseAdd
+		key := srv.EscapedServiceInstanceName()
+		if e, ok := c.services[key]; ok {
+			if !e.expiration.Before(srv.expiration) {
+				continue
+			}
+			c.unindex(e)
+			kind = BrowseUpdate
+		}
+		c.services[key] = srv
+		c.index(srv)
+		c.setExpiration(srv, srv.expiration)
+		events = append(events, CacheEvent{Kind: kind, Service: srv.snapshot()})
+	}
+
+	c.publish(events)
+
+	return nil
+}
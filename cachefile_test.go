@@ -0,0 +1,137 @@
+package dnssd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fixedClock is a clock, which always returns the same time.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time                         { return c.now }
+func (c *fixedClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func TestCacheSaveLoad(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	sv, err := NewService(Config{
+		Name: "Test Service",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Text: map[string]string{"key": "value"},
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{PTR(sv), SRV(sv), TXT(sv)}
+	for _, a := range A(sv, testIface) {
+		msg.Answer = append(msg.Answer, a)
+	}
+
+	cache := NewCache()
+	cache.clock = clock
+	cache.UpdateFrom(&Request{msg: msg, iface: testIface})
+
+	var b bytes.Buffer
+	if err := cache.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The service is restored 30 seconds later with the remaining TTL.
+	clock.now = clock.now.Add(30 * time.Second)
+	loaded := NewCache()
+	loaded.clock = clock
+	if err := loaded.Load(bytes.NewReader(b.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	srvs := loaded.Services()
+	if is, want := len(srvs), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	srv := srvs[0]
+	if is, want := srv.ServiceInstanceName(), sv.ServiceInstanceName(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srv.Port, 1234; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srv.Text["key"], "value"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srv.TTL, time.Duration(TTLDefault)*time.Second-30*time.Second; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srv.IPsAtInterface(testIface)[0].String(), "192.168.0.123"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// Expired services are not restored.
+	clock.now = clock.now.Add(time.Duration(TTLDefault) * time.Second)
+	expired := NewCache()
+	expired.clock = clock
+	if err := expired.Load(bytes.NewReader(b.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(expired.Services()), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestResolverLoad(t *testing.T) {
+	cache := NewCache()
+	srv := newService("Test._asdf._tcp.local.")
+	srv.SetHostname("Computer.local.")
+	srv.Port = 1234
+	srv.addIP(net.IP{192, 168, 0, 123}, testIface)
+	srv.expiration = time.Now().Add(time.Minute)
+	cache.services[srv.EscapedServiceInstanceName()] = srv
+
+	var b bytes.Buffer
+	if err := cache.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newResolver(newTestConn())
+	defer r.Close()
+
+	if err := r.Load(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lookups are answered from the loaded cache.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.LookupInstance(ctx, srv.EscapedServiceInstanceName()); err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err := r.LookupHost(ctx, "Computer.local.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := ips[0].String(), "192.168.0.123"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
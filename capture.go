@@ -0,0 +1,228 @@
+package dnssd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var capture atomic.Pointer[CaptureWriter]
+
+// Capture writes every sent and received mDNS packet to w in the pcapng format,
+// which can be opened with Wireshark or tcpdump. Use nil to stop capturing.
+func Capture(w io.Writer) {
+	if w == nil {
+		capture.Store(nil)
+		return
+	}
+
+	capture.Store(NewCaptureWriter(w))
+}
+
+// CaptureWriter writes mDNS packets in the pcapng format.
+// Every network interface is written as a separate pcapng interface
+// with its name, and packets are written as raw IP packets.
+type CaptureWriter struct {
+	mutex  sync.Mutex
+	w      io.Writer
+	ifaces map[string]uint32
+	header bool
+}
+
+// NewCaptureWriter returns a new capture writer, which writes to w.
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{
+		w:      w,
+		ifaces: map[string]uint32{},
+	}
+}
+
+const (
+	pcapngSectionHeaderBlock  = 0x0A0D0D0A
+	pcapngInterfaceBlock      = 0x00000001
+	pcapngEnhancedPacketBlock = 0x00000006
+	pcapngByteOrderMagic      = 0x1A2B3C4D
+	pcapngLinkTypeRaw         = 101
+	pcapngOptionEnd           = 0
+	pcapngOptionInterfaceName = 2
+	pcapngMaxSectionLength    = 0xFFFFFFFFFFFFFFFF
+	pcapngBlockOverheadLength = 12
+)
+
+// WritePacket writes a UDP packet with the payload from src to dst, which was
+// sent or received at iface at time t. If src is nil, the address of iface is used.
+func (c *CaptureWriter) WritePacket(t time.Time, iface *net.Interface, src, dst *net.UDPAddr, payload []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.header {
+		if err := c.writeBlock(pcapngSectionHeaderBlock, sectionHeader()); err != nil {
+			return err
+		}
+		c.header = true
+	}
+
+	name := "?"
+	if iface != nil {
+		name = iface.Name
+	}
+
+	id, ok := c.ifaces[name]
+	if !ok {
+		id = uint32(len(c.ifaces))
+		if err := c.writeBlock(pcapngInterfaceBlock, interfaceDescription(name)); err != nil {
+			return err
+		}
+		c.ifaces[name] = id
+	}
+
+	if src == nil {
+		src = &net.UDPAddr{IP: interfaceIP(iface, dst.IP.To4() != nil), Port: 5353}
+	}
+
+	pkt := ipPacket(src, dst, payload)
+
+	var b bytes.Buffer
+	ts := uint64(t.UnixMicro())
+	binary.Write(&b, binary.LittleEndian, id)
+	binary.Write(&b, binary.LittleEndian, uint32(ts>>32))
+	binary.Write(&b, binary.LittleEndian, uint32(ts))
+	binary.Write(&b, binary.LittleEndian, uint32(len(pkt)))
+	binary.Write(&b, binary.LittleEndian, uint32(len(pkt)))
+	b.Write(pad(pkt))
+
+	return c.writeBlock(pcapngEnhancedPacketBlock, b.Bytes())
+}
+
+func (c *CaptureWriter) writeBlock(typ uint32, body []byte) error {
+	length := uint32(len(body) + pcapngBlockOverheadLength)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, typ)
+	binary.Write(&b, binary.LittleEndian, length)
+	b.Write(body)
+	binary.Write(&b, binary.LittleEndian, length)
+
+	_, err := c.w.Write(b.Bytes())
+	return err
+}
+
+func sectionHeader() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(pcapngByteOrderMagic))
+	binary.Write(&b, binary.LittleEndian, uint16(1)) // major version
+	binary.Write(&b, binary.LittleEndian, uint16(0)) // minor version
+	binary.Write(&b, binary.LittleEndian, uint64(pcapngMaxSectionLength))
+	return b.Bytes()
+}
+
+func interfaceDescription(name string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(pcapngLinkTypeRaw))
+	binary.Write(&b, binary.LittleEndian, uint16(0)) // reserved
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // no snap length
+	binary.Write(&b, binary.LittleEndian, uint16(pcapngOptionInterfaceName))
+	binary.Write(&b, binary.LittleEndian, uint16(len(name)))
+	b.Write(pad([]byte(name)))
+	binary.Write(&b, binary.LittleEndian, uint16(pcapngOptionEnd))
+	binary.Write(&b, binary.LittleEndian, uint16(0))
+	return b.Bytes()
+}
+
+// pad pads b with zeros to a multiple of 4 bytes.
+func pad(b []byte) []byte {
+	if n := len(b) % 4; n != 0 {
+		return append(b, make([]byte, 4-n)...)
+	}
+
+	return b
+}
+
+// interfaceIP returns the first IPv4 or IPv6 address of iface.
+func interfaceIP(iface *net.Interface, ipv4 bool) net.IP {
+	if iface != nil {
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && (ipnet.IP.To4() != nil) == ipv4 {
+				return ipnet.IP
+			}
+		}
+	}
+
+	if ipv4 {
+		return net.IPv4zero
+	}
+
+	return net.IPv6unspecified
+}
+
+// ipPacket returns a raw IPv4 or IPv6 packet containing a UDP datagram with payload.
+func ipPacket(src, dst *net.UDPAddr, payload []byte) []byte {
+	udp := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(len(udp)))
+	copy(udp[8:], payload)
+
+	if src4, dst4 := src.IP.To4(), dst.IP.To4(); src4 != nil && dst4 != nil {
+		ip := make([]byte, 20)
+		ip[0] = 0x45 // version 4, header length 20
+		binary.BigEndian.PutUint16(ip[2:], uint16(len(ip)+len(udp)))
+		ip[8] = 255 // ttl (RFC6762 11)
+		ip[9] = 17  // udp
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip, 0))
+
+		pseudo := append(append([]byte{}, ip[12:20]...), 0, 17, udp[4], udp[5])
+		binary.BigEndian.PutUint16(udp[6:], checksum(udp, sum(pseudo)))
+
+		return append(ip, udp...)
+	}
+
+	ip := make([]byte, 40)
+	ip[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(udp)))
+	ip[6] = 17  // udp
+	ip[7] = 255 // hop limit (RFC6762 11)
+	copy(ip[8:], src.IP.To16())
+	copy(ip[24:], dst.IP.To16())
+
+	pseudo := append(append([]byte{}, ip[8:40]...), 0, 0, udp[4], udp[5], 0, 0, 0, 17)
+	binary.BigEndian.PutUint16(udp[6:], checksum(udp, sum(pseudo)))
+
+	return append(ip, udp...)
+}
+
+func sum(b []byte) uint32 {
+	var s uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+
+	return s
+}
+
+// checksum returns the internet checksum (RFC1071) of b and the initial sum s.
+func checksum(b []byte, s uint32) uint16 {
+	s += sum(b)
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+
+	return ^uint16(s)
+}
+
+// capturePacket writes the packet to the capture writer, if capturing is enabled.
+func capturePacket(iface *net.Interface, src, dst *net.UDPAddr, payload []byte) {
+	if c := capture.Load(); c != nil {
+		c.WritePacket(time.Now(), iface, src, dst, payload)
+	}
+}
@@ -0,0 +1,63 @@
+package dnssd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCaptureWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewCaptureWriter(&b)
+
+	src := &net.UDPAddr{IP: net.IP{192, 168, 0, 2}, Port: 5353}
+	payload := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if err := w.WritePacket(time.Now(), &net.Interface{Name: "en0"}, src, AddrIPv4LinkLocalMulticast, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePacket(time.Now(), &net.Interface{Name: "en0"}, src, AddrIPv4LinkLocalMulticast, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	// Section header, interface description and 2 packet blocks
+	data := b.Bytes()
+	types := []uint32{}
+	for len(data) > 0 {
+		typ := binary.LittleEndian.Uint32(data[0:])
+		length := binary.LittleEndian.Uint32(data[4:])
+		if length%4 != 0 || int(length) > len(data) {
+			t.Fatalf("invalid block length %d", length)
+		}
+		if is, want := binary.LittleEndian.Uint32(data[length-4:]), length; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+		types = append(types, typ)
+		data = data[length:]
+	}
+
+	want := []uint32{pcapngSectionHeaderBlock, pcapngInterfaceBlock, pcapngEnhancedPacketBlock, pcapngEnhancedPacketBlock}
+	if len(types) != len(want) {
+		t.Fatalf("is=%v want=%v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("is=%v want=%v", types, want)
+		}
+	}
+}
+
+func TestIPv4PacketChecksum(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IP{192, 168, 0, 2}, Port: 5353}
+	pkt := ipPacket(src, AddrIPv4LinkLocalMulticast, []byte{1, 2, 3})
+
+	// The checksum of a valid header is zero.
+	if is, want := checksum(pkt[:20], 0), uint16(0); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(pkt), 20+8+3; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
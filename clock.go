@@ -0,0 +1,43 @@
+package dnssd
+
+import (
+	"context"
+	"time"
+)
+
+// Clock provides the current time and timers for probing, announcements
+// and cache expiry. Tests can use a fake clock to control the timing.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel, which receives the current time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// sleep waits until d has elapsed on c.
+func sleep(c Clock, d time.Duration) {
+	<-c.After(d)
+}
+
+type clockKey struct{}
+
+// WithClock returns a copy of ctx which carries the clock c.
+// Lookups and probing use the clock of their context.
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// clockFrom returns the clock of ctx, or the system clock if ctx has none.
+func clockFrom(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey{}).(Clock); ok && c != nil {
+		return c
+	}
+
+	return realClock{}
+}
@@ -1,18 +1,23 @@
-// dnssd is a utilty to register and browser DNS-SD services.
+// dnssd is a utilty to register and browser DNS-SD services,
+// and to query mDNS records.
 package main
 
 import (
 	"github.com/brutella/dnssd"
 	"github.com/brutella/dnssd/log"
+	"github.com/miekg/dns"
 
 	"context"
 	"flag"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -25,6 +30,20 @@ var portFlag = flag.Int("Port", 0, "")
 var interfaceFlag = flag.String("Interface", "", "")
 var timeFormat = "15:04:05.000"
 var verboseFlag = flag.Bool("Verbose", false, "Verbose logging")
+var captureFlag = flag.String("Capture", "", "Write mDNS packets to a pcapng file")
+var timeoutFlag = flag.Duration("Timeout", 0, "Stop browsing or resolving after the duration, e.g. 5s")
+var expectCountFlag = flag.Int("ExpectCount", 0, "Stop browsing or resolving once the number of services are found")
+
+var resolveFlag = flag.Bool("Resolve", false, "Print the host, port and TXT records of found services")
+var listenFlag = flag.String("Listen", "127.0.0.1:8080", "Address of the HTTP server of the serve command")
+var watchFlag = flag.Bool("Watch", false, "Keep watching for changed addresses of the host")
+var fileFlag = flag.String("File", "", "YAML or JSON file with a list of services to register")
+var txtFlag dnssd.TextFlag
+var txtFileFlag = flag.String("TXTFile", "", "File with one TXT record entry key=value per line")
+
+func init() {
+	flag.Var(&txtFlag, "TXT", "TXT record entry key=value (repeatable)")
+}
 
 // Name of the invoked executable.
 var name = filepath.Base(os.Args[0])
@@ -32,12 +51,40 @@ var name = filepath.Base(os.Args[0])
 func printUsage() {
 	log.Info.Println("A DNS-SD utilty to register, browse and resolve Bonjour services.\n\n" +
 		"Usage:\n" +
-		"  " + name + " register -Name <string> -Type <string> -Port <int> [-Domain <string> -Interface <string[,string]> -Host <string> -IP <string>]\n" +
-		"  " + name + " browse                  -Type <string>             [-Domain <string> -Interface <string[,string]>]\n" +
-		"  " + name + " resolve  -Name <string> -Type <string>             [-Domain <string> -Interface <string[,string]>]\n")
+		"  " + name + " register -Name <string> -Type <string> -Port <int> [-Domain <string> -Interface <string[,string]> -Host <string> -IP <string> -TXT <key=value> -TXTFile <path>]\n" +
+		"  " + name + " register -File <path>\n" +
+		"  " + name + " browse                  -Type <string>             [-Domain <string> -Interface <string[,string]> -Timeout <duration> -ExpectCount <int> -Resolve]\n" +
+		"  " + name + " resolve  -Name <string> -Type <string>             [-Domain <string> -Interface <string[,string]> -Timeout <duration> -ExpectCount <int>]\n" +
+		"  " + name + " query    -Name <string> -Type <rrtype>             [-Interface <string[,string]> -Timeout <duration> -ExpectCount <int>]\n" +
+		"  " + name + " host     <hostname>                                [-Interface <string[,string]> -Timeout <duration> -Watch]\n" +
+		"  " + name + " serve                                              [-Listen <addr> -Interface <string[,string]>]\n\n" +
+		"browse, resolve, query and host exit with status 1, if less services or records than expected (at least one) were found.\n")
+}
+
+// lookupContext returns a context, which is done on interrupt or when the timeout expires.
+func lookupContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if *timeoutFlag <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeoutFlag)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
 }
 
-func resolve(typee, instance string) {
+// exitCode returns the exit status for the number of found services.
+func exitCode(found int) int {
+	if found == 0 || found < *expectCountFlag {
+		return 1
+	}
+
+	return 0
+}
+
+func resolve(typee, instance string) int {
 	ifaces := parseInterfaceFlag()
 	ifaceDesc := "all interfaces"
 	if len(ifaces) > 0 {
@@ -48,6 +95,16 @@ func resolve(typee, instance string) {
 	fmt.Printf("DATE: –––%s–––\n", time.Now().Format("Mon Jan 2 2006"))
 	fmt.Printf("%s	...STARTING...\n", time.Now().Format(timeFormat))
 
+	ctx, cancel := lookupContext()
+	defer cancel()
+
+	// With a timeout, resolving stops once the service is found.
+	expect := *expectCountFlag
+	if expect == 0 && *timeoutFlag > 0 {
+		expect = 1
+	}
+
+	found := 0
 	addFn := func(e dnssd.BrowseEntry) {
 		if e.ServiceInstanceName() == instance {
 			text := ""
@@ -55,22 +112,139 @@ func resolve(typee, instance string) {
 				text += fmt.Sprintf("%s=%s", key, value)
 			}
 			fmt.Printf("%s	%s can be reached at %s.%s.:%d %v\n", time.Now().Format(timeFormat), e.ServiceInstanceName(), e.Host, e.Domain, e.Port, text)
+
+			if found++; expect > 0 && found >= expect {
+				cancel()
+			}
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	if err := dnssd.LookupTypeAtInterfaces(ctx, typee, addFn, func(dnssd.BrowseEntry) {}, ifaces...); err != nil && ctx.Err() == nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	return exitCode(found)
+}
+
+func query(name, typee string) int {
+	qtype, ok := dns.StringToType[strings.ToUpper(typee)]
+	if !ok {
+		fmt.Printf("invalid record type %s\n", typee)
+		return 1
+	}
+
+	ifaces := parseInterfaceFlag()
+	ifaceDesc := "all interfaces"
+	if len(ifaces) > 0 {
+		ifaceDesc = strings.Join(ifaces, ", ")
+	}
+
+	fmt.Printf("Query %s %s at %s\n", dns.Fqdn(name), dns.TypeToString[qtype], ifaceDesc)
+	fmt.Printf("DATE: –––%s–––\n", time.Now().Format("Mon Jan 2 2006"))
+	fmt.Printf("%s	...STARTING...\n", time.Now().Format(timeFormat))
+
+	ctx, cancel := lookupContext()
 	defer cancel()
 
-	if err := dnssd.LookupTypeAtInterfaces(ctx, typee, addFn, func(dnssd.BrowseEntry) {}, ifaces...); err != nil {
+	found := 0
+	fn := func(rr dns.RR) {
+		// Print the class without the cache-flush bit. (RFC6762 10.2)
+		flush := ""
+		if rr.Header().Class&(1<<15) != 0 {
+			rr = dns.Copy(rr)
+			rr.Header().Class &^= (1 << 15)
+			flush = " (cache flush)"
+		}
+		fmt.Printf("%s	%s%s\n", time.Now().Format(timeFormat), rr, flush)
+
+		if found++; *expectCountFlag > 0 && found >= *expectCountFlag {
+			cancel()
+		}
+	}
+
+	if err := dnssd.QueryRecord(ctx, name, qtype, fn, ifaces...); err != nil && ctx.Err() == nil {
 		fmt.Println(err)
-		return
+		return 1
+	}
+
+	return exitCode(found)
+}
+
+// printDetails prints the host, port and TXT records of e.
+func printDetails(e dnssd.BrowseEntry) {
+	var keys []string
+	for key := range e.Text {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var txt []string
+	for _, key := range keys {
+		txt = append(txt, fmt.Sprintf("%s=%s", key, e.Text[key]))
+	}
+	txt = append(txt, e.TextFlags...)
+
+	fmt.Printf("\t\t%s can be reached at %s.%s.:%d %s\n", e.ServiceInstanceName(), e.Host, e.Domain, e.Port, strings.Join(txt, " "))
+}
+
+func host(hostname string) int {
+	ifaces := parseInterfaceFlag()
+	ifaceDesc := "all interfaces"
+	if len(ifaces) > 0 {
+		ifaceDesc = strings.Join(ifaces, ", ")
+	}
+
+	hostname = dns.Fqdn(hostname)
+	fmt.Printf("Lookup host %s at %s\n", hostname, ifaceDesc)
+	fmt.Printf("DATE: –––%s–––\n", time.Now().Format("Mon Jan 2 2006"))
+	fmt.Printf("%s	...STARTING...\n", time.Now().Format(timeFormat))
+
+	ctx, cancel := lookupContext()
+	defer cancel()
+
+	// ips stores the addresses of the host, which were found.
+	ips := map[string]bool{}
+	found := 0
+	fn := func(rr dns.RR) {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			return
+		}
+
+		if rr.Header().Ttl == 0 {
+			// Goodbye packet (RFC6762 10.1)
+			if ips[ip.String()] {
+				delete(ips, ip.String())
+				fmt.Printf("%s	Rmv	%s\n", time.Now().Format(timeFormat), ip)
+			}
+			return
+		}
+
+		if !ips[ip.String()] {
+			ips[ip.String()] = true
+			found++
+			fmt.Printf("%s	Add	%s	ttl=%d\n", time.Now().Format(timeFormat), ip, rr.Header().Ttl)
+		}
+
+		if !*watchFlag {
+			// The response is complete and the remaining records of it are still handled.
+			cancel()
+		}
 	}
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	// An ANY query asks for the A and AAAA records at once. (RFC6762 6.5)
+	if err := dnssd.QueryRecord(ctx, hostname, dns.TypeANY, fn, ifaces...); err != nil && ctx.Err() == nil {
+		fmt.Println(err)
+		return 1
+	}
 
-	<-stop
-	cancel()
+	return exitCode(found)
 }
 
 func register(instance string) {
@@ -80,25 +254,31 @@ func register(instance string) {
 		return
 	}
 
-	var ips []net.IP
+	var addrs []netip.Addr
 	if *ipFlag != "" {
-		ip := net.ParseIP(*ipFlag)
-		if ip == nil {
+		addr, err := netip.ParseAddr(*ipFlag)
+		if err != nil {
 			log.Info.Println("invalid ip", *ipFlag)
 			printUsage()
 			return
 		}
-		ips = []net.IP{ip}
+		addrs = []netip.Addr{addr}
+	}
+
+	text, flags, err := dnssd.ParseTextWithFile(txtFlag, *txtFileFlag)
+	if err != nil {
+		log.Info.Println("invalid TXT file", err)
+		return
 	}
 
 	fmt.Printf("Registering Service %s port %d\n", instance, *portFlag)
 	fmt.Printf("DATE: –––%s–––\n", time.Now().Format("Mon Jan 2 2006"))
 	fmt.Printf("%s	...STARTING...\n", time.Now().Format(timeFormat))
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	if resp, err := dnssd.NewResponder(); err != nil {
+	if resp, err := newResponder(); err != nil {
 		fmt.Println(err)
 	} else {
 		cfg := dnssd.Config{
@@ -107,22 +287,21 @@ func register(instance string) {
 			Domain: *domainFlag,
 			Port:   *portFlag,
 			Ifaces: parseInterfaceFlag(),
-			IPs:    ips,
+			Addrs:  addrs,
 			Host:   *hostFlag,
+			Proxy:  len(addrs) > 0 && *hostFlag != "",
+
+			Text:      text,
+			TextFlags: flags,
+
+			// Tell systemd that the service is registered.
+			StatusFunc: dnssd.SdNotifyReady(1),
 		}
 		srv, err := dnssd.NewService(cfg)
 		if err != nil {
 			log.Info.Fatal(err)
 		}
 
-		go func() {
-			stop := make(chan os.Signal, 1)
-			signal.Notify(stop, os.Interrupt)
-
-			<-stop
-			cancel()
-		}()
-
 		go func() {
 			time.Sleep(1 * time.Second)
 			handle, err := resp.Add(srv)
@@ -132,9 +311,7 @@ func register(instance string) {
 				fmt.Printf("%s	Got a reply for service %s: Name now registered and active\n", time.Now().Format(timeFormat), handle.Service().ServiceInstanceName())
 			}
 		}()
-		err = resp.Respond(ctx)
-
-		if err != nil {
+		if err := respond(ctx, resp); err != nil {
 			fmt.Println(err)
 		}
 	}
@@ -155,8 +332,8 @@ func parseInterfaceFlag() []string {
 	return ifaces
 }
 
-func browse(typee string) {
-	ctx, cancel := context.WithCancel(context.Background())
+func browse(typee string) int {
+	ctx, cancel := lookupContext()
 	defer cancel()
 
 	ifaces := parseInterfaceFlag()
@@ -170,24 +347,38 @@ func browse(typee string) {
 	fmt.Printf("%s  ...STARTING...\n", time.Now().Format(timeFormat))
 	fmt.Printf("Timestamp	A/R	if Domain	Service Type	Instance Name\n")
 
+	// found stores the found service instances by name.
+	found := map[string]bool{}
 	addFn := func(e dnssd.BrowseEntry) {
-		fmt.Printf("%s	Add	%s	%s	%s	%s (%s)\n", time.Now().Format(timeFormat), e.IfaceName, e.Domain, e.Type, e.Name, e.IPs)
+		fmt.Printf("%s	Add	%s	%s	%s	%s (%s)\n", time.Now().Format(timeFormat), e.IfaceName, e.Domain, e.Type, e.Name, e.Addrs)
+		if *resolveFlag {
+			printDetails(e)
+		}
+
+		found[e.ServiceInstanceName()] = true
+		if *expectCountFlag > 0 && len(found) >= *expectCountFlag {
+			cancel()
+		}
 	}
 
 	rmvFn := func(e dnssd.BrowseEntry) {
 		fmt.Printf("%s	Rmv	%s	%s	%s	%s\n", time.Now().Format(timeFormat), e.IfaceName, e.Domain, e.Type, e.Name)
 	}
 
-	if err := dnssd.LookupTypeAtInterfaces(ctx, typee, addFn, rmvFn, ifaces...); err != nil {
-		fmt.Println(err)
-		return
+	var updFn dnssd.UpdFunc
+	if *resolveFlag {
+		updFn = func(e dnssd.BrowseEntry) {
+			fmt.Printf("%s	Upd	%s	%s	%s	%s (%s)\n", time.Now().Format(timeFormat), e.IfaceName, e.Domain, e.Type, e.Name, e.Addrs)
+			printDetails(e)
+		}
 	}
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	if err := dnssd.LookupTypeWithUpdates(ctx, typee, addFn, updFn, rmvFn, ifaces...); err != nil && ctx.Err() == nil {
+		fmt.Println(err)
+		return 1
+	}
 
-	<-stop
-	cancel()
+	return exitCode(len(found))
 }
 
 func main() {
@@ -200,10 +391,17 @@ func main() {
 	// The first argument is the command.
 	cmd := args[0]
 
+	// The host command has the host name as argument.
+	var hostname string
+	flags := os.Args[2:]
+	if cmd == "host" && len(flags) > 0 && !strings.HasPrefix(flags[0], "-") {
+		hostname, flags = flags[0], flags[1:]
+	}
+
 	// Use the remaining arguments as flags.
-	flag.CommandLine.Parse(os.Args[2:])
+	flag.CommandLine.Parse(flags)
 
-	if *typeFlag == "" {
+	if *typeFlag == "" && (cmd != "register" || *fileFlag == "") && cmd != "host" && cmd != "serve" {
 		printUsage()
 		return
 	}
@@ -212,24 +410,62 @@ func main() {
 		log.Debug.Enable()
 	}
 
+	// code is the exit status, which is returned after the capture file is closed.
+	code := 0
+	defer func() {
+		if code != 0 {
+			os.Exit(code)
+		}
+	}()
+
+	if *captureFlag != "" {
+		f, err := os.Create(*captureFlag)
+		if err != nil {
+			log.Info.Fatal(err)
+		}
+		defer f.Close()
+		dnssd.Capture(f)
+	}
+
 	typee := fmt.Sprintf("%s.%s.", strings.Trim(*typeFlag, "."), strings.Trim(*domainFlag, "."))
 	instance := fmt.Sprintf("%s.%s.%s.", strings.Trim(*nameFlag, "."), strings.Trim(*typeFlag, "."), strings.Trim(*domainFlag, "."))
 
 	switch cmd {
 	case "register":
+		if *fileFlag != "" {
+			registerFile(*fileFlag)
+			return
+		}
 		if *nameFlag == "" {
 			printUsage()
 			return
 		}
 		register(instance)
 	case "browse":
-		browse(typee)
+		code = browse(typee)
 	case "resolve":
 		if *nameFlag == "" {
 			printUsage()
 			return
 		}
-		resolve(typee, instance)
+		code = resolve(typee, instance)
+	case "host":
+		if hostname == "" {
+			hostname = *nameFlag
+		}
+		if hostname == "" {
+			printUsage()
+			return
+		}
+		code = host(hostname)
+	case "query":
+		if *nameFlag == "" {
+			printUsage()
+			return
+		}
+		code = query(*nameFlag, *typeFlag)
+	case "serve":
+		code = serve(*listenFlag)
 	default:
 		printUsage()
 		return
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"github.com/brutella/dnssd"
+
+	"gopkg.in/yaml.v3"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fileService is a service in the file of the -File flag.
+type fileService struct {
+	Name       string            `json:"name" yaml:"name"`
+	Type       string            `json:"type" yaml:"type"`
+	Domain     string            `json:"domain" yaml:"domain"`
+	Host       string            `json:"host" yaml:"host"`
+	Port       int               `json:"port" yaml:"port"`
+	Text       map[string]string `json:"txt" yaml:"txt"`
+	TextFlags  []string          `json:"txtFlags" yaml:"txtFlags"`
+	Interfaces []string          `json:"interfaces" yaml:"interfaces"`
+}
+
+// service returns the service described by f, which calls fn when its status changes.
+func (f fileService) service(fn dnssd.StatusFunc) (dnssd.Service, error) {
+	return dnssd.NewService(dnssd.Config{
+		Name:       f.Name,
+		Type:       f.Type,
+		Domain:     f.Domain,
+		Host:       f.Host,
+		Port:       f.Port,
+		Text:       f.Text,
+		TextFlags:  f.TextFlags,
+		Ifaces:     f.Interfaces,
+		StatusFunc: fn,
+	})
+}
+
+// readServices returns the services in the YAML or JSON file at path, which
+// call fn when their status changes. Files with the extension .yaml or .yml
+// are read as YAML, other files as JSON, e.g.
+//
+//	[{"name": "Printer", "type": "_ipp._tcp", "port": 631, "txt": {"pdl": "application/postscript"}, "txtFlags": ["Color"]}]
+func readServices(path string, fn dnssd.StatusFunc) ([]dnssd.Service, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fs []fileService
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &fs)
+	default:
+		err = json.Unmarshal(b, &fs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var srvs []dnssd.Service
+	for i, f := range fs {
+		srv, err := f.service(fn)
+		if err != nil {
+			return nil, fmt.Errorf("%s: service %d: %w", path, i, err)
+		}
+		srvs = append(srvs, srv)
+	}
+
+	return srvs, nil
+}
+
+// registerFile registers the services in the file at path with one responder.
+// The file is read again on SIGHUP to add, remove and update services.
+func registerFile(path string) {
+	// ready tells systemd when the services of the file are registered.
+	// It is set before the responder probes the services.
+	var ready dnssd.StatusFunc
+	statusFn := func(e dnssd.StatusEvent) {
+		ready(e)
+	}
+
+	srvs, err := readServices(path, statusFn)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	ready = dnssd.SdNotifyReady(len(srvs))
+	if len(srvs) == 0 {
+		dnssd.SdNotify("READY=1")
+	}
+
+	resp, err := newResponder()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Registering Services in %s\n", path)
+	fmt.Printf("DATE: –––%s–––\n", time.Now().Format("Mon Jan 2 2006"))
+	fmt.Printf("%s	...STARTING...\n", time.Now().Format(timeFormat))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	fr := &fileResponder{resp: resp, handles: map[string]dnssd.ServiceHandle{}, configs: map[string]dnssd.Service{}}
+	fr.update(srvs)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				srvs, err := readServices(path, statusFn)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				dnssd.SdNotify("RELOADING=1")
+				fr.update(srvs)
+				dnssd.SdNotify("READY=1")
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := respond(ctx, resp); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// registrar adds and removes services, like a dnssd.Responder.
+type registrar interface {
+	Add(srv dnssd.Service) (dnssd.ServiceHandle, error)
+	Remove(h dnssd.ServiceHandle)
+}
+
+// fileResponder registers the services of a file.
+type fileResponder struct {
+	resp registrar
+
+	// handles stores the registered services by service instance name.
+	handles map[string]dnssd.ServiceHandle
+
+	// configs stores the services of the file by service instance name,
+	// as they were registered. The services of the handles may differ
+	// after they were renamed because of a conflict.
+	configs map[string]dnssd.Service
+}
+
+// update registers srvs. Services, which are not in srvs anymore, are removed.
+// The TXT records of registered services are updated, and services with other
+// changed properties are registered again.
+func (fr *fileResponder) update(srvs []dnssd.Service) {
+	next := map[string]dnssd.Service{}
+	for _, srv := range srvs {
+		next[srv.ServiceInstanceName()] = srv
+	}
+
+	for name, h := range fr.handles {
+		if _, ok := next[name]; !ok {
+			fr.resp.Remove(h)
+			delete(fr.handles, name)
+			delete(fr.configs, name)
+			fmt.Printf("%s	Removed service %s\n", time.Now().Format(timeFormat), name)
+		}
+	}
+
+	for name, srv := range next {
+		if h, ok := fr.handles[name]; ok {
+			config := fr.configs[name]
+			if isSameService(config, srv) {
+				if !reflect.DeepEqual(config.Text, srv.Text) {
+					if err := h.SetText(srv.Text); err != nil {
+						fmt.Println(err)
+						continue
+					}
+					fr.configs[name] = srv
+				}
+				continue
+			}
+
+			// Other properties can't be updated.
+			fr.resp.Remove(h)
+			delete(fr.handles, name)
+			delete(fr.configs, name)
+		}
+
+		h, err := fr.resp.Add(srv)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fr.handles[name] = h
+		fr.configs[name] = srv
+		fmt.Printf("%s	Added service %s\n", time.Now().Format(timeFormat), name)
+	}
+}
+
+// isSameService returns true, if the properties of this and that
+// except the TXT records are the same.
+func isSameService(this, that dnssd.Service) bool {
+	return this.Host == that.Host && this.Port == that.Port && reflect.DeepEqual(this.Ifaces, that.Ifaces) && reflect.DeepEqual(this.TextFlags, that.TextFlags)
+}
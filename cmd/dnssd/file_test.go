@@ -0,0 +1,191 @@
+package main
+
+import (
+	"github.com/brutella/dnssd"
+
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestReadServices(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"services.json", `[{"name": "Printer", "type": "_ipp._tcp", "port": 631, "txt": {"pdl": "application/postscript"}, "txtFlags": ["Color"], "interfaces": ["en0"]}]`},
+		{"services.yaml", `
+- name: Printer
+  type: _ipp._tcp
+  port: 631
+  txt:
+    pdl: application/postscript
+  txtFlags: [Color]
+  interfaces: [en0]
+`},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.name)
+		if err := os.WriteFile(path, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		srvs, err := readServices(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := len(srvs), 1; is != want {
+			t.Fatalf("%s: is=%v want=%v", test.name, is, want)
+		}
+
+		srv := srvs[0]
+		if is, want := srv.ServiceInstanceName(), "Printer._ipp._tcp.local."; is != want {
+			t.Fatalf("%s: is=%v want=%v", test.name, is, want)
+		}
+
+		if is, want := srv.Port, 631; is != want {
+			t.Fatalf("%s: is=%v want=%v", test.name, is, want)
+		}
+
+		if is, want := srv.Text, map[string]string{"pdl": "application/postscript"}; !reflect.DeepEqual(is, want) {
+			t.Fatalf("%s: is=%v want=%v", test.name, is, want)
+		}
+
+		if is, want := srv.TextFlags, []string{"Color"}; !reflect.DeepEqual(is, want) {
+			t.Fatalf("%s: is=%v want=%v", test.name, is, want)
+		}
+
+		if is, want := srv.Ifaces, []string{"en0"}; !reflect.DeepEqual(is, want) {
+			t.Fatalf("%s: is=%v want=%v", test.name, is, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "Printer", "port": 631}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readServices(path, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+type testHandle struct {
+	srv   dnssd.Service
+	texts []map[string]string
+}
+
+func (h *testHandle) UpdateText(text map[string]string) { h.SetText(text) }
+
+func (h *testHandle) SetText(text map[string]string) error {
+	h.srv.Text = text
+	h.texts = append(h.texts, text)
+	return nil
+}
+
+func (h *testHandle) UpdateIPs(iface string, ips []net.IP)      {}
+func (h *testHandle) Announce()                                 {}
+func (h *testHandle) SetMaintenance(mode dnssd.MaintenanceMode) {}
+func (h *testHandle) Service() dnssd.Service                    { return h.srv }
+
+type testRegistrar struct {
+	added   []string
+	removed []string
+}
+
+func (r *testRegistrar) Add(srv dnssd.Service) (dnssd.ServiceHandle, error) {
+	r.added = append(r.added, srv.Name)
+	return &testHandle{srv: srv}, nil
+}
+
+func (r *testRegistrar) Remove(h dnssd.ServiceHandle) {
+	r.removed = append(r.removed, h.Service().Name)
+}
+
+func TestFileResponderUpdate(t *testing.T) {
+	service := func(name string, port int, text map[string]string) dnssd.Service {
+		srv, err := dnssd.NewService(dnssd.Config{Name: name, Type: "_ipp._tcp", Port: port, Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return srv
+	}
+
+	r := &testRegistrar{}
+	fr := &fileResponder{resp: r, handles: map[string]dnssd.ServiceHandle{}, configs: map[string]dnssd.Service{}}
+	fr.update([]dnssd.Service{
+		service("A", 631, nil),
+		service("B", 631, nil),
+		service("C", 631, nil),
+	})
+
+	sort.Strings(r.added)
+	if is, want := r.added, []string{"A", "B", "C"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// A is removed, the TXT records of B are updated,
+	// and C is registered again with another port.
+	r.added = nil
+	text := map[string]string{"pdl": "application/postscript"}
+	fr.update([]dnssd.Service{
+		service("B", 631, text),
+		service("C", 632, nil),
+	})
+
+	sort.Strings(r.removed)
+	if is, want := r.removed, []string{"A", "C"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := r.added, []string{"C"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	h := fr.handles["B._ipp._tcp.local."].(*testHandle)
+	if is, want := h.texts, []map[string]string{text}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := fr.handles["C._ipp._tcp.local."].Service().Port, 632; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+// hostRenamingRegistrar registers services with another hostname,
+// as if their hostname was already used by another host.
+type hostRenamingRegistrar struct {
+	testRegistrar
+}
+
+func (r *hostRenamingRegistrar) Add(srv dnssd.Service) (dnssd.ServiceHandle, error) {
+	r.added = append(r.added, srv.Name)
+	srv.Host += "-2"
+	return &testHandle{srv: srv}, nil
+}
+
+func TestFileResponderUpdateRenamed(t *testing.T) {
+	srv, err := dnssd.NewService(dnssd.Config{Name: "A", Type: "_ipp._tcp", Host: "Computer", Port: 631})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &hostRenamingRegistrar{}
+	fr := &fileResponder{resp: r, handles: map[string]dnssd.ServiceHandle{}, configs: map[string]dnssd.Service{}}
+	fr.update([]dnssd.Service{srv})
+	fr.update([]dnssd.Service{srv})
+
+	// The renamed service is not registered again.
+	if is, want := r.added, []string{"A"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(r.removed), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"github.com/brutella/dnssd"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// server registers services and browses for service types on behalf of
+// HTTP clients, which share the mDNS connection of the server.
+//
+//	GET    /services         lists the registered services
+//	POST   /services         registers the service in the JSON body
+//	DELETE /services/<name>  removes the service with the (path escaped) service instance name
+//	GET    /browse?type=...  streams found and removed service instances as server-sent events
+type server struct {
+	conn *dnssd.SharedConn
+	resp registrar
+
+	mutex sync.Mutex
+
+	// handles stores the registered services by their service instance name,
+	// which may differ from the requested name after a name conflict.
+	handles map[string]dnssd.ServiceHandle
+
+	// adding contains the requested service instance names of services,
+	// which are being probed.
+	adding map[string]bool
+}
+
+// serviceResponse is a registered service in a response.
+type serviceResponse struct {
+	fileService
+	Instance string `json:"instance"`
+}
+
+// browseEvent is a found or removed service instance in a browse stream.
+type browseEvent struct {
+	Instance  string            `json:"instance"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Domain    string            `json:"domain"`
+	Host      string            `json:"host"`
+	Port      int               `json:"port"`
+	Text      map[string]string `json:"txt"`
+	Interface string            `json:"interface"`
+	Addrs     []string          `json:"addrs"`
+}
+
+func newBrowseEvent(e dnssd.BrowseEntry) browseEvent {
+	ev := browseEvent{
+		Instance:  e.ServiceInstanceName(),
+		Name:      e.Name,
+		Type:      e.Type,
+		Domain:    e.Domain,
+		Host:      e.Host,
+		Port:      e.Port,
+		Text:      e.Text,
+		Interface: e.IfaceName,
+	}
+	for _, addr := range e.Addrs {
+		ev.Addrs = append(ev.Addrs, addr.String())
+	}
+
+	return ev
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/services" && r.Method == http.MethodGet:
+		s.list(w)
+	case r.URL.Path == "/services" && r.Method == http.MethodPost:
+		s.add(w, r)
+	case strings.HasPrefix(r.URL.Path, "/services/") && r.Method == http.MethodDelete:
+		s.remove(w, strings.TrimPrefix(r.URL.Path, "/services/"))
+	case r.URL.Path == "/browse" && r.Method == http.MethodGet:
+		s.browse(w, r)
+	case r.URL.Path == "/services" || strings.HasPrefix(r.URL.Path, "/services/") || r.URL.Path == "/browse":
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *server) list(w http.ResponseWriter) {
+	s.mutex.Lock()
+	var srvs []serviceResponse
+	for name, h := range s.handles {
+		srvs = append(srvs, newServiceResponse(name, h.Service()))
+	}
+	s.mutex.Unlock()
+
+	sort.Slice(srvs, func(i, j int) bool { return srvs[i].Instance < srvs[j].Instance })
+	writeJSON(w, http.StatusOK, srvs)
+}
+
+func (s *server) add(w http.ResponseWriter, r *http.Request) {
+	var f fileService
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	srv, err := f.service(nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := srv.ServiceInstanceName()
+	s.mutex.Lock()
+	if _, ok := s.handles[name]; ok || s.adding[name] {
+		s.mutex.Unlock()
+		http.Error(w, fmt.Sprintf("service %s is already registered", name), http.StatusConflict)
+		return
+	}
+	s.adding[name] = true
+	s.mutex.Unlock()
+
+	// The service is probed without blocking other requests.
+	h, err := s.resp.Add(srv)
+
+	s.mutex.Lock()
+	delete(s.adding, name)
+	if err == nil {
+		name = h.Service().ServiceInstanceName()
+		s.handles[name] = h
+	}
+	s.mutex.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("%s	Added service %s\n", time.Now().Format(timeFormat), name)
+
+	writeJSON(w, http.StatusCreated, newServiceResponse(name, h.Service()))
+}
+
+func (s *server) remove(w http.ResponseWriter, name string) {
+	s.mutex.Lock()
+	h, ok := s.handles[name]
+	delete(s.handles, name)
+	s.mutex.Unlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("service %s is not registered", name), http.StatusNotFound)
+		return
+	}
+
+	s.resp.Remove(h)
+	fmt.Printf("%s	Removed service %s\n", time.Now().Format(timeFormat), name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// browse streams the service instances of the service type in the query
+// of r as "add", "upd" and "rmv" events until the client disconnects.
+func (s *server) browse(w http.ResponseWriter, r *http.Request) {
+	typee := r.URL.Query().Get("type")
+	if typee == "" {
+		http.Error(w, "missing service type", http.StatusBadRequest)
+		return
+	}
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		domain = "local"
+	}
+	service := fmt.Sprintf("%s.%s.", strings.Trim(typee, "."), strings.Trim(domain, "."))
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The functions are called from the goroutine of the lookup.
+	send := func(event string, e dnssd.BrowseEntry) {
+		b, err := json.Marshal(newBrowseEvent(e))
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		flusher.Flush()
+	}
+	addFn := func(e dnssd.BrowseEntry) { send("add", e) }
+	updFn := func(e dnssd.BrowseEntry) { send("upd", e) }
+	rmvFn := func(e dnssd.BrowseEntry) { send("rmv", e) }
+
+	var ifaces []string
+	if *interfaceFlag != "" {
+		ifaces = strings.Split(*interfaceFlag, ",")
+	}
+
+	b := dnssd.NewBrowserWithConn(s.conn, ifaces...)
+	b.Add(service, addFn, updFn, rmvFn)
+	if err := b.Run(r.Context()); err != nil && r.Context().Err() == nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+		flusher.Flush()
+	}
+}
+
+func newServiceResponse(name string, srv dnssd.Service) serviceResponse {
+	return serviceResponse{
+		fileService: fileService{
+			Name:       srv.Name,
+			Type:       srv.Type,
+			Domain:     srv.Domain,
+			Host:       srv.Host,
+			Port:       srv.Port,
+			Text:       srv.Text,
+			Interfaces: srv.Ifaces,
+		},
+		Instance: name,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// serve runs one responder, which registers services and browses for
+// service types on behalf of the clients of the HTTP server at addr.
+func serve(addr string) int {
+	var ifaces []string
+	if *interfaceFlag != "" {
+		ifaces = strings.Split(*interfaceFlag, ",")
+	}
+
+	conn, err := dnssd.NewSharedConn(ifaces...)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer conn.Shutdown()
+
+	resp := dnssd.NewResponderWithConn(conn, dnssd.ResponderOptions{}).(dnssd.ResponderControl)
+	s := &server{
+		conn:    conn,
+		resp:    resp,
+		handles: map[string]dnssd.ServiceHandle{},
+		adding:  map[string]bool{},
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	hs := &http.Server{
+		Addr:        addr,
+		Handler:     s,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- hs.ListenAndServe()
+	}()
+
+	fmt.Printf("Serving at %s\n", addr)
+	fmt.Printf("DATE: –––%s–––\n", time.Now().Format("Mon Jan 2 2006"))
+	fmt.Printf("%s	...STARTING...\n", time.Now().Format(timeFormat))
+
+	// The responder is stopped with Stop to send goodbye packets.
+	go resp.Respond(context.Background())
+	dnssd.SdNotify("READY=1")
+
+	select {
+	case err := <-errs:
+		fmt.Println(err)
+		return 1
+	case <-ctx.Done():
+	}
+	dnssd.SdNotify("STOPPING=1")
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stopCancel()
+	hs.Shutdown(stopCtx)
+	resp.Stop(stopCtx)
+
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/brutella/dnssd"
+
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// renamingRegistrar registers services with a number appended to their name,
+// as if their name was already used by another host.
+type renamingRegistrar struct {
+	testRegistrar
+}
+
+func (r *renamingRegistrar) Add(srv dnssd.Service) (dnssd.ServiceHandle, error) {
+	srv.Name += " (2)"
+	return r.testRegistrar.Add(srv)
+}
+
+func TestServerAddRenamed(t *testing.T) {
+	r := &renamingRegistrar{}
+	s := &server{resp: r, handles: map[string]dnssd.ServiceHandle{}, adding: map[string]bool{}}
+
+	w := httptest.NewRecorder()
+	body := `{"name": "Printer", "type": "_ipp._tcp", "port": 631}`
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/services", strings.NewReader(body)))
+	if is, want := w.Code, http.StatusCreated; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	name := "Printer (2)._ipp._tcp.local."
+	if _, ok := s.handles[name]; !ok {
+		t.Fatalf("service %s not found in %v", name, s.handles)
+	}
+
+	if is, want := len(s.adding), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/services/Printer%20(2)._ipp._tcp.local.", nil))
+	if is, want := w.Code, http.StatusNoContent; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(r.removed), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
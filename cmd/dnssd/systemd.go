@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/brutella/dnssd"
+
+	"context"
+)
+
+// newResponder returns a responder, which uses the sockets passed
+// by systemd with socket activation, or its own sockets otherwise.
+func newResponder() (dnssd.Responder, error) {
+	conns, err := dnssd.SdListenConns()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conns) == 0 {
+		return dnssd.NewResponder()
+	}
+
+	conn, err := dnssd.NewMDNSConnWithOptions(dnssd.ConnOptions{Conns: conns})
+	if err != nil {
+		return nil, err
+	}
+
+	return dnssd.NewResponderWithConn(conn, dnssd.ResponderOptions{}), nil
+}
+
+// respond responds with resp until ctx is done. systemd is told that the
+// command is stopping while goodbye packets are sent, and respond returns
+// only after they are sent, so that the command doesn't exit before.
+func respond(ctx context.Context, resp dnssd.Responder) error {
+	stopping := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		dnssd.SdNotify("STOPPING=1\nSTATUS=Sending goodbye packets")
+		close(stopping)
+	}()
+
+	// Goodbye packets are sent before Respond returns.
+	err := resp.Respond(ctx)
+	if ctx.Err() == nil {
+		return err
+	}
+
+	<-stopping
+	dnssd.SdNotify("STATUS=Goodbye packets sent")
+
+	return nil
+}
@@ -23,6 +23,13 @@ var verboseFlag = flag.Bool("Verbose", false, "Verbose logging")
 var interfaceFlag = flag.String("Interface", "", "Network interface name")
 var timeFormat = "15:04:05.000"
 
+var txtFlag dnssd.TextFlag
+var txtFileFlag = flag.String("TXTFile", "", "File with one TXT record entry key=value per line")
+
+func init() {
+	flag.Var(&txtFlag, "TXT", "TXT record entry key=value (repeatable)")
+}
+
 func main() {
 	flag.Parse()
 	if len(*instanceFlag) == 0 || len(*serviceFlag) == 0 || len(*domainFlag) == 0 {
@@ -36,6 +43,11 @@ func main() {
 
 	instance := fmt.Sprintf("%s.%s.%s.", strings.Trim(*instanceFlag, "."), strings.Trim(*serviceFlag, "."), strings.Trim(*domainFlag, "."))
 
+	text, flags, err := dnssd.ParseTextWithFile(txtFlag, *txtFileFlag)
+	if err != nil {
+		slog.Fatal(err)
+	}
+
 	fmt.Printf("Registering Service %s port %d\n", instance, *portFlag)
 	fmt.Printf("DATE: –––%s–––\n", time.Now().Format("Mon Jan 2 2006"))
 	fmt.Printf("%s	...STARTING...\n", time.Now().Format(timeFormat))
@@ -57,6 +69,9 @@ func main() {
 			Domain: *domainFlag,
 			Port:   *portFlag,
 			Ifaces: ifaces,
+
+			Text:      text,
+			TextFlags: flags,
 		}
 		srv, err := dnssd.NewService(cfg)
 		if err != nil {
@@ -3,8 +3,8 @@ package dnssd
 import (
 	"fmt"
 	"net"
-	"reflect"
 	"sort"
+	"strings"
 
 	"github.com/miekg/dns"
 )
@@ -56,13 +56,26 @@ func TXT(srv Service) *dns.TXT {
 	for key := range srv.Text {
 		keys = append(keys, key)
 	}
-	sort.Strings(keys)
+	sort.Slice(keys, func(i, j int) bool {
+		// The version should be the first attribute. (RFC6763 6.7)
+		if strings.EqualFold(keys[i], TXTVersionKey) != strings.EqualFold(keys[j], TXTVersionKey) {
+			return strings.EqualFold(keys[i], TXTVersionKey)
+		}
+		return keys[i] < keys[j]
+	})
 
 	txts := []string{}
 	for _, k := range keys {
 		txts = append(txts, fmt.Sprintf("%s=%s", k, srv.Text[k]))
 	}
 
+	// Boolean attributes are present without "=". (RFC6763 6.4)
+	for _, k := range srv.TextFlags {
+		if _, ok := srv.Text[k]; !ok {
+			txts = append(txts, k)
+		}
+	}
+
 	// An empty TXT record containing zero strings is not allowed. (RFC6763 6.1)
 	if len(txts) == 0 {
 		txts = []string{""}
@@ -79,6 +92,55 @@ func TXT(srv Service) *dns.TXT {
 	}
 }
 
+// parseText returns the attributes in the TXT strings txts as key/value pairs
+// and the keys of boolean attributes, which are present without "=".
+// Keys keep their case, but are case-insensitive: only the first occurrence
+// of a key is used and values are looked up with LookupText.
+// Strings without key are ignored. (RFC6763 6.4)
+func parseText(txts []string) (text map[string]string, flags []string) {
+	text = map[string]string{}
+	seen := map[string]bool{}
+	for _, txt := range txts {
+		key, value, hasValue := strings.Cut(txt, "=")
+		if len(key) == 0 {
+			continue
+		}
+
+		lower := strings.ToLower(key)
+		if seen[lower] {
+			continue
+		}
+		seen[lower] = true
+
+		if hasValue {
+			text[key] = value
+		} else {
+			flags = append(flags, key)
+		}
+	}
+
+	return
+}
+
+// CNAME returns the CNAME records for the aliases of the service's host name.
+func CNAME(srv Service) []*dns.CNAME {
+	var cnames []*dns.CNAME
+	for _, name := range srv.AliasNames() {
+		cname := &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+				Ttl:    TTLHostname,
+			},
+			Target: srv.Hostname(),
+		}
+		cnames = append(cnames, cname)
+	}
+
+	return cnames
+}
+
 // NSEC returns the NSEC record for the service.
 func NSEC(rr dns.RR, srv Service, iface *net.Interface) *dns.NSEC {
 	if iface != nil && !srv.IsVisibleAtInterface(iface.Name) {
@@ -125,6 +187,86 @@ func NSEC(rr dns.RR, srv Service, iface *net.Interface) *dns.NSEC {
 	return nil
 }
 
+// nsecRecords returns the NSEC records for the unique names of srv at iface
+// by lowercased name. Each record lists exactly the types which exist for its
+// name, so that queriers can cache the nonexistence of all other types. (RFC6762 6.1)
+// The service name is shared with other responders and is never covered.
+func nsecRecords(srv Service, iface *net.Interface) map[string]*dns.NSEC {
+	if iface != nil && !srv.IsVisibleAtInterface(iface.Name) {
+		return nil
+	}
+
+	nsec := func(name string, types ...uint16) *dns.NSEC {
+		return &dns.NSEC{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeNSEC,
+				Class:  dns.ClassINET,
+				Ttl:    TTLDefault,
+			},
+			NextDomain: name,
+			TypeBitMap: types,
+		}
+	}
+
+	instance := srv.EscapedServiceInstanceName()
+	nsecs := map[string]*dns.NSEC{
+		strings.ToLower(instance): nsec(instance, dns.TypeTXT, dns.TypeSRV),
+	}
+
+	var hostTypes []uint16
+	ips := srv.IPsAtInterface(iface)
+	if includesIPv4(ips) {
+		hostTypes = append(hostTypes, dns.TypeA)
+	}
+	if includesIPv6(ips) {
+		hostTypes = append(hostTypes, dns.TypeAAAA)
+	}
+	// The host names only exist, if they have addresses at the interface.
+	if len(hostTypes) > 0 {
+		nsecs[strings.ToLower(srv.Hostname())] = nsec(srv.Hostname(), hostTypes...)
+		for _, name := range srv.HostNames() {
+			nsecs[strings.ToLower(name)] = nsec(name, hostTypes...)
+		}
+	}
+
+	for _, name := range srv.AliasNames() {
+		nsecs[strings.ToLower(name)] = nsec(name, dns.TypeCNAME)
+	}
+
+	return nsecs
+}
+
+// referencedNSEC returns the records of nsecs, whose names are owned by or referenced in rrs.
+func referencedNSEC(rrs []dns.RR, nsecs map[string]*dns.NSEC) []dns.RR {
+	var names []string
+	for _, rr := range rrs {
+		names = append(names, rr.Header().Name)
+		switch r := rr.(type) {
+		case *dns.PTR:
+			names = append(names, r.Ptr)
+		case *dns.SRV:
+			names = append(names, r.Target)
+		case *dns.CNAME:
+			names = append(names, r.Target)
+		}
+	}
+
+	var result []dns.RR
+	seen := map[string]bool{}
+	for _, name := range names {
+		key := strings.ToLower(name)
+		nsec, ok := nsecs[key]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, nsec)
+	}
+
+	return result
+}
+
 // A returns the A records (IPv4 addresses) for the service.
 func A(srv Service, iface *net.Interface) []*dns.A {
 	if iface == nil {
@@ -187,6 +329,40 @@ func AAAA(srv Service, iface *net.Interface) []*dns.AAAA {
 	return aaaas
 }
 
+// addressRecords returns the A and AAAA records of the service at iface.
+func addressRecords(srv Service, iface *net.Interface) []dns.RR {
+	var rrs []dns.RR
+	for _, a := range A(srv, iface) {
+		rrs = append(rrs, a)
+	}
+	for _, aaaa := range AAAA(srv, iface) {
+		rrs = append(rrs, aaaa)
+	}
+
+	return rrs
+}
+
+// extraAddressRecords returns the address records of the additional host names
+// of srv at iface by lowercased name. They have the addresses of the host name.
+func extraAddressRecords(srv Service, iface *net.Interface) map[string][]dns.RR {
+	rrs := addressRecords(srv, iface)
+	if len(rrs) == 0 || len(srv.Hosts) == 0 {
+		return nil
+	}
+
+	m := map[string][]dns.RR{}
+	for _, name := range srv.HostNames() {
+		named := make([]dns.RR, len(rrs))
+		for i, rr := range rrs {
+			named[i] = dns.Copy(rr)
+			named[i].Header().Name = name
+		}
+		m[strings.ToLower(name)] = named
+	}
+
+	return m
+}
+
 func splitRecords(records []dns.RR) (as []*dns.A, aaaas []*dns.AAAA, srvs []*dns.SRV) {
 	for _, record := range records {
 		switch rr := record.(type) {
@@ -229,30 +405,16 @@ func includesIPv6(ips []net.IP) bool {
 }
 
 // Removes this from that.
+// A record in that is only removed, if this contains the same record
+// with at least half of its TTL. (RFC6762 7.1)
 func remove(this []dns.RR, that []dns.RR) []dns.RR {
 	var result []dns.RR
 	for _, thatRr := range that {
 		isUnknown := true
 		for _, thisRr := range this {
-			switch a := thisRr.(type) {
-			case *dns.PTR:
-				if ptr, ok := thatRr.(*dns.PTR); ok {
-					if a.Ptr == ptr.Ptr && a.Hdr.Name == ptr.Hdr.Name && a.Hdr.Ttl > ptr.Hdr.Ttl/2 {
-						isUnknown = false
-					}
-				}
-			case *dns.SRV:
-				if srv, ok := thatRr.(*dns.SRV); ok {
-					if a.Target == srv.Target && a.Port == srv.Port && a.Hdr.Name == srv.Hdr.Name && a.Hdr.Ttl > srv.Hdr.Ttl/2 {
-						isUnknown = false
-					}
-				}
-			case *dns.TXT:
-				if txt, ok := thatRr.(*dns.TXT); ok {
-					if reflect.DeepEqual(a.Txt, txt.Txt) && a.Hdr.Ttl > txt.Hdr.Ttl/2 {
-						isUnknown = false
-					}
-				}
+			if isKnownAnswer(thisRr, thatRr) {
+				isUnknown = false
+				break
 			}
 		}
 
@@ -264,6 +426,73 @@ func remove(this []dns.RR, that []dns.RR) []dns.RR {
 	return result
 }
 
+// isKnownAnswer returns true, if known is the same record as rr and
+// its TTL is at least half of the TTL of rr. Otherwise rr must be answered
+// again, so that the cache of the querier is refreshed. (RFC6762 7.1)
+// Names are compared case-insensitively and the cache-flush bit is ignored.
+func isKnownAnswer(known dns.RR, rr dns.RR) bool {
+	if 2*uint64(known.Header().Ttl) < uint64(rr.Header().Ttl) {
+		return false
+	}
+
+	return dns.IsDuplicate(withoutCacheFlushBit(known), withoutCacheFlushBit(rr))
+}
+
+// withoutCacheFlushBit returns a copy of rr without the cache-flush bit.
+func withoutCacheFlushBit(rr dns.RR) dns.RR {
+	if rr.Header().Class&(1<<15) == 0 {
+		return rr
+	}
+
+	cp := dns.Copy(rr)
+	cp.Header().Class &^= (1 << 15)
+	return cp
+}
+
+// trimMsg removes records from the additional section of msg,
+// until the packed message is not larger than size.
+// Additional records are optional and can be requested by the receiver.
+func trimMsg(msg *dns.Msg, size int) {
+	for len(msg.Extra) > 0 && msg.Len() > size {
+		msg.Extra = msg.Extra[:len(msg.Extra)-1]
+	}
+}
+
+// splitMsg splits msg into messages which are not larger than size.
+// The answers are distributed across the messages; questions and authority records
+// are only included in the first message. Additional records are included in the
+// last message, as long as they fit.
+// Split queries have the TC bit set in all but the last message,
+// to indicate that more known answers follow. (RFC6762 7.2)
+func splitMsg(msg *dns.Msg, size int) []*dns.Msg {
+	if msg.Len() <= size {
+		return []*dns.Msg{msg}
+	}
+
+	msgs := []*dns.Msg{}
+	cur := &dns.Msg{MsgHdr: msg.MsgHdr, Compress: msg.Compress, Question: msg.Question, Ns: msg.Ns}
+	for _, rr := range msg.Answer {
+		cur.Answer = append(cur.Answer, rr)
+		if cur.Len() > size && len(cur.Answer) > 1 {
+			cur.Answer = cur.Answer[:len(cur.Answer)-1]
+			msgs = append(msgs, cur)
+			cur = &dns.Msg{MsgHdr: msg.MsgHdr, Compress: msg.Compress, Answer: []dns.RR{rr}}
+		}
+	}
+
+	cur.Extra = msg.Extra
+	trimMsg(cur, size)
+	msgs = append(msgs, cur)
+
+	if !msg.Response {
+		for i, m := range msgs {
+			m.Truncated = i < len(msgs)-1
+		}
+	}
+
+	return msgs
+}
+
 // mergeMsgs merges the records in msgs into one message.
 func mergeMsgs(msgs []*dns.Msg) *dns.Msg {
 	resp := new(dns.Msg)
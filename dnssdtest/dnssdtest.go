@@ -0,0 +1,217 @@
+// Package dnssdtest provides an in-memory network to test
+// mDNS responders and browsers without multicast sockets.
+//
+// Every connection of a network receives the multicast messages sent by
+// the other connections, and unicast responses sent to its address.
+// Messages are delivered at the network interface at which they were sent.
+//
+// Responders should be configured with DisableSubnetCheck and
+// services with explicit IPs, because the addresses of the connections
+// are not assigned to the network interfaces of the host.
+package dnssdtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/brutella/dnssd"
+	"github.com/miekg/dns"
+)
+
+// Network is an in-memory multicast network.
+type Network struct {
+	mutex sync.Mutex
+	conns []*Conn
+	next  byte
+}
+
+// NewNetwork returns an empty network.
+func NewNetwork() *Network {
+	return &Network{next: 1}
+}
+
+// NewConn returns a new connection at the network. The connection has
+// the address 192.0.2.<n>:5353, where n is the number of the connection.
+func (n *Network) NewConn() *Conn {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	c := &Conn{
+		network: n,
+		addr:    &net.UDPAddr{IP: net.IP{192, 0, 2, n.next}, Port: 5353},
+		readers: map[*reader]struct{}{},
+	}
+	n.next++
+	n.conns = append(n.conns, c)
+
+	return c
+}
+
+// send delivers msg from the connection from to the other connections,
+// or only to the connection with the address to, if to is not nil.
+func (n *Network) send(from *Conn, msg *dns.Msg, to *net.UDPAddr, iface *net.Interface) {
+	n.mutex.Lock()
+	conns := append([]*Conn{}, n.conns...)
+	n.mutex.Unlock()
+
+	for _, c := range conns {
+		if c == from {
+			continue
+		}
+
+		if to != nil && !(c.addr.IP.Equal(to.IP) && c.addr.Port == to.Port) {
+			continue
+		}
+
+		c.receive(dnssd.NewRequest(msg.Copy(), from.addr, iface))
+	}
+}
+
+// remove removes the connection c from the network.
+func (n *Network) remove(c *Conn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for i, conn := range n.conns {
+		if conn == c {
+			n.conns = append(n.conns[:i], n.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// Conn is a connection at an in-memory network. It implements dnssd.MDNSConn.
+type Conn struct {
+	network *Network
+	addr    *net.UDPAddr
+
+	mutex   sync.Mutex
+	readers map[*reader]struct{}
+	closed  bool
+}
+
+// Addr returns the address of the connection.
+func (c *Conn) Addr() *net.UDPAddr {
+	return c.addr
+}
+
+// SendQuery sends a query to the other connections.
+func (c *Conn) SendQuery(q *dnssd.Query) error {
+	if c.isClosed() {
+		return fmt.Errorf("connection closed")
+	}
+
+	c.network.send(c, q.Raw(), nil, q.Iface())
+
+	return nil
+}
+
+// SendResponse sends a response to the other connections,
+// or to the receiver of a unicast response.
+func (c *Conn) SendResponse(resp *dnssd.Response) error {
+	if c.isClosed() {
+		return fmt.Errorf("connection closed")
+	}
+
+	c.network.send(c, resp.Raw(), resp.To(), resp.Iface())
+
+	return nil
+}
+
+// Read returns a channel, which receives messages until ctx is done.
+func (c *Conn) Read(ctx context.Context) <-chan *dnssd.Request {
+	r := &reader{
+		ctx:    ctx,
+		ch:     make(chan *dnssd.Request),
+		notify: make(chan struct{}, 1),
+	}
+
+	c.mutex.Lock()
+	c.readers[r] = struct{}{}
+	c.mutex.Unlock()
+
+	go func() {
+		r.run()
+		c.mutex.Lock()
+		delete(c.readers, r)
+		c.mutex.Unlock()
+	}()
+
+	return r.ch
+}
+
+// Drain does nothing, because messages are only
+// delivered to readers, which are reading.
+func (c *Conn) Drain(ctx context.Context) {}
+
+// Close removes the connection from the network.
+func (c *Conn) Close() {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+
+	c.network.remove(c)
+}
+
+func (c *Conn) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.closed
+}
+
+func (c *Conn) receive(req *dnssd.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for r := range c.readers {
+		r.push(req)
+	}
+}
+
+// reader queues received messages, so that sending never blocks.
+type reader struct {
+	ctx context.Context
+	ch  chan *dnssd.Request
+
+	mutex  sync.Mutex
+	queue  []*dnssd.Request
+	notify chan struct{}
+}
+
+func (r *reader) push(req *dnssd.Request) {
+	r.mutex.Lock()
+	r.queue = append(r.queue, req)
+	r.mutex.Unlock()
+
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *reader) run() {
+	for {
+		r.mutex.Lock()
+		if len(r.queue) == 0 {
+			r.mutex.Unlock()
+			select {
+			case <-r.notify:
+				continue
+			case <-r.ctx.Done():
+				return
+			}
+		}
+		req := r.queue[0]
+		r.queue = r.queue[1:]
+		r.mutex.Unlock()
+
+		select {
+		case r.ch <- req:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package dnssdtest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/brutella/dnssd"
+)
+
+func TestNetwork(t *testing.T) {
+	if len(dnssd.MulticastInterfaces()) == 0 {
+		t.Skip("no multicast interface")
+	}
+
+	network := NewNetwork()
+
+	sv, err := dnssd.NewService(dnssd.Config{
+		Name:      "Test",
+		Type:      "_asdf._tcp",
+		Host:      "Computer",
+		IPs:       []net.IP{net.IP{192, 0, 2, 1}},
+		Port:      1234,
+		SkipProbe: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rp := dnssd.NewResponderWithConn(network.NewConn(), dnssd.ResponderOptions{DisableSubnetCheck: true})
+	if _, err := rp.Add(sv); err != nil {
+		t.Fatal(err)
+	}
+	go rp.Respond(ctx)
+
+	added := make(chan dnssd.BrowseEntry, 1)
+	go dnssd.LookupTypeWithConn(ctx, network.NewConn(), sv.ServiceName(), func(e dnssd.BrowseEntry) {
+		added <- e
+	}, func(e dnssd.BrowseEntry) {})
+
+	select {
+	case e := <-added:
+		if is, want := e.Port, 1234; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+		if is, want := e.IPs[0].String(), "192.0.2.1"; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+
+	ch := clock.After(time.Second)
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case now := <-ch:
+		if is, want := now, start.Add(time.Second); !is.Equal(want) {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	if is, want := clock.Waiters(), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestAnnouncementsWithClock(t *testing.T) {
+	if len(dnssd.MulticastInterfaces()) == 0 {
+		t.Skip("no multicast interface")
+	}
+
+	network := NewNetwork()
+	clock := NewClock(time.Now())
+
+	sv, err := dnssd.NewService(dnssd.Config{
+		Name:      "Test",
+		Type:      "_asdf._tcp",
+		Host:      "Computer",
+		IPs:       []net.IP{net.IP{192, 0, 2, 1}},
+		Port:      1234,
+		SkipProbe: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ch := network.NewConn().Read(ctx)
+
+	rp := dnssd.NewResponderWithConn(network.NewConn(), dnssd.ResponderOptions{Clock: clock})
+	if _, err := rp.Add(sv); err != nil {
+		t.Fatal(err)
+	}
+	go rp.Respond(ctx)
+
+	n := len(dnssd.MulticastInterfaces())
+	receive := func() {
+		for i := 0; i < n; i++ {
+			select {
+			case <-ch:
+			case <-ctx.Done():
+				t.Fatal("timeout")
+			}
+		}
+	}
+
+	// first announcement
+	receive()
+
+	for clock.Waiters() < n {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+
+	// second announcement
+	receive()
+}
@@ -0,0 +1,159 @@
+package dnssd
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// EDNS0OWNER is the code of the EDNS0 owner option,
+// which is used by sleep proxies. (draft-cheshire-edns0-owner-option)
+const EDNS0OWNER = 4
+
+// EDNS0UDPSize is the receive buffer size advertised in outgoing messages.
+var EDNS0UDPSize uint16 = 9000
+
+// optLen is the length of an OPT record without options.
+const optLen = 11
+
+// Owner is the EDNS0 owner option of a message.
+type Owner struct {
+	// Version of the option.
+	Version uint8
+
+	// Seq is incremented by the owner every time it wakes up.
+	Seq uint8
+
+	// PrimaryMAC is the hardware address of the interface
+	// on which the owner registered the records.
+	PrimaryMAC net.HardwareAddr
+
+	// WakeupMAC is the hardware address used to wake up the owner.
+	// It is the same as PrimaryMAC, if not specified.
+	WakeupMAC net.HardwareAddr
+
+	// Password is the optional wakeup password (4 or 6 bytes).
+	Password []byte
+}
+
+// EDNS0 returns the owner as EDNS0 option.
+func (o Owner) EDNS0() dns.EDNS0 {
+	data := []byte{o.Version, o.Seq}
+	data = append(data, o.PrimaryMAC...)
+	if len(o.WakeupMAC) > 0 || len(o.Password) > 0 {
+		wakeup := o.WakeupMAC
+		if len(wakeup) == 0 {
+			wakeup = o.PrimaryMAC
+		}
+		data = append(data, wakeup...)
+		data = append(data, o.Password...)
+	}
+
+	return &dns.EDNS0_LOCAL{Code: EDNS0OWNER, Data: data}
+}
+
+// parseOwner parses the data of an owner option.
+func parseOwner(data []byte) (*Owner, error) {
+	switch len(data) {
+	case 8, 14, 18, 20:
+	default:
+		return nil, fmt.Errorf("invalid owner option length %d", len(data))
+	}
+
+	o := &Owner{
+		Version:    data[0],
+		Seq:        data[1],
+		PrimaryMAC: net.HardwareAddr(data[2:8]),
+	}
+
+	if len(data) > 8 {
+		o.WakeupMAC = net.HardwareAddr(data[8:14])
+		o.Password = data[14:]
+	}
+
+	return o, nil
+}
+
+// UDPSize returns the receive buffer size advertised by the sender.
+// If the message has no OPT record, 0 is returned.
+func (r Request) UDPSize() uint16 {
+	if opt := r.msg.IsEdns0(); opt != nil {
+		return opt.UDPSize()
+	}
+
+	return 0
+}
+
+// Owner returns the owner option of the request, or nil if there is none.
+func (r Request) Owner() *Owner {
+	opt := r.msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, o := range opt.Option {
+		var data []byte
+		switch e := o.(type) {
+		case *dns.EDNS0_LOCAL:
+			if e.Code != EDNS0OWNER {
+				continue
+			}
+			data = e.Data
+		case *dns.EDNS0_ESU:
+			// miekg/dns unpacks the option code 4 as ENUM Source-URI.
+			data = []byte(e.Uri)
+		default:
+			continue
+		}
+
+		if owner, err := parseOwner(data); err == nil {
+			return owner
+		}
+	}
+
+	return nil
+}
+
+// withEDNS0 returns msg with an OPT record, which advertises our receive buffer size.
+// If msg has no OPT record, a copy is returned so that msg is not modified.
+func withEDNS0(msg *dns.Msg) *dns.Msg {
+	if msg.IsEdns0() != nil {
+		return msg
+	}
+
+	m := new(dns.Msg)
+	*m = *msg
+	m.Extra = append([]dns.RR(nil), msg.Extra...)
+	m.SetEdns0(EDNS0UDPSize, false)
+
+	return m
+}
+
+// withoutOPT returns rrs without OPT pseudo-records.
+func withoutOPT(rrs []dns.RR) []dns.RR {
+	var result []dns.RR
+	for _, rr := range rrs {
+		if _, ok := rr.(*dns.OPT); !ok {
+			result = append(result, rr)
+		}
+	}
+
+	return result
+}
+
+// isLocalHardwareAddr returns true, if addr is the hardware address of a local network interface.
+func isLocalHardwareAddr(addr net.HardwareAddr) bool {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return false
+	}
+
+	for _, iface := range ifaces {
+		if len(iface.HardwareAddr) > 0 && iface.HardwareAddr.String() == addr.String() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package dnssd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestOwnerOption(t *testing.T) {
+	owner := Owner{
+		Version:    0,
+		Seq:        3,
+		PrimaryMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		Password:   []byte{1, 2, 3, 4},
+	}
+
+	msg := new(dns.Msg)
+	msg.SetEdns0(1440, false)
+	opt := msg.IsEdns0()
+	opt.Option = append(opt.Option, owner.EDNS0())
+
+	buf, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unpacked := new(dns.Msg)
+	if err := unpacked.Unpack(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	req := Request{msg: unpacked}
+	if is, want := req.UDPSize(), uint16(1440); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	o := req.Owner()
+	if o == nil {
+		t.Fatal("owner option expected")
+	}
+
+	if is, want := o.Seq, owner.Seq; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := o.PrimaryMAC.String(), owner.PrimaryMAC.String(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// wakeup address defaults to primary address
+	if is, want := o.WakeupMAC.String(), owner.PrimaryMAC.String(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(o.Password), 4; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestRequestWithoutOPT(t *testing.T) {
+	req := Request{msg: new(dns.Msg)}
+	if is, want := req.UDPSize(), uint16(0); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if req.Owner() != nil {
+		t.Fatal("unexpected owner option")
+	}
+}
+
+func TestWithEDNS0(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Extra = make([]dns.RR, 0, 1)
+
+	m := withEDNS0(msg)
+	if m.IsEdns0() == nil {
+		t.Fatal("expected OPT record")
+	}
+
+	// The message of the caller is not modified, not even the spare capacity of its records.
+	if msg.IsEdns0() != nil || msg.Extra[:1][0] != nil {
+		t.Fatal("unexpected OPT record in original message")
+	}
+
+	if withEDNS0(m) != m {
+		t.Fatal("expected message with OPT record to be returned")
+	}
+}
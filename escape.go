@@ -0,0 +1,74 @@
+package dnssd
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// EscapeInstanceName returns the instance name name as DNS label in presentation format.
+// Dots and backslashes are escaped with a backslash, as well as characters
+// which have a special meaning in the presentation format. Control characters
+// are escaped as "\DDD". UTF-8 characters are kept. (RFC6763 4.3)
+func EscapeInstanceName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '.' || c == '\\' || c == ' ' || c == '\'' || c == '@' || c == ';' || c == '(' || c == ')' || c == '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			b.WriteByte('\\')
+			b.WriteByte('0' + c/100)
+			b.WriteByte('0' + c/10%10)
+			b.WriteByte('0' + c%10)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// UnescapeInstanceName returns the escaped instance name s without escape characters.
+// Decimal escapes in the form of "\DDD" are replaced by the byte they denote,
+// which restores UTF-8 characters escaped by other implementations. (RFC1035 5.1)
+func UnescapeInstanceName(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			b.WriteByte(c)
+			continue
+		}
+
+		if i+3 < len(s) && isDigit(rune(s[i+1])) && isDigit(rune(s[i+2])) && isDigit(rune(s[i+3])) {
+			if n := int(s[i+1]-'0')*100 + int(s[i+2]-'0')*10 + int(s[i+3]-'0'); n <= 255 {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+
+		b.WriteByte(s[i+1])
+		i++
+	}
+
+	return b.String()
+}
+
+// canonicalName returns the domain name name with consistently escaped labels,
+// so that names escaped by different implementations can be compared.
+func canonicalName(name string) string {
+	labels := dns.SplitDomainName(name)
+	for i, label := range labels {
+		labels[i] = EscapeInstanceName(UnescapeInstanceName(label))
+	}
+
+	return strings.Join(labels, ".") + "."
+}
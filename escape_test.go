@@ -0,0 +1,85 @@
+package dnssd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestEscapeInstanceName(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Escaped string
+	}{
+		{"Test", "Test"},
+		{"Home Printer v1.0", "Home\\ Printer\\ v1\\.0"},
+		{"back\\slash", "back\\\\slash"},
+		{"tab\t", "tab\\009"},
+		{"Café", "Café"},
+	}
+
+	for _, test := range tests {
+		if is, want := EscapeInstanceName(test.Name), test.Escaped; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+
+		if is, want := UnescapeInstanceName(test.Escaped), test.Name; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+
+	if is, want := UnescapeInstanceName("Caf\\195\\169"), "Café"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestInstanceNameRoundTrip(t *testing.T) {
+	name := "Café \"Printer\" 1.0 \\ (2nd floor)"
+	sv, err := NewService(Config{
+		Name: name,
+		Type: "_ipp._tcp",
+		Host: "Computer",
+		Port: 631,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{PTR(sv), SRV(sv), TXT(sv)}
+	for _, a := range A(sv, testIface) {
+		msg.Answer = append(msg.Answer, a)
+	}
+
+	// Send the message over the wire.
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := new(dns.Msg)
+	if err := in.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCache()
+	cache.UpdateFrom(&Request{msg: in, iface: testIface})
+
+	services := cache.Services()
+	if is, want := len(services), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	srv := services[0]
+	if is, want := srv.Name, name; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srv.Port, 631; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
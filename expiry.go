@@ -0,0 +1,61 @@
+package dnssd
+
+import (
+	"time"
+)
+
+// expiryTimer fires when the next service of a cache expires, so that
+// expired services are removed even if no messages are received.
+type expiryTimer struct {
+	cache *Cache
+
+	// C receives a value when the service expires, which expires at at.
+	C  <-chan time.Time
+	at time.Time
+}
+
+// reset starts the timer for the next expiration of the cached services,
+// if the timer is not already running for it.
+func (t *expiryTimer) reset() {
+	at, ok := t.cache.nextExpiration()
+	if !ok {
+		t.C = nil
+		return
+	}
+
+	if t.C != nil && at.Equal(t.at) {
+		return
+	}
+
+	// Services expire after their expiration time.
+	t.at = at
+	t.C = t.cache.clock.After(at.Sub(t.cache.clock.Now()) + time.Millisecond)
+}
+
+// expire removes the expired services from the cache and returns their events.
+// The timer must be reset afterwards.
+func (t *expiryTimer) expire() []CacheEvent {
+	t.C = nil
+
+	return t.cache.expireDelta()
+}
+
+// nextExpiration returns the earliest expiration time of the cached services
+// and negative entries. The returned time may be earlier, if an expiration was extended.
+func (c *Cache) nextExpiration() (time.Time, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.next, !c.next.IsZero()
+}
+
+// expireDelta removes the expired services and returns the remove events.
+func (c *Cache) expireDelta() []CacheEvent {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	events := c.events(nil, nil, c.removeExpired())
+	c.publish(events)
+
+	return events
+}
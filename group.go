@@ -0,0 +1,305 @@
+package dnssd
+
+import (
+	"fmt"
+	"sync"
+)
+
+// GroupState is the registration state of a service group.
+type GroupState int
+
+const (
+	// GroupUncommitted means that the services of the group are not committed yet.
+	GroupUncommitted GroupState = iota
+
+	// GroupRegistering means that the services of the group are being probed.
+	GroupRegistering
+
+	// GroupEstablished means that all services of the group are registered and announced.
+	GroupEstablished
+
+	// GroupFailed means that the services of the group could not be registered.
+	GroupFailed
+)
+
+func (s GroupState) String() string {
+	switch s {
+	case GroupUncommitted:
+		return "Uncommitted"
+	case GroupRegistering:
+		return "Registering"
+	case GroupEstablished:
+		return "Established"
+	case GroupFailed:
+		return "Failed"
+	default:
+		return "Unknown"
+	}
+}
+
+// GroupStateFunc is called when the state of a service group changes.
+// The function is called synchronously and must not block.
+type GroupStateFunc func(GroupState)
+
+// ServiceGroup is a set of services, which are registered, updated and
+// withdrawn together, like an entry group of Avahi.
+type ServiceGroup struct {
+	rp Responder
+	fn GroupStateFunc
+
+	mutex   sync.Mutex
+	srvs    []Service
+	handles []ServiceHandle
+
+	// stateMutex protects the state, which is changed by
+	// the status functions of the services.
+	stateMutex sync.Mutex
+	state      GroupState
+	registered []bool
+	// gen is incremented when the group is withdrawn,
+	// to ignore status events of withdrawn services.
+	gen int
+}
+
+// NewServiceGroup returns an empty service group, whose services are added
+// to rp. The function fn is called when the state of the group changes.
+// If rp doesn't implement ResponderControl, like the responders of this
+// package do, the services are added and removed one after another.
+func NewServiceGroup(rp Responder, fn GroupStateFunc) *ServiceGroup {
+	return &ServiceGroup{rp: rp, fn: fn}
+}
+
+// Add adds srv to the group. Services can only be added
+// before the group is committed.
+func (g *ServiceGroup) Add(srv Service) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.handles != nil {
+		return fmt.Errorf("service group is already committed")
+	}
+
+	g.stateMutex.Lock()
+	i, gen := len(g.srvs), g.gen
+	g.stateMutex.Unlock()
+
+	statusFn := srv.statusFn
+	srv.statusFn = func(e StatusEvent) {
+		if statusFn != nil {
+			statusFn(e)
+		}
+		g.statusChanged(gen, i, e.Status)
+	}
+	g.srvs = append(g.srvs, srv)
+
+	return nil
+}
+
+// Commit adds the services of the group to the responder.
+// The services are probed together and announced at once.
+func (g *ServiceGroup) Commit() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.handles != nil {
+		return fmt.Errorf("service group is already committed")
+	}
+
+	if len(g.srvs) == 0 {
+		return fmt.Errorf("service group is empty")
+	}
+
+	g.stateMutex.Lock()
+	g.registered = make([]bool, len(g.srvs))
+	g.setState(GroupRegistering)
+	g.stateMutex.Unlock()
+
+	hs, err := g.addAll()
+	if err != nil {
+		g.stateMutex.Lock()
+		g.setState(GroupFailed)
+		g.stateMutex.Unlock()
+		return err
+	}
+	g.handles = hs
+
+	return nil
+}
+
+// UpdateText replaces the TXT records of the committed services.
+// The TXT records of the i-th added service are replaced by texts[i],
+// unless texts[i] is nil. No TXT records are replaced, if any of them
+// can't be published as TXT record. If the services are added to a responder
+// of this package, the new TXT records of all services are announced with one
+// message per network interface.
+func (g *ServiceGroup) UpdateText(texts []map[string]string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.handles == nil {
+		return fmt.Errorf("service group is not committed")
+	}
+
+	if len(texts) != len(g.handles) {
+		return fmt.Errorf("%d TXT records for %d services", len(texts), len(g.handles))
+	}
+
+	for i, text := range texts {
+		if text == nil {
+			continue
+		}
+
+		if err := validateText(text, g.srvs[i].TextFlags); err != nil {
+			return err
+		}
+	}
+
+	var hs []*serviceHandle
+	var changed []map[string]string
+	for i, text := range texts {
+		if text == nil {
+			continue
+		}
+
+		h, ok := g.handles[i].(*serviceHandle)
+		if !ok || (len(hs) > 0 && h.responder != hs[0].responder) {
+			hs = nil
+			break
+		}
+		hs = append(hs, h)
+		changed = append(changed, text)
+	}
+
+	if len(hs) > 0 {
+		return hs[0].responder.updateTexts(hs, changed)
+	}
+
+	for i, text := range texts {
+		if text == nil {
+			continue
+		}
+
+		if err := g.handles[i].SetText(text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addAll adds the services of the group to the responder.
+func (g *ServiceGroup) addAll() ([]ServiceHandle, error) {
+	if rc, ok := g.rp.(ResponderControl); ok {
+		return rc.AddAll(g.srvs)
+	}
+
+	var hs []ServiceHandle
+	for _, srv := range g.srvs {
+		h, err := g.rp.Add(srv)
+		if err != nil {
+			for _, h := range hs {
+				g.rp.Remove(h)
+			}
+			return nil, err
+		}
+		hs = append(hs, h)
+	}
+
+	return hs, nil
+}
+
+// removeAll removes the committed services of the group from the responder.
+func (g *ServiceGroup) removeAll() {
+	if rc, ok := g.rp.(ResponderControl); ok {
+		rc.RemoveAll(g.handles)
+		return
+	}
+
+	for _, h := range g.handles {
+		g.rp.Remove(h)
+	}
+}
+
+// Withdraw removes the committed services from the responder and sends
+// goodbye packets for them at once. (RFC6762 10.1)
+// The group is empty and uncommitted afterwards.
+func (g *ServiceGroup) Withdraw() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.handles != nil {
+		g.removeAll()
+	}
+	g.srvs = nil
+	g.handles = nil
+
+	g.stateMutex.Lock()
+	g.gen++
+	g.registered = nil
+	g.setState(GroupUncommitted)
+	g.stateMutex.Unlock()
+}
+
+// Services returns the services of the group. The service instance
+// names and hostnames of committed services reflect any renaming during probing.
+func (g *ServiceGroup) Services() []Service {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.handles == nil {
+		return append([]Service{}, g.srvs...)
+	}
+
+	var srvs []Service
+	for _, h := range g.handles {
+		srvs = append(srvs, h.Service())
+	}
+
+	return srvs
+}
+
+// State returns the current state of the group.
+func (g *ServiceGroup) State() GroupState {
+	g.stateMutex.Lock()
+	defer g.stateMutex.Unlock()
+
+	return g.state
+}
+
+// statusChanged updates the state of the group, when the status of
+// the i-th service of the generation gen changes.
+func (g *ServiceGroup) statusChanged(gen, i int, status Status) {
+	g.stateMutex.Lock()
+	defer g.stateMutex.Unlock()
+
+	if gen != g.gen || i >= len(g.registered) {
+		return
+	}
+
+	switch status {
+	case StatusProbing, StatusConflictLost:
+		g.registered[i] = false
+		g.setState(GroupRegistering)
+	case StatusRegistered, StatusReannounced:
+		g.registered[i] = true
+		for _, ok := range g.registered {
+			if !ok {
+				return
+			}
+		}
+		g.setState(GroupEstablished)
+	}
+}
+
+// setState sets the state of the group and calls the state function,
+// if the state changed. It must be called with stateMutex locked.
+func (g *ServiceGroup) setState(state GroupState) {
+	if g.state == state {
+		return
+	}
+	g.state = state
+
+	if g.fn != nil {
+		g.fn(state)
+	}
+}
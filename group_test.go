@@ -0,0 +1,196 @@
+package dnssd
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServiceGroup(t *testing.T) {
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.isRunning = true
+
+	var states []GroupState
+	g := NewServiceGroup(r, func(s GroupState) {
+		states = append(states, s)
+	})
+
+	for _, name := range []string{"One", "Two"} {
+		sv, err := NewService(Config{
+			Name:      name,
+			Type:      "_asdf._tcp",
+			Host:      "Computer",
+			Port:      1234,
+			SkipProbe: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sv.ifaceIPs = map[string][]net.IP{
+			testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+		}
+
+		if err := g.Add(sv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := g.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := g.State(), GroupEstablished; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(r.managed), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	sv, _ := NewService(Config{Name: "Three", Type: "_asdf._tcp", Port: 1234})
+	if err := g.Add(sv); err == nil {
+		t.Fatal("expected error when adding to a committed group")
+	}
+
+	// Invalid TXT records don't update any service.
+	texts := []map[string]string{{"key": "value"}, {"": "value"}}
+	if err := g.UpdateText(texts); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if is := g.Services()[0].Text; len(is) != 0 {
+		t.Fatalf("unexpected TXT records %v", is)
+	}
+
+	g.Withdraw()
+
+	if is, want := len(r.managed), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := states, []GroupState{GroupRegistering, GroupEstablished, GroupUncommitted}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestServiceGroupUpdateText(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.isRunning = true
+	r.announcements = 1
+
+	g := NewServiceGroup(r, nil)
+	for _, name := range []string{"One", "Two"} {
+		sv, err := NewService(Config{
+			Name:      name,
+			Type:      "_asdf._tcp",
+			Host:      "Computer",
+			Port:      1234,
+			Ifaces:    []string{lo.Name},
+			Addrs:     []netip.Addr{netip.MustParseAddr("192.168.0.123")},
+			SkipProbe: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := g.Add(sv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := g.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ignore the announcements of the services.
+	for drained := false; !drained; {
+		select {
+		case <-conn.out:
+		case <-time.After(100 * time.Millisecond):
+			drained = true
+		}
+	}
+
+	texts := []map[string]string{{"key": "one"}, {"key": "two"}}
+	if err := g.UpdateText(texts); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TXT records of both services are announced in one message.
+	select {
+	case msg := <-conn.out:
+		if is, want := len(msg.Answer), 2; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	select {
+	case <-conn.out:
+		t.Fatal("unexpected message")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// minimalResponder implements Responder, but not ResponderControl.
+type minimalResponder struct {
+	*responder
+}
+
+func (r minimalResponder) Add(srv Service) (ServiceHandle, error) {
+	return r.responder.Add(srv)
+}
+
+func (r minimalResponder) Remove(h ServiceHandle) {
+	r.responder.Remove(h)
+}
+
+func (r minimalResponder) Respond(ctx context.Context) error {
+	return r.responder.Respond(ctx)
+}
+
+func (r minimalResponder) Debug(ctx context.Context, fn ReadFunc) {
+	r.responder.Debug(ctx, fn)
+}
+
+func TestServiceGroupWithResponder(t *testing.T) {
+	r := newResponder(newTestConn())
+	g := NewServiceGroup(minimalResponder{r}, nil)
+
+	for _, name := range []string{"One", "Two"} {
+		sv, err := NewService(Config{Name: name, Type: "_asdf._tcp", Port: 1234})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := g.Add(sv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The services are added one after another.
+	if err := g.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(r.unmanaged), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	g.Withdraw()
+
+	if is, want := len(r.unmanaged), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
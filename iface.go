@@ -0,0 +1,136 @@
+package dnssd
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ExcludeInterfaceFunc returns true, if a multicast network interface is not
+// used unless it is specified explicitly, e.g. in Config.Ifaces. By default,
+// virtual interfaces are excluded (see IsVirtualInterface). Set it to nil
+// to use all multicast interfaces. Responders join the multicast groups at
+// excluded interfaces, when services are added which specify them.
+var ExcludeInterfaceFunc func(iface net.Interface) bool = IsVirtualInterface
+
+// virtualInterfacePrefixes are the name prefixes of network interfaces, which are
+// created by container runtimes, hypervisors and VPNs, e.g. docker0 or tailscale0.
+var virtualInterfacePrefixes = []string{
+	"docker", "br-", "veth", "cni", "flannel", "cali", "podman", "lxcbr", "lxdbr",
+	"virbr", "vnet", "vmnet", "vboxnet",
+	"tailscale", "zt", "wg", "tun", "tap", "utun", "ipsec",
+}
+
+// IsVirtualInterface returns true, if iface is a point-to-point interface, or if its
+// name is one of a container bridge, virtual ethernet device, hypervisor network
+// or VPN tunnel. Services announced at these interfaces are not reachable from
+// the local network, or are reported a second time by LAN clients.
+func IsVirtualInterface(iface net.Interface) bool {
+	if iface.Flags&net.FlagPointToPoint != 0 {
+		return true
+	}
+
+	name := strings.ToLower(iface.Name)
+	for _, prefix := range virtualInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifaceNameMatch returns true, if name is the name of a network interface,
+// which matches pattern, e.g. "eth0" or "en*" (see path.Match).
+func ifaceNameMatch(pattern, name string) bool {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return ifaceNameEqual(pattern, name)
+	}
+
+	if runtime.GOOS == "windows" {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	ok, _ := path.Match(pattern, name)
+
+	return ok
+}
+
+// isExcludedIface returns true, if iface is excluded by ExcludeInterfaceFunc
+// and not specified in filters.
+func isExcludedIface(iface net.Interface, filters []string) bool {
+	return len(filters) == 0 && ExcludeInterfaceFunc != nil && ExcludeInterfaceFunc(iface)
+}
+
+// validateIfaceIPs returns an error, if ips are not assigned
+// to the network interface with the name in the namespace.
+func (ns *netns) validateIfaceIPs(name string, ips []net.IP) error {
+	iface, err := ns.interfaceByName(name)
+	if err != nil {
+		return err
+	}
+
+	addrs, err := ns.addrs(iface)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		found := false
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not an address of interface %s", ip, name)
+		}
+	}
+
+	return nil
+}
+
+// filteredIfaces caches at which network interfaces the IfaceFilter of a service
+// selects the service, because looking up an interface by name is expensive and
+// visibility is checked for every received packet. A nil cache caches nothing.
+type filteredIfaces struct {
+	mutex   sync.Mutex
+	visible map[string]bool
+}
+
+// lookup returns the cached visibility at the network interface with name n,
+// or caches and returns the result of fn.
+func (f *filteredIfaces) lookup(n string, fn func() bool) bool {
+	if f == nil {
+		return fn()
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if visible, ok := f.visible[n]; ok {
+		return visible
+	}
+
+	if f.visible == nil {
+		f.visible = map[string]bool{}
+	}
+	visible := fn()
+	f.visible[n] = visible
+
+	return visible
+}
+
+// reset clears the cache, e.g. when the network interfaces changed.
+func (f *filteredIfaces) reset() {
+	if f == nil {
+		return
+	}
+
+	f.mutex.Lock()
+	f.visible = nil
+	f.mutex.Unlock()
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package dnssd
+
+// hasControlMessages is true, because the outgoing network interface
+// of a message is set with a control message.
+const hasControlMessages = true
+
+// ifaceNameEqual returns true, if a and b are names of the same network interface.
+func ifaceNameEqual(a, b string) bool {
+	return a == b
+}
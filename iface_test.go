@@ -0,0 +1,141 @@
+package dnssd
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsVirtualInterface(t *testing.T) {
+	tests := []struct {
+		iface net.Interface
+		want  bool
+	}{
+		{net.Interface{Name: "eth0", Flags: net.FlagUp | net.FlagMulticast}, false},
+		{net.Interface{Name: "en0", Flags: net.FlagUp | net.FlagMulticast}, false},
+		{net.Interface{Name: "br0", Flags: net.FlagUp | net.FlagMulticast}, false},
+		{net.Interface{Name: "docker0", Flags: net.FlagUp | net.FlagMulticast}, true},
+		{net.Interface{Name: "veth1a2b3c", Flags: net.FlagUp | net.FlagMulticast}, true},
+		{net.Interface{Name: "br-0123456789ab", Flags: net.FlagUp | net.FlagMulticast}, true},
+		{net.Interface{Name: "tailscale0", Flags: net.FlagUp | net.FlagMulticast}, true},
+		{net.Interface{Name: "ppp0", Flags: net.FlagUp | net.FlagMulticast | net.FlagPointToPoint}, true},
+	}
+
+	for _, test := range tests {
+		if is, want := IsVirtualInterface(test.iface), test.want; is != want {
+			t.Fatalf("%s: %v != %v", test.iface.Name, is, want)
+		}
+	}
+}
+
+func TestIsExcludedIface(t *testing.T) {
+	iface := net.Interface{Name: "docker0", Flags: net.FlagUp | net.FlagMulticast}
+
+	if is, want := isExcludedIface(iface, nil), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// Explicitly specified interfaces are used.
+	if is, want := isExcludedIface(iface, []string{"docker0"}), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	fn := ExcludeInterfaceFunc
+	defer func() { ExcludeInterfaceFunc = fn }()
+
+	ExcludeInterfaceFunc = nil
+	if is, want := isExcludedIface(iface, nil), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestIfaceNameMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"eth0", "eth0", true},
+		{"eth0", "eth1", false},
+		{"eth*", "eth1", true},
+		{"en*", "eth1", false},
+		{"wlan[0-9]", "wlan0", true},
+	}
+
+	for _, test := range tests {
+		if is, want := ifaceNameMatch(test.pattern, test.name), test.want; is != want {
+			t.Fatalf("%s %s: %v != %v", test.pattern, test.name, is, want)
+		}
+	}
+}
+
+func TestIsVisibleAtInterfaceFilter(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	srv, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, Ifaces: []string{"en*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := srv.IsVisibleAtInterface("en0"), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := srv.IsVisibleAtInterface("eth0"), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	srv, err = NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, IfaceFilter: func(iface net.Interface) bool {
+		return iface.Flags&net.FlagLoopback == 0
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := srv.IsVisibleAtInterface(lo.Name), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestIsVisibleAtInterfaceFilterCache(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	calls := 0
+	srv, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, IfaceFilter: func(iface net.Interface) bool {
+		calls++
+		return true
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The filter is resolved once per interface, after the service is added to a responder.
+	r := newResponder(newTestConn())
+	if _, err := r.Add(srv); err != nil {
+		t.Fatal(err)
+	}
+	h := r.unmanaged[0]
+
+	for i := 0; i < 2; i++ {
+		if is, want := h.service.IsVisibleAtInterface(lo.Name), true; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+
+	if is, want := calls, 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// The filter is resolved again, when the network interfaces change.
+	h.service.filtered.reset()
+	h.service.IsVisibleAtInterface(lo.Name)
+
+	if is, want := calls, 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,16 @@
+package dnssd
+
+import (
+	"strings"
+)
+
+// hasControlMessages is false, because the control messages of IPv4 and IPv6
+// packet connections are not implemented on Windows. The outgoing network interface
+// of multicast messages is set with IP_MULTICAST_IF or IPV6_MULTICAST_IF instead.
+const hasControlMessages = false
+
+// ifaceNameEqual returns true, if a and b are names of the same network interface.
+// Interface names are case-insensitive on Windows.
+func ifaceNameEqual(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
@@ -0,0 +1,73 @@
+package dnssd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestIfaceNameEqual(t *testing.T) {
+	if !ifaceNameEqual("Ethernet", "ethernet") {
+		t.Fatal("expected equal names")
+	}
+
+	if ifaceNameEqual("Ethernet", "Ethernet 2") {
+		t.Fatal("expected different names")
+	}
+}
+
+func TestMulticastInterfacesCaseInsensitive(t *testing.T) {
+	ifaces := MulticastInterfaces()
+	if len(ifaces) == 0 {
+		t.Skip("no multicast interface")
+	}
+
+	name := ifaces[0].Name
+	filtered := MulticastInterfaces(strings.ToUpper(name))
+	if is, want := len(filtered), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	sv := Service{Ifaces: []string{strings.ToLower(name)}}
+	if !sv.IsVisibleAtInterface(name) {
+		t.Fatal("expected service to be visible")
+	}
+
+	if is, want := len(sv.Interfaces()), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestSetMulticastInterface(t *testing.T) {
+	ifaces := MulticastInterfaces()
+	if len(ifaces) == 0 {
+		t.Skip("no multicast interface")
+	}
+	iface := ifaces[0]
+
+	conn, err := newMDNSConn(iface.Name)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.close()
+
+	if conn.ipv4 == nil {
+		t.Skip("no IPv4 connection")
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("Computer.local.", dns.TypeA)
+	if err := conn.writeMsgTo(msg, iface, AddrIPv4LinkLocalMulticast); err != nil {
+		t.Fatal(err)
+	}
+
+	mif, err := conn.ipv4.MulticastInterface()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := mif.Index, iface.Index; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
@@ -0,0 +1,265 @@
+package dnssd
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// linkDebounce is the time to wait for more network interface changes
+// before services are announced.
+const linkDebounce = 500 * time.Millisecond
+
+// groupJoiner is implemented by connections, which can join the
+// multicast groups at network interfaces which came up.
+type groupJoiner interface {
+	joinGroups(ifaces []*net.Interface)
+}
+
+// joinExcludedIfaces joins the multicast groups at the network interfaces of srvs,
+// which are excluded by ExcludeInterfaceFunc unless they are specified explicitly.
+// The connection doesn't join them by default, but queries and probe responses
+// must be received at every interface at which services are announced.
+func (r *responder) joinExcludedIfaces(srvs []Service) {
+	j, ok := r.conn.(groupJoiner)
+	if !ok {
+		return
+	}
+
+	var ifaces []*net.Interface
+	for _, srv := range srvs {
+		for _, iface := range srv.Interfaces() {
+			if isExcludedIface(*iface, nil) && !containsInterface(ifaces, iface) {
+				ifaces = append(ifaces, iface)
+			}
+		}
+	}
+
+	if len(ifaces) > 0 {
+		j.joinGroups(ifaces)
+	}
+}
+
+// containsInterface returns true, if ifaces contains iface.
+func containsInterface(ifaces []*net.Interface, iface *net.Interface) bool {
+	for _, i := range ifaces {
+		if i.Index == iface.Index {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchLinks calls linkUpdate after events are received.
+// Events which are received within a short time are handled together.
+func (r *responder) watchLinks(ctx context.Context, events <-chan struct{}) {
+	r.mutex.Lock()
+	r.upIfaces = linkState(r.netns)
+	r.mutex.Unlock()
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-events:
+			if timer == nil {
+				timer = r.clock.After(linkDebounce)
+			}
+		case <-timer:
+			timer = nil
+			r.linkUpdate()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// linkState returns the addresses of the multicast network interfaces in ns by name.
+func linkState(ns *netns) map[string]string {
+	state := map[string]string{}
+	for _, iface := range ns.multicastInterfaces() {
+		var addrs []string
+		if as, err := ns.addrs(iface); err == nil {
+			for _, a := range as {
+				addrs = append(addrs, a.String())
+			}
+		}
+		sort.Strings(addrs)
+		state[iface.Name] = strings.Join(addrs, ",")
+	}
+
+	return state
+}
+
+// linkUpdate compares the current network interfaces with the previous ones.
+// Services are probed and announced at interfaces which came up or whose addresses
+// changed (RFC6762 8), and goodbye packets are sent at interfaces which went down.
+func (r *responder) linkUpdate() {
+	state := linkState(r.netns)
+
+	r.mutex.Lock()
+	prev := r.upIfaces
+	r.upIfaces = state
+	temporaryAddrs.reset()
+	var hs []*serviceHandle
+	var srvs []*Service
+	for _, h := range r.managed {
+		// The addresses and interfaces of the services may have changed.
+		h.resetRecords()
+		h.service.filtered.reset()
+		hs = append(hs, h)
+		srvs = append(srvs, h.service.Copy())
+	}
+	r.mutex.Unlock()
+
+	var changed []*net.Interface
+	for name, addrs := range state {
+		if prevAddrs, ok := prev[name]; ok && prevAddrs == addrs {
+			continue
+		}
+
+		iface, err := r.netns.interfaceByName(name)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := prev[name]; ok {
+			r.logger.Debug("Interface addresses changed", "iface", name, "addrs", addrs)
+		} else {
+			r.logger.Debug("Interface is up", "iface", name, "addrs", addrs)
+		}
+		changed = append(changed, iface)
+	}
+
+	if j, ok := r.conn.(groupJoiner); ok && len(changed) > 0 {
+		j.joinGroups(changed)
+	}
+
+	for _, iface := range changed {
+		var probe []*serviceHandle
+		var probeSrvs []Service
+		for i, srv := range srvs {
+			// Services in maintenance are not announced (see announce).
+			if srv.maintenance == MaintenanceOff && srv.IsVisibleAtInterface(iface.Name) {
+				probe = append(probe, hs[i])
+				probeSrvs = append(probeSrvs, *srv)
+			}
+		}
+
+		if len(probe) > 0 {
+			go r.probeAtInterface(probe, probeSrvs, iface)
+		}
+	}
+
+	for name := range prev {
+		if _, ok := state[name]; ok {
+			continue
+		}
+
+		r.logger.Debug("Interface is down", "iface", name)
+		iface, err := r.netns.interfaceByName(name)
+		if err != nil {
+			// The interface is gone.
+			continue
+		}
+
+		var rrs []dns.RR
+		for _, srv := range srvs {
+			if srv.IsVisibleAtInterface(name) {
+				rr := PTR(*srv)
+				rr.Header().Ttl = 0
+				rrs = append(rrs, rr)
+			}
+		}
+
+		if len(rrs) > 0 {
+			go r.sendGoodbye(rrs, iface)
+		}
+	}
+}
+
+// probeAtInterface probes for the names of the services srvs of the handles hs
+// at iface before they are announced there. (RFC6762 8)
+// Services whose names are used by another host are reprobed like after a conflict.
+func (r *responder) probeAtInterface(hs []*serviceHandle, srvs []Service, iface *net.Interface) {
+	ctx, cancel := r.probeContext()
+	defer cancel()
+
+	// Only probe at iface.
+	candidates := make([]Service, len(srvs))
+	for i, srv := range srvs {
+		candidate := srv.Copy()
+		candidate.Ifaces = []string{iface.Name}
+		candidates[i] = *candidate
+	}
+
+	r.logger.Debug("Probing at interface", "iface", iface.Name, "services", srvs)
+	probed, err := ProbeServicesWithConfig(ctx, candidates, r.probeConfig)
+	if err != nil {
+		r.logger.Debug("Probing at interface failed", "iface", iface.Name, "err", err)
+		return
+	}
+
+	r.mutex.Lock()
+	for i, srv := range probed {
+		h := hs[i]
+		if !r.isManaged(h) {
+			// The service was removed or is already reprobed.
+			continue
+		}
+
+		if isRenamed(srv, srvs[i]) {
+			r.logger.Debug("Reprobe", "service", srvs[i].ServiceInstanceName(), "iface", iface.Name)
+			r.loseConflict(h)
+			continue
+		}
+
+		go r.announceAtInterface(&srvs[i], iface)
+	}
+	r.unlock()
+}
+
+// sendGoodbye sends the goodbye records rrs at iface twice. (RFC6762 10.1)
+func (r *responder) sendGoodbye(rrs []dns.RR, iface *net.Interface) {
+	msg := new(dns.Msg)
+	msg.Answer = rrs
+	msg.Response = true
+	msg.Authoritative = true
+	resp := &Response{msg: msg, iface: iface}
+	if err := r.sendResponse(nil, resp); err != nil {
+		r.logger.Debug("1st goodbye failed", "iface", iface.Name, "err", err)
+	}
+	sleep(r.clock, 250*time.Millisecond)
+	if err := r.sendResponse(nil, resp); err != nil {
+		r.logger.Debug("2nd goodbye failed", "iface", iface.Name, "err", err)
+	}
+}
+
+// joinGroups joins the mDNS multicast groups at ifaces.
+func (c *mdnsConn) joinGroups(ifaces []*net.Interface) {
+	for _, iface := range ifaces {
+		if c.ipv4 != nil {
+			if err := c.ipv4.JoinGroup(iface, &net.UDPAddr{IP: c.addr4.IP}); err != nil {
+				c.logger.Debug("Joining IPv4 group failed", "iface", iface.Name, "err", err)
+			}
+		}
+
+		if c.ipv6 != nil {
+			if err := c.ipv6.JoinGroup(iface, &net.UDPAddr{IP: c.addr6.IP}); err != nil {
+				c.logger.Debug("Joining IPv6 group failed", "iface", iface.Name, "err", err)
+			}
+		}
+	}
+}
+
+// notifyLink sends an event to events without blocking.
+func notifyLink(events chan<- struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
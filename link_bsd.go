@@ -0,0 +1,63 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package dnssd
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"golang.org/x/net/route"
+)
+
+// linkSubscribe subscribes to network interface updates via a routing socket.
+func (r *responder) linkSubscribe(ctx context.Context) {
+	fd, err := syscall.Socket(syscall.AF_ROUTE, syscall.SOCK_RAW, syscall.AF_UNSPEC)
+	if err != nil {
+		r.logger.Error("dnssd: unable to wait for link updates", "err", err)
+		return
+	}
+
+	// A non-blocking file can be closed while reading.
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		r.logger.Debug("Routing socket non-blocking", "err", err)
+	}
+	f := os.NewFile(uintptr(fd), "route")
+
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	r.logger.Debug("Waiting for link updates")
+
+	events := make(chan struct{}, 1)
+	go r.watchLinks(ctx, events)
+
+	buf := make([]byte, os.Getpagesize())
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Debug("Reading routing socket failed", "err", err)
+			}
+			return
+		}
+
+		msgs, err := route.ParseRIB(route.RIBTypeRoute, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		for _, msg := range msgs {
+			switch m := msg.(type) {
+			case *route.InterfaceMessage:
+				r.logger.Debug("Link update", "index", m.Index)
+				notifyLink(events)
+			case *route.InterfaceAddrMessage:
+				r.logger.Debug("Address update", "index", m.Index)
+				notifyLink(events)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package dnssd
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	iphlpapi                    = syscall.NewLazyDLL("iphlpapi.dll")
+	procNotifyIpInterfaceChange = iphlpapi.NewProc("NotifyIpInterfaceChange")
+	procCancelMibChangeNotify2  = iphlpapi.NewProc("CancelMibChangeNotify2")
+)
+
+// linkCallback is created only once, because the number of callbacks is limited.
+// It notifies the channel of the responder, which is registered for the caller context
+// of the notification, so that every responder receives its own events.
+var (
+	linkCallback     uintptr
+	linkCallbackOnce sync.Once
+
+	linkMutex     sync.Mutex
+	linkListeners = map[uintptr]chan struct{}{}
+	linkNextID    uintptr
+)
+
+// linkNotify is called by NotifyIpInterfaceChange with the caller context
+// of the subscription.
+func linkNotify(callerContext, row, notificationType uintptr) uintptr {
+	linkMutex.Lock()
+	events, ok := linkListeners[callerContext]
+	linkMutex.Unlock()
+
+	if ok {
+		notifyLink(events)
+	}
+
+	return 0
+}
+
+// linkSubscribe subscribes to network interface updates via NotifyIpInterfaceChange.
+func (r *responder) linkSubscribe(ctx context.Context) {
+	linkCallbackOnce.Do(func() {
+		linkCallback = syscall.NewCallback(linkNotify)
+	})
+
+	// The caller context is an id and not a pointer,
+	// because it is kept by the system.
+	events := make(chan struct{}, 1)
+	linkMutex.Lock()
+	linkNextID++
+	id := linkNextID
+	linkListeners[id] = events
+	linkMutex.Unlock()
+
+	defer func() {
+		linkMutex.Lock()
+		delete(linkListeners, id)
+		linkMutex.Unlock()
+	}()
+
+	var handle uintptr
+	// AF_UNSPEC, no initial notification
+	ret, _, _ := procNotifyIpInterfaceChange.Call(0, linkCallback, id, 0, uintptr(unsafe.Pointer(&handle)))
+	if ret != 0 {
+		r.logger.Error("dnssd: unable to wait for link updates", "err", syscall.Errno(ret))
+		return
+	}
+	defer procCancelMibChangeNotify2.Call(handle)
+
+	r.logger.Debug("Waiting for link updates")
+
+	r.watchLinks(ctx, events)
+}
@@ -0,0 +1,101 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Default returns a structured logger, which writes debug messages
+// to the Debug logger and all other messages to the Info logger.
+func Default() *slog.Logger {
+	return slog.New(&handler{enabled: isEnabled, output: func(level slog.Level, s string) {
+		l := Info
+		if level < slog.LevelInfo {
+			l = Debug
+		}
+
+		// Skip the slog and handler frames to log the caller.
+		l.Output(5, s)
+	}})
+}
+
+// isEnabled returns false for debug messages, if the Debug logger is disabled.
+func isEnabled(level slog.Level) bool {
+	return level >= slog.LevelInfo || Debug.Writer() != io.Discard
+}
+
+// NewHandler returns a slog.Handler, which formats records as
+// "<message> <key>=<value> …" and passes them to fn.
+func NewHandler(fn func(level slog.Level, s string)) slog.Handler {
+	return &handler{output: fn}
+}
+
+type handler struct {
+	enabled func(level slog.Level) bool
+	output  func(level slog.Level, s string)
+	attrs   []slog.Attr
+	prefix  string
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.enabled == nil {
+		return true
+	}
+
+	return h.enabled(level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+
+	for _, attr := range h.attrs {
+		writeAttr(&b, "", attr)
+	}
+
+	r.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&b, h.prefix, attr)
+		return true
+	})
+
+	h.output(r.Level, b.String())
+
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	all := append([]slog.Attr{}, h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		all = append(all, attr)
+	}
+
+	return &handler{enabled: h.enabled, output: h.output, attrs: all, prefix: h.prefix}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+
+	return &handler{enabled: h.enabled, output: h.output, attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+func writeAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		for _, a := range value.Group() {
+			writeAttr(b, prefix+attr.Key+".", a)
+		}
+		return
+	}
+
+	fmt.Fprintf(b, " %s%s=%v", prefix, attr.Key, value.Any())
+}
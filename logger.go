@@ -0,0 +1,60 @@
+package dnssd
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/brutella/dnssd/log"
+)
+
+// Logger is the interface of loggers, which can be used
+// to route log messages into the logging system of an application.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// NewSlogLogger returns a structured logger which writes messages to l.
+// Use the returned logger in ResponderOptions or with WithLogger.
+func NewSlogLogger(l Logger) *slog.Logger {
+	return slog.New(log.NewHandler(func(level slog.Level, s string) {
+		switch {
+		case level < slog.LevelInfo:
+			l.Debugf("%s", s)
+		case level < slog.LevelError:
+			l.Infof("%s", s)
+		default:
+			l.Errorf("%s", s)
+		}
+	}))
+}
+
+// defaultLogger writes structured log messages to the loggers of the log package.
+var defaultLogger = log.Default()
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx which carries the logger l.
+// Lookups and probing write structured log messages to the logger of their context.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger of ctx, or the default logger if ctx has none.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+
+	return defaultLogger
+}
+
+// loggerOf returns the logger of conn, or the default logger if conn has none.
+func loggerOf(conn MDNSConn) *slog.Logger {
+	if c, ok := conn.(*mdnsConn); ok && c.logger != nil {
+		return c.logger
+	}
+
+	return defaultLogger
+}
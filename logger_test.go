@@ -0,0 +1,93 @@
+package dnssd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.lines = append(l.lines, "DEBUG "+fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Infof(format string, args ...interface{}) {
+	l.lines = append(l.lines, "INFO "+fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Errorf(format string, args ...interface{}) {
+	l.lines = append(l.lines, "ERROR "+fmt.Sprintf(format, args...))
+}
+
+func TestSlogLogger(t *testing.T) {
+	l := &testLogger{}
+	logger := NewSlogLogger(l).With("iface", "en0")
+	logger.Debug("Sending probe", "delay", 5)
+	logger.Error("Failed")
+
+	if is, want := len(l.lines), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := l.lines[0], "DEBUG Sending probe iface=en0 delay=5"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := l.lines[1], "ERROR Failed iface=en0"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestConnLogger(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	l := &testLogger{}
+	logger := NewSlogLogger(l)
+	conn, err := newMDNSConnWithOptions(ConnOptions{
+		IPv4Addr: &net.UDPAddr{IP: IPv4LinkLocalMulticast, Port: 5354},
+		Ifaces:   []string{lo.Name},
+		Network:  "udp4",
+		Logger:   logger,
+	})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.close()
+
+	// Responses must not contain questions. (RFC6762 6)
+	msg := new(dns.Msg)
+	msg.SetQuestion("Computer.local.", dns.TypeA)
+	msg.Response = true
+	msg.Authoritative = true
+	if err := conn.sendResponse(msg, lo); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, line := range l.lines {
+		found = found || strings.HasPrefix(line, "INFO dnssd: Multicast DNS responses MUST NOT contain any questions")
+	}
+
+	if !found {
+		t.Fatalf("missing log message in %v", l.lines)
+	}
+}
+
+func TestResponderOptionsLogger(t *testing.T) {
+	logger := NewSlogLogger(&testLogger{})
+	r := NewResponderWithConn(newTestConn(), ResponderOptions{Logger: logger}).(*responder)
+
+	// Connections used for probing write to the logger of the responder.
+	if is, want := r.probeConfig.connOptions.Logger, logger; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
@@ -0,0 +1,46 @@
+package dnssd
+
+import (
+	"fmt"
+	"net"
+)
+
+// LoopbackInterface returns the loopback network interface, e.g. "lo0" or "lo".
+//
+// Services and lookups can use the loopback interface for local development,
+// e.g. on machines whose network blocks multicast traffic.
+// Use a connection from NewLoopbackConn and set the loopback interface
+// as Ifaces of the services and as interface of the lookups.
+func LoopbackInterface() (*net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			iface := iface
+			return &iface, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no loopback interface")
+}
+
+// NewLoopbackConn returns a mdns connection, which only
+// sends and receives messages at the loopback interface.
+func NewLoopbackConn() (MDNSConn, error) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		return nil, err
+	}
+
+	return newMDNSConn(lo.Name)
+}
+
+// isExplicitLoopback returns true, if iface is the loopback interface
+// and is contained in filters. The loopback interface is only used,
+// if it is explicitly specified, because it isn't a multicast interface on every system.
+func isExplicitLoopback(iface net.Interface, filters []string) bool {
+	return iface.Flags&net.FlagLoopback != 0 && len(filters) > 0 && containsIfaces(iface.Name, filters)
+}
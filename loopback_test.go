@@ -0,0 +1,61 @@
+package dnssd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoopback(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	conn, err := NewLoopbackConn()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	sv, err := NewService(Config{
+		Name:   "Loopback",
+		Type:   "_asdf._tcp",
+		Host:   "Loopback",
+		Port:   1234,
+		Ifaces: []string{lo.Name},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rp := NewResponderWithConn(conn, ResponderOptions{DisableSubnetCheck: true})
+	if _, err := rp.Add(sv); err != nil {
+		t.Fatal(err)
+	}
+	go rp.Respond(ctx)
+
+	browseConn, err := NewLoopbackConn()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer browseConn.Close()
+
+	added := make(chan BrowseEntry, 1)
+	go LookupTypeWithConn(ctx, browseConn, sv.ServiceName(), func(e BrowseEntry) {
+		if e.Name == sv.Name {
+			added <- e
+		}
+	}, func(BrowseEntry) {}, lo.Name)
+
+	select {
+	case e := <-added:
+		if is, want := e.IfaceName, lo.Name; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,53 @@
+package dnssd
+
+import (
+	"github.com/miekg/dns"
+)
+
+// MaintenanceMode describes how a service in maintenance is answered.
+// A service in maintenance stays registered and its names are defended,
+// e.g. to drain clients of a deployment before it is shut down.
+type MaintenanceMode int
+
+const (
+	// MaintenanceOff means that the service is answered and announced.
+	MaintenanceOff MaintenanceMode = iota
+
+	// MaintenanceSilent means that queries for the PTR, SRV and TXT records
+	// of the service are not answered, and the records expire in the caches.
+	MaintenanceSilent
+
+	// MaintenanceGoodbye means that a goodbye packet is sent, and the PTR,
+	// SRV and TXT records of the service are answered with a TTL of 0,
+	// so that they are removed from the caches within one second. (RFC6762 10.1)
+	MaintenanceGoodbye
+)
+
+func (m MaintenanceMode) String() string {
+	switch m {
+	case MaintenanceOff:
+		return "Off"
+	case MaintenanceSilent:
+		return "Silent"
+	case MaintenanceGoodbye:
+		return "Goodbye"
+	default:
+		return "Unknown"
+	}
+}
+
+// withGoodbyeTTL returns rrs with a TTL of 0 for the PTR, SRV and TXT records.
+// The records are copied, if they are modified.
+func withGoodbyeTTL(rrs []dns.RR) []dns.RR {
+	result := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		switch rr.(type) {
+		case *dns.PTR, *dns.SRV, *dns.TXT:
+			rr = dns.Copy(rr)
+			rr.Header().Ttl = 0
+		}
+		result = append(result, rr)
+	}
+
+	return result
+}
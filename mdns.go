@@ -2,11 +2,15 @@ package dnssd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/brutella/dnssd/log"
 	"github.com/miekg/dns"
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
@@ -35,6 +39,12 @@ var (
 
 	// TTLHostname is the default time-to-livefor mDNS hostname records.
 	TTLHostname uint32 = 120
+
+	// TTLLegacyUnicast is the maximum time-to-live of records in legacy unicast responses.
+	TTLLegacyUnicast uint32 = 10
+
+	// MaxMessageSize is the maximum size of a mDNS message. (RFC6762 17)
+	MaxMessageSize = 9000 - 40 - 8
 )
 
 // Query is a mDNS query
@@ -53,6 +63,17 @@ func (q Query) IfaceName() string {
 	return "?"
 }
 
+// Raw returns the raw DNS message.
+func (q Query) Raw() *dns.Msg {
+	return q.msg
+}
+
+// Iface returns the network interface to which the query is sent,
+// or nil if it is sent to all interfaces.
+func (q Query) Iface() *net.Interface {
+	return q.iface
+}
+
 // Response is a mDNS response
 type Response struct {
 	msg   *dns.Msg       // The response message
@@ -60,11 +81,56 @@ type Response struct {
 	iface *net.Interface // The network interface to which the message is sent
 }
 
+// Raw returns the raw DNS message.
+func (r Response) Raw() *dns.Msg {
+	return r.msg
+}
+
+// To returns the receiver address of a unicast response,
+// or nil for a multicast response.
+func (r Response) To() *net.UDPAddr {
+	return r.addr
+}
+
+// Iface returns the network interface to which the response is sent,
+// or nil if it is sent to all interfaces.
+func (r Response) Iface() *net.Interface {
+	return r.iface
+}
+
+// IfaceName returns the name of the network interface at which the response is sent.
+// If the network interface is unknown, the string "?" is returned.
+func (r Response) IfaceName() string {
+	if r.iface != nil {
+		return r.iface.Name
+	}
+
+	return "?"
+}
+
 // Request represents an incoming mDNS message
 type Request struct {
 	msg   *dns.Msg       // The message
 	from  *net.UDPAddr   // The source addr of the message
 	iface *net.Interface // The network interface from which the message was received
+
+	// own is true, if the message was sent by the same connection
+	// and received via multicast loopback.
+	own bool
+
+	// port is the mDNS port of the connection which received the message.
+	// If zero, the port 5353 is assumed.
+	port int
+
+	// to is the destination address of the message, or nil if unknown.
+	to *net.UDPAddr
+}
+
+// NewRequest returns a request for the message msg, which was received
+// from the address from at the network interface iface.
+// This is useful to implement a MDNSConn.
+func NewRequest(msg *dns.Msg, from *net.UDPAddr, iface *net.Interface) *Request {
+	return &Request{msg: msg, from: from, iface: iface}
 }
 
 func (r Request) String() string {
@@ -81,6 +147,12 @@ func (r Request) From() *net.UDPAddr {
 	return r.from
 }
 
+// To returns the destination address of the message, which is the multicast
+// address for multicast messages, or nil if it is unknown.
+func (r Request) To() *net.UDPAddr {
+	return r.to
+}
+
 // IfaceName returns the name of the network interface where the request was received.
 // If the network interface is unknown, the string "?" is returned.
 func (r Request) IfaceName() string {
@@ -91,10 +163,20 @@ func (r Request) IfaceName() string {
 	return "?"
 }
 
-// IsLegacyUnicast returns `true` if the request came from a non-5353 port and thus, the resolver is a simple resolver by https://datatracker.ietf.org/doc/html/rfc6762#section-6.7).
+// IsLegacyUnicast returns `true` if the request came from a port other than the mDNS port and thus, the resolver is a simple resolver by https://datatracker.ietf.org/doc/html/rfc6762#section-6.7).
 // For legacy unicast requests, the response needs to look like a normal unicast DNS response.
-func isLegacyUnicastSource(addr *net.UDPAddr) bool {
-	return addr != nil && addr.Port != 5353
+func isLegacyUnicastSource(addr *net.UDPAddr, port int) bool {
+	return addr != nil && addr.Port != port
+}
+
+// isLegacyUnicast returns true if the request is a legacy unicast query.
+func (r Request) isLegacyUnicast() bool {
+	port := r.port
+	if port == 0 {
+		port = AddrIPv4LinkLocalMulticast.Port
+	}
+
+	return isLegacyUnicastSource(r.from, port)
 }
 
 // MDNSConn represents a mDNS connection. It encapsulates an IPv4 and IPv6 UDP connection.
@@ -121,6 +203,98 @@ type mdnsConn struct {
 	udpConn4 *net.UDPConn
 	udpConn6 *net.UDPConn
 	ch       chan *Request
+	sent     *sentPackets
+
+	// custom packet connections, which are used
+	// instead of ipv4 and ipv6 (see NewMDNSConnWith)
+	pc4 net.PacketConn
+	pc6 net.PacketConn
+
+	// multicast addresses to which messages are sent
+	addr4 *net.UDPAddr
+	addr6 *net.UDPAddr
+
+	// writeMutex serializes setting the multicast interface and sending
+	// on platforms without control messages (see hasControlMessages)
+	writeMutex sync.Mutex
+
+	// netns is the network namespace of the connection
+	netns *netns
+
+	// stats counts the received messages
+	stats *connStats
+
+	// logger receives the log messages of the connection
+	logger *slog.Logger
+}
+
+// ConnOptions configures the multicast addresses and network interfaces
+// of a mDNS connection.
+type ConnOptions struct {
+	// IPv4Addr is the IPv4 multicast address and port.
+	// If nil, AddrIPv4LinkLocalMulticast is used.
+	IPv4Addr *net.UDPAddr
+
+	// IPv6Addr is the IPv6 multicast address and port.
+	// If nil, AddrIPv6LinkLocalMulticast is used.
+	IPv6Addr *net.UDPAddr
+
+	// Ifaces are the names of the network interfaces at which the
+	// multicast groups are joined. If empty, all multicast interfaces are used.
+	Ifaces []string
+
+	// ReusePort sets SO_REUSEPORT on the sockets, so that the mDNS port can be
+	// shared with other processes, which also set this option, e.g. avahi-daemon.
+	// Multicast messages are then received by every process.
+	// On Windows, the port is always shared (SO_REUSEADDR).
+	ReusePort bool
+
+	// Netns is the path of a Linux network namespace, e.g. /var/run/netns/blue
+	// or /proc/<pid>/ns/net, in which the connection is created.
+	// Use /proc/self/fd/<fd> for an open file descriptor of a namespace.
+	// Responders and resolvers, which use the connection, look up
+	// network interfaces in the namespace. If empty, the namespace
+	// of the process is used.
+	Netns string
+
+	// ReadBufferSize is the number of received messages, which are buffered
+	// until they are read. If zero, DefaultReadBufferSize is used.
+	// Messages which can't be buffered are dropped and counted (see ConnStats).
+	ReadBufferSize int
+
+	// Conns are UDP sockets, which are bound to the mDNS port, e.g. passed by
+	// systemd socket activation (see SdListenConns). They are used instead of
+	// opening sockets, and the multicast groups are joined with them. Sockets
+	// bound to IPv6 addresses must be IPv6-only (BindIPv6Only=ipv6-only).
+	Conns []*net.UDPConn
+
+	// Network is "udp4" or "udp6" to only use IPv4 or IPv6.
+	// If empty, both are used.
+	Network string
+
+	// Logger receives structured log messages of the connection.
+	// If nil, messages are written to the loggers of the log package.
+	Logger *slog.Logger
+}
+
+func (o ConnOptions) withDefaults() ConnOptions {
+	if o.ReadBufferSize <= 0 {
+		o.ReadBufferSize = DefaultReadBufferSize
+	}
+
+	if o.Logger == nil {
+		o.Logger = defaultLogger
+	}
+
+	if o.IPv4Addr == nil {
+		o.IPv4Addr = AddrIPv4LinkLocalMulticast
+	}
+
+	if o.IPv6Addr == nil {
+		o.IPv6Addr = AddrIPv6LinkLocalMulticast
+	}
+
+	return o
 }
 
 // NewMDNSConn returns a new mdns connection.
@@ -128,6 +302,38 @@ func NewMDNSConn() (MDNSConn, error) {
 	return newMDNSConn()
 }
 
+// NewMDNSConnWithOptions returns a new mdns connection configured by opts.
+// Use different multicast addresses or ports to run isolated
+// discovery planes on the same host, e.g. for test networks.
+func NewMDNSConnWithOptions(opts ConnOptions) (MDNSConn, error) {
+	return newMDNSConnWithOptions(opts)
+}
+
+// NewMDNSConnWith returns a new mdns connection, which sends and receives
+// messages with the packet connections conn4 for IPv4 and conn6 for IPv6.
+// One of them may be nil. This allows to use the library with
+// simulated networks or userspace network stacks.
+//
+// The connections must already be bound to the mDNS port and receive
+// multicast messages. Received messages are associated with the network interface
+// which has the source address, or with no interface, if there is none.
+func NewMDNSConnWith(conn4 net.PacketConn, conn6 net.PacketConn) (MDNSConn, error) {
+	if conn4 == nil && conn6 == nil {
+		return nil, fmt.Errorf("no packet connection")
+	}
+
+	return &mdnsConn{
+		pc4:    conn4,
+		pc6:    conn6,
+		ch:     make(chan *Request, DefaultReadBufferSize),
+		sent:   newSentPackets(nil),
+		stats:  &connStats{},
+		addr4:  AddrIPv4LinkLocalMulticast,
+		addr6:  AddrIPv6LinkLocalMulticast,
+		logger: defaultLogger,
+	}, nil
+}
+
 // SendQuery sends a query.
 func (c *mdnsConn) SendQuery(q *Query) error {
 	return c.sendQuery(q.msg, q.iface)
@@ -150,11 +356,12 @@ func (c *mdnsConn) Read(ctx context.Context) <-chan *Request {
 
 // Drain drains the incoming requests channel.
 func (c *mdnsConn) Drain(ctx context.Context) {
-	log.Debug.Println("Draining connection")
+	logger := loggerFrom(ctx)
+	logger.Debug("Draining connection")
 	for {
 		select {
 		case req := <-c.Read(ctx):
-			log.Debug.Println("Ignoring msg from", req.from.IP)
+			logger.Debug("Ignoring message", "peer", req.from, "iface", req.IfaceName())
 		default:
 			return
 		}
@@ -167,68 +374,106 @@ func (c *mdnsConn) Close() {
 }
 
 func newMDNSConn(ifs ...string) (*mdnsConn, error) {
+	return newMDNSConnWithOptions(ConnOptions{Ifaces: ifs})
+}
+
+func newMDNSConnWithOptions(opts ConnOptions) (*mdnsConn, error) {
+	opts = opts.withDefaults()
+	ifs := opts.Ifaces
+	logger := opts.Logger
+
+	var ns *netns
+	if opts.Netns != "" {
+		var err error
+		if ns, err = openNetns(opts.Netns); err != nil {
+			return nil, err
+		}
+	}
+
+	switch opts.Network {
+	case "", "udp4", "udp6":
+	default:
+		ns.close()
+		return nil, fmt.Errorf("invalid network %q", opts.Network)
+	}
+
+	// listen returns nil, if the network is not used.
+	listen := func(network string, addr *net.UDPAddr) (*net.UDPConn, error) {
+		if opts.Network != "" && opts.Network != network {
+			return nil, nil
+		}
+
+		if len(opts.Conns) > 0 {
+			return connOfNetwork(opts.Conns, network), nil
+		}
+
+		return listenMulticast(ns, network, addr, opts.ReusePort)
+	}
+
 	var errs []error
 	var connIPv4 *ipv4.PacketConn
 	var connIPv6 *ipv6.PacketConn
 
-	conn4, err := net.ListenUDP("udp4", AddrIPv4LinkLocalMulticast)
+	conn4, err := listen("udp4", opts.IPv4Addr)
 	if err != nil {
 		errs = append(errs, err)
-	}
-
-	connIPv4 = ipv4.NewPacketConn(conn4)
-	if err := connIPv4.SetControlMessage(ipv4.FlagInterface, true); err != nil {
-		log.Debug.Printf("IPv4 interface socket opt: %v", err)
-	}
-	// Enable multicast loopback to receive all sent data
-	if err := connIPv4.SetMulticastLoopback(true); err != nil {
-		log.Debug.Println("IPv4 set multicast loopback:", err)
-	}
-	// Set TTL to 255 (rfc6762)
-	if err := connIPv4.SetTTL(255); err != nil {
-		log.Debug.Println("IPv4 set TTL:", err)
-	}
-	if err := connIPv4.SetMulticastTTL(255); err != nil {
-		log.Debug.Println("IPv4 set multicast TTL:", err)
-	}
+	} else if conn4 != nil {
+		connIPv4 = ipv4.NewPacketConn(conn4)
+		if err := connIPv4.SetControlMessage(ipv4.FlagInterface|ipv4.FlagDst, true); err != nil {
+			logger.Debug("IPv4 interface socket option failed", "err", err)
+		}
+		// Enable multicast loopback to receive all sent data
+		if err := connIPv4.SetMulticastLoopback(true); err != nil {
+			logger.Debug("IPv4 set multicast loopback failed", "err", err)
+		}
+		// Set TTL to 255 (rfc6762)
+		if err := connIPv4.SetTTL(255); err != nil {
+			logger.Debug("IPv4 set TTL failed", "err", err)
+		}
+		if err := connIPv4.SetMulticastTTL(255); err != nil {
+			logger.Debug("IPv4 set multicast TTL failed", "err", err)
+		}
 
-	for _, iface := range MulticastInterfaces(ifs...) {
-		if err := connIPv4.JoinGroup(iface, &net.UDPAddr{IP: IPv4LinkLocalMulticast}); err != nil {
-			log.Debug.Printf("Failed joining IPv4 %v: %v", iface.Name, err)
-		} else {
-			log.Debug.Printf("Joined IPv4 %v", iface.Name)
+		for _, iface := range ns.multicastInterfaces(ifs...) {
+			if err := connIPv4.JoinGroup(iface, &net.UDPAddr{IP: opts.IPv4Addr.IP}); err != nil {
+				logger.Debug("Joining IPv4 group failed", "iface", iface.Name, "err", err)
+			} else {
+				logger.Debug("Joined IPv4 group", "iface", iface.Name)
+			}
 		}
 	}
 
-	conn6, err := net.ListenUDP("udp6", AddrIPv6LinkLocalMulticast)
+	conn6, err := listen("udp6", opts.IPv6Addr)
 	if err != nil {
 		errs = append(errs, err)
-	}
-	connIPv6 = ipv6.NewPacketConn(conn6)
-	if err := connIPv6.SetControlMessage(ipv6.FlagInterface, true); err != nil {
-		log.Debug.Printf("IPv6 interface socket opt: %v", err)
-	}
-	// Enable multicast loopback to receive all sent data
-	if err := connIPv6.SetMulticastLoopback(true); err != nil {
-		log.Debug.Println("IPv6 set multicast loopback:", err)
-	}
-	// Set TTL to 255 (rfc6762)
-	if err := connIPv6.SetHopLimit(255); err != nil {
-		log.Debug.Println("IPv4 set TTL:", err)
-	}
-	if err := connIPv6.SetMulticastHopLimit(255); err != nil {
-		log.Debug.Println("IPv4 set multicast TTL:", err)
-	}
-	for _, iface := range MulticastInterfaces(ifs...) {
-		if err := connIPv6.JoinGroup(iface, &net.UDPAddr{IP: IPv6LinkLocalMulticast}); err != nil {
-			log.Debug.Printf("Failed joining IPv6 %v: %v", iface.Name, err)
-		} else {
-			log.Debug.Printf("Joined IPv6 %v", iface.Name)
+	} else if conn6 != nil {
+		connIPv6 = ipv6.NewPacketConn(conn6)
+		if err := connIPv6.SetControlMessage(ipv6.FlagInterface|ipv6.FlagDst, true); err != nil {
+			logger.Debug("IPv6 interface socket option failed", "err", err)
+		}
+		// Enable multicast loopback to receive all sent data
+		if err := connIPv6.SetMulticastLoopback(true); err != nil {
+			logger.Debug("IPv6 set multicast loopback failed", "err", err)
+		}
+		// Set TTL to 255 (rfc6762)
+		if err := connIPv6.SetHopLimit(255); err != nil {
+			logger.Debug("IPv6 set hop limit failed", "err", err)
+		}
+		if err := connIPv6.SetMulticastHopLimit(255); err != nil {
+			logger.Debug("IPv6 set multicast hop limit failed", "err", err)
+		}
+		for _, iface := range ns.multicastInterfaces(ifs...) {
+			if err := connIPv6.JoinGroup(iface, &net.UDPAddr{IP: opts.IPv6Addr.IP}); err != nil {
+				logger.Debug("Joining IPv6 group failed", "iface", iface.Name, "err", err)
+			} else {
+				logger.Debug("Joined IPv6 group", "iface", iface.Name)
+			}
 		}
 	}
 
 	if err := first(errs...); connIPv4 == nil && connIPv6 == nil {
-		return nil, fmt.Errorf("Failed setting up UDP server: %v", err)
+		ns.close()
+		return nil, fmt.Errorf("Failed setting up UDP server: %w", err)
 	}
 
 	return &mdnsConn{
@@ -236,10 +481,64 @@ func newMDNSConn(ifs ...string) (*mdnsConn, error) {
 		ipv6:     connIPv6,
 		udpConn4: conn4,
 		udpConn6: conn6,
-		ch:       make(chan *Request),
+		ch:       make(chan *Request, opts.ReadBufferSize),
+		sent:     newSentPackets(ns),
+		stats:    &connStats{},
+		addr4:    opts.IPv4Addr,
+		addr6:    opts.IPv6Addr,
+		netns:    ns,
+		logger:   opts.Logger,
 	}, nil
 }
 
+// connOfNetwork returns the connection of conns, which is bound
+// to an address of network "udp4" or "udp6", or nil.
+func connOfNetwork(conns []*net.UDPConn, network string) *net.UDPConn {
+	for _, conn := range conns {
+		addr, ok := conn.LocalAddr().(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		if is4 := addr.IP.To4() != nil; is4 == (network == "udp4") {
+			return conn
+		}
+	}
+
+	return nil
+}
+
+// ErrPortInUse is returned if the mDNS port is used by another process,
+// which doesn't share it, e.g. a system mDNS daemon like avahi-daemon or mDNSResponder.
+var ErrPortInUse = errors.New("mDNS port is in use by another process")
+
+// listenMulticast listens at the multicast address addr in the network namespace ns.
+// The socket allows other processes to bind to the same address,
+// and if reuse is true, SO_REUSEPORT is set on platforms which support it.
+func listenMulticast(ns *netns, network string, addr *net.UDPAddr, reuse bool) (*net.UDPConn, error) {
+	lc := net.ListenConfig{}
+	if reuse {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			return reusePort(c)
+		}
+	}
+
+	var pc net.PacketConn
+	err := ns.do(func() error {
+		var err error
+		pc, err = lc.ListenPacket(context.Background(), network, addr.String())
+		return err
+	})
+	if err != nil {
+		if isAddrInUse(err) {
+			return nil, fmt.Errorf("%w: %v (a system mDNS daemon like avahi-daemon or mDNSResponder may own the port; set ConnOptions.ReusePort if it allows sharing the port)", ErrPortInUse, err)
+		}
+		return nil, err
+	}
+
+	return pc.(*net.UDPConn), nil
+}
+
 func (c *mdnsConn) close() {
 	if c.ipv4 != nil {
 		c.ipv4.Close()
@@ -256,6 +555,21 @@ func (c *mdnsConn) close() {
 	if c.udpConn6 != nil {
 		c.udpConn6.Close()
 	}
+
+	if c.pc4 != nil {
+		c.pc4.Close()
+	}
+
+	if c.pc6 != nil {
+		c.pc6.Close()
+	}
+
+	c.netns.close()
+}
+
+// namespace returns the network namespace of the connection.
+func (c *mdnsConn) namespace() *netns {
+	return c.netns
 }
 
 func (c *mdnsConn) read(ctx context.Context) <-chan *Request {
@@ -264,117 +578,190 @@ func (c *mdnsConn) read(ctx context.Context) <-chan *Request {
 }
 
 func (c *mdnsConn) readInto(ctx context.Context, ch chan *Request) {
+	readers := newIfaceReaders(ctx, c, ch)
 
-	isDone := func(ctx context.Context) bool {
-		return ctx.Err() != nil
+	if c.ipv4 != nil {
+		go c.readIPv4(ctx, readers)
 	}
 
-	if c.ipv4 != nil {
-		go func() {
-			buf := make([]byte, 65536)
-			for {
-				if isDone(ctx) {
-					return
-				}
-
-				n, cm, from, err := c.ipv4.ReadFrom(buf)
-				if err != nil {
-					continue
-				}
-
-				udpAddr, ok := from.(*net.UDPAddr)
-				if !ok {
-					log.Info.Println("dnssd: invalid source address")
-					continue
-				}
-
-				var iface *net.Interface
-				if cm != nil {
-					iface, err = net.InterfaceByIndex(cm.IfIndex)
-					if err != nil {
-						continue
-					}
-				} else {
-					//On Windows, the ControlMessage for ReadFrom and WriteTo methods of PacketConn is not implemented.
-					//ref https://pkg.go.dev/golang.org/x/net/ipv4#pkg-note-BUG
-					iface, err = getInterfaceByIp(udpAddr.IP)
-					if err != nil {
-						continue
-					}
-				}
-
-				if n > 0 {
-					m := new(dns.Msg)
-					if err := m.Unpack(buf); err == nil && !shouldIgnore(m) {
-						ch <- &Request{m, udpAddr, iface}
-					}
-				}
-			}
-		}()
+	if c.pc4 != nil {
+		go c.readPackets(ctx, c.pc4, c.addr4, readers)
+	}
+
+	if c.pc6 != nil {
+		go c.readPackets(ctx, c.pc6, c.addr6, readers)
 	}
 
 	if c.ipv6 != nil {
-		go func() {
-			buf := make([]byte, 65536)
-			for {
-				if isDone(ctx) {
-					return
-				}
-
-				n, cm, from, err := c.ipv6.ReadFrom(buf)
-				if err != nil {
-					continue
-				}
-
-				udpAddr, ok := from.(*net.UDPAddr)
-				if !ok {
-					log.Info.Println("dnssd: invalid source address")
-					continue
-				}
-
-				var iface *net.Interface
-				if cm != nil {
-					iface, err = net.InterfaceByIndex(cm.IfIndex)
-					if err != nil {
-						continue
-					}
-				} else {
-					//On Windows, the ControlMessage for ReadFrom and WriteTo methods of PacketConn is not implemented.
-					//ref https://pkg.go.dev/golang.org/x/net/ipv6#pkg-note-BUG
-					//The zone specifies the scope of the literal IPv6 address as defined in RFC 4007.
-					iface, err = net.InterfaceByName(udpAddr.Zone)
-					if err != nil {
-						continue
-					}
-				}
-
-				if n > 0 {
-					m := new(dns.Msg)
-					if err := m.Unpack(buf); err == nil && !shouldIgnore(m) {
-						ch <- &Request{m, udpAddr, iface}
-					}
-				}
+		go c.readIPv6(ctx, readers)
+	}
+}
+
+// readIPv4 reads packets from the IPv4 connection. The receiving network
+// interface and the destination address are taken from the control message.
+func (c *mdnsConn) readIPv4(ctx context.Context, readers *ifaceReaders) {
+	buf := make([]byte, 65536)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		n, cm, from, err := c.ipv4.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+
+		udpAddr, ok := from.(*net.UDPAddr)
+		if !ok {
+			c.logger.Info("dnssd: invalid source address", "addr", from)
+			continue
+		}
+
+		var iface *net.Interface
+		dst := c.addr4.IP
+		if cm != nil {
+			iface, err = c.netns.interfaceByIndex(cm.IfIndex)
+			if err != nil {
+				continue
+			}
+
+			if cm.Dst != nil {
+				dst = cm.Dst
 			}
-		}()
+		} else {
+			//On Windows, the ControlMessage for ReadFrom and WriteTo methods of PacketConn is not implemented.
+			//ref https://pkg.go.dev/golang.org/x/net/ipv4#pkg-note-BUG
+			iface, err = c.netns.interfaceByIP(udpAddr.IP)
+			if err != nil {
+				continue
+			}
+		}
+
+		readers.dispatch(packet{
+			data:  copyBuffer(buf[:n]),
+			from:  udpAddr,
+			to:    &net.UDPAddr{IP: dst, Port: c.addr4.Port},
+			iface: iface,
+		})
 	}
 }
 
+// readIPv6 reads packets from the IPv6 connection. The receiving network
+// interface and the destination address are taken from the control message.
+func (c *mdnsConn) readIPv6(ctx context.Context, readers *ifaceReaders) {
+	buf := make([]byte, 65536)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		n, cm, from, err := c.ipv6.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+
+		udpAddr, ok := from.(*net.UDPAddr)
+		if !ok {
+			c.logger.Info("dnssd: invalid source address", "addr", from)
+			continue
+		}
+
+		var iface *net.Interface
+		dst := c.addr6.IP
+		if cm != nil {
+			iface, err = c.netns.interfaceByIndex(cm.IfIndex)
+			if err != nil {
+				continue
+			}
+
+			if cm.Dst != nil {
+				dst = cm.Dst
+			}
+		} else {
+			//On Windows, the ControlMessage for ReadFrom and WriteTo methods of PacketConn is not implemented.
+			//ref https://pkg.go.dev/golang.org/x/net/ipv6#pkg-note-BUG
+			//The zone specifies the scope of the literal IPv6 address as defined in RFC 4007.
+			iface, err = c.netns.interfaceByZone(udpAddr.Zone)
+			if err != nil {
+				continue
+			}
+		}
+
+		readers.dispatch(packet{
+			data:  copyBuffer(buf[:n]),
+			from:  udpAddr,
+			to:    &net.UDPAddr{IP: dst, Port: c.addr6.Port},
+			iface: iface,
+		})
+	}
+}
+
+// readPackets reads messages from the custom packet connection pc.
+// The destination address of the packets is unknown and assumed to be group.
+func (c *mdnsConn) readPackets(ctx context.Context, pc net.PacketConn, group *net.UDPAddr, readers *ifaceReaders) {
+	buf := make([]byte, 65536)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+
+		udpAddr, ok := from.(*net.UDPAddr)
+		if !ok {
+			c.logger.Info("dnssd: invalid source address", "addr", from)
+			continue
+		}
+
+		var iface *net.Interface
+		if udpAddr.IP.To4() != nil {
+			iface, _ = c.netns.interfaceByIP(udpAddr.IP)
+		} else if udpAddr.Zone != "" {
+			iface, _ = c.netns.interfaceByZone(udpAddr.Zone)
+		}
+
+		readers.dispatch(packet{
+			data:  copyBuffer(buf[:n]),
+			from:  udpAddr,
+			to:    group,
+			iface: iface,
+		})
+	}
+}
+
+// port returns the mDNS port of the connection for the address family of addr.
+func (c *mdnsConn) port(addr *net.UDPAddr) int {
+	if addr.IP.To4() == nil && c.addr6 != nil {
+		return c.addr6.Port
+	}
+
+	if c.addr4 != nil {
+		return c.addr4.Port
+	}
+
+	return AddrIPv4LinkLocalMulticast.Port
+}
+
 func (c *mdnsConn) sendQuery(m *dns.Msg, iface *net.Interface) error {
-	sanitizeQuery(m)
+	sanitizeQuery(m, c.logger)
 
 	return c.writeMsg(m, iface)
 }
 
 func (c *mdnsConn) sendResponse(m *dns.Msg, iface *net.Interface) error {
-	sanitizeResponse(m)
+	sanitizeResponse(m, c.logger)
 
 	return c.writeMsg(m, iface)
 }
 
 func (c *mdnsConn) sendResponseTo(m *dns.Msg, iface *net.Interface, addr *net.UDPAddr) error {
 	// Don't sanitize legacy unicast responses.
-	if !isLegacyUnicastSource(addr) {
-		sanitizeResponse(m)
+	if !isLegacyUnicastSource(addr, c.port(addr)) {
+		sanitizeResponse(m, c.logger)
 	}
 
 	return c.writeMsgTo(m, iface, addr)
@@ -382,56 +769,159 @@ func (c *mdnsConn) sendResponseTo(m *dns.Msg, iface *net.Interface, addr *net.UD
 
 func (c *mdnsConn) writeMsg(m *dns.Msg, iface *net.Interface) error {
 	var err error
-	if c.ipv4 != nil {
-		err = c.writeMsgTo(m, iface, AddrIPv4LinkLocalMulticast)
+	if c.ipv4 != nil || c.pc4 != nil {
+		err = c.writeMsgTo(m, iface, c.addr4)
 	}
 
-	if c.ipv6 != nil {
-		err = c.writeMsgTo(m, iface, AddrIPv6LinkLocalMulticast)
+	if c.ipv6 != nil || c.pc6 != nil {
+		err = c.writeMsgTo(m, iface, c.addr6)
 	}
 
 	return err
 }
 
 func (c *mdnsConn) writeMsgTo(m *dns.Msg, iface *net.Interface, addr *net.UDPAddr) error {
+	legacy := isLegacyUnicastSource(addr, c.port(addr))
+
 	// Don't sanitize legacy unicast responses.
-	if !isLegacyUnicastSource(addr) {
-		sanitizeMsg(m)
+	if !legacy {
+		sanitizeMsg(m, c.logger)
+	}
+
+	size := maxMessageSize(iface, addr)
+	msgs := []*dns.Msg{m}
+	if legacy {
+		// Legacy unicast responses are conventional DNS responses and can't be split.
+		trimMsg(m, size)
+	} else {
+		msgs = splitMsg(m, size-optLen)
+		for i, msg := range msgs {
+			msgs[i] = withEDNS0(msg)
+		}
+	}
+
+	for _, msg := range msgs {
+		if err := c.writePacket(msg, iface, addr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *mdnsConn) writePacket(m *dns.Msg, iface *net.Interface, addr *net.UDPAddr) error {
+	addr = scopedAddr(addr, iface)
+
+	// The message is packed into a buffer from the pool.
+	buf := getBuffer()
+	defer putBuffer(buf)
+	out, err := m.PackBuffer((*buf)[:cap(*buf)])
+	if err != nil {
+		return err
 	}
 
 	if c.ipv4 != nil && addr.IP.To4() != nil {
-		if out, err := m.Pack(); err == nil {
-			var ctrl *ipv4.ControlMessage
-			if iface != nil {
-				ctrl = &ipv4.ControlMessage{
-					IfIndex: iface.Index,
-				}
+		var ctrl *ipv4.ControlMessage
+		if iface != nil {
+			ctrl = &ipv4.ControlMessage{
+				IfIndex: iface.Index,
 			}
-			c.ipv4.PacketConn.SetWriteDeadline(time.Now().Add(time.Second))
-			if _, err = c.ipv4.WriteTo(out, ctrl, addr); err != nil {
-				return err
+		}
+		c.writeMutex.Lock()
+		if !hasControlMessages && iface != nil && addr.IP.IsMulticast() {
+			if err := c.ipv4.SetMulticastInterface(iface); err != nil {
+				c.logger.Debug("IPv4 set multicast interface failed", "iface", iface.Name, "err", err)
 			}
 		}
+		c.ipv4.PacketConn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.sent.add(out, localPort(c.ipv4))
+		_, err = c.ipv4.WriteTo(out, ctrl, addr)
+		c.writeMutex.Unlock()
+		if err != nil {
+			return err
+		}
+		capturePacket(iface, nil, addr, out)
 	}
 
 	if c.ipv6 != nil && addr.IP.To4() == nil {
-		if out, err := m.Pack(); err == nil {
-			var ctrl *ipv6.ControlMessage
-			if iface != nil {
-				ctrl = &ipv6.ControlMessage{
-					IfIndex: iface.Index,
-				}
+		var ctrl *ipv6.ControlMessage
+		if iface != nil {
+			ctrl = &ipv6.ControlMessage{
+				IfIndex: iface.Index,
 			}
-			c.ipv6.PacketConn.SetWriteDeadline(time.Now().Add(time.Second))
-			if _, err = c.ipv6.WriteTo(out, ctrl, addr); err != nil {
-				return err
+		}
+		c.writeMutex.Lock()
+		if !hasControlMessages && iface != nil && addr.IP.IsMulticast() {
+			if err := c.ipv6.SetMulticastInterface(iface); err != nil {
+				c.logger.Debug("IPv6 set multicast interface failed", "iface", iface.Name, "err", err)
 			}
 		}
+		c.ipv6.PacketConn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.sent.add(out, localPort(c.ipv6))
+		_, err = c.ipv6.WriteTo(out, ctrl, addr)
+		c.writeMutex.Unlock()
+		if err != nil {
+			return err
+		}
+		capturePacket(iface, nil, addr, out)
+	}
+
+	if pc := c.packetConn(addr); pc != nil {
+		pc.SetWriteDeadline(time.Now().Add(time.Second))
+		c.sent.add(out, localPort(pc))
+		if _, err = pc.WriteTo(out, addr); err != nil {
+			return err
+		}
+		capturePacket(iface, nil, addr, out)
 	}
 
 	return nil
 }
 
+// scopedAddr returns addr with the index of iface as zone, if addr
+// is an IPv6 link-local address without zone. Otherwise addr is returned.
+func scopedAddr(addr *net.UDPAddr, iface *net.Interface) *net.UDPAddr {
+	if iface == nil || addr.Zone != "" || addr.IP.To4() != nil {
+		return addr
+	}
+
+	if !addr.IP.IsLinkLocalUnicast() && !addr.IP.IsLinkLocalMulticast() {
+		return addr
+	}
+
+	return &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: strconv.Itoa(iface.Index)}
+}
+
+// packetConn returns the custom packet connection for messages to addr, or nil if there is none.
+func (c *mdnsConn) packetConn(addr *net.UDPAddr) net.PacketConn {
+	if addr.IP.To4() != nil {
+		return c.pc4
+	}
+
+	return c.pc6
+}
+
+// maxMessageSize returns the maximum size of a message sent to addr at iface.
+// Messages must not exceed the interface MTU. (RFC6762 17)
+func maxMessageSize(iface *net.Interface, addr *net.UDPAddr) int {
+	size := MaxMessageSize
+	if iface == nil || iface.MTU <= 0 {
+		return size
+	}
+
+	// IP and UDP header
+	hdr := 20 + 8
+	if addr.IP.To4() == nil {
+		hdr = 40 + 8
+	}
+
+	if mtu := iface.MTU - hdr; mtu < size {
+		size = mtu
+	}
+
+	return size
+}
+
 func shouldIgnore(m *dns.Msg) bool {
 	if m.Opcode != 0 {
 		return true
@@ -444,68 +934,68 @@ func shouldIgnore(m *dns.Msg) bool {
 	return false
 }
 
-func sanitizeResponse(m *dns.Msg) {
+func sanitizeResponse(m *dns.Msg, logger *slog.Logger) {
 	if m.Question != nil && len(m.Question) > 0 {
-		log.Info.Println("dnssd: Multicast DNS responses MUST NOT contain any questions in the Question Section.  (RFC6762 6)")
+		logger.Info("dnssd: Multicast DNS responses MUST NOT contain any questions in the Question Section.  (RFC6762 6)")
 		m.Question = nil
 	}
 
 	if !m.Response {
-		log.Info.Println("dnssd: In response messages the QR bit MUST be one (RFC6762 18.2)")
+		logger.Info("dnssd: In response messages the QR bit MUST be one (RFC6762 18.2)")
 		m.Response = true
 	}
 
 	if !m.Authoritative {
-		log.Info.Println("dnssd: AA Bit bit MUST be set to one in response messages (RFC6762 18.4)")
+		logger.Info("dnssd: AA Bit bit MUST be set to one in response messages (RFC6762 18.4)")
 		m.Authoritative = true
 	}
 
 	if m.Truncated {
-		log.Info.Println("dnssd: In multicast response messages, the TC bit MUST be zero on transmission. (RFC6762 18.5)")
+		logger.Info("dnssd: In multicast response messages, the TC bit MUST be zero on transmission. (RFC6762 18.5)")
 		m.Truncated = false
 	}
 }
 
-func sanitizeQuery(m *dns.Msg) {
+func sanitizeQuery(m *dns.Msg, logger *slog.Logger) {
 	if m.Response {
-		log.Info.Println("dnssd: In query messages the QR bit MUST be zero (RFC6762 18.2)")
+		logger.Info("dnssd: In query messages the QR bit MUST be zero (RFC6762 18.2)")
 		m.Response = false
 	}
 
 	if m.Authoritative {
-		log.Info.Println("dnssd: AA Bit MUST be zero in query messages (RFC6762 18.4)")
+		logger.Info("dnssd: AA Bit MUST be zero in query messages (RFC6762 18.4)")
 		m.Authoritative = false
 	}
 }
 
-func sanitizeMsg(m *dns.Msg) {
+func sanitizeMsg(m *dns.Msg, logger *slog.Logger) {
 	if m.Opcode != 0 {
-		log.Info.Println("dnssd: In both multicast query and multicast response messages, the OPCODE MUST be zero on transmission (RFC6762 18.3)")
+		logger.Info("dnssd: In both multicast query and multicast response messages, the OPCODE MUST be zero on transmission (RFC6762 18.3)")
 		m.Opcode = 0
 	}
 
 	if m.RecursionDesired {
-		log.Info.Println("dnssd: In both multicast query and multicast response messages, the Recursion Available bit MUST be zero on transmission. (RFC6762 18.7)")
+		logger.Info("dnssd: In both multicast query and multicast response messages, the Recursion Available bit MUST be zero on transmission. (RFC6762 18.7)")
 		m.RecursionDesired = false
 	}
 
 	if m.Zero {
-		log.Info.Println("dnssd: In both query and response messages, the Zero bit MUST be zero on transmission (RFC6762 18.8)")
+		logger.Info("dnssd: In both query and response messages, the Zero bit MUST be zero on transmission (RFC6762 18.8)")
 		m.Zero = false
 	}
 
 	if m.AuthenticatedData {
-		log.Info.Println("dnssd: In both multicast query and multicast response messages, the Authentic Data bit MUST be zero on transmission (RFC6762 18.9)")
+		logger.Info("dnssd: In both multicast query and multicast response messages, the Authentic Data bit MUST be zero on transmission (RFC6762 18.9)")
 		m.AuthenticatedData = false
 	}
 
 	if m.CheckingDisabled {
-		log.Info.Println("dnssd: In both multicast query and multicast response messages, the Checking Disabled bit MUST be zero on transmission (RFC6762 18.10)")
+		logger.Info("dnssd: In both multicast query and multicast response messages, the Checking Disabled bit MUST be zero on transmission (RFC6762 18.10)")
 		m.CheckingDisabled = false
 	}
 
 	if m.Rcode != 0 {
-		log.Info.Println("dnssd: In both multicast query and multicast response messages, the Response Code MUST be zero on transmission. (RFC6762 18.11)")
+		logger.Info("dnssd: In both multicast query and multicast response messages, the Response Code MUST be zero on transmission. (RFC6762 18.11)")
 		m.Rcode = 0
 	}
 }
@@ -537,6 +1027,20 @@ func setAnswerCacheFlushBit(msg *dns.Msg) {
 	}
 }
 
+// prepareLegacyUnicastResponse clears the cache-flush bit and caps the time-to-live
+// of all records in msg, which is a response to a legacy unicast query. (RFC6762 6.7)
+func prepareLegacyUnicastResponse(msg *dns.Msg) {
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			hdr.Class &^= (1 << 15)
+			if hdr.Ttl > TTLLegacyUnicast {
+				hdr.Ttl = TTLLegacyUnicast
+			}
+		}
+	}
+}
+
 // Sets the Top Bit of class to indicate the unicast responses are preferred for this question.
 func setQuestionUnicast(q *dns.Question) {
 	q.Qclass |= (1 << 15)
@@ -553,22 +1057,24 @@ func isUnicastQuestion(q dns.Question) bool {
 	return q.Qclass&(1<<15) != 0
 }
 
-func getInterfaceByIp(ip net.IP) (*net.Interface, error) {
-	interfaces, err := net.Interfaces()
-	if err != nil {
-		return nil, err
+// isFromLocalSubnet returns true, if the source address of req is
+// on a subnet which is directly attached to the receiving network interface.
+// Requests from link-local addresses are always local. (RFC6762 11)
+func isFromLocalSubnet(req *Request, ns *netns) bool {
+	if req.from == nil || req.iface == nil {
+		return true
 	}
 
-	for _, iface := range interfaces {
-		// check interface running flag
-		if iface.Flags&net.FlagRunning != 0 {
-			addrs, _ := iface.Addrs()
-			for _, addr := range addrs {
-				if ipnet, ok := addr.(*net.IPNet); ok && ipnet.Contains(ip) {
-					return &iface, nil
-				}
-			}
-		}
+	ip := req.from.IP
+	if ip.IsLinkLocalUnicast() || ip.IsLoopback() {
+		return true
 	}
-	return nil, fmt.Errorf("could not find interface by %v", ip)
+
+	addrs, err := ns.addrs(req.iface)
+	if err != nil || len(addrs) == 0 {
+		// The subnets of the interface are unknown.
+		return true
+	}
+
+	return len(ipsInSubnets([]net.IP{ip}, addrs)) > 0
 }
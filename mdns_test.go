@@ -0,0 +1,232 @@
+package dnssd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestNewMDNSConnWith(t *testing.T) {
+	if _, err := NewMDNSConnWith(nil, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := NewMDNSConnWith(pc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ch := conn.Read(ctx)
+
+	peer, err := net.Dial("udp4", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("Computer.local.", dns.TypeA)
+	msg.Id = 0
+	out, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := peer.Write(out); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case req := <-ch:
+		if is, want := req.msg.Question[0].Name, "Computer.local."; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+		if is, want := req.From().String(), peer.LocalAddr().String(); is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+}
+
+func TestConnOptions(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	opts := ConnOptions{
+		IPv4Addr: &net.UDPAddr{IP: IPv4LinkLocalMulticast, Port: 5354},
+		IPv6Addr: &net.UDPAddr{IP: IPv6LinkLocalMulticast, Port: 5354},
+		Ifaces:   []string{lo.Name},
+	}
+
+	sender, err := newMDNSConnWithOptions(opts)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer sender.close()
+
+	receiver, err := newMDNSConnWithOptions(opts)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer receiver.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ch := receiver.Read(ctx)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("Computer.local.", dns.TypeA)
+	if err := sender.writeMsgTo(msg, lo, sender.addr4); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		select {
+		case req := <-ch:
+			if len(req.msg.Question) == 0 || req.msg.Question[0].Name != "Computer.local." {
+				continue
+			}
+			if is, want := req.From().Port, 5354; is != want {
+				t.Fatalf("is=%v want=%v", is, want)
+			}
+			if req.isLegacyUnicast() {
+				t.Fatal("expected multicast query")
+			}
+			return
+		case <-ctx.Done():
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestConnOptionsNetwork(t *testing.T) {
+	if _, err := newMDNSConnWithOptions(ConnOptions{Network: "tcp"}); err == nil {
+		t.Fatal("expected error for invalid network")
+	}
+
+	opts := ConnOptions{
+		IPv4Addr: &net.UDPAddr{IP: IPv4LinkLocalMulticast, Port: 5354},
+		Network:  "udp4",
+	}
+
+	conn, err := newMDNSConnWithOptions(opts)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.close()
+
+	if conn.ipv4 == nil || conn.ipv6 != nil {
+		t.Fatalf("unexpected connections ipv4=%v ipv6=%v", conn.ipv4, conn.ipv6)
+	}
+}
+
+func TestListenMulticastPortInUse(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	conn, err := listenMulticast(nil, "udp4", &net.UDPAddr{IP: IPv4LinkLocalMulticast, Port: port}, true)
+	if err == nil {
+		conn.Close()
+		t.Skip("port is shared")
+	}
+
+	if !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("is=%v want=%v", err, ErrPortInUse)
+	}
+}
+
+func TestScopedAddr(t *testing.T) {
+	iface := &net.Interface{Index: 7, Name: "eth0"}
+
+	tests := []struct {
+		addr *net.UDPAddr
+		zone string
+	}{
+		{AddrIPv6LinkLocalMulticast, "7"},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 5353}, "7"},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 5353, Zone: "eth1"}, "eth1"},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5353}, ""},
+		{AddrIPv4LinkLocalMulticast, ""},
+	}
+
+	for _, test := range tests {
+		if is, want := scopedAddr(test.addr, iface).Zone, test.zone; is != want {
+			t.Fatalf("%v is=%v want=%v", test.addr, is, want)
+		}
+	}
+
+	if is, want := scopedAddr(AddrIPv6LinkLocalMulticast, nil).Zone, ""; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestInterfaceByZone(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var ns *netns
+	for _, zone := range []string{lo.Name, strconv.Itoa(lo.Index)} {
+		iface, err := ns.interfaceByZone(zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := iface.Index, lo.Index; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+}
+
+func TestSentPackets(t *testing.T) {
+	sent := newSentPackets(nil)
+	sent.add([]byte{1, 2, 3}, 5353)
+
+	local := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 5353}
+	if !sent.isOwn([]byte{1, 2, 3}, local) {
+		t.Fatal("expected own packet")
+	}
+
+	// The same packet of another process on the local host.
+	other := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 54321}
+	if sent.isOwn([]byte{1, 2, 3}, other) {
+		t.Fatal("expected packet from other socket")
+	}
+
+	// The port of a custom connection may be unknown.
+	sent.add([]byte{4, 5, 6}, 0)
+	if !sent.isOwn([]byte{4, 5, 6}, other) {
+		t.Fatal("expected own packet")
+	}
+
+	if sent.isOwn([]byte{1, 2, 4}, local) {
+		t.Fatal("expected foreign packet")
+	}
+
+	remote := &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 5353}
+	if sent.isOwn([]byte{1, 2, 3}, remote) {
+		t.Fatal("expected packet from other host")
+	}
+}
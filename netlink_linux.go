@@ -2,55 +2,49 @@ package dnssd
 
 import (
 	"context"
-	"net"
 
-	"github.com/brutella/dnssd/log"
 	"github.com/vishvananda/netlink"
 )
 
 // linkSubscribe subscribes to network interface updates (Ethernet cable is plugged in) via the netlink API.
-// For simplicity reasons, all network interfaces are re-announced, when network interfaces change.
 func (r *responder) linkSubscribe(ctx context.Context) {
 	done := make(chan struct{})
 	defer close(done)
 
+	// The netlink sockets are created in the network namespace of the connection.
 	ch := make(chan netlink.LinkUpdate, 1)
-	if err := netlink.LinkSubscribe(ch, done); err != nil {
+	addrCh := make(chan netlink.AddrUpdate, 1)
+	err := r.netns.do(func() error {
+		if err := netlink.LinkSubscribe(ch, done); err != nil {
+			return err
+		}
+
+		if err := netlink.AddrSubscribe(addrCh, done); err != nil {
+			r.logger.Debug("Unable to wait for address updates", "err", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("dnssd: unable to wait for link updates", "err", err)
 		return
 	}
 
-	log.Debug.Println("waiting for link updates...")
+	r.logger.Debug("Waiting for link updates")
+
+	events := make(chan struct{}, 1)
+	go r.watchLinks(ctx, events)
 
 	for {
 		select {
 		case update := <-ch:
-			iface, err := net.InterfaceByIndex(int(update.Index))
-			if err != nil {
-				log.Info.Println(err)
-				continue
-			}
-
-			if isInterfaceUpAndRunning(iface) {
-				log.Debug.Printf("interface %s is up", iface.Name)
-
-				addrs, err := iface.Addrs()
-				if err == nil {
-					log.Debug.Printf("addrs %+v", addrs)
-				}
-			} else {
-				log.Debug.Printf("interface %s is down", iface.Name)
-			}
-
-			log.Debug.Println("announcing services after link update")
-			r.mutex.Lock()
-			r.announce(services(r.managed))
-			r.mutex.Unlock()
+			r.logger.Debug("Link update", "index", update.Index)
+			notifyLink(events)
+		case update := <-addrCh:
+			r.logger.Debug("Address update", "index", update.LinkIndex, "addr", update.LinkAddress.String())
+			notifyLink(events)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
-
-func isInterfaceUpAndRunning(iface *net.Interface) bool {
-	return iface.Flags&net.FlagUp == net.FlagUp && iface.Flags&net.FlagRunning == net.FlagRunning
-}
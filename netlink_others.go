@@ -1,13 +1,11 @@
-//go:build !linux
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
 
 package dnssd
 
 import (
 	"context"
-
-	"github.com/brutella/dnssd/log"
 )
 
 func (r *responder) linkSubscribe(context.Context) {
-	log.Info.Println("dnssd: unable to wait for link updates")
+	r.logger.Info("dnssd: unable to wait for link updates")
 }
@@ -0,0 +1,228 @@
+package dnssd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// netns is a network namespace, in which network interfaces are looked up.
+// A nil netns is the network namespace of the process.
+type netns struct {
+	path string
+	fd   int
+
+	// calls are called by a thread, which stays in the namespace,
+	// until closed is closed.
+	calls     chan func()
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mutex  sync.Mutex
+	ifaces map[int]*net.Interface // interfaces by index
+}
+
+// namespacer is implemented by connections, which are bound to a network namespace.
+type namespacer interface {
+	namespace() *netns
+}
+
+// netnsOf returns the network namespace of conn.
+func netnsOf(conn MDNSConn) *netns {
+	if c, ok := conn.(namespacer); ok {
+		return c.namespace()
+	}
+
+	return nil
+}
+
+// interfaces returns the network interfaces of the namespace.
+func (ns *netns) interfaces() ([]net.Interface, error) {
+	if ns == nil {
+		return net.Interfaces()
+	}
+
+	var ifaces []net.Interface
+	err := ns.do(func() error {
+		var err error
+		ifaces, err = net.Interfaces()
+		return err
+	})
+
+	return ifaces, err
+}
+
+// addrs returns the addresses of iface.
+func (ns *netns) addrs(iface *net.Interface) ([]net.Addr, error) {
+	if ns == nil {
+		return iface.Addrs()
+	}
+
+	var addrs []net.Addr
+	err := ns.do(func() error {
+		var err error
+		addrs, err = iface.Addrs()
+		return err
+	})
+
+	return addrs, err
+}
+
+// interfaceAddrs returns the addresses of all network interfaces.
+func (ns *netns) interfaceAddrs() ([]net.Addr, error) {
+	if ns == nil {
+		return net.InterfaceAddrs()
+	}
+
+	var addrs []net.Addr
+	err := ns.do(func() error {
+		var err error
+		addrs, err = net.InterfaceAddrs()
+		return err
+	})
+
+	return addrs, err
+}
+
+// interfaceByIndex returns the network interface with the index.
+// Interfaces of a namespace are cached, because every received message is
+// associated with an interface and entering a namespace is expensive.
+func (ns *netns) interfaceByIndex(index int) (*net.Interface, error) {
+	if ns == nil {
+		return net.InterfaceByIndex(index)
+	}
+
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	if iface, ok := ns.ifaces[index]; ok {
+		return iface, nil
+	}
+
+	ifaces, err := ns.interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	ns.ifaces = map[int]*net.Interface{}
+	for _, iface := range ifaces {
+		iface := iface
+		ns.ifaces[iface.Index] = &iface
+	}
+
+	if iface, ok := ns.ifaces[index]; ok {
+		return iface, nil
+	}
+
+	return nil, fmt.Errorf("no interface with index %d in network namespace %s", index, ns.path)
+}
+
+// interfaceByName returns the network interface with the name.
+// On Windows, the name is matched case-insensitively.
+func (ns *netns) interfaceByName(name string) (*net.Interface, error) {
+	if ns == nil {
+		if iface, err := net.InterfaceByName(name); err == nil {
+			return iface, nil
+		}
+	}
+
+	ifaces, err := ns.interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ifi := range ifaces {
+		if ifaceNameEqual(ifi.Name, name) {
+			return &ifi, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no interface with name %s", name)
+}
+
+// interfaceByZone returns the network interface of the IPv6 zone,
+// which is either the name or the index of the interface.
+func (ns *netns) interfaceByZone(zone string) (*net.Interface, error) {
+	if index, err := strconv.Atoi(zone); err == nil {
+		return ns.interfaceByIndex(index)
+	}
+
+	return ns.interfaceByName(zone)
+}
+
+// interfaceByIP returns the running network interface,
+// which is attached to the subnet of ip.
+func (ns *netns) interfaceByIP(ip net.IP) (*net.Interface, error) {
+	interfaces, err := ns.interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, iface := range interfaces {
+		// check interface running flag
+		if iface.Flags&net.FlagRunning != 0 {
+			addrs, _ := ns.addrs(&iface)
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok && ipnet.Contains(ip) {
+					return &iface, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("could not find interface by %v", ip)
+}
+
+// multicastInterfaces returns the active multicast network interfaces
+// of the namespace like MulticastInterfaces.
+func (ns *netns) multicastInterfaces(filters ...string) []*net.Interface {
+	return ns.filterInterfaces(filters, nil)
+}
+
+// filterInterfaces returns the active multicast network interfaces of the namespace,
+// whose names match filters. If fn is not nil, only interfaces for which fn returns
+// true are returned, and ExcludeInterfaceFunc is not applied.
+func (ns *netns) filterInterfaces(filters []string, fn func(net.Interface) bool) []*net.Interface {
+	var tmp []*net.Interface
+	ifaces, err := ns.interfaces()
+	if err != nil {
+		return nil
+	}
+
+	for _, iface := range ifaces {
+		iface := iface
+		if (iface.Flags & net.FlagUp) == 0 {
+			continue
+		}
+
+		if (iface.Flags&net.FlagMulticast) == 0 && !isExplicitLoopback(iface, filters) {
+			continue
+		}
+
+		if !containsIfaces(iface.Name, filters) {
+			continue
+		}
+
+		if fn != nil {
+			if !fn(iface) {
+				continue
+			}
+		} else if isExcludedIface(iface, filters) {
+			continue
+		}
+
+		// check for a valid ip at that interface
+		addrs, err := ns.addrs(&iface)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if _, _, err := net.ParseCIDR(addr.String()); err == nil {
+				tmp = append(tmp, &iface)
+				break
+			}
+		}
+	}
+
+	return tmp
+}
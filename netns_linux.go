@@ -0,0 +1,85 @@
+package dnssd
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// openNetns opens the network namespace at path,
+// e.g. /var/run/netns/blue or /proc/<pid>/ns/net.
+func openNetns(path string) (*netns, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening network namespace %s: %w", path, err)
+	}
+
+	ns := &netns{
+		path:   path,
+		fd:     fd,
+		calls:  make(chan func()),
+		closed: make(chan struct{}),
+	}
+
+	errs := make(chan error, 1)
+	go ns.serve(errs)
+	if err := <-errs; err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return ns, nil
+}
+
+// serve enters the network namespace and calls the functions of do,
+// until the namespace is closed. Entering a namespace is expensive,
+// which is why one thread stays in the namespace for all calls.
+func (ns *netns) serve(errs chan<- error) {
+	// The thread is not unlocked, so that it is terminated
+	// when the goroutine exits, instead of being reused
+	// by other goroutines in the namespace.
+	runtime.LockOSThread()
+
+	if err := unix.Setns(ns.fd, unix.CLONE_NEWNET); err != nil {
+		errs <- fmt.Errorf("entering network namespace %s: %w", ns.path, err)
+		return
+	}
+	errs <- nil
+
+	for {
+		select {
+		case fn := <-ns.calls:
+			fn()
+		case <-ns.closed:
+			return
+		}
+	}
+}
+
+// do calls fn in the network namespace. Sockets which are created by fn
+// stay in the namespace after do returns. fn must not call do.
+func (ns *netns) do(fn func() error) error {
+	if ns == nil {
+		return fn()
+	}
+
+	errs := make(chan error, 1)
+	select {
+	case ns.calls <- func() { errs <- fn() }:
+		return <-errs
+	case <-ns.closed:
+		return fmt.Errorf("network namespace %s is closed", ns.path)
+	}
+}
+
+// close stops the thread in the namespace and
+// closes the file descriptor of the namespace.
+func (ns *netns) close() {
+	if ns != nil {
+		ns.closeOnce.Do(func() {
+			close(ns.closed)
+			unix.Close(ns.fd)
+		})
+	}
+}
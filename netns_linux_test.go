@@ -0,0 +1,134 @@
+package dnssd
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// newTestNetns returns the file descriptor of a new network namespace.
+func newTestNetns() (int, error) {
+	type result struct {
+		fd  int
+		err error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		// The thread is terminated with the goroutine.
+		runtime.LockOSThread()
+
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			ch <- result{err: err}
+			return
+		}
+
+		fd, err := unix.Open("/proc/thread-self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		ch <- result{fd, err}
+	}()
+
+	r := <-ch
+	return r.fd, r.err
+}
+
+func TestNetns(t *testing.T) {
+	fd, err := newTestNetns()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer unix.Close(fd)
+
+	ns, err := openNetns(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.close()
+
+	// A new network namespace only contains the loopback interface.
+	ifaces, err := ns.interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(ifaces), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	lo, err := ns.interfaceByIndex(ifaces[0].Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := lo.Flags&net.FlagLoopback != 0, true; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The loopback interface is down and has no multicast interfaces.
+	if is, want := len(ns.multicastInterfaces()), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestNewMDNSConnInNetns(t *testing.T) {
+	fd, err := newTestNetns()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer unix.Close(fd)
+
+	conn, err := NewMDNSConnWithOptions(ConnOptions{Netns: fmt.Sprintf("/proc/self/fd/%d", fd)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := ShareConn(conn)
+	defer shared.Shutdown()
+
+	ns := netnsOf(shared)
+	if ns == nil {
+		t.Fatal("expected network namespace")
+	}
+
+	r := newResponder(shared)
+	if is, want := r.netns, ns; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(linkState(r.netns)), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestNetnsDoReusesThread(t *testing.T) {
+	fd, err := newTestNetns()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer unix.Close(fd)
+
+	ns, err := openNetns(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every call is made by the same thread in the namespace.
+	var tids []int
+	for i := 0; i < 2; i++ {
+		ns.do(func() error {
+			tids = append(tids, unix.Gettid())
+			return nil
+		})
+	}
+
+	if is, want := tids[0], tids[1]; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	ns.close()
+	if err := ns.do(func() error { return nil }); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package dnssd
+
+import (
+	"fmt"
+)
+
+// openNetns returns an error, because network namespaces are only supported on Linux.
+func openNetns(path string) (*netns, error) {
+	return nil, fmt.Errorf("network namespaces are not supported")
+}
+
+// do calls fn.
+func (ns *netns) do(fn func() error) error {
+	if ns != nil {
+		return fmt.Errorf("network namespaces are not supported")
+	}
+
+	return fn()
+}
+
+// close does nothing.
+func (ns *netns) close() {}
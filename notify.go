@@ -0,0 +1,130 @@
+package dnssd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// SdNotify sends state, e.g. "READY=1" or "STOPPING=1", to the service manager
+// at the socket in $NOTIFY_SOCKET (see sd_notify(3)). It does nothing, if the
+// process was not started by systemd with Type=notify.
+func SdNotify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+
+	// A leading @ refers to the abstract namespace.
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// SdNotifyReady returns a status function, which sends "READY=1" to the service
+// manager once n services are registered, e.g. the StatusFunc of the services
+// of a systemd unit. Errors are logged.
+func SdNotifyReady(n int) StatusFunc {
+	var mutex sync.Mutex
+	registered := map[string]bool{}
+	ready := false
+
+	return func(e StatusEvent) {
+		if e.Status != StatusRegistered {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		registered[e.Service.EscapedServiceInstanceName()] = true
+		if ready || len(registered) < n {
+			return
+		}
+		ready = true
+
+		if err := SdNotify("READY=1"); err != nil {
+			defaultLogger.Debug("dnssd: notifying service manager failed", "err", err)
+		}
+	}
+}
+
+// sdListenFDsStart is the first file descriptor passed by the service manager.
+const sdListenFDsStart = 3
+
+// SdListenConns returns the UDP sockets, which are passed by the service manager
+// with socket activation (see sd_listen_fds(3)), e.g. of a socket unit with
+// ListenDatagram=0.0.0.0:5353. Use them as ConnOptions.Conns, so that the mDNS
+// port stays bound while the service is restarted. It returns nil, if no sockets
+// are passed to the process. The environment variables are unset.
+func SdListenConns() ([]*net.UDPConn, error) {
+	fds := sdListenFDs(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var conns []*net.UDPConn
+	for _, fd := range fds {
+		conn, err := udpConnFromFD(fd)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	return conns, nil
+}
+
+// sdListenFDs returns the file descriptors, which are passed to the process
+// according to the values of LISTEN_PID and LISTEN_FDS.
+func sdListenFDs(pid, n string) []int {
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		return nil
+	}
+
+	count, err := strconv.Atoi(n)
+	if err != nil || count <= 0 {
+		return nil
+	}
+
+	fds := make([]int, count)
+	for i := range fds {
+		fds[i] = sdListenFDsStart + i
+	}
+
+	return fds
+}
+
+// udpConnFromFD returns the UDP connection of the socket fd.
+// The file descriptor is closed.
+func udpConnFromFD(fd int) (*net.UDPConn, error) {
+	f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+	defer f.Close()
+
+	pc, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket %d: %w", fd, err)
+	}
+
+	conn, ok := pc.(*net.UDPConn)
+	if !ok {
+		pc.Close()
+		return nil, fmt.Errorf("socket %d is not a UDP socket", fd)
+	}
+
+	return conn, nil
+}
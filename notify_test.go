@@ -0,0 +1,109 @@
+//go:build !windows
+
+package dnssd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSdNotifyReady(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	srv1, _ := NewService(Config{Name: "One", Type: "_asdf._tcp", Port: 1234})
+	srv2, _ := NewService(Config{Name: "Two", Type: "_asdf._tcp", Port: 1234})
+
+	fn := SdNotifyReady(2)
+	fn(StatusEvent{Status: StatusProbing, Service: srv1})
+	fn(StatusEvent{Status: StatusRegistered, Service: srv1})
+	fn(StatusEvent{Status: StatusRegistered, Service: srv1})
+	fn(StatusEvent{Status: StatusRegistered, Service: srv2})
+	fn(StatusEvent{Status: StatusRegistered, Service: srv2})
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 64)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := string(b[:n]), "READY=1"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// READY=1 is only sent once.
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(b); err == nil {
+		t.Fatal("expected no more messages")
+	}
+}
+
+func TestSdListenFDs(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	if is, want := sdListenFDs(pid, "2"), []int{3, 4}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// The sockets are passed to another process.
+	if is := sdListenFDs("1", "2"); is != nil {
+		t.Fatalf("unexpected file descriptors %v", is)
+	}
+
+	if is := sdListenFDs(pid, ""); is != nil {
+		t.Fatalf("unexpected file descriptors %v", is)
+	}
+}
+
+func TestUDPConnFromFD(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	f, err := conn.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The file descriptor is closed by udpConnFromFD.
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passed, err := udpConnFromFD(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := passed.LocalAddr().String(), conn.LocalAddr().String(); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	mc, err := newMDNSConnWithOptions(ConnOptions{Conns: []*net.UDPConn{passed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.close()
+
+	// The passed socket is used for IPv4 instead of opening sockets.
+	if mc.udpConn4 != passed || mc.udpConn6 != nil {
+		t.Fatal("passed socket is not used")
+	}
+}
@@ -0,0 +1,107 @@
+package dnssd
+
+import (
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+)
+
+// ownPacketTimeout is the duration in which a received packet
+// is compared with the packets sent by a connection.
+const ownPacketTimeout = 2 * time.Second
+
+// sentPackets remembers the packets sent by a connection
+// to recognize them when they are received via multicast loopback.
+type sentPackets struct {
+	mutex   sync.Mutex
+	packets map[sentPacket]time.Time
+
+	// netns is the network namespace of the connection
+	netns *netns
+}
+
+// sentPacket is the hash of a sent packet
+// and the local port of the socket which sent it.
+type sentPacket struct {
+	hash uint64
+	port int
+}
+
+func newSentPackets(ns *netns) *sentPackets {
+	return &sentPackets{packets: map[sentPacket]time.Time{}, netns: ns}
+}
+
+func packetHash(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// localPort returns the local port of pc, or 0 if it is unknown.
+func localPort(pc interface{ LocalAddr() net.Addr }) int {
+	if addr, ok := pc.LocalAddr().(*net.UDPAddr); ok {
+		return addr.Port
+	}
+
+	return 0
+}
+
+// add remembers the packet b, which was sent from the local port.
+// If port is 0, the packet is recognized from any port.
+func (s *sentPackets) add(b []byte, port int) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for p, t := range s.packets {
+		if now.Sub(t) > ownPacketTimeout {
+			delete(s.packets, p)
+		}
+	}
+	s.packets[sentPacket{packetHash(b), port}] = now
+}
+
+// isOwn returns true, if the packet b from the address from was recently
+// sent by the connection from the same port and the address belongs to
+// the local host. A byte-identical packet of another process on the local
+// host is only treated as own packet, if it was sent from the same port.
+func (s *sentPackets) isOwn(b []byte, from *net.UDPAddr) bool {
+	if s == nil || from == nil {
+		return false
+	}
+
+	h := packetHash(b)
+	s.mutex.Lock()
+	t, ok := s.packets[sentPacket{h, from.Port}]
+	if !ok {
+		t, ok = s.packets[sentPacket{h, 0}]
+	}
+	s.mutex.Unlock()
+
+	if !ok || time.Since(t) > ownPacketTimeout {
+		return false
+	}
+
+	return isLocalIP(from.IP, s.netns)
+}
+
+// isLocalIP returns true, if ip is an address of a local network interface in ns.
+func isLocalIP(ip net.IP, ns *netns) bool {
+	addrs, err := ns.interfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
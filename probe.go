@@ -1,110 +1,316 @@
 package dnssd
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
 	"math/rand"
 	"net"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/brutella/dnssd/log"
 	"github.com/miekg/dns"
 )
 
 // ProbeService probes for the hostname and service instance name of srv.
 // If err == nil, the returned service is verified to be unique on the local network.
 func ProbeService(ctx context.Context, srv Service) (Service, error) {
-	conn, err := newMDNSConn(srv.Ifaces...)
-
+	probed, err := ProbeServices(ctx, []Service{srv})
 	if err != nil {
 		return srv, err
 	}
 
-	defer conn.close()
+	return probed[0], nil
+}
+
+// ProbeConfig configures probing.
+type ProbeConfig struct {
+	// Timeout is the maximum duration of probing.
+	// If zero, probing fails after one minute. (RFC6762 9)
+	Timeout time.Duration
+
+	// Delay is the upper bound of the random delay before the first probe query.
+	// If zero, the delay is in the range 0-250ms. (RFC6762 8.1)
+	// If negative, probing starts immediately.
+	Delay time.Duration
+
+	// Attempts is the number of probe queries.
+	// If zero, 3 probe queries are sent. (RFC6762 8.1)
+	Attempts int
+
+	// Interval is the time between probe queries.
+	// If zero, probe queries are sent 250ms apart. (RFC6762 8.1)
+	Interval time.Duration
+
+	// Conn is the connection used for probing.
+	// If nil, a new connection is opened and closed after probing.
+	Conn MDNSConn
+
+	// RenameService returns a new service instance name after a conflict.
+	// If nil, a number is appended to the name, e.g. "Name (2)".
+	RenameService RenameFunc
+
+	// RenameHost returns a new host name after a conflict.
+	// If nil, a number is appended to the name, e.g. "Host-2".
+	RenameHost RenameFunc
+
+	// connOptions configures the connection, which is opened if Conn is nil.
+	connOptions ConnOptions
+}
+
+// newConn returns a new connection for probing at the network interfaces ifaces.
+func (c ProbeConfig) newConn(ifaces ...string) (*mdnsConn, error) {
+	opts := c.connOptions
+	opts.Ifaces = ifaces
+
+	return newMDNSConnWithOptions(opts)
+}
+
+// RenameFunc returns a new name for name, which was found to be in use on the network.
+// count is the number of the attempt and starts at 2.
+// The final names are returned by the probing functions and reported
+// as StatusNameChanged to the StatusFunc of a service.
+type RenameFunc func(name string, count int) string
+
+func (c ProbeConfig) withDefaults() ProbeConfig {
+	if c.Timeout <= 0 {
+		c.Timeout = 60 * time.Second
+	}
+
+	if c.Delay == 0 {
+		c.Delay = 250 * time.Millisecond
+	}
+
+	if c.Attempts <= 0 {
+		c.Attempts = 3
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = 250 * time.Millisecond
+	}
+
+	if c.RenameService == nil {
+		c.RenameService = incrementServiceName
+	}
+
+	if c.RenameHost == nil {
+		c.RenameHost = incrementHostname
+	}
+
+	return c
+}
+
+// ProbeServices probes for the hostnames and service instance names of srvs.
+// All names are probed together in one probe message per network interface,
+// and hostnames shared by multiple services are only probed once.
+// If err == nil, the returned services are verified to be unique on the local network.
+func ProbeServices(ctx context.Context, srvs []Service) ([]Service, error) {
+	return ProbeServicesWithConfig(ctx, srvs, ProbeConfig{})
+}
+
+// ProbeServicesWithConfig probes for the hostnames and service instance names of srvs
+// like ProbeServices, using the timing and connection specified by cfg.
+func ProbeServicesWithConfig(ctx context.Context, srvs []Service, cfg ProbeConfig) ([]Service, error) {
+	if len(srvs) == 0 {
+		return srvs, nil
+	}
+
+	cfg = cfg.withDefaults()
+
+	conn := cfg.Conn
+	if conn == nil {
+		c, err := cfg.newConn(probeIfaces(srvs)...)
+		if err != nil {
+			return srvs, err
+		}
+		defer c.close()
+		conn = c
+	}
 
 	// After one minute of probing, if the Multicast DNS responder has been
 	// unable to find any unused name, it should log an error (RFC6762 9)
-	probeCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	probeCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
 	defer cancel()
 
 	// When ready to send its Multicast DNS probe packet(s) the host should
 	// first wait for a short random delay time, uniformly distributed in
 	// the range 0-250 ms. (RFC6762 8.1)
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	delay := time.Duration(r.Intn(250)) * time.Millisecond
-	log.Debug.Println("Probing delay", delay)
-	time.Sleep(delay)
+	if cfg.Delay > 0 {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		delay := time.Duration(r.Int63n(int64(cfg.Delay)))
+		loggerFrom(ctx).Debug("Probing delay", "delay", delay)
+		sleep(clockFrom(ctx), delay)
+	}
 
-	return probeService(probeCtx, conn, srv, 250*time.Millisecond, false)
+	return probeServices(probeCtx, conn, srvs, cfg, cfg.Interval, false)
 }
 
+// ReprobeService probes for the hostname and service instance name of srv
+// after a conflict was detected.
 func ReprobeService(ctx context.Context, srv Service) (Service, error) {
-	conn, err := newMDNSConn(srv.Ifaces...)
+	return ReprobeServiceWithConfig(ctx, srv, ProbeConfig{})
+}
+
+// ReprobeServiceWithConfig probes for the hostname and service instance name of srv
+// like ReprobeService, using the timing and connection specified by cfg.
+func ReprobeServiceWithConfig(ctx context.Context, srv Service, cfg ProbeConfig) (Service, error) {
+	cfg = cfg.withDefaults()
 
+	conn := cfg.Conn
+	if conn == nil {
+		c, err := cfg.newConn(srv.Ifaces...)
+		if err != nil {
+			return srv, err
+		}
+		defer c.close()
+		conn = c
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	probed, err := probeServices(probeCtx, conn, []Service{srv}, cfg, cfg.Interval, true)
 	if err != nil {
 		return srv, err
 	}
 
-	defer conn.close()
-	return probeService(ctx, conn, srv, 250*time.Millisecond, true)
+	return probed[0], nil
+}
+
+// probeIfaces returns the names of the network interfaces at which srvs are registered.
+// If any service is registered at all interfaces, no names are returned.
+func probeIfaces(srvs []Service) []string {
+	var ifaces []string
+	for _, srv := range srvs {
+		if len(srv.Ifaces) == 0 {
+			return nil
+		}
+		for _, name := range srv.Ifaces {
+			if len(ifaces) == 0 || !containsIfaces(name, ifaces) {
+				ifaces = append(ifaces, name)
+			}
+		}
+	}
+
+	return ifaces
 }
 
 func probeService(ctx context.Context, conn MDNSConn, srv Service, delay time.Duration, probeOnce bool) (s Service, e error) {
-	candidate := srv.Copy()
-	prevConflict := probeConflict{}
+	probed, err := probeServices(ctx, conn, []Service{srv}, ProbeConfig{}.withDefaults(), delay, probeOnce)
+	if err != nil {
+		e = err
+		return
+	}
+
+	if len(probed) > 0 {
+		s = probed[0]
+	}
+
+	return
+}
+
+func probeServices(ctx context.Context, conn MDNSConn, srvs []Service, cfg ProbeConfig, delay time.Duration, probeOnce bool) (result []Service, e error) {
+	candidates := make([]*Service, len(srvs))
+	for i, srv := range srvs {
+		candidates[i] = srv.Copy()
+	}
+	prevConflicts := make([]probeConflict, len(srvs))
+
+	logger := loggerFrom(ctx)
 
 	// Keep track of the number of conflicts
 	numHostConflicts := 0
-	numNameConflicts := 0
+	numNameConflicts := make([]int, len(srvs))
+	numExtraHostConflicts := make([]int, len(srvs))
 
 	for i := 1; i <= 100; i++ {
-		conflict, err := probe(ctx, conn, *candidate)
+		services := make([]Service, len(candidates))
+		for j, candidate := range candidates {
+			services[j] = *candidate
+		}
+
+		conflicts, err := probe(ctx, conn, services, cfg)
 		if err != nil {
 			e = err
 			return
 		}
 
-		if conflict.hasNone() {
-			s = *candidate
+		if !hasAnyConflict(conflicts) {
+			result = services
 			return
 		}
 
-		candidate = candidate.Copy()
+		// Services with the same host are renamed together.
+		renamedHosts := map[string]string{}
 
-		if conflict.hostname && (prevConflict.hostname || probeOnce) {
-			numHostConflicts++
-			candidate.Host = incrementHostname(candidate.Host, numHostConflicts+1)
-			conflict.hostname = false
-		}
+		for j, conflict := range conflicts {
+			candidate := candidates[j].Copy()
+
+			if conflict.hostname && (prevConflicts[j].hostname || probeOnce) {
+				if renamed, ok := renamedHosts[candidate.Host]; ok {
+					candidate.Host = renamed
+				} else {
+					numHostConflicts++
+					renamed := validHostname(cfg.RenameHost(candidate.Host, numHostConflicts+1))
+					renamedHosts[candidate.Host] = renamed
+					candidate.Host = renamed
+				}
+				conflict.hostname = false
+			}
+
+			if conflict.serviceName && (prevConflicts[j].serviceName || probeOnce) {
+				numNameConflicts[j]++
+				candidate.Name = cfg.RenameService(candidate.Name, numNameConflicts[j]+1)
+				conflict.serviceName = false
+			}
 
-		if conflict.serviceName && (prevConflict.serviceName || probeOnce) {
-			numNameConflicts++
-			candidate.Name = incrementServiceName(candidate.Name, numNameConflicts+1)
-			conflict.serviceName = false
+			if len(conflict.hosts) > 0 && (len(prevConflicts[j].hosts) > 0 || probeOnce) {
+				numExtraHostConflicts[j]++
+				hosts := append([]string(nil), candidate.Hosts...)
+				for k, name := range candidate.HostNames() {
+					if containsName(conflict.hosts, name) {
+						hosts[k] = validHostname(cfg.RenameHost(hosts[k], numExtraHostConflicts[j]+1))
+					}
+				}
+				candidate.Hosts = hosts
+				conflict.hosts = nil
+			}
+
+			candidates[j] = candidate
+			prevConflicts[j] = conflict
 		}
 
-		prevConflict = conflict
+		for _, candidate := range candidates {
+			if renamed, ok := renamedHosts[candidate.Host]; ok {
+				candidate.Host = renamed
+			}
+		}
 
-		if conflict.hasAny() {
+		if hasAnyConflict(prevConflicts) {
 			// If the host finds that its own data is lexicographically earlier,
 			// then it defers to the winning host by waiting one second,
 			// and then begins probing for this record again. (RFC6762 8.2)
-			log.Debug.Println("Increase wait time after receiving conflicting data")
+			logger.Debug("Increase wait time after receiving conflicting data")
 			delay = 1 * time.Second
 		}
 
-		log.Debug.Println("Probing wait", delay)
-		time.Sleep(delay)
+		logger.Debug("Probing wait", "delay", delay)
+		sleep(clockFrom(ctx), delay)
 	}
 
 	return
 }
 
-func probe(ctx context.Context, conn MDNSConn, service Service) (conflict probeConflict, err error) {
+func probe(ctx context.Context, conn MDNSConn, services []Service, cfg ProbeConfig) (conflicts []probeConflict, err error) {
+	conflicts = make([]probeConflict, len(services))
+	logger := loggerFrom(ctx)
+
 	var queries []*Query
-	for _, iface := range service.Interfaces() {
-		queries = append(queries, probeQuery(service, iface))
+	for _, iface := range interfacesOf(services) {
+		if q := probeQuery(services, iface); q != nil {
+			queries = append(queries, q)
+		}
 	}
 
 	readCtx, readCancel := context.WithCancel(ctx)
@@ -115,7 +321,8 @@ func probe(ctx context.Context, conn MDNSConn, service Service) (conflict probeC
 	conn.Drain(readCtx)
 	ch := conn.Read(readCtx)
 
-	queryTime := time.After(1 * time.Millisecond)
+	clock := clockFrom(ctx)
+	queryTime := clock.After(1 * time.Millisecond)
 	queriesCount := 1
 
 	for {
@@ -126,28 +333,63 @@ func probe(ctx context.Context, conn MDNSConn, service Service) (conflict probeC
 				continue
 			}
 
-			reqAs, reqAAAAs, reqSRVs := splitRecords(filterRecords(rsp, &service))
-
-			as := A(service, rsp.iface)
-			aaaas := AAAA(service, rsp.iface)
-
-			if len(reqAs) > 0 && len(as) > 0 && areDenyingAs(reqAs, as) {
-				log.Debug.Printf("%v:%d@%s denies A\n", rsp.from.IP, rsp.from.Port, rsp.IfaceName())
-				log.Debug.Println(reqAs)
-				log.Debug.Println(as)
-				conflict.hostname = true
+			if rsp.own {
+				// Ignore our own probes received via multicast loopback.
+				continue
 			}
 
-			if len(reqAAAAs) > 0 && len(aaaas) > 0 && areDenyingAAAAs(reqAAAAs, aaaas) {
-				log.Debug.Printf("%v:%d@%s denies AAAA\n", rsp.from.IP, rsp.from.Port, rsp.IfaceName())
-				log.Debug.Println(reqAAAAs)
-				log.Debug.Println(aaaas)
-				conflict.hostname = true
+			// Simultaneous probes for the same names are resolved
+			// by comparing the proposed records. (RFC6762 8.2)
+			if isProbeQuery(rsp.msg) {
+				for i, service := range services {
+					conflict := tiebreak(service, rsp)
+					conflict.hostname = conflict.hostname && !service.hostVerified
+					if conflict.hostname {
+						logger.Debug("Lost hostname tiebreak", "peer", rsp.from, "iface", rsp.IfaceName(), "host", service.Hostname())
+						conflicts[i].hostname = true
+					}
+					if conflict.serviceName {
+						logger.Debug("Lost service name tiebreak", "peer", rsp.from, "iface", rsp.IfaceName(), "service", service.ServiceInstanceName())
+						conflicts[i].serviceName = true
+					}
+					if len(conflict.hosts) > 0 {
+						logger.Debug("Lost host name tiebreak", "peer", rsp.from, "iface", rsp.IfaceName(), "hosts", conflict.hosts)
+						conflicts[i].hosts = appendNames(conflicts[i].hosts, conflict.hosts...)
+					}
+				}
+				continue
 			}
 
-			// If the service instance name is already taken from another host,
-			// we have a service instance name conflict
-			conflict.serviceName = len(reqSRVs) > 0
+			for i, service := range services {
+				service := service
+				reqAs, reqAAAAs, reqSRVs := splitRecords(filterRecords(rsp, &service))
+
+				as := A(service, rsp.iface)
+				aaaas := AAAA(service, rsp.iface)
+				if service.hostVerified {
+					// The hostname is already owned by the responder.
+					as, aaaas = nil, nil
+				}
+
+				if len(reqAs) > 0 && len(as) > 0 && areDenyingAs(reqAs, as, logger) {
+					logger.Debug("Denying A records", "peer", rsp.from, "iface", rsp.IfaceName(), "theirs", reqAs, "ours", as)
+					conflicts[i].hostname = true
+				}
+
+				if len(reqAAAAs) > 0 && len(aaaas) > 0 && areDenyingAAAAs(reqAAAAs, aaaas, logger) {
+					logger.Debug("Denying AAAA records", "peer", rsp.from, "iface", rsp.IfaceName(), "theirs", reqAAAAs, "ours", aaaas)
+					conflicts[i].hostname = true
+				}
+
+				if names := conflictingHosts(rsp, service, logger); len(names) > 0 {
+					logger.Debug("Denying address records of additional host names", "peer", rsp.from, "iface", rsp.IfaceName(), "hosts", names)
+					conflicts[i].hosts = appendNames(conflicts[i].hosts, names...)
+				}
+
+				// If the service instance name is already taken from another host,
+				// we have a service instance name conflict
+				conflicts[i].serviceName = len(reqSRVs) > 0
+			}
 
 		case <-ctx.Done():
 			err = ctx.Err()
@@ -155,61 +397,116 @@ func probe(ctx context.Context, conn MDNSConn, service Service) (conflict probeC
 
 		case <-queryTime:
 			// Stop on conflict
-			if conflict.hasAny() {
-				return conflict, err
+			if hasAnyConflict(conflicts) {
+				return conflicts, err
 			}
 
-			// Stop after 3 probe queries
-			if queriesCount > 3 {
+			// Stop after all probe queries were sent
+			if queriesCount > cfg.Attempts {
 				return
 			}
 
 			queriesCount++
 			for _, q := range queries {
-				log.Debug.Println("Sending probe", q.iface.Name, q.msg)
+				logger.Debug("Sending probe", "iface", q.iface.Name, "msg", q.msg)
 				if err := conn.SendQuery(q); err != nil {
-					log.Debug.Println("Sending probe err:", err)
+					logger.Debug("Sending probe failed", "iface", q.iface.Name, "err", err)
 				}
 			}
 
-			delay := 250 * time.Millisecond
-			log.Debug.Println("Waiting for conflicting data", delay)
-			queryTime = time.After(delay)
+			logger.Debug("Waiting for conflicting data", "delay", cfg.Interval)
+			queryTime = clock.After(cfg.Interval)
+		}
+	}
+}
+
+// interfacesOf returns the network interfaces at which services are registered.
+func interfacesOf(services []Service) []*net.Interface {
+	var ifaces []*net.Interface
+	for _, service := range services {
+		for _, iface := range service.Interfaces() {
+			found := false
+			for _, ifi := range ifaces {
+				if ifi.Name == iface.Name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ifaces = append(ifaces, iface)
+			}
 		}
 	}
+
+	return ifaces
 }
 
-func probeQuery(service Service, iface *net.Interface) *Query {
+// probeQuery returns one probe query for all services, which are visible at iface.
+// Hostnames which are shared by multiple services are only included once.
+func probeQuery(services []Service, iface *net.Interface) *Query {
 	msg := new(dns.Msg)
 
-	instanceQ := dns.Question{
-		Name:   service.EscapedServiceInstanceName(),
-		Qtype:  dns.TypeANY,
-		Qclass: dns.ClassINET,
-	}
+	var questions []dns.Question
+	var authority []dns.RR
+	hosts := map[string]bool{}
 
-	hostQ := dns.Question{
-		Name:   service.Hostname(),
-		Qtype:  dns.TypeANY,
-		Qclass: dns.ClassINET,
-	}
+	for _, service := range services {
+		if !service.IsVisibleAtInterface(iface.Name) {
+			continue
+		}
 
-	setQuestionUnicast(&instanceQ)
-	setQuestionUnicast(&hostQ)
+		instanceQ := dns.Question{
+			Name:   service.EscapedServiceInstanceName(),
+			Qtype:  dns.TypeANY,
+			Qclass: dns.ClassINET,
+		}
+		setQuestionUnicast(&instanceQ)
+		questions = append(questions, instanceQ)
+		authority = append(authority, SRV(service))
 
-	msg.Question = []dns.Question{instanceQ, hostQ}
+		extra := extraAddressRecords(service, iface)
+		for _, name := range service.HostNames() {
+			if hosts[name] {
+				continue
+			}
+			hosts[name] = true
 
-	srv := SRV(service)
-	as := A(service, iface)
-	aaaas := AAAA(service, iface)
+			q := dns.Question{
+				Name:   name,
+				Qtype:  dns.TypeANY,
+				Qclass: dns.ClassINET,
+			}
+			setQuestionUnicast(&q)
+			questions = append(questions, q)
+			authority = append(authority, extra[strings.ToLower(name)]...)
+		}
+
+		if service.hostVerified || hosts[service.Hostname()] {
+			continue
+		}
+		hosts[service.Hostname()] = true
 
-	var authority = []dns.RR{srv}
-	for _, a := range as {
-		authority = append(authority, a)
+		hostQ := dns.Question{
+			Name:   service.Hostname(),
+			Qtype:  dns.TypeANY,
+			Qclass: dns.ClassINET,
+		}
+		setQuestionUnicast(&hostQ)
+		questions = append(questions, hostQ)
+
+		for _, a := range A(service, iface) {
+			authority = append(authority, a)
+		}
+		for _, aaaa := range AAAA(service, iface) {
+			authority = append(authority, aaaa)
+		}
 	}
-	for _, aaaa := range aaaas {
-		authority = append(authority, aaaa)
+
+	if len(questions) == 0 {
+		return nil
 	}
+
+	msg.Question = questions
 	msg.Ns = authority
 
 	return &Query{msg: msg, iface: iface}
@@ -218,33 +515,235 @@ func probeQuery(service Service, iface *net.Interface) *Query {
 type probeConflict struct {
 	hostname    bool
 	serviceName bool
+
+	// hosts are the conflicting additional host names.
+	hosts []string
 }
 
 func (pr probeConflict) hasNone() bool {
-	return !pr.hostname && !pr.serviceName
+	return !pr.hasAny()
 }
 
 func (pr probeConflict) hasAny() bool {
-	return pr.hostname || pr.serviceName
+	return pr.hostname || pr.serviceName || len(pr.hosts) > 0
 }
 
-func isDenyingA(this *dns.A, that *dns.A) bool {
-	if strings.EqualFold(this.Hdr.Name, that.Hdr.Name) {
-		log.Debug.Println("Same hosts")
+func hasAnyConflict(conflicts []probeConflict) bool {
+	for _, conflict := range conflicts {
+		if conflict.hasAny() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isProbeQuery returns true, if msg is a probe query,
+// which contains the proposed records in the authority section. (RFC6762 8.2)
+func isProbeQuery(msg *dns.Msg) bool {
+	return !msg.Response && len(msg.Question) > 0 && len(msg.Ns) > 0
+}
+
+// tiebreak compares the records of service with the proposed records in the
+// probe query req and returns a conflict for every name, for which service
+// loses the tiebreak. (RFC6762 8.2.1)
+func tiebreak(service Service, req *Request) probeConflict {
+	var conflict probeConflict
+	if !service.IsVisibleAtInterface(req.iface.Name) {
+		return conflict
+	}
+
+	theirSRVs := recordsNamed(req.msg.Ns, service.EscapedServiceInstanceName())
+	if len(theirSRVs) > 0 {
+		conflict.serviceName = compareRRSets([]dns.RR{SRV(service)}, theirSRVs) < 0
+	}
+
+	theirAddrs := recordsNamed(req.msg.Ns, service.Hostname())
+	if len(theirAddrs) > 0 {
+		conflict.hostname = compareRRSets(addressRecords(service, req.iface), theirAddrs) < 0
+	}
+
+	extra := extraAddressRecords(service, req.iface)
+	for _, name := range service.HostNames() {
+		theirs := recordsNamed(req.msg.Ns, name)
+		if len(theirs) > 0 && compareRRSets(extra[strings.ToLower(name)], theirs) < 0 {
+			conflict.hosts = append(conflict.hosts, name)
+		}
+	}
+
+	return conflict
+}
+
+// conflictingHosts returns the additional host names of service, for which req
+// contains address records, which deny the address records of service at the interface.
+func conflictingHosts(req *Request, service Service, logger *slog.Logger) []string {
+	if len(service.Hosts) == 0 || req.iface == nil || !service.IsVisibleAtInterface(req.iface.Name) {
+		return nil
+	}
+
+	var all []dns.RR
+	all = append(all, req.msg.Answer...)
+	all = append(all, req.msg.Ns...)
+	all = append(all, withoutOPT(req.msg.Extra)...)
+
+	extra := extraAddressRecords(service, req.iface)
+
+	var names []string
+	for _, name := range service.HostNames() {
+		as, aaaas, _ := splitRecords(extra[strings.ToLower(name)])
+
+		var reqAs []*dns.A
+		var reqAAAAs []*dns.AAAA
+		for _, rr := range recordsNamed(all, name) {
+			switch rr := rr.(type) {
+			case *dns.A:
+				// Ignore the addresses of the service at other interfaces.
+				if !service.HasIPOnAnyInterface(rr.A) {
+					reqAs = append(reqAs, rr)
+				}
+			case *dns.AAAA:
+				if !service.HasIPOnAnyInterface(rr.AAAA) {
+					reqAAAAs = append(reqAAAAs, rr)
+				}
+			}
+		}
+
+		if len(reqAs) > 0 && len(as) > 0 && areDenyingAs(reqAs, as, logger) || len(reqAAAAs) > 0 && len(aaaas) > 0 && areDenyingAAAAs(reqAAAAs, aaaas, logger) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// appendNames appends the names to names, which are not already contained.
+func appendNames(names []string, add ...string) []string {
+	for _, name := range add {
+		if !containsName(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// containsName returns true, if names contains name ignoring the case.
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordsNamed returns the records in rrs with the name.
+func recordsNamed(rrs []dns.RR, name string) []dns.RR {
+	var result []dns.RR
+	for _, rr := range rrs {
+		if strings.EqualFold(rr.Header().Name, name) {
+			result = append(result, rr)
+		}
+	}
+
+	return result
+}
+
+// compareRRSets compares the records in this and that lexicographically
+// and returns -1, if this is earlier, 1 if this is later, or 0 if both are equal.
+// The records are sorted by class, type and rdata before comparing them pairwise.
+// If one set runs out of records first, the set with the remaining records is later. (RFC6762 8.2.1)
+func compareRRSets(this []dns.RR, that []dns.RR) int {
+	this = sortedRRs(this)
+	that = sortedRRs(that)
+
+	for i := 0; i < len(this) && i < len(that); i++ {
+		if c := compareRR(this[i], that[i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(this) < len(that):
+		return -1
+	case len(this) > len(that):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func sortedRRs(rrs []dns.RR) []dns.RR {
+	sorted := make([]dns.RR, len(rrs))
+	copy(sorted, rrs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareRR(sorted[i], sorted[j]) < 0
+	})
 
+	return sorted
+}
+
+// compareRR compares the class (without the cache-flush bit), type and rdata of this and that.
+func compareRR(this dns.RR, that dns.RR) int {
+	thisClass := this.Header().Class &^ (1 << 15)
+	thatClass := that.Header().Class &^ (1 << 15)
+	if thisClass != thatClass {
+		if thisClass < thatClass {
+			return -1
+		}
+		return 1
+	}
+
+	if this.Header().Rrtype != that.Header().Rrtype {
+		if this.Header().Rrtype < that.Header().Rrtype {
+			return -1
+		}
+		return 1
+	}
+
+	return bytes.Compare(rdata(this), rdata(that))
+}
+
+// rdata returns the uncompressed wire format of the rdata of rr.
+func rdata(rr dns.RR) []byte {
+	buf := make([]byte, dns.Len(rr)+1)
+	off, err := dns.PackRR(rr, buf, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+
+	name := make([]byte, len(rr.Header().Name)+2)
+	n, err := dns.PackDomainName(rr.Header().Name, name, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+
+	// name, type, class, ttl and rdlength
+	hdr := n + 10
+	if hdr > off {
+		return nil
+	}
+
+	return buf[hdr:off]
+}
+
+// isDenyingA returns true if this denies that.
+func isDenyingA(this *dns.A, that *dns.A, logger *slog.Logger) bool {
+	if strings.EqualFold(this.Hdr.Name, that.Hdr.Name) {
 		if !isValidRR(this) {
-			log.Debug.Println("Invalid record produces conflict")
+			logger.Debug("Invalid record produces conflict", "record", this)
 			return true
 		}
 
 		switch compareIP(this.A.To4(), that.A.To4()) {
 		case -1:
-			log.Debug.Println("Lexicographical earlier")
+			logger.Debug("Lexicographically earlier", "this", this.A, "that", that.A)
 		case 1:
-			log.Debug.Println("Lexicographical later")
+			logger.Debug("Lexicographically later", "this", this.A, "that", that.A)
 			return true
 		default:
-			log.Debug.Println("No conflict")
+			logger.Debug("No conflict", "this", this.A, "that", that.A)
 		}
 	}
 
@@ -252,22 +751,21 @@ func isDenyingA(this *dns.A, that *dns.A) bool {
 }
 
 // isDenyingAAAA returns true if this denies that.
-func isDenyingAAAA(this *dns.AAAA, that *dns.AAAA) bool {
+func isDenyingAAAA(this *dns.AAAA, that *dns.AAAA, logger *slog.Logger) bool {
 	if strings.EqualFold(this.Hdr.Name, that.Hdr.Name) {
-		log.Debug.Println("Same hosts")
 		if !isValidRR(this) {
-			log.Debug.Println("Invalid record produces conflict")
+			logger.Debug("Invalid record produces conflict", "record", this)
 			return true
 		}
 
 		switch compareIP(this.AAAA.To16(), that.AAAA.To16()) {
 		case -1:
-			log.Debug.Println("Lexicographical earlier")
+			logger.Debug("Lexicographically earlier", "this", this.AAAA, "that", that.AAAA)
 		case 1:
-			log.Debug.Println("Lexicographical later")
+			logger.Debug("Lexicographically later", "this", this.AAAA, "that", that.AAAA)
 			return true
 		default:
-			log.Debug.Println("No conflict")
+			logger.Debug("No conflict", "this", this.AAAA, "that", that.AAAA)
 		}
 	}
 
@@ -275,9 +773,9 @@ func isDenyingAAAA(this *dns.AAAA, that *dns.AAAA) bool {
 }
 
 // areDenyingAs returns true if this and that are denying each other.
-func areDenyingAs(this []*dns.A, that []*dns.A) bool {
+func areDenyingAs(this []*dns.A, that []*dns.A, logger *slog.Logger) bool {
 	if len(this) != len(that) {
-		log.Debug.Printf("A: different number of records is a conflict (%d != %d)\n", len(this), len(that))
+		logger.Debug("Different number of A records is a conflict", "this", len(this), "that", len(that))
 		return true
 	}
 
@@ -286,18 +784,17 @@ func areDenyingAs(this []*dns.A, that []*dns.A) bool {
 
 	for i, ti := range this {
 		ta := that[i]
-		if isDenyingA(ti, ta) {
+		if isDenyingA(ti, ta, logger) {
 			return true
 		}
 	}
 
-	log.Debug.Println("A: same records are no conflict")
 	return false
 }
 
-func areDenyingAAAAs(this []*dns.AAAA, that []*dns.AAAA) bool {
+func areDenyingAAAAs(this []*dns.AAAA, that []*dns.AAAA, logger *slog.Logger) bool {
 	if len(this) != len(that) {
-		log.Debug.Printf("AAAA: different number of records is a conflict (%d != %d)\n", len(this), len(that))
+		logger.Debug("Different number of AAAA records is a conflict", "this", len(this), "that", len(that))
 		return true
 	}
 
@@ -306,12 +803,11 @@ func areDenyingAAAAs(this []*dns.AAAA, that []*dns.AAAA) bool {
 
 	for i, ti := range this {
 		ta := that[i]
-		if isDenyingAAAA(ti, ta) {
+		if isDenyingAAAA(ti, ta, logger) {
 			return true
 		}
 	}
 
-	log.Debug.Println("AAAA: same records are no conflict")
 	return false
 }
 
@@ -332,22 +828,21 @@ func (a byAAAAIP) Less(i, j int) bool {
 }
 
 // isDenyingSRV returns true if this denies that.
-func isDenyingSRV(this *dns.SRV, that *dns.SRV) bool {
+func isDenyingSRV(this *dns.SRV, that *dns.SRV, logger *slog.Logger) bool {
 	if strings.EqualFold(this.Hdr.Name, that.Hdr.Name) {
-		log.Debug.Println("Same SRV")
 		if !isValidRR(this) {
-			log.Debug.Println("Invalid record produces conflict")
+			logger.Debug("Invalid record produces conflict", "record", this)
 			return true
 		}
 
 		switch compareSRV(this, that) {
 		case -1:
-			log.Debug.Println("Lexicographical earlier")
+			logger.Debug("Lexicographically earlier", "this", this, "that", that)
 		case 1:
-			log.Debug.Println("Lexicographical later")
+			logger.Debug("Lexicographically later", "this", this, "that", that)
 			return true
 		default:
-			log.Debug.Println("No conflict")
+			logger.Debug("No conflict", "this", this, "that", that)
 		}
 	}
 
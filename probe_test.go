@@ -4,13 +4,15 @@ import (
 	"github.com/miekg/dns"
 
 	"context"
+	"fmt"
 	"net"
+	"reflect"
 	"testing"
 	"time"
 )
 
 var testAddr = net.UDPAddr{
-	IP:   net.IP{},
+	IP:   net.IP{127, 0, 0, 1},
 	Port: 1234,
 	Zone: "",
 }
@@ -81,10 +83,7 @@ func (c *testConn) start(ctx context.Context) {
 // is announced, the probing for the second service should give
 func TestProbing(t *testing.T) {
 	// log.Debug.Enable()
-	testIface, _ = net.InterfaceByName("lo0")
-	if testIface == nil {
-		testIface, _ = net.InterfaceByName("lo")
-	}
+	testIface, _ = LoopbackInterface()
 	if testIface == nil {
 		t.Fatal("can not find the local interface")
 	}
@@ -245,8 +244,305 @@ func TestDenyingAs(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		if is, want := areDenyingAs(test.This, test.That), test.Result; is != want {
+		if is, want := areDenyingAs(test.This, test.That, defaultLogger), test.Result; is != want {
 			t.Fatalf("%v != %v is=%v want=%v", test.This, test.That, is, want)
 		}
 	}
 }
+
+func TestProbeQuerySharedHost(t *testing.T) {
+	var srvs []Service
+	for _, name := range []string{"Service A", "Service B"} {
+		srv, err := NewService(Config{
+			Name: name,
+			Type: "_hap._tcp",
+			Host: "My Computer",
+			Port: 12334,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ifaceIPs = map[string][]net.IP{
+			"lo0": []net.IP{net.IP{192, 168, 0, 122}},
+		}
+		srvs = append(srvs, srv)
+	}
+
+	q := probeQuery(srvs, &net.Interface{Name: "lo0"})
+
+	// 2 service instance names and 1 hostname
+	if is, want := len(q.msg.Question), 3; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// 2 SRV records and 1 A record
+	if is, want := len(q.msg.Ns), 3; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestProbeQueryVerifiedHost(t *testing.T) {
+	srv, err := NewService(Config{
+		Name: "Service A",
+		Type: "_hap._tcp",
+		Host: "My Computer",
+		Port: 12334,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ifaceIPs = map[string][]net.IP{
+		"lo0": []net.IP{net.IP{192, 168, 0, 122}},
+	}
+	srv.hostVerified = true
+
+	q := probeQuery([]Service{srv}, &net.Interface{Name: "lo0"})
+
+	// only the service instance name
+	if is, want := len(q.msg.Question), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(q.msg.Ns), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestProbeServicesWithConfig(t *testing.T) {
+	srv, err := NewService(Config{
+		Name:   "My Service",
+		Type:   "_hap._tcp",
+		Host:   "My Computer",
+		Port:   12334,
+		Ifaces: []string{testIface.Name},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := ProbeConfig{
+		Delay:    -1,
+		Attempts: 1,
+		Interval: 10 * time.Millisecond,
+		Conn:     newTestConn(),
+	}
+
+	start := time.Now()
+	probed, err := ProbeServicesWithConfig(context.Background(), []Service{srv}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Fatalf("probing took %v", d)
+	}
+
+	if is, want := probed[0].ServiceInstanceName(), srv.ServiceInstanceName(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestReprobeServiceTimeout(t *testing.T) {
+	srv, err := NewService(Config{
+		Name:   "My Service",
+		Type:   "_hap._tcp",
+		Host:   "My Computer",
+		Port:   12334,
+		Ifaces: []string{testIface.Name},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := ProbeConfig{
+		Timeout:  50 * time.Millisecond,
+		Attempts: 100,
+		Interval: 10 * time.Millisecond,
+		Conn:     newTestConn(),
+	}
+
+	_, err = ReprobeServiceWithConfig(context.Background(), srv, cfg)
+	if is, want := err, context.DeadlineExceeded; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestProbingRenameFunc(t *testing.T) {
+	testIface, _ = LoopbackInterface()
+	if testIface == nil {
+		t.Fatal("can not find the local interface")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	conn := newTestConn()
+	otherConn := newTestConn()
+	conn.in = otherConn.out
+	conn.out = otherConn.in
+
+	cfg := Config{
+		Name:   "My Service",
+		Type:   "_hap._tcp",
+		Host:   "My Computer",
+		Port:   12334,
+		Ifaces: []string{testIface.Name},
+	}
+	srv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 122}},
+	}
+
+	rsrv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsrv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	r := newResponder(otherConn)
+	r.addManaged(rsrv)
+	go r.Respond(ctx)
+
+	pcfg := ProbeConfig{
+		RenameService: func(name string, count int) string {
+			return fmt.Sprintf("%s #%d", cfg.Name, count)
+		},
+		RenameHost: func(name string, count int) string {
+			return fmt.Sprintf("%s %d", cfg.Host, count)
+		},
+	}.withDefaults()
+
+	probed, err := probeServices(ctx, conn, []Service{srv}, pcfg, 500*time.Millisecond, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := probed[0].Host, "My-Computer-2"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := probed[0].Name, "My Service #2"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestProbingRenameHosts(t *testing.T) {
+	testIface, _ = LoopbackInterface()
+	if testIface == nil {
+		t.Fatal("can not find the local interface")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	conn := newTestConn()
+	otherConn := newTestConn()
+	conn.in = otherConn.out
+	conn.out = otherConn.in
+
+	srv, err := NewService(Config{Name: "My Service", Type: "_hap._tcp", Host: "My Computer", Hosts: []string{"scanner"}, Port: 12334, Ifaces: []string{testIface.Name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 122}},
+	}
+
+	rsrv, err := NewService(Config{Name: "Other Service", Type: "_hap._tcp", Host: "Other Computer", Hosts: []string{"scanner"}, Port: 12334, Ifaces: []string{testIface.Name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsrv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	r := newResponder(otherConn)
+	r.addManaged(rsrv)
+	go r.Respond(ctx)
+
+	probed, err := probeServices(ctx, conn, []Service{srv}, ProbeConfig{}.withDefaults(), 500*time.Millisecond, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := probed[0].Host, "My-Computer"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := probed[0].Hosts, []string{"scanner-2"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestConflictingHosts(t *testing.T) {
+	sv, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Host: "Computer", Port: 1234, Hosts: []string{"scanner"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	q := probeQuery([]Service{sv}, testIface)
+	if is, want := len(recordsNamed(q.msg.Ns, "scanner.local.")), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{
+		&dns.A{
+			Hdr: dns.RR_Header{Name: "scanner.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: TTLHostname},
+			A:   net.IP{192, 168, 0, 200},
+		},
+	}
+	req := &Request{msg: msg, iface: testIface}
+
+	if is, want := conflictingHosts(req, sv, defaultLogger), []string{"scanner.local."}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The same address is no conflict.
+	msg.Answer[0].(*dns.A).A = net.IP{192, 168, 0, 123}
+	if is := conflictingHosts(req, sv, defaultLogger); len(is) > 0 {
+		t.Fatalf("unexpected conflict %v", is)
+	}
+}
+
+func TestCompareRRSets(t *testing.T) {
+	a := func(ip string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{Name: "MyPrinter.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: TTLHostname},
+			A:   net.ParseIP(ip),
+		}
+	}
+	aaaa := &dns.AAAA{
+		Hdr:  dns.RR_Header{Name: "MyPrinter.local.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET | 1<<15, Ttl: TTLHostname},
+		AAAA: net.ParseIP("fe80::1"),
+	}
+
+	tests := []struct {
+		This   []dns.RR
+		That   []dns.RR
+		Result int
+	}{
+		{[]dns.RR{a("169.254.99.200")}, []dns.RR{a("169.254.200.50")}, -1},
+		{[]dns.RR{a("169.254.200.50")}, []dns.RR{a("169.254.99.200")}, 1},
+		{[]dns.RR{a("169.254.99.200"), aaaa}, []dns.RR{aaaa, a("169.254.99.200")}, 0},
+		// the set with remaining records wins
+		{[]dns.RR{a("169.254.99.200")}, []dns.RR{a("169.254.99.200"), aaaa}, -1},
+		// A records sort before AAAA records
+		{[]dns.RR{aaaa, a("169.254.1.1")}, []dns.RR{aaaa, a("169.254.99.200")}, -1},
+	}
+
+	for i, test := range tests {
+		if is, want := compareRRSets(test.This, test.That), test.Result; is != want {
+			t.Fatalf("%d is=%v want=%v", i, is, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package profiles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AirPlayType is the service type of AirPlay receivers.
+const AirPlayType = "_airplay._tcp"
+
+// AirPlayFeature is a bit of the AirPlay features bitmask.
+type AirPlayFeature uint
+
+// AirPlay features.
+const (
+	AirPlayVideo          AirPlayFeature = 0
+	AirPlayPhoto          AirPlayFeature = 1
+	AirPlaySlideshow      AirPlayFeature = 5
+	AirPlayScreen         AirPlayFeature = 7
+	AirPlayScreenRotate   AirPlayFeature = 8
+	AirPlayAudio          AirPlayFeature = 9
+	AirPlayAudioRedundant AirPlayFeature = 11
+	AirPlayAuthFairPlay   AirPlayFeature = 14
+	AirPlayAuthRSA        AirPlayFeature = 23
+	AirPlayAuthMFi        AirPlayFeature = 26
+	AirPlayLegacyPairing  AirPlayFeature = 27
+	AirPlayRAOP           AirPlayFeature = 30
+	AirPlayBufferedAudio  AirPlayFeature = 40
+	AirPlayPTP            AirPlayFeature = 41
+	AirPlayHomeKitPairing AirPlayFeature = 46
+)
+
+// AirPlayFeatures is the 64 bit features bitmask of an AirPlay receiver.
+type AirPlayFeatures uint64
+
+// Has returns true, if the feature f is set.
+func (fs AirPlayFeatures) Has(f AirPlayFeature) bool {
+	return fs&(1<<f) != 0
+}
+
+// String returns the features as published in TXT records, e.g. "0x5A7FFFF7,0x1E".
+// The upper 32 bits are omitted, if they are zero.
+func (fs AirPlayFeatures) String() string {
+	if hi := uint32(fs >> 32); hi != 0 {
+		return fmt.Sprintf("0x%X,0x%X", uint32(fs), hi)
+	}
+
+	return fmt.Sprintf("0x%X", uint32(fs))
+}
+
+// parseAirPlayFeatures returns the features of the attribute key in text,
+// which are published as hexadecimal number or as lower and upper 32 bits
+// separated by comma.
+func parseAirPlayFeatures(text map[string]string, key string) (AirPlayFeatures, error) {
+	v, ok := value(text, key)
+	if !ok || v == "" {
+		return 0, nil
+	}
+
+	lo, hi, found := strings.Cut(v, ",")
+	l, err := strconv.ParseUint(trimHexPrefix(lo), 16, 64)
+	if err != nil || (found && l > 0xFFFFFFFF) {
+		return 0, fmt.Errorf("invalid TXT attribute %s=%s", key, v)
+	}
+
+	var h uint64
+	if found {
+		if h, err = strconv.ParseUint(trimHexPrefix(hi), 16, 32); err != nil {
+			return 0, fmt.Errorf("invalid TXT attribute %s=%s", key, v)
+		}
+	}
+
+	return AirPlayFeatures(h<<32 | l), nil
+}
+
+// AirPlay are the TXT records of an AirPlay receiver.
+type AirPlay struct {
+	// DeviceID (deviceid) is the MAC address of the receiver, e.g. "AA:BB:CC:DD:EE:FF".
+	DeviceID string
+
+	// Features (features) are the supported features.
+	Features AirPlayFeatures
+
+	// Flags (flags) is the status bitmask of the receiver.
+	Flags uint64
+
+	// Model (model) is the model name, e.g. "AppleTV6,2".
+	Model string
+
+	// PairingID (pi) is the pairing identity of the receiver.
+	PairingID string
+
+	// PublicKey (pk) is the hex encoded public key of the receiver.
+	PublicKey string
+
+	// SourceVersion (srcvers) is the version of the AirPlay server, e.g. "366.0".
+	SourceVersion string
+
+	// ProtocolVersion (protovers) is the version of the protocol, e.g. "1.1".
+	ProtocolVersion string
+
+	// OSVersion (osvers) is the version of the operating system.
+	OSVersion string
+}
+
+// ParseAirPlay returns the AirPlay attributes in text.
+func ParseAirPlay(text map[string]string) (AirPlay, error) {
+	var a AirPlay
+	var err error
+
+	if a.Features, err = parseAirPlayFeatures(text, "features"); err != nil {
+		return a, err
+	}
+	if a.Flags, err = parseHex(text, "flags"); err != nil {
+		return a, err
+	}
+	a.DeviceID = str(text, "deviceid")
+	a.Model = str(text, "model")
+	a.PairingID = str(text, "pi")
+	a.PublicKey = str(text, "pk")
+	a.SourceVersion = str(text, "srcvers")
+	a.ProtocolVersion = str(text, "protovers")
+	a.OSVersion = str(text, "osvers")
+
+	return a, nil
+}
+
+// Text returns the TXT records of a.
+func (a AirPlay) Text() map[string]string {
+	text := map[string]string{
+		"features": a.Features.String(),
+	}
+	if a.Flags != 0 {
+		text["flags"] = fmt.Sprintf("0x%X", a.Flags)
+	}
+	setStr(text, "deviceid", a.DeviceID)
+	setStr(text, "model", a.Model)
+	setStr(text, "pi", a.PairingID)
+	setStr(text, "pk", a.PublicKey)
+	setStr(text, "srcvers", a.SourceVersion)
+	setStr(text, "protovers", a.ProtocolVersion)
+	setStr(text, "osvers", a.OSVersion)
+
+	return text
+}
@@ -0,0 +1,81 @@
+package profiles
+
+// GoogleCastType is the service type of Google Cast receivers.
+const GoogleCastType = "_googlecast._tcp"
+
+// Google Cast capabilities (ca).
+const (
+	GoogleCastVideoOut  = 0x01
+	GoogleCastVideoIn   = 0x02
+	GoogleCastAudioOut  = 0x04
+	GoogleCastAudioIn   = 0x08
+	GoogleCastMultizone = 0x20
+)
+
+// GoogleCast are the TXT records of a Google Cast receiver.
+type GoogleCast struct {
+	// ID (id) is the hex encoded UUID of the receiver.
+	ID string
+
+	// Version (ve) is the version of the TXT records, e.g. "05".
+	Version string
+
+	// Model (md) is the model name, e.g. "Chromecast".
+	Model string
+
+	// Name (fn) is the friendly name of the receiver, e.g. "Living Room TV".
+	Name string
+
+	// Icon (ic) is the path of the icon, e.g. "/setup/icon.png".
+	Icon string
+
+	// Capabilities (ca) is a bitmask of the capabilities, e.g. GoogleCastVideoOut.
+	Capabilities int
+
+	// Status (st) is 1, if an application is running.
+	Status int
+
+	// AppStatus (rs) is the status text of the running application.
+	AppStatus string
+}
+
+// ParseGoogleCast returns the Google Cast attributes in text.
+func ParseGoogleCast(text map[string]string) (GoogleCast, error) {
+	var c GoogleCast
+	var err error
+
+	if c.Capabilities, err = parseInt(text, "ca"); err != nil {
+		return c, err
+	}
+	if c.Status, err = parseInt(text, "st"); err != nil {
+		return c, err
+	}
+	c.ID = str(text, "id")
+	c.Version = str(text, "ve")
+	c.Model = str(text, "md")
+	c.Name = str(text, "fn")
+	c.Icon = str(text, "ic")
+	c.AppStatus = str(text, "rs")
+
+	return c, nil
+}
+
+// Has returns true, if the receiver has all capabilities in ca.
+func (c GoogleCast) Has(ca int) bool {
+	return c.Capabilities&ca == ca
+}
+
+// Text returns the TXT records of c.
+func (c GoogleCast) Text() map[string]string {
+	text := map[string]string{}
+	setStr(text, "id", c.ID)
+	setStr(text, "ve", c.Version)
+	setStr(text, "md", c.Model)
+	setStr(text, "fn", c.Name)
+	setStr(text, "ic", c.Icon)
+	setInt(text, "ca", c.Capabilities)
+	setInt(text, "st", c.Status)
+	setStr(text, "rs", c.AppStatus)
+
+	return text
+}
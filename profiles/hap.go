@@ -0,0 +1,102 @@
+package profiles
+
+import (
+	"strconv"
+)
+
+// HAPType is the service type of HomeKit accessories.
+const HAPType = "_hap._tcp"
+
+// HAP status flags (sf).
+const (
+	// HAPStatusNotPaired means that the accessory is not paired with any controller.
+	HAPStatusNotPaired = 0x01
+
+	// HAPStatusNotConfigured means that the accessory is not configured to join a Wi-Fi network.
+	HAPStatusNotConfigured = 0x02
+
+	// HAPStatusProblem means that the accessory detected a problem.
+	HAPStatusProblem = 0x04
+)
+
+// HAP are the TXT records of a HomeKit accessory.
+type HAP struct {
+	// ConfigNumber (c#) is incremented when the accessory database changes.
+	ConfigNumber int
+
+	// FeatureFlags (ff) is a bitmask of the pairing features.
+	FeatureFlags int
+
+	// ID (id) is the device id, e.g. "AA:BB:CC:DD:EE:FF".
+	ID string
+
+	// Model (md) is the model name of the accessory.
+	Model string
+
+	// ProtocolVersion (pv) is the version of the HomeKit Accessory Protocol, e.g. "1.1".
+	ProtocolVersion string
+
+	// StateNumber (s#) is the current state number, which is always 1.
+	StateNumber int
+
+	// StatusFlags (sf) is a bitmask of HAPStatusNotPaired,
+	// HAPStatusNotConfigured and HAPStatusProblem.
+	StatusFlags int
+
+	// Category (ci) is the category identifier, e.g. 2 for bridges.
+	Category int
+
+	// SetupHash (sh) is the base64 encoded hash of the setup id.
+	SetupHash string
+}
+
+// ParseHAP returns the HomeKit attributes in text.
+func ParseHAP(text map[string]string) (HAP, error) {
+	var h HAP
+	var err error
+
+	if h.ConfigNumber, err = parseInt(text, "c#"); err != nil {
+		return h, err
+	}
+	if h.FeatureFlags, err = parseInt(text, "ff"); err != nil {
+		return h, err
+	}
+	if h.StateNumber, err = parseInt(text, "s#"); err != nil {
+		return h, err
+	}
+	if h.StatusFlags, err = parseInt(text, "sf"); err != nil {
+		return h, err
+	}
+	if h.Category, err = parseInt(text, "ci"); err != nil {
+		return h, err
+	}
+	h.ID = str(text, "id")
+	h.Model = str(text, "md")
+	h.ProtocolVersion = str(text, "pv")
+	h.SetupHash = str(text, "sh")
+
+	return h, nil
+}
+
+// Paired returns true, if the accessory is paired with a controller.
+func (h HAP) Paired() bool {
+	return h.StatusFlags&HAPStatusNotPaired == 0
+}
+
+// Text returns the TXT records of h. The numeric attributes
+// are required and also published, if they are zero.
+func (h HAP) Text() map[string]string {
+	text := map[string]string{
+		"c#": strconv.Itoa(h.ConfigNumber),
+		"ff": strconv.Itoa(h.FeatureFlags),
+		"s#": strconv.Itoa(h.StateNumber),
+		"sf": strconv.Itoa(h.StatusFlags),
+		"ci": strconv.Itoa(h.Category),
+	}
+	setStr(text, "id", h.ID)
+	setStr(text, "md", h.Model)
+	setStr(text, "pv", h.ProtocolVersion)
+	setStr(text, "sh", h.SetupHash)
+
+	return text
+}
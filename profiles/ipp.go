@@ -0,0 +1,118 @@
+package profiles
+
+import (
+	"strings"
+)
+
+// IPPType is the service type of IPP printers.
+const IPPType = "_ipp._tcp"
+
+// IPP are the TXT records of an IPP printer, as specified
+// by the Bonjour Printing Specification and PWG 5100.14.
+type IPP struct {
+	// TXTVersion (txtvers) is the version of the TXT records, which is 1.
+	TXTVersion int
+
+	// Queues (qtotal) is the number of print queues of the printer.
+	Queues int
+
+	// ResourcePath (rp) is the path of the print queue, e.g. "ipp/print".
+	ResourcePath string
+
+	// Type (ty) is the make and model of the printer.
+	Type string
+
+	// AdminURL (adminurl) is the URL of the configuration page.
+	AdminURL string
+
+	// Note (note) is the location of the printer.
+	Note string
+
+	// Priority (priority) is the priority of the protocol (0-99, lower is preferred).
+	Priority int
+
+	// Product (product) is the PostScript product name, e.g. "(LaserJet)".
+	Product string
+
+	// PDL (pdl) are the MIME types of the supported document formats.
+	PDL []string
+
+	// UUID (UUID) is the UUID of the printer.
+	UUID string
+
+	// URF (URF) are the AirPrint raster capabilities, e.g. "W8" or "SRGB24".
+	URF []string
+
+	// Color (Color) is true, if the printer supports color printing.
+	Color bool
+
+	// Duplex (Duplex) is true, if the printer supports duplex printing.
+	Duplex bool
+
+	// Kind (kind) are the kinds of documents, e.g. "document" or "photo".
+	Kind []string
+
+	// TLS (TLS) is the maximum supported TLS version, e.g. "1.2".
+	TLS string
+}
+
+// ParseIPP returns the IPP attributes in text.
+func ParseIPP(text map[string]string) (IPP, error) {
+	var p IPP
+	var err error
+
+	if p.TXTVersion, err = parseInt(text, "txtvers"); err != nil {
+		return p, err
+	}
+	if p.Queues, err = parseInt(text, "qtotal"); err != nil {
+		return p, err
+	}
+	if p.Priority, err = parseInt(text, "priority"); err != nil {
+		return p, err
+	}
+	p.ResourcePath = str(text, "rp")
+	p.Type = str(text, "ty")
+	p.AdminURL = str(text, "adminurl")
+	p.Note = str(text, "note")
+	p.Product = str(text, "product")
+	p.PDL = parseList(text, "pdl")
+	p.UUID = str(text, "UUID")
+	p.URF = parseList(text, "URF")
+	p.Color = strings.EqualFold(str(text, "Color"), "T")
+	p.Duplex = strings.EqualFold(str(text, "Duplex"), "T")
+	p.Kind = parseList(text, "kind")
+	p.TLS = str(text, "TLS")
+
+	return p, nil
+}
+
+// Text returns the TXT records of p.
+func (p IPP) Text() map[string]string {
+	text := map[string]string{
+		"rp":     p.ResourcePath,
+		"Color":  boolTF(p.Color),
+		"Duplex": boolTF(p.Duplex),
+	}
+	setInt(text, "txtvers", p.TXTVersion)
+	setInt(text, "qtotal", p.Queues)
+	setStr(text, "ty", p.Type)
+	setStr(text, "adminurl", p.AdminURL)
+	setStr(text, "note", p.Note)
+	setInt(text, "priority", p.Priority)
+	setStr(text, "product", p.Product)
+	setStr(text, "pdl", strings.Join(p.PDL, ","))
+	setStr(text, "UUID", p.UUID)
+	setStr(text, "URF", strings.Join(p.URF, ","))
+	setStr(text, "kind", strings.Join(p.Kind, ","))
+	setStr(text, "TLS", p.TLS)
+
+	return text
+}
+
+func boolTF(b bool) string {
+	if b {
+		return "T"
+	}
+
+	return "F"
+}
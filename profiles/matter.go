@@ -0,0 +1,171 @@
+package profiles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MatterType is the service type of commissioned Matter nodes.
+	MatterType = "_matter._tcp"
+
+	// MatterCommissionableType is the service type of Matter nodes,
+	// which can be commissioned.
+	MatterCommissionableType = "_matterc._udp"
+)
+
+// Matter are the TXT records of a commissioned Matter node.
+type Matter struct {
+	// SessionIdleInterval (SII) is the retransmission interval of an idle node.
+	SessionIdleInterval time.Duration
+
+	// SessionActiveInterval (SAI) is the retransmission interval of an active node.
+	SessionActiveInterval time.Duration
+
+	// SessionActiveThreshold (SAT) is the time a node stays active after a message.
+	SessionActiveThreshold time.Duration
+
+	// TCP (T) is a bitmask of the supported TCP modes, or 0 if TCP is not supported.
+	TCP int
+
+	// ICD (ICD) is 1, if the node is an intermittently connected device
+	// operating in long idle time mode.
+	ICD int
+}
+
+// ParseMatter returns the attributes of a commissioned Matter node in text.
+func ParseMatter(text map[string]string) (Matter, error) {
+	var m Matter
+	var err error
+
+	if m.SessionIdleInterval, err = parseMillis(text, "SII"); err != nil {
+		return m, err
+	}
+	if m.SessionActiveInterval, err = parseMillis(text, "SAI"); err != nil {
+		return m, err
+	}
+	if m.SessionActiveThreshold, err = parseMillis(text, "SAT"); err != nil {
+		return m, err
+	}
+	if m.TCP, err = parseInt(text, "T"); err != nil {
+		return m, err
+	}
+	if m.ICD, err = parseInt(text, "ICD"); err != nil {
+		return m, err
+	}
+
+	return m, nil
+}
+
+// Text returns the TXT records of m.
+func (m Matter) Text() map[string]string {
+	text := map[string]string{}
+	setInt(text, "SII", int(m.SessionIdleInterval/time.Millisecond))
+	setInt(text, "SAI", int(m.SessionActiveInterval/time.Millisecond))
+	setInt(text, "SAT", int(m.SessionActiveThreshold/time.Millisecond))
+	setInt(text, "T", m.TCP)
+	setInt(text, "ICD", m.ICD)
+
+	return text
+}
+
+// MatterCommissionable are the TXT records of a Matter node, which can be commissioned.
+type MatterCommissionable struct {
+	Matter
+
+	// Discriminator (D) is the 12 bit discriminator of the node.
+	Discriminator int
+
+	// VendorID and ProductID (VP) identify the product, e.g. "65521+32769".
+	VendorID  int
+	ProductID int
+
+	// CommissioningMode (CM) is 1 for basic and 2 for enhanced
+	// commissioning mode, or 0 if the node is not in commissioning mode.
+	CommissioningMode int
+
+	// DeviceType (DT) is the primary device type of the node.
+	DeviceType int
+
+	// DeviceName (DN) is the name of the node.
+	DeviceName string
+
+	// RotatingID (RI) is the hex encoded rotating device identifier.
+	RotatingID string
+
+	// PairingHint (PH) is a bitmask of hints how to put the node into commissioning mode.
+	PairingHint int
+
+	// PairingInstruction (PI) is an instruction, which is required by the pairing hint.
+	PairingInstruction string
+}
+
+// ParseMatterCommissionable returns the attributes of a
+// Matter node, which can be commissioned, in text.
+func ParseMatterCommissionable(text map[string]string) (MatterCommissionable, error) {
+	var m MatterCommissionable
+	var err error
+
+	if m.Matter, err = ParseMatter(text); err != nil {
+		return m, err
+	}
+	if m.Discriminator, err = parseInt(text, "D"); err != nil {
+		return m, err
+	}
+	if m.CommissioningMode, err = parseInt(text, "CM"); err != nil {
+		return m, err
+	}
+	if m.DeviceType, err = parseInt(text, "DT"); err != nil {
+		return m, err
+	}
+	if m.PairingHint, err = parseInt(text, "PH"); err != nil {
+		return m, err
+	}
+
+	if vp := str(text, "VP"); vp != "" {
+		vendor, product, found := strings.Cut(vp, "+")
+		if m.VendorID, err = strconv.Atoi(vendor); err != nil {
+			return m, fmt.Errorf("invalid TXT attribute VP=%s", vp)
+		}
+		if found {
+			if m.ProductID, err = strconv.Atoi(product); err != nil {
+				return m, fmt.Errorf("invalid TXT attribute VP=%s", vp)
+			}
+		}
+	}
+	m.DeviceName = str(text, "DN")
+	m.RotatingID = str(text, "RI")
+	m.PairingInstruction = str(text, "PI")
+
+	return m, nil
+}
+
+// Text returns the TXT records of m. The discriminator and
+// commissioning mode are required and also published, if they are zero.
+func (m MatterCommissionable) Text() map[string]string {
+	text := m.Matter.Text()
+	text["D"] = strconv.Itoa(m.Discriminator)
+	text["CM"] = strconv.Itoa(m.CommissioningMode)
+	if m.VendorID != 0 {
+		vp := strconv.Itoa(m.VendorID)
+		if m.ProductID != 0 {
+			vp += "+" + strconv.Itoa(m.ProductID)
+		}
+		text["VP"] = vp
+	}
+	setInt(text, "DT", m.DeviceType)
+	setStr(text, "DN", m.DeviceName)
+	setStr(text, "RI", m.RotatingID)
+	setInt(text, "PH", m.PairingHint)
+	setStr(text, "PI", m.PairingInstruction)
+
+	return text
+}
+
+// parseMillis returns the value of the attribute key in text as milliseconds.
+func parseMillis(text map[string]string, key string) (time.Duration, error) {
+	ms, err := parseInt(text, key)
+	return time.Duration(ms) * time.Millisecond, err
+}
@@ -0,0 +1,126 @@
+// Package profiles provides typed TXT records of well-known service types,
+// e.g. the status flags of a HomeKit accessory or the features of an AirPlay receiver.
+//
+// Every profile can be decoded from the TXT records of a browse entry
+// and encoded as TXT records of a service.
+//
+//	hap, err := profiles.ParseHAP(entry.Text)
+//	if err == nil && !hap.Paired() {
+//		...
+//	}
+//
+// Keys are matched case-insensitive with dnssd.LookupText. (RFC6763 6.4)
+// Missing attributes are decoded as zero values.
+package profiles
+
+import (
+	"github.com/brutella/dnssd"
+
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// value returns the value of the attribute key in text.
+func value(text map[string]string, key string) (string, bool) {
+	return dnssd.LookupText(text, key)
+}
+
+// str returns the value of the attribute key in text, or "" if it is missing.
+func str(text map[string]string, key string) string {
+	v, _ := value(text, key)
+	return v
+}
+
+// parseInt returns the decimal value of the attribute key in text, or 0 if it is missing.
+func parseInt(text map[string]string, key string) (int, error) {
+	v, ok := value(text, key)
+	if !ok || v == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid TXT attribute %s=%s", key, v)
+	}
+
+	return i, nil
+}
+
+// parseHex returns the value of the attribute key in text as
+// hexadecimal number with optional 0x prefix, or 0 if it is missing.
+func parseHex(text map[string]string, key string) (uint64, error) {
+	v, ok := value(text, key)
+	if !ok || v == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.ParseUint(trimHexPrefix(v), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid TXT attribute %s=%s", key, v)
+	}
+
+	return i, nil
+}
+
+// parseInts returns the comma-separated decimal values of the attribute key in text.
+func parseInts(text map[string]string, key string) ([]int, error) {
+	var is []int
+	for _, s := range parseList(text, key) {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TXT attribute %s=%s", key, str(text, key))
+		}
+		is = append(is, i)
+	}
+
+	return is, nil
+}
+
+// parseList returns the comma-separated values of the attribute key in text.
+func parseList(text map[string]string, key string) []string {
+	v, ok := value(text, key)
+	if !ok || v == "" {
+		return nil
+	}
+
+	var ss []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			ss = append(ss, s)
+		}
+	}
+
+	return ss
+}
+
+func trimHexPrefix(s string) string {
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s[2:]
+	}
+
+	return s
+}
+
+// setStr sets the attribute key in text to v, if v is not empty.
+func setStr(text map[string]string, key, v string) {
+	if v != "" {
+		text[key] = v
+	}
+}
+
+// setInt sets the attribute key in text to i, if i is not zero.
+func setInt(text map[string]string, key string, i int) {
+	if i != 0 {
+		text[key] = strconv.Itoa(i)
+	}
+}
+
+// setInts sets the attribute key in text to the comma-separated values is, if any.
+func setInts(text map[string]string, key string, is []int) {
+	var ss []string
+	for _, i := range is {
+		ss = append(ss, strconv.Itoa(i))
+	}
+	setStr(text, key, strings.Join(ss, ","))
+}
@@ -0,0 +1,182 @@
+package profiles
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHAP(t *testing.T) {
+	text := map[string]string{
+		"c#": "2",
+		"ff": "0",
+		"id": "AA:BB:CC:DD:EE:FF",
+		"md": "Bridge",
+		"pv": "1.1",
+		"s#": "1",
+		"SF": "1",
+		"ci": "2",
+	}
+
+	h, err := ParseHAP(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := HAP{ConfigNumber: 2, ID: "AA:BB:CC:DD:EE:FF", Model: "Bridge", ProtocolVersion: "1.1", StateNumber: 1, StatusFlags: HAPStatusNotPaired, Category: 2}
+	if is := h; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%+v want=%+v", is, want)
+	}
+
+	if h.Paired() {
+		t.Fatal("accessory is not paired")
+	}
+
+	text["sf"] = text["SF"]
+	delete(text, "SF")
+	if is, want := h.Text(), text; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if _, err := ParseHAP(map[string]string{"c#": "x"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestAirPlayFeatures(t *testing.T) {
+	a, err := ParseAirPlay(map[string]string{"features": "0x5A7FFFF7,0x1E", "flags": "0x244"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := a.Features, AirPlayFeatures(0x1E5A7FFFF7); is != want {
+		t.Fatalf("is=%X want=%X", is, want)
+	}
+
+	if is, want := a.Flags, uint64(0x244); is != want {
+		t.Fatalf("is=%X want=%X", is, want)
+	}
+
+	for _, f := range []AirPlayFeature{AirPlayVideo, AirPlayScreen, AirPlayAudio, AirPlayRAOP} {
+		if !a.Features.Has(f) {
+			t.Fatalf("feature %d not set", f)
+		}
+	}
+
+	if a.Features.Has(AirPlayBufferedAudio) {
+		t.Fatal("unexpected buffered audio feature")
+	}
+
+	if is, want := a.Features.String(), "0x5A7FFFF7,0x1E"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := AirPlayFeatures(0x77).String(), "0x77"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestParseRAOP(t *testing.T) {
+	text := map[string]string{
+		"txtvers": "1",
+		"ch":      "2",
+		"cn":      "0,1,2,3",
+		"et":      "0,3,5",
+		"md":      "0,1,2",
+		"pw":      "false",
+		"sr":      "44100",
+		"ss":      "16",
+		"tp":      "UDP",
+		"vs":      "366.0",
+		"am":      "AudioAccessory5,1",
+		"ft":      "0x4A7FDFD5,0xBC157FDE",
+	}
+
+	r, err := ParseRAOP(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := r.Codecs, []int{0, 1, 2, 3}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := r.Text(), text; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	id, name, ok := SplitRAOPName("AABBCCDDEEFF@Living Room")
+	if !ok || id != "AABBCCDDEEFF" || name != "Living Room" {
+		t.Fatalf("invalid split %v %v %v", id, name, ok)
+	}
+}
+
+func TestParseIPP(t *testing.T) {
+	p, err := ParseIPP(map[string]string{
+		"rp":     "ipp/print",
+		"pdl":    "application/pdf,image/urf",
+		"Color":  "T",
+		"duplex": "F",
+		"URF":    "W8,SRGB24,CP1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := IPP{ResourcePath: "ipp/print", PDL: []string{"application/pdf", "image/urf"}, Color: true, URF: []string{"W8", "SRGB24", "CP1"}}
+	if is := p; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%+v want=%+v", is, want)
+	}
+}
+
+func TestParseGoogleCast(t *testing.T) {
+	c, err := ParseGoogleCast(map[string]string{"fn": "Living Room TV", "ca": "4101", "md": "Chromecast"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Has(GoogleCastVideoOut | GoogleCastAudioOut) {
+		t.Fatalf("invalid capabilities %d", c.Capabilities)
+	}
+
+	if c.Has(GoogleCastMultizone) {
+		t.Fatal("unexpected multizone capability")
+	}
+}
+
+func TestParseMatterCommissionable(t *testing.T) {
+	text := map[string]string{
+		"D":   "3840",
+		"VP":  "65521+32769",
+		"CM":  "1",
+		"DT":  "257",
+		"DN":  "Light",
+		"SII": "5000",
+		"SAI": "300",
+		"T":   "1",
+		"PH":  "33",
+	}
+
+	m, err := ParseMatterCommissionable(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := MatterCommissionable{
+		Matter:            Matter{SessionIdleInterval: 5 * time.Second, SessionActiveInterval: 300 * time.Millisecond, TCP: 1},
+		Discriminator:     3840,
+		VendorID:          65521,
+		ProductID:         32769,
+		CommissioningMode: 1,
+		DeviceType:        257,
+		DeviceName:        "Light",
+		PairingHint:       33,
+	}
+	if is := m; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%+v want=%+v", is, want)
+	}
+
+	if is, want := m.Text(), text; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
@@ -0,0 +1,113 @@
+package profiles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RAOPType is the service type of AirTunes (Remote Audio Output Protocol) receivers.
+const RAOPType = "_raop._tcp"
+
+// RAOP are the TXT records of an AirTunes receiver.
+type RAOP struct {
+	// TXTVersion (txtvers) is the version of the TXT records, which is 1.
+	TXTVersion int
+
+	// Channels (ch) is the number of audio channels, e.g. 2.
+	Channels int
+
+	// Codecs (cn) are the supported audio codecs, e.g. 0 (PCM) and 1 (ALAC).
+	Codecs []int
+
+	// Encryption (et) are the supported encryption types, e.g. 0 (none) and 1 (RSA).
+	Encryption []int
+
+	// Metadata (md) are the supported metadata types, e.g. 0 (text) and 1 (artwork).
+	Metadata []int
+
+	// Password (pw) is true, if a password is required.
+	Password bool
+
+	// SampleRate (sr) is the audio sample rate, e.g. 44100.
+	SampleRate int
+
+	// SampleSize (ss) is the audio sample size in bits, e.g. 16.
+	SampleSize int
+
+	// Transport (tp) are the supported transport protocols, e.g. "UDP".
+	Transport []string
+
+	// Version (vs) is the version of the server, e.g. "366.0".
+	Version string
+
+	// Model (am) is the model name, e.g. "AudioAccessory5,1".
+	Model string
+
+	// Features (ft) are the supported AirPlay features.
+	Features AirPlayFeatures
+}
+
+// ParseRAOP returns the AirTunes attributes in text.
+func ParseRAOP(text map[string]string) (RAOP, error) {
+	var r RAOP
+	var err error
+
+	if r.TXTVersion, err = parseInt(text, "txtvers"); err != nil {
+		return r, err
+	}
+	if r.Channels, err = parseInt(text, "ch"); err != nil {
+		return r, err
+	}
+	if r.Codecs, err = parseInts(text, "cn"); err != nil {
+		return r, err
+	}
+	if r.Encryption, err = parseInts(text, "et"); err != nil {
+		return r, err
+	}
+	if r.Metadata, err = parseInts(text, "md"); err != nil {
+		return r, err
+	}
+	if r.SampleRate, err = parseInt(text, "sr"); err != nil {
+		return r, err
+	}
+	if r.SampleSize, err = parseInt(text, "ss"); err != nil {
+		return r, err
+	}
+	if r.Features, err = parseAirPlayFeatures(text, "ft"); err != nil {
+		return r, err
+	}
+	r.Password = strings.EqualFold(str(text, "pw"), "true")
+	r.Transport = parseList(text, "tp")
+	r.Version = str(text, "vs")
+	r.Model = str(text, "am")
+
+	return r, nil
+}
+
+// Text returns the TXT records of r.
+func (r RAOP) Text() map[string]string {
+	text := map[string]string{
+		"pw": fmt.Sprint(r.Password),
+	}
+	setInt(text, "txtvers", r.TXTVersion)
+	setInt(text, "ch", r.Channels)
+	setInts(text, "cn", r.Codecs)
+	setInts(text, "et", r.Encryption)
+	setInts(text, "md", r.Metadata)
+	setInt(text, "sr", r.SampleRate)
+	setInt(text, "ss", r.SampleSize)
+	setStr(text, "tp", strings.Join(r.Transport, ","))
+	setStr(text, "vs", r.Version)
+	setStr(text, "am", r.Model)
+	if r.Features != 0 {
+		text["ft"] = r.Features.String()
+	}
+
+	return text
+}
+
+// SplitRAOPName returns the device id and name of the instance name
+// of an AirTunes service, e.g. "AABBCCDDEEFF@Living Room".
+func SplitRAOPName(instance string) (deviceID, name string, ok bool) {
+	return strings.Cut(instance, "@")
+}
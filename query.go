@@ -0,0 +1,90 @@
+package dnssd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RecordFunc is called when a record was received.
+type RecordFunc func(dns.RR)
+
+// QueryRecord sends a query for the records with the name name and the type qtype,
+// e.g. "Computer.local." and dns.TypeAAAA, at the network interfaces ifaces,
+// or at all multicast interfaces if none are specified. The query type dns.TypeANY
+// matches records of every type. fn is called for every received matching record until ctx is done.
+// If the deadline of ctx expires after records were received, no error is returned.
+func QueryRecord(ctx context.Context, name string, qtype uint16, fn RecordFunc, ifaces ...string) error {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	return queryRecord(ctx, conn, name, qtype, fn, ifaces...)
+}
+
+func queryRecord(ctx context.Context, conn MDNSConn, name string, qtype uint16, fn RecordFunc, ifaces ...string) error {
+	name = dns.Fqdn(name)
+
+	m := new(dns.Msg)
+	m.Question = []dns.Question{
+		{
+			Name:   name,
+			Qtype:  qtype,
+			Qclass: dns.ClassINET,
+		},
+	}
+
+	readCtx, readCancel := context.WithCancel(ctx)
+	defer readCancel()
+
+	ch := conn.Read(readCtx)
+
+	qs := make(chan *Query)
+	go func() {
+		for _, iface := range netnsOf(conn).multicastInterfaces(ifaces...) {
+			iface := iface
+			q := &Query{msg: m, iface: iface}
+			select {
+			case qs <- q:
+			case <-readCtx.Done():
+				return
+			}
+		}
+	}()
+
+	found := false
+	for {
+		select {
+		case q := <-qs:
+			if err := conn.SendQuery(q); err != nil {
+				loggerFrom(ctx).Error("dnssd: sending query failed", "question", name, "iface", q.IfaceName(), "err", err)
+			}
+		case req := <-ch:
+			if !acceptsIface(ifaces, req.iface) || !req.msg.Response {
+				break
+			}
+
+			for _, rr := range filterRecords(req, nil) {
+				if isAnswerTo(rr, name, qtype) {
+					found = true
+					fn(rr)
+				}
+			}
+		case <-ctx.Done():
+			return lookupErr(ctx, found)
+		}
+	}
+}
+
+// isAnswerTo returns true, if rr is an answer to a question
+// for name and qtype. Names are compared case-insensitively.
+func isAnswerTo(rr dns.RR, name string, qtype uint16) bool {
+	if !strings.EqualFold(rr.Header().Name, name) {
+		return false
+	}
+
+	return qtype == dns.TypeANY || rr.Header().Rrtype == qtype
+}
@@ -0,0 +1,48 @@
+package dnssd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestQueryRecord(t *testing.T) {
+	conn := newTestConn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{
+			&dns.A{
+				Hdr: dns.RR_Header{Name: "Computer.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: TTLHostname},
+				A:   net.IP{192, 168, 0, 123},
+			},
+			&dns.AAAA{
+				Hdr:  dns.RR_Header{Name: "computer.local.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: TTLHostname},
+				AAAA: net.ParseIP("fe80::1"),
+			},
+		}
+		conn.in <- msg
+	}()
+
+	var rrs []dns.RR
+	if err := queryRecord(ctx, conn, "Computer.local", dns.TypeAAAA, func(rr dns.RR) {
+		rrs = append(rrs, rr)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(rrs), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := rrs[0].Header().Rrtype, dns.TypeAAAA; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
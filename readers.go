@@ -0,0 +1,130 @@
+package dnssd
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// packet is a received packet.
+// The data is stored in a buffer of bufferPool, which is returned after unpacking.
+type packet struct {
+	data  *[]byte
+	from  *net.UDPAddr   // The source address
+	to    *net.UDPAddr   // The destination address
+	iface *net.Interface // The network interface at which the packet was received, or nil
+	time  time.Time      // The time when the packet was received
+}
+
+// ifaceName returns the name of the network interface of p, or "?" if it is unknown.
+func (p packet) ifaceName() string {
+	return Request{iface: p.iface}.IfaceName()
+}
+
+// packetQueueSize is the number of received packets per network interface,
+// which can wait to be unpacked.
+const packetQueueSize = 32
+
+// ifaceReaders runs one read loop per network interface, which unpacks the
+// packets received at the interface into requests. A burst of packets at one
+// interface doesn't delay the packets received at other interfaces.
+type ifaceReaders struct {
+	ctx  context.Context
+	conn *mdnsConn
+	ch   chan *Request
+
+	mutex   sync.Mutex
+	packets map[int]chan packet
+}
+
+func newIfaceReaders(ctx context.Context, conn *mdnsConn, ch chan *Request) *ifaceReaders {
+	return &ifaceReaders{
+		ctx:     ctx,
+		conn:    conn,
+		ch:      ch,
+		packets: map[int]chan packet{},
+	}
+}
+
+// dispatch passes p to the read loop of its network interface.
+// The packet is dropped, if the read loop is busy.
+func (rs *ifaceReaders) dispatch(p packet) {
+	index := 0
+	if p.iface != nil {
+		index = p.iface.Index
+	}
+
+	rs.mutex.Lock()
+	packets, ok := rs.packets[index]
+	if !ok {
+		packets = make(chan packet, packetQueueSize)
+		rs.packets[index] = packets
+		go rs.read(packets)
+	}
+	rs.mutex.Unlock()
+
+	p.time = time.Now()
+	rs.conn.stats.received.Add(1)
+
+	select {
+	case packets <- p:
+	default:
+		rs.conn.logger.Debug("Dropping packet", "peer", p.from, "iface", p.ifaceName())
+		rs.conn.stats.dropped.Add(1)
+		putBuffer(p.data)
+	}
+}
+
+// read unpacks the packets of one network interface into requests.
+func (rs *ifaceReaders) read(packets <-chan packet) {
+	for {
+		select {
+		case p := <-packets:
+			req := rs.unpack(p)
+			putBuffer(p.data)
+			if req == nil {
+				continue
+			}
+
+			select {
+			case rs.ch <- req:
+			case <-rs.ctx.Done():
+				return
+			}
+
+			if d := time.Since(p.time); d > LateReadDelay {
+				rs.conn.logger.Debug("Message was read late", "peer", p.from, "iface", p.ifaceName(), "delay", d)
+				rs.conn.stats.late.Add(1)
+			}
+
+		case <-rs.ctx.Done():
+			return
+		}
+	}
+}
+
+// unpack returns the request of the packet p, or nil if it is invalid or ignored.
+func (rs *ifaceReaders) unpack(p packet) *Request {
+	data := *p.data
+	if len(data) == 0 {
+		return nil
+	}
+
+	capturePacket(p.iface, p.from, p.to, data)
+	m := new(dns.Msg)
+	if err := m.Unpack(data); err != nil || shouldIgnore(m) {
+		return nil
+	}
+
+	return &Request{
+		msg:   m,
+		from:  p.from,
+		iface: p.iface,
+		own:   rs.conn.sent.isOwn(data, p.from),
+		port:  p.to.Port,
+		to:    p.to,
+	}
+}
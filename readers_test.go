@@ -0,0 +1,102 @@
+package dnssd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestIfaceReaders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan *Request)
+	readers := newIfaceReaders(ctx, &mdnsConn{stats: &connStats{}, logger: defaultLogger}, ch)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("Computer.local.", dns.TypeA)
+	msg.Id = 0
+	out, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	en0 := &net.Interface{Index: 1, Name: "en0"}
+	en1 := &net.Interface{Index: 2, Name: "en1"}
+	from := &net.UDPAddr{IP: net.IP{192, 168, 0, 2}, Port: 5353}
+	unicast := &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}
+
+	readers.dispatch(packet{data: copyBuffer(out), from: from, to: AddrIPv4LinkLocalMulticast, iface: en0})
+	readers.dispatch(packet{data: copyBuffer(out), from: from, to: unicast, iface: en1})
+
+	reqs := map[string]*Request{}
+	for i := 0; i < 2; i++ {
+		select {
+		case req := <-ch:
+			reqs[req.IfaceName()] = req
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	if is, want := reqs["en0"].To().String(), AddrIPv4LinkLocalMulticast.String(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := reqs["en1"].To().String(), unicast.String(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if reqs["en1"].isLegacyUnicast() {
+		t.Fatal("request from the mDNS port is not a legacy unicast query")
+	}
+}
+
+func TestIfaceReadersDrop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := &mdnsConn{stats: &connStats{}, logger: defaultLogger}
+	ch := make(chan *Request)
+	readers := newIfaceReaders(ctx, conn, ch)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("Computer.local.", dns.TypeA)
+	out, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody reads from ch, so that the packets are
+	// queued until the queue is full.
+	from := &net.UDPAddr{IP: net.IP{192, 168, 0, 2}, Port: 5353}
+	n := packetQueueSize + 10
+	for i := 0; i < n; i++ {
+		readers.dispatch(packet{data: copyBuffer(out), from: from, to: AddrIPv4LinkLocalMulticast, iface: testIface})
+	}
+
+	stats := conn.Stats()
+	if is, want := stats.Received, uint64(n); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if stats.Dropped == 0 {
+		t.Fatal("expected dropped packets")
+	}
+
+	time.Sleep(LateReadDelay)
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// The counter is updated after the message was read.
+	time.Sleep(10 * time.Millisecond)
+	if is, want := conn.Stats().Late, uint64(1); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
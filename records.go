@@ -0,0 +1,110 @@
+package dnssd
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// recordsMaxAge is the duration after which cached records are rebuilt,
+// because the addresses of a network interface may change without a link update.
+const recordsMaxAge = time.Second
+
+// serviceRecords are the records of a service at a network interface, which
+// are reused to answer queries. The records must not be modified; responses
+// which change them, e.g. by setting the cache-flush bit, use copies.
+type serviceRecords struct {
+	created time.Time
+
+	ptr     *dns.PTR
+	srv     *dns.SRV
+	txt     *dns.TXT
+	cnames  []*dns.CNAME
+	address []dns.RR
+
+	// hosts stores the address records of the additional host names by lowercased name.
+	hosts map[string][]dns.RR
+
+	// nsecs stores the NSEC records by lowercased name.
+	nsecs map[string]*dns.NSEC
+
+	// Lowercased names of the service
+	serviceName  string
+	instanceName string
+	hostname     string
+}
+
+func newServiceRecords(srv Service, iface *net.Interface, now time.Time) *serviceRecords {
+	return &serviceRecords{
+		created:      now,
+		ptr:          PTR(srv),
+		srv:          SRV(srv),
+		txt:          TXT(srv),
+		cnames:       CNAME(srv),
+		address:      addressRecords(srv, iface),
+		hosts:        extraAddressRecords(srv, iface),
+		nsecs:        nsecRecords(srv, iface),
+		serviceName:  strings.ToLower(srv.ServiceName()),
+		instanceName: strings.ToLower(srv.EscapedServiceInstanceName()),
+		hostname:     strings.ToLower(srv.Hostname()),
+	}
+}
+
+// cname returns the CNAME record for the alias name, or nil
+// if name is not an alias of the service's host.
+func (rs *serviceRecords) cname(name string) *dns.CNAME {
+	for _, cname := range rs.cnames {
+		if strings.EqualFold(cname.Hdr.Name, name) {
+			return cname
+		}
+	}
+
+	return nil
+}
+
+// recordsAt returns the records of the service at iface.
+// The records are cached until the service is replaced or they are too old.
+// This method must be called while holding the responder mutex.
+func (h *serviceHandle) recordsAt(iface *net.Interface, now time.Time) *serviceRecords {
+	if h.recordsOf != h.service {
+		h.records = map[string]*serviceRecords{}
+		h.recordsOf = h.service
+	}
+
+	name := "?"
+	if iface != nil {
+		name = iface.Name
+	}
+
+	if rs, ok := h.records[name]; ok && now.Sub(rs.created) < recordsMaxAge {
+		return rs
+	}
+
+	rs := newServiceRecords(*h.service, iface, now)
+	h.records[name] = rs
+
+	return rs
+}
+
+// resetRecords removes the cached records, e.g. after the
+// addresses of network interfaces changed.
+func (h *serviceHandle) resetRecords() {
+	h.records = nil
+	h.recordsOf = nil
+}
+
+// copyRecords returns copies of rrs, which can be modified.
+func copyRecords(rrs []dns.RR) []dns.RR {
+	if rrs == nil {
+		return nil
+	}
+
+	cps := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		cps[i] = dns.Copy(rr)
+	}
+
+	return cps
+}
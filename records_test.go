@@ -0,0 +1,48 @@
+package dnssd
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServiceRecordsCache(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	h := &serviceHandle{service: &sv}
+	now := time.Now()
+
+	rs := h.recordsAt(testIface, now)
+	if is, want := len(rs.address), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if h.recordsAt(testIface, now) != rs {
+		t.Fatal("expected cached records")
+	}
+
+	if h.recordsAt(testIface, now.Add(recordsMaxAge)) == rs {
+		t.Fatal("expected new records after max age")
+	}
+
+	// The records of a replaced service are rebuilt.
+	srv := sv.Copy()
+	srv.Text = map[string]string{"key": "value"}
+	h.service = srv
+
+	rs = h.recordsAt(testIface, now)
+	if is, want := rs.txt.Txt[0], "key=value"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
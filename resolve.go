@@ -2,12 +2,20 @@ package dnssd
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
-	"github.com/brutella/dnssd/log"
 	"github.com/miekg/dns"
 )
 
-// LookupInstance resolves a service by its service instance name.
+// LookupInstance resolves a service by its service instance name, e.g. "Printer._ipp._tcp.local.".
+// Spaces and dots in the instance name don't have to be escaped. The queries are
+// repeated with increasing intervals until the service is resolved.
+// The service is returned once its SRV and TXT records are received.
+// If the deadline of ctx expires before, the partially resolved service
+// is returned without error, e.g. a service without TXT records.
 func LookupInstance(ctx context.Context, instance string) (Service, error) {
 	var srv Service
 
@@ -16,28 +24,54 @@ func LookupInstance(ctx context.Context, instance string) (Service, error) {
 		return srv, err
 	}
 
-	return lookupInstance(ctx, instance, conn)
+	return lookupInstance(ctx, instance, conn, WaitNoAddr)
 }
 
-func lookupInstance(ctx context.Context, instance string, conn MDNSConn) (srv Service, err error) {
-	var cache = NewCache()
+// LookupInstanceAtInterfaces resolves a service like LookupInstance at specific network interfaces.
+// Queries are only sent at and responses only accepted from these interfaces.
+func LookupInstanceAtInterfaces(ctx context.Context, instance string, ifaces ...string) (Service, error) {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return Service{}, err
+	}
+	defer conn.close()
 
-	m := new(dns.Msg)
+	return lookupInstance(ctx, instance, conn, WaitNoAddr, ifaces...)
+}
 
-	srvQ := dns.Question{
-		Name:   instance,
-		Qtype:  dns.TypeSRV,
-		Qclass: dns.ClassINET,
-	}
-	txtQ := dns.Question{
-		Name:   instance,
-		Qtype:  dns.TypeTXT,
-		Qclass: dns.ClassINET,
-	}
-	setQuestionUnicast(&srvQ)
-	setQuestionUnicast(&txtQ)
+// WaitAddrs specifies the addresses of a service,
+// which are resolved before the service is returned.
+type WaitAddrs int
 
-	m.Question = []dns.Question{srvQ, txtQ}
+const (
+	// WaitNoAddr returns the service without waiting for addresses.
+	WaitNoAddr WaitAddrs = iota
+
+	// WaitAnyAddr waits for an IPv4 or IPv6 address.
+	WaitAnyAddr
+
+	// WaitAllAddrs waits for an IPv4 and an IPv6 address,
+	// unless the host has no address of a family. (RFC6762 6.1)
+	WaitAllAddrs
+)
+
+// LookupInstanceWithConn resolves a service by its service instance name using conn,
+// e.g. a SharedConn which is also used by a responder.
+func LookupInstanceWithConn(ctx context.Context, conn MDNSConn, instance string) (Service, error) {
+	return lookupInstance(ctx, instance, conn, WaitNoAddr)
+}
+
+// LookupInstanceWithAddrs resolves a service like LookupInstanceWithConn and waits
+// until the addresses specified by wait are resolved. Address records, which are not
+// received together with the SRV record, are queried for the host of the service.
+func LookupInstanceWithAddrs(ctx context.Context, conn MDNSConn, instance string, wait WaitAddrs) (Service, error) {
+	return lookupInstance(ctx, instance, conn, wait)
+}
+
+func lookupInstance(ctx context.Context, instance string, conn MDNSConn, wait WaitAddrs, ifaces ...string) (srv Service, err error) {
+	var cache = NewCache()
+	cache.clock = clockFrom(ctx)
+	instance = escapeServiceInstanceName(instance)
 
 	readCtx, readCancel := context.WithCancel(ctx)
 	defer readCancel()
@@ -45,29 +79,183 @@ func lookupInstance(ctx context.Context, instance string, conn MDNSConn) (srv Se
 	ch := conn.Read(readCtx)
 
 	qs := make(chan *Query)
-	go func() {
-		for _, iface := range MulticastInterfaces() {
-			iface := iface
-			q := &Query{msg: m, iface: iface}
-			qs <- q
-		}
-	}()
+	send := func(m *dns.Msg) {
+		go func() {
+			for _, iface := range netnsOf(conn).multicastInterfaces(ifaces...) {
+				iface := iface
+				q := &Query{msg: m, iface: iface}
+				select {
+				case qs <- q:
+				case <-readCtx.Done():
+					return
+				}
+			}
+		}()
+	}
 
+	// Only the first query asks for unicast responses. (RFC6762 5.4)
+	send(instanceQuery(instance, true))
+	interval := firstQueryInterval
+	retry := cache.clock.After(interval)
+
+	// hasTXT is true, if the TXT record of the service was received,
+	// and askedAddrs if the addresses of the host were queried.
+	var hasTXT, askedAddrs bool
 	for {
 		select {
 		case q := <-qs:
 			if err := conn.SendQuery(q); err != nil {
-				log.Info.Println("dnssd:", err)
+				loggerFrom(ctx).Error("dnssd: sending query failed", "question", instance, "iface", q.IfaceName(), "err", err)
+			}
+		case <-retry:
+			m := instanceQuery(instance, false)
+			if s, ok := cache.Lookup(instance); ok && s.Host != "" {
+				m.Question = append(m.Question, addrQuestions(cache, s, wait)...)
 			}
+			send(m)
+			interval = nextQueryInterval(interval)
+			retry = cache.clock.After(interval)
 		case req := <-ch:
+			if !acceptsIface(ifaces, req.iface) {
+				break
+			}
 			cache.UpdateFrom(req)
-			if s, ok := cache.services[instance]; ok {
-				srv = *s
-				return
+			hasTXT = hasTXT || containsTXT(req.msg, instance)
+			s, ok := cache.Lookup(instance)
+			if !ok || s.Host == "" {
+				break
+			}
+
+			if hasTXT && hasAddrs(cache, s, wait) {
+				return s, nil
+			}
+
+			if qs := addrQuestions(cache, s, wait); len(qs) > 0 && !askedAddrs {
+				// Ask for the missing addresses once, and then with the next queries.
+				askedAddrs = true
+				m := new(dns.Msg)
+				m.Question = qs
+				send(m)
 			}
 		case <-ctx.Done():
+			if s, ok := cache.Lookup(instance); ok {
+				return s, lookupErr(ctx, true)
+			}
 			err = ctx.Err()
 			return
 		}
 	}
 }
+
+// hasAddrs returns true, if the addresses of srv specified by wait are cached.
+func hasAddrs(cache *Cache, srv Service, wait WaitAddrs) bool {
+	hasIPv4 := includesIPv4(srv.IPs) || cache.hasNoRecord(srv.Hostname(), dns.TypeA)
+	hasIPv6 := includesIPv6(srv.IPs) || cache.hasNoRecord(srv.Hostname(), dns.TypeAAAA)
+
+	switch wait {
+	case WaitAnyAddr:
+		return len(srv.IPs) > 0 || (hasIPv4 && hasIPv6)
+	case WaitAllAddrs:
+		return hasIPv4 && hasIPv6
+	default:
+		return true
+	}
+}
+
+// addrQuestions returns the questions for the
+// addresses of srv, which are missing according to wait.
+func addrQuestions(cache *Cache, srv Service, wait WaitAddrs) []dns.Question {
+	if hasAddrs(cache, srv, wait) {
+		return nil
+	}
+
+	var qs []dns.Question
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		if cache.hasNoRecord(srv.Hostname(), qtype) {
+			continue
+		}
+		if qtype == dns.TypeA && includesIPv4(srv.IPs) || qtype == dns.TypeAAAA && includesIPv6(srv.IPs) {
+			continue
+		}
+		qs = append(qs, dns.Question{Name: srv.Hostname(), Qtype: qtype, Qclass: dns.ClassINET})
+	}
+
+	return qs
+}
+
+// instanceQuery returns a query for the SRV and TXT records of instance.
+func instanceQuery(instance string, unicast bool) *dns.Msg {
+	srvQ := dns.Question{
+		Name:   instance,
+		Qtype:  dns.TypeSRV,
+		Qclass: dns.ClassINET,
+	}
+	txtQ := dns.Question{
+		Name:   instance,
+		Qtype:  dns.TypeTXT,
+		Qclass: dns.ClassINET,
+	}
+	if unicast {
+		setQuestionUnicast(&srvQ)
+		setQuestionUnicast(&txtQ)
+	}
+
+	m := new(dns.Msg)
+	m.Question = []dns.Question{srvQ, txtQ}
+
+	return m
+}
+
+const (
+	// firstQueryInterval is the time between the first two queries of a lookup.
+	firstQueryInterval = time.Second
+
+	// maxQueryInterval is the maximum time between queries of a lookup.
+	maxQueryInterval = 60 * time.Minute
+)
+
+// nextQueryInterval returns the time until the next query, if the
+// last query was sent after interval. The interval is doubled
+// after every query until it reaches sixty minutes. (RFC6762 5.2)
+func nextQueryInterval(interval time.Duration) time.Duration {
+	if interval *= 2; interval > maxQueryInterval {
+		return maxQueryInterval
+	}
+
+	return interval
+}
+
+// escapeServiceInstanceName returns the escaped service instance name of instance,
+// which may contain unescaped spaces and dots in the instance name,
+// e.g. "My Printer 2.0._ipp._tcp.local" is "My\ Printer\ 2\.0._ipp._tcp.local.".
+// Escaped names are returned unchanged.
+func escapeServiceInstanceName(instance string) string {
+	name, service, domain := parseServiceInstanceName(dns.Fqdn(instance))
+	if service == "" {
+		return dns.Fqdn(instance)
+	}
+
+	return fmt.Sprintf("%s.%s.%s.", EscapeInstanceName(name), service, domain)
+}
+
+// containsTXT returns true, if msg contains a TXT record for instance.
+func containsTXT(msg *dns.Msg, instance string) bool {
+	for _, rr := range filterRecords(&Request{msg: msg}, nil) {
+		if txt, ok := rr.(*dns.TXT); ok && strings.EqualFold(txt.Hdr.Name, instance) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupErr returns the error of a lookup, which stopped because ctx is done.
+// If the deadline expired after results were found, the lookup succeeded
+// and the results are returned without error.
+func lookupErr(ctx context.Context, found bool) error {
+	if found && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+
+	return ctx.Err()
+}
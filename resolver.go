@@ -0,0 +1,415 @@
+package dnssd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Resolver performs lookups on one connection and keeps the received
+// records in a long-lived cache. Lookups are answered from the cache
+// as long as the records have not expired. (RFC6762 5.2)
+type Resolver struct {
+	conn   MDNSConn
+	ifaces []string
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+	cache *Cache
+	hosts map[string]*hostAddrs
+
+	// hostsNext is not after the earliest expiration time of the hosts
+	// (see Cache.next).
+	hostsNext time.Time
+
+	// network interfaces at which messages were received by name
+	seenIfaces map[string]*net.Interface
+
+	// listeners are notified when a message was received
+	listeners map[*listener]struct{}
+}
+
+// listener is notified when a message was received.
+type listener struct {
+	ch chan struct{}
+
+	// events are the changes of the cache since the last notification,
+	// if they are tracked. They are guarded by the mutex of the resolver.
+	events      []CacheEvent
+	trackEvents bool
+}
+
+// hostAddrs are the cached ip addresses of a host.
+type hostAddrs struct {
+	ips        []net.IP
+	expiration time.Time
+}
+
+// NewResolver returns a resolver, which sends queries at the network
+// interfaces ifaces, or at all multicast interfaces if none are specified.
+// The resolver must be closed when it is no longer needed.
+func NewResolver(ifaces ...string) (*Resolver, error) {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newResolver(conn, ifaces...), nil
+}
+
+// NewResolverWithConn returns a resolver, which uses conn, e.g. a SharedConn
+// which is also used by a responder. The connection is closed by Close.
+func NewResolverWithConn(conn MDNSConn, ifaces ...string) *Resolver {
+	return newResolver(conn, ifaces...)
+}
+
+func newResolver(conn MDNSConn, ifaces ...string) *Resolver {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Resolver{
+		conn:       conn,
+		ifaces:     ifaces,
+		cancel:     cancel,
+		cache:      NewCache(),
+		hosts:      map[string]*hostAddrs{},
+		seenIfaces: map[string]*net.Interface{},
+		listeners:  map[*listener]struct{}{},
+	}
+
+	go r.read(ctx)
+
+	return r
+}
+
+// Cache returns the cache of the resolver, e.g. to list the cached services.
+func (r *Resolver) Cache() *Cache {
+	return r.cache
+}
+
+// Close stops receiving messages and closes the connection of the resolver.
+func (r *Resolver) Close() {
+	r.cancel()
+	r.conn.Close()
+}
+
+func (r *Resolver) read(ctx context.Context) {
+	ch := r.conn.Read(ctx)
+	expiry := &expiryTimer{cache: r.cache}
+	for {
+		expiry.reset()
+		select {
+		case req := <-ch:
+			if !acceptsIface(r.ifaces, req.iface) {
+				break
+			}
+			r.mutex.Lock()
+			if req.iface != nil {
+				r.seenIfaces[req.iface.Name] = req.iface
+			}
+			events := r.cache.updateDelta(req)
+			r.updateHosts(req)
+			r.notify(events)
+			r.mutex.Unlock()
+
+		case <-expiry.C:
+			r.mutex.Lock()
+			if events := expiry.expire(); len(events) > 0 {
+				r.notify(events)
+			}
+			r.mutex.Unlock()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notify notifies the listeners about the changes events while the mutex is locked.
+func (r *Resolver) notify(events []CacheEvent) {
+	for l := range r.listeners {
+		if l.trackEvents {
+			l.events = append(l.events, events...)
+		}
+		select {
+		case l.ch <- struct{}{}:
+		default:
+			// The listener was already notified.
+		}
+	}
+}
+
+// updateHosts caches the address records in req and removes expired hosts.
+func (r *Resolver) updateHosts(req *Request) {
+	now := r.cache.clock.Now()
+	r.removeExpiredHosts(now)
+	for _, rr := range filterRecords(req, nil) {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+
+		name := strings.ToLower(rr.Header().Name)
+		ttl := time.Duration(rr.Header().Ttl) * time.Second
+		h, ok := r.hosts[name]
+		if !ok || now.After(h.expiration) {
+			if ttl == 0 {
+				continue
+			}
+			h = &hostAddrs{}
+			r.hosts[name] = h
+		}
+
+		if ttl == 0 {
+			// Goodbye packet (RFC6762 10.1)
+			h.ips = removeIP(h.ips, ip)
+			continue
+		}
+
+		if !containsIP(h.ips, ip) {
+			h.ips = append(h.ips, ip)
+		}
+		r.setHostExpiration(h, now.Add(ttl))
+	}
+}
+
+// setHostExpiration sets the expiration time of the cached host h.
+func (r *Resolver) setHostExpiration(h *hostAddrs, expiration time.Time) {
+	h.expiration = expiration
+	if r.hostsNext.IsZero() || expiration.Before(r.hostsNext) {
+		r.hostsNext = expiration
+	}
+}
+
+// removeExpiredHosts removes the hosts, which addresses have expired at now.
+func (r *Resolver) removeExpiredHosts(now time.Time) {
+	if r.hostsNext.IsZero() || !now.After(r.hostsNext) {
+		return
+	}
+
+	var next time.Time
+	for name, h := range r.hosts {
+		if now.After(h.expiration) {
+			delete(r.hosts, name)
+		} else if next.IsZero() || h.expiration.Before(next) {
+			next = h.expiration
+		}
+	}
+	r.hostsNext = next
+}
+
+// removeIP returns ips without ip.
+func removeIP(ips []net.IP, ip net.IP) []net.IP {
+	var result []net.IP
+	for _, i := range ips {
+		if !i.Equal(ip) {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
+
+// Save writes the cached services of the resolver to w (see Cache.Save).
+func (r *Resolver) Save(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.cache.Save(w)
+}
+
+// Load restores cached services from r, which were written by Save,
+// so that lookups are answered before services are announced again.
+// The addresses of the services are also used to answer LookupHost.
+func (r *Resolver) Load(rd io.Reader) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.cache.Load(rd); err != nil {
+		return err
+	}
+
+	for _, srv := range r.cache.services {
+		if srv.Host == "" || len(srv.IPs) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(srv.Hostname())
+		if h, ok := r.hosts[name]; ok && !h.expiration.Before(srv.expiration) {
+			continue
+		}
+		h := &hostAddrs{ips: append([]net.IP{}, srv.IPs...)}
+		r.setHostExpiration(h, srv.expiration)
+		r.hosts[name] = h
+	}
+
+	return nil
+}
+
+// listen returns a listener, which channel receives a value when a message was received.
+// If trackEvents is true, the listener also collects the changes of the cache.
+// The returned function must be called to stop listening.
+func (r *Resolver) listen(trackEvents bool) (*listener, func()) {
+	l := &listener{ch: make(chan struct{}, 1), trackEvents: trackEvents}
+	r.mutex.Lock()
+	r.listeners[l] = struct{}{}
+	r.mutex.Unlock()
+
+	return l, func() {
+		r.mutex.Lock()
+		delete(r.listeners, l)
+		r.mutex.Unlock()
+	}
+}
+
+// query sends m at every network interface of the resolver.
+func (r *Resolver) query(ctx context.Context, m *dns.Msg) {
+	for _, iface := range netnsOf(r.conn).multicastInterfaces(r.ifaces...) {
+		q := &Query{msg: m, iface: iface}
+		if err := r.conn.SendQuery(q); err != nil {
+			loggerFrom(ctx).Debug("dnssd: sending query failed", "iface", q.IfaceName(), "err", err)
+		}
+	}
+}
+
+// LookupType browses for service instances like LookupType.
+// Cached service instances are reported immediately.
+func (r *Resolver) LookupType(ctx context.Context, service string, add AddFunc, rmv RmvFunc) error {
+	l, stop := r.listen(true)
+	defer stop()
+
+	tb := &typeBrowser{service: service, add: add, rmv: rmv}
+	r.mutex.Lock()
+	var cached []CacheEvent
+	for _, srv := range r.cache.Services() {
+		cached = append(cached, CacheEvent{Kind: BrowseAdd, Service: *srv})
+	}
+	tb.apply(cached, r.seenIfaces)
+	r.mutex.Unlock()
+
+	r.query(ctx, browseQuery(service))
+	// Cached service instances may also miss records.
+	tb.followUp(r.conn, r.cache, cached, nil, r.ifaces, loggerFrom(ctx))
+
+	for {
+		select {
+		case <-l.ch:
+			r.mutex.Lock()
+			events := l.events
+			l.events = nil
+			tb.apply(events, r.seenIfaces)
+			tb.followUp(r.conn, r.cache, events, nil, r.ifaces, loggerFrom(ctx))
+			r.mutex.Unlock()
+
+		case <-ctx.Done():
+			return lookupErr(ctx, len(tb.es) > 0)
+		}
+	}
+}
+
+// LookupInstance resolves a service by its service instance name like LookupInstance.
+// A cached service is returned without sending a query. Otherwise the queries are
+// repeated with increasing intervals until the service is resolved. If the deadline of ctx
+// expires before the SRV record is received, the partially resolved service is returned.
+func (r *Resolver) LookupInstance(ctx context.Context, instance string) (Service, error) {
+	l, stop := r.listen(false)
+	defer stop()
+
+	instance = escapeServiceInstanceName(instance)
+	if srv, ok := r.cachedInstance(instance); ok {
+		return srv, nil
+	}
+
+	r.query(ctx, instanceQuery(instance, false))
+	clock := clockFrom(ctx)
+	interval := firstQueryInterval
+	retry := clock.After(interval)
+
+	for {
+		select {
+		case <-retry:
+			r.query(ctx, instanceQuery(instance, false))
+			interval = nextQueryInterval(interval)
+			retry = clock.After(interval)
+
+		case <-l.ch:
+			if srv, ok := r.cachedInstance(instance); ok {
+				return srv, nil
+			}
+
+		case <-ctx.Done():
+			if srv, ok := r.cache.Lookup(instance); ok {
+				return srv, lookupErr(ctx, true)
+			}
+			return Service{}, ctx.Err()
+		}
+	}
+}
+
+// cachedInstance returns the cached service with the service instance name instance,
+// if its SRV record was received.
+func (r *Resolver) cachedInstance(instance string) (Service, bool) {
+	if srv, ok := r.cache.Lookup(instance); ok && srv.Host != "" {
+		return srv, true
+	}
+
+	return Service{}, false
+}
+
+// LookupHost returns the ip addresses of host, e.g. "Computer.local.".
+// Cached addresses are returned without sending a query.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]net.IP, error) {
+	l, stop := r.listen(false)
+	defer stop()
+
+	name := dns.Fqdn(host)
+	if ips := r.cachedHost(name); len(ips) > 0 {
+		return ips, nil
+	}
+
+	m := new(dns.Msg)
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		// Don't ask for records, which don't exist. (RFC6762 6.1)
+		if !r.cache.hasNoRecord(name, qtype) {
+			m.Question = append(m.Question, dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET})
+		}
+	}
+
+	if len(m.Question) == 0 {
+		return nil, fmt.Errorf("host %s has no addresses", name)
+	}
+	r.query(ctx, m)
+
+	for {
+		select {
+		case <-l.ch:
+			if ips := r.cachedHost(name); len(ips) > 0 {
+				return ips, nil
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// cachedHost returns the cached and not expired ip addresses of the host name.
+func (r *Resolver) cachedHost(name string) []net.IP {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if h, ok := r.hosts[strings.ToLower(name)]; ok && r.cache.clock.Now().Before(h.expiration) {
+		return append([]net.IP{}, h.ips...)
+	}
+
+	return nil
+}
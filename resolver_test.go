@@ -0,0 +1,357 @@
+package dnssd
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestResolverCache(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResolver(conn)
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{SRV(sv), TXT(sv)}
+		for _, a := range A(sv, testIface) {
+			msg.Answer = append(msg.Answer, a)
+		}
+		conn.in <- msg
+	}()
+
+	srv, err := r.LookupInstance(ctx, sv.EscapedServiceInstanceName())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := srv.Port, 1234; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The following lookups are answered from the cache.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.LookupInstance(ctx, sv.EscapedServiceInstanceName()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Service instance names are compared case-insensitively.
+	if _, err := r.LookupInstance(ctx, "test._asdf._tcp.local."); err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err := r.LookupHost(ctx, "Computer.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := ips[0].String(), "192.168.0.123"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestResolverLookupType(t *testing.T) {
+	service := func(name string) Service {
+		sv, err := NewService(Config{Name: name, Type: "_asdf._tcp", Host: "Computer", Port: 1234})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sv.ifaceIPs = map[string][]net.IP{
+			testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+		}
+		return sv
+	}
+	send := func(conn *testConn, rrs ...dns.RR) {
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = rrs
+		conn.in <- msg
+	}
+	records := func(sv Service) []dns.RR {
+		rrs := []dns.RR{PTR(sv), SRV(sv)}
+		for _, a := range A(sv, testIface) {
+			rrs = append(rrs, a)
+		}
+		return rrs
+	}
+
+	conn := newTestConn()
+	go func() {
+		for range conn.out {
+		}
+	}()
+	r := newResolver(conn)
+	defer r.Close()
+
+	a, b := service("A"), service("B")
+	send(conn, records(a)...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	added := make(chan BrowseEntry)
+	removed := make(chan BrowseEntry)
+	add := func(e BrowseEntry) { added <- e }
+	rmv := func(e BrowseEntry) { removed <- e }
+	go r.LookupType(ctx, "_asdf._tcp.local.", add, rmv)
+
+	// A is reported from the cache, B when it is received.
+	for _, name := range []string{"A", "B"} {
+		if name == "B" {
+			send(conn, records(b)...)
+		}
+
+		select {
+		case e := <-added:
+			if is, want := e.Name, name; is != want {
+				t.Fatalf("is=%v want=%v", is, want)
+			}
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+
+	goodbye := PTR(a)
+	goodbye.Hdr.Ttl = 0
+	send(conn, goodbye)
+
+	select {
+	case e := <-removed:
+		if is, want := e.Name, "A"; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+}
+
+func TestResolverHostsExpire(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: start}
+	r := &Resolver{cache: NewCache(), hosts: map[string]*hostAddrs{}}
+	r.cache.clock = clock
+
+	update := func(host string, ttl uint32) {
+		msg := new(dns.Msg)
+		msg.Answer = []dns.RR{&dns.A{
+			Hdr: dns.RR_Header{Name: host, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   net.IP{192, 168, 0, 1},
+		}}
+		r.updateHosts(&Request{msg: msg, iface: testIface})
+	}
+
+	update("Computer.local.", 10)
+	if ips := r.cachedHost("Computer.local."); len(ips) != 1 {
+		t.Fatalf("unexpected addresses %v", ips)
+	}
+
+	// The addresses expire with the clock of the cache.
+	clock.now = start.Add(time.Minute)
+	if ips := r.cachedHost("Computer.local."); len(ips) != 0 {
+		t.Fatalf("unexpected addresses %v", ips)
+	}
+
+	// Expired hosts are removed.
+	update("Other.local.", 120)
+	if _, ok := r.hosts["computer.local."]; ok {
+		t.Fatal("expected expired host to be removed")
+	}
+
+	if is, want := len(r.hosts), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+// retryClock is a clock, which records the durations of its timers,
+// whose timers fire when a time is sent to gate.
+type retryClock struct {
+	gate chan time.Time
+
+	mutex sync.Mutex
+	ds    []time.Duration
+}
+
+func (c *retryClock) Now() time.Time { return time.Now() }
+
+func (c *retryClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ds = append(c.ds, d)
+	return c.gate
+}
+
+func TestResolverLookupInstanceClock(t *testing.T) {
+	conn := newTestConn()
+	go func() {
+		for range conn.out {
+		}
+	}()
+
+	r := newResolver(conn)
+	defer r.Close()
+
+	// The first retry fires immediately.
+	c := &retryClock{gate: make(chan time.Time, 1)}
+	c.gate <- time.Now()
+
+	ctx, cancel := context.WithTimeout(WithClock(context.Background(), c), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.LookupInstance(ctx, "Test._asdf._tcp.local."); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if is, want := c.ds, []time.Duration{firstQueryInterval, nextQueryInterval(firstQueryInterval)}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestLookupInstancePartial(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newTestConn()
+	go func() {
+		for range conn.out {
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{SRV(sv)}
+		conn.in <- msg
+	}()
+
+	// The TXT record is missing when the deadline expires.
+	srv, err := lookupInstance(ctx, sv.EscapedServiceInstanceName(), conn, WaitNoAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := srv.Port, sv.Port; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// Nothing was resolved.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := lookupInstance(ctx, "Other._asdf._tcp.local.", conn, WaitNoAddr); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestEscapeServiceInstanceName(t *testing.T) {
+	tests := []struct {
+		Instance string
+		Escaped  string
+	}{
+		{"My Printer 2.0._ipp._tcp.local", "My\\ Printer\\ 2\\.0._ipp._tcp.local."},
+		{"My\\ Printer\\ 2\\.0._ipp._tcp.local.", "My\\ Printer\\ 2\\.0._ipp._tcp.local."},
+		{"Printer._ipp._tcp.example.com.", "Printer._ipp._tcp.example.com."},
+	}
+
+	for _, test := range tests {
+		if is, want := escapeServiceInstanceName(test.Instance), test.Escaped; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+}
+
+func TestNextQueryInterval(t *testing.T) {
+	interval := firstQueryInterval
+	for _, want := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		if interval = nextQueryInterval(interval); interval != want {
+			t.Fatalf("is=%v want=%v", interval, want)
+		}
+	}
+
+	if is, want := nextQueryInterval(45*time.Minute), maxQueryInterval; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestLookupInstanceWithAddrs(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newTestConn()
+	go func() {
+		for range conn.out {
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		// The address is received after the SRV and TXT records.
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{SRV(sv), TXT(sv)}
+		conn.in <- msg
+
+		msg = new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{
+			&dns.A{Hdr: dns.RR_Header{Name: sv.Hostname(), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120}, A: net.IP{192, 168, 0, 123}},
+		}
+		select {
+		case conn.in <- msg:
+		case <-ctx.Done():
+		}
+	}()
+
+	srv, err := LookupInstanceWithAddrs(ctx, conn, sv.EscapedServiceInstanceName(), WaitAnyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(srv.IPs), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
@@ -3,18 +3,60 @@ package dnssd
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/brutella/dnssd/log"
 	"github.com/miekg/dns"
 )
 
 type ReadFunc func(*Request)
 
+// MiddlewareFunc is called by a responder for every received request with a nil response,
+// and for every response before it is sent. The request is nil for unsolicited
+// responses like announcements and goodbye packets.
+// The response message can be modified. Return false to ignore the request
+// or to not send the response.
+type MiddlewareFunc func(req *Request, resp *Response) bool
+
+// ResponderOptions configures a responder.
+type ResponderOptions struct {
+	// Logger receives structured log messages of the responder.
+	// If nil, messages are written to the loggers of the log package.
+	Logger *slog.Logger
+
+	// DisableSubnetCheck disables the check, that the source address of a query
+	// is on a subnet of the network interface at which the query was received.
+	// By default, queries from other subnets are ignored. (RFC6762 11)
+	DisableSubnetCheck bool
+
+	// Announcements is the number of announcements sent for a service (2-8).
+	// Values outside of this range are clamped to it.
+	// By default, services are announced twice. (RFC6762 8.3)
+	Announcements int
+
+	// AnnounceInterval is the time between the first two announcements.
+	// The interval is doubled after every announcement. (RFC6762 8.3)
+	// If zero or less than one second, an interval of one second is used.
+	AnnounceInterval time.Duration
+
+	// Probe configures probing of added services.
+	Probe ProbeConfig
+
+	// Clock is used for probing, announcements and response delays.
+	// If nil, the system clock is used.
+	Clock Clock
+
+	// Conn configures the multicast addresses of the connection, which is
+	// opened by NewResponderWithOptions, and of the connections used for probing.
+	// By default, the mDNS addresses 224.0.0.251:5353 and [ff02::fb]:5353 are used.
+	Conn ConnOptions
+}
+
 // Responder represents a mDNS responder.
 type Responder interface {
 	// Add adds a service to the responder.
@@ -31,20 +73,119 @@ type Responder interface {
 	Debug(ctx context.Context, fn ReadFunc)
 }
 
+// ResponderControl is implemented by the responders of this package in addition
+// to Responder. Its operations are not part of Responder, so that other
+// implementations of Responder don't have to implement them, e.g.
+//
+//	if rc, ok := rp.(dnssd.ResponderControl); ok {
+//		rc.Stop(ctx)
+//	}
+type ResponderControl interface {
+	Responder
+
+	// AddAll adds multiple services to the responder.
+	// The services are probed together and announced at once.
+	AddAll(srvs []Service) ([]ServiceHandle, error)
+
+	// RemoveAll removes the services associated with the service handles
+	// from the responder and sends goodbye packets for them at once.
+	RemoveAll(srvs []ServiceHandle)
+
+	// Stop stops responding and sends goodbye packets for all services.
+	// It returns once the goodbye packets are sent and Respond has returned,
+	// or when ctx is done.
+	Stop(ctx context.Context) error
+
+	// Pause makes the responder stop answering queries.
+	// The services stay registered and are not probed again on Resume.
+	Pause()
+
+	// Resume makes a paused responder answer queries again.
+	Resume()
+
+	// Reannounce resends the announcements of all services,
+	// e.g. after the network configuration has changed.
+	Reannounce()
+
+	// Services returns the services which are currently announced by the responder.
+	// The service instance names and hostnames reflect any renaming during probing.
+	Services() []Service
+
+	// Use adds a middleware function, which can observe requests and
+	// inspect, modify or veto responses. Middleware functions are
+	// called in the order they were added.
+	Use(fn MiddlewareFunc)
+}
+
 type responder struct {
 	isRunning bool
 
+	// stop cancels responding and done is closed when Respond returns.
+	// ctx is the context of Respond, which is used for reprobing.
+	stopMutex sync.Mutex
+	stop      context.CancelFunc
+	done      chan struct{}
+	ctx       context.Context
+
+	// paused is true, if queries are not answered.
+	paused atomic.Bool
+
+	// events are the status events, which are sent when the mutex is unlocked (see unlock).
+	events statusEvents
+
 	conn      MDNSConn
 	unmanaged []*serviceHandle
 	managed   []*serviceHandle
 
-	mutex     *sync.Mutex
-	truncated *Request
+	mutex *sync.Mutex
+	// truncated stores truncated queries per source, which wait for more known answers.
+	truncated map[string]*truncatedQuery
 	random    *rand.Rand
-	upIfaces  []string
+	// upIfaces stores the addresses of the multicast network interfaces by name.
+	upIfaces map[string]string
+	logger   *slog.Logger
+
+	// anySubnet is true, if queries from other subnets are answered.
+	anySubnet bool
+
+	// announcements is the number of announcements and
+	// announceInterval the time between the first two.
+	announcements    int
+	announceInterval time.Duration
+
+	probeConfig ProbeConfig
+	clock       Clock
+
+	// netns is the network namespace of the connection,
+	// in which network interfaces are looked up.
+	netns *netns
+
+	// hosts stores the lowercased hostnames, which were probed successfully.
+	hosts map[string]bool
+
+	middlewareMutex sync.RWMutex
+	middlewares     []MiddlewareFunc
+
+	// multicasts stores when records were multicast per interface.
+	multicastMutex sync.Mutex
+	multicasts     map[string]time.Time
+
+	// observed stores answers multicast by other responders per interface.
+	observed map[string]observedAnswer
+
+	// senders stores the senders of scheduled responses per interface name.
+	sendersMutex sync.Mutex
+	senders      map[string]*sender
+}
+
+// observedAnswer is an answer which was multicast by another responder.
+type observedAnswer struct {
+	time time.Time
+	ttl  uint32
 }
 
-// NewResponder returns a new mDNS responder.
+// NewResponder returns a new mDNS responder,
+// which also implements ResponderControl.
 func NewResponder() (Responder, error) {
 	conn, err := newMDNSConn()
 	if err != nil {
@@ -54,15 +195,77 @@ func NewResponder() (Responder, error) {
 	return newResponder(conn), nil
 }
 
+// NewResponderWithOptions returns a new mDNS responder configured by opts.
+func NewResponderWithOptions(opts ResponderOptions) (Responder, error) {
+	if opts.Conn.Logger == nil {
+		opts.Conn.Logger = opts.Logger
+	}
+
+	conn, err := newMDNSConnWithOptions(opts.Conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewResponderWithConn(conn, opts), nil
+}
+
+// NewResponderWithConn returns a new mDNS responder configured by opts,
+// which uses conn, e.g. a SharedConn which is also used for lookups.
+// The connection is closed when the responder stops.
+func NewResponderWithConn(conn MDNSConn, opts ResponderOptions) Responder {
+	r := newResponder(conn)
+	if opts.Logger != nil {
+		r.logger = opts.Logger
+	}
+	r.anySubnet = opts.DisableSubnetCheck
+
+	if n := opts.Announcements; n > 0 {
+		// At least two announcements must be sent. (RFC6762 8.3)
+		if n < 2 {
+			n = 2
+		} else if n > 8 {
+			n = 8
+		}
+		r.announcements = n
+	}
+
+	if opts.AnnounceInterval > time.Second {
+		r.announceInterval = opts.AnnounceInterval
+	}
+
+	r.probeConfig = opts.Probe
+	r.probeConfig.connOptions = opts.Conn
+	if r.probeConfig.connOptions.Logger == nil {
+		r.probeConfig.connOptions.Logger = opts.Logger
+	}
+
+	if opts.Clock != nil {
+		r.clock = opts.Clock
+	}
+
+	return r
+}
+
 func newResponder(conn MDNSConn) *responder {
 	return &responder{
-		isRunning: false,
-		conn:      conn,
-		unmanaged: []*serviceHandle{},
-		managed:   []*serviceHandle{},
-		mutex:     &sync.Mutex{},
-		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
-		upIfaces:  []string{},
+		isRunning:  false,
+		conn:       conn,
+		unmanaged:  []*serviceHandle{},
+		managed:    []*serviceHandle{},
+		mutex:      &sync.Mutex{},
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		upIfaces:   map[string]string{},
+		logger:     defaultLogger,
+		multicasts: map[string]time.Time{},
+		observed:   map[string]observedAnswer{},
+		truncated:  map[string]*truncatedQuery{},
+		senders:    map[string]*sender{},
+		hosts:      map[string]bool{},
+		netns:      netnsOf(conn),
+
+		announcements:    2,
+		announceInterval: time.Second,
+		clock:            realClock{},
 	}
 }
 
@@ -74,15 +277,69 @@ func (r *responder) Remove(h ServiceHandle) {
 			handle := h.(*serviceHandle)
 			r.unannounce([]*Service{handle.service})
 			r.managed = append(r.managed[:i], r.managed[i+1:]...)
+			r.releaseHosts([]*Service{handle.service})
 			return
 		}
 	}
 }
 
-func (r *responder) Add(srv Service) (ServiceHandle, error) {
+func (r *responder) RemoveAll(hs []ServiceHandle) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	var services []*Service
+	for _, h := range hs {
+		for i, s := range r.managed {
+			if h == s {
+				services = append(services, s.service)
+				r.managed = append(r.managed[:i], r.managed[i+1:]...)
+				break
+			}
+		}
+
+		// Unmanaged services are not announced yet.
+		for i, s := range r.unmanaged {
+			if h == s {
+				r.unmanaged = append(r.unmanaged[:i], r.unmanaged[i+1:]...)
+				break
+			}
+		}
+	}
+	r.unannounce(services)
+	r.releaseHosts(services)
+}
+
+// releaseHosts forgets the verified hostnames of the removed services srvs,
+// which are not used by other managed services, so that they are probed
+// again when they are used by added services.
+func (r *responder) releaseHosts(srvs []*Service) {
+	for _, srv := range srvs {
+		name := strings.ToLower(srv.Hostname())
+		used := false
+		for _, h := range r.managed {
+			if strings.ToLower(h.service.Hostname()) == name {
+				used = true
+				break
+			}
+		}
+
+		if !used {
+			delete(r.hosts, name)
+		}
+	}
+}
+
+func (r *responder) Add(srv Service) (ServiceHandle, error) {
+	r.mutex.Lock()
+	defer r.unlock()
+
+	srv.bind(r.netns, r.logger)
+	if err := srv.validateIfaceIPs(); err != nil {
+		return nil, err
+	}
+	r.checkTextSize(&srv)
+	r.joinExcludedIfaces([]Service{srv})
+
 	if r.isRunning {
 		ctx, cancel := context.WithCancel(context.TODO())
 		defer cancel()
@@ -98,24 +355,90 @@ func (r *responder) Add(srv Service) (ServiceHandle, error) {
 	return r.addUnmanaged(srv), nil
 }
 
+func (r *responder) AddAll(srvs []Service) ([]ServiceHandle, error) {
+	r.mutex.Lock()
+	defer r.unlock()
+
+	srvs = append([]Service{}, srvs...)
+	for i := range srvs {
+		srvs[i].bind(r.netns, r.logger)
+		if err := srvs[i].validateIfaceIPs(); err != nil {
+			return nil, err
+		}
+		r.checkTextSize(&srvs[i])
+	}
+	r.joinExcludedIfaces(srvs)
+
+	var hs []ServiceHandle
+	if r.isRunning {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+
+		probed, err := r.registerAll(ctx, srvs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, srv := range probed {
+			hs = append(hs, r.addManaged(srv))
+		}
+
+		return hs, nil
+	}
+
+	for _, srv := range srvs {
+		hs = append(hs, r.addUnmanaged(srv))
+	}
+
+	return hs, nil
+}
+
 func (r *responder) Respond(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	r.stopMutex.Lock()
+	r.stop = cancel
+	r.done = done
+	r.ctx = ctx
+	r.stopMutex.Unlock()
+
+	defer func() {
+		r.stopMutex.Lock()
+		r.stop = nil
+		r.stopMutex.Unlock()
+
+		cancel()
+		close(done)
+	}()
+
 	r.mutex.Lock()
 	err := func() error {
 		r.isRunning = true
+		if len(r.unmanaged) == 0 {
+			return nil
+		}
+
+		srvs := []Service{}
 		for _, h := range r.unmanaged {
-			log.Debug.Println(h.service)
-			srv, err := r.register(ctx, *h.service)
-			if err != nil {
-				return err
-			}
+			r.logger.Debug("Registering service", "service", h.service.ServiceInstanceName())
+			srvs = append(srvs, *h.service)
+		}
+
+		probed, err := r.registerAll(ctx, srvs)
+		if err != nil {
+			return err
+		}
 
+		for i, h := range r.unmanaged {
+			srv := probed[i]
 			h.service = &srv
 			r.managed = append(r.managed, h)
 		}
 		r.unmanaged = []*serviceHandle{}
 		return nil
 	}()
-	r.mutex.Unlock()
+	r.unlock()
 
 	if err != nil {
 		return err
@@ -126,9 +449,214 @@ func (r *responder) Respond(ctx context.Context) error {
 	return r.respond(ctx)
 }
 
+// Stop stops responding and waits until the goodbye packets are sent.
+func (r *responder) Stop(ctx context.Context) error {
+	r.stopMutex.Lock()
+	stop, done := r.stop, r.done
+	r.stopMutex.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+
+	stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *responder) Pause() {
+	r.paused.Store(true)
+}
+
+func (r *responder) Resume() {
+	r.paused.Store(false)
+}
+
+func (r *responder) Reannounce() {
+	r.mutex.Lock()
+	var srvs []*Service
+	for _, srv := range services(r.managed) {
+		srvs = append(srvs, srv.Copy())
+	}
+	r.mutex.Unlock()
+
+	r.logger.Debug("Reannouncing services", "services", srvs)
+	r.announce(srvs)
+	notifyReannounced(srvs)
+}
+
+// notifyReannounced reports StatusReannounced for the announced services of srvs.
+func notifyReannounced(srvs []*Service) {
+	for _, srv := range srvs {
+		if srv.maintenance == MaintenanceOff {
+			srv.notify(StatusReannounced)
+		}
+	}
+}
+
+// unlock unlocks the mutex of the responder and then sends the collected
+// status events, so that status functions can call the responder.
+func (r *responder) unlock() {
+	events := r.events
+	r.events = nil
+	r.mutex.Unlock()
+
+	events.send()
+}
+
+func (r *responder) Services() []Service {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	result := []Service{}
+	for _, srv := range services(r.managed) {
+		result = append(result, *srv.Copy())
+	}
+
+	return result
+}
+
+func (r *responder) Use(fn MiddlewareFunc) {
+	r.middlewareMutex.Lock()
+	defer r.middlewareMutex.Unlock()
+
+	r.middlewares = append(r.middlewares, fn)
+}
+
+// allow returns false if any middleware function vetoes the request or response.
+func (r *responder) allow(req *Request, resp *Response) bool {
+	r.middlewareMutex.RLock()
+	defer r.middlewareMutex.RUnlock()
+
+	for _, fn := range r.middlewares {
+		if !fn(req, resp) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sendResponse sends resp, if no middleware function vetoes it.
+// req is the request to which resp is the response, or nil.
+func (r *responder) sendResponse(req *Request, resp *Response) error {
+	if !r.allow(req, resp) {
+		r.logger.Debug("Response suppressed by middleware", "iface", resp.IfaceName())
+		return nil
+	}
+
+	if err := r.conn.SendResponse(resp); err != nil {
+		return err
+	}
+
+	if resp.addr == nil {
+		r.setMulticast(resp.msg.Answer, resp.iface)
+	}
+
+	return nil
+}
+
+// multicastKey returns the key of rr at iface to keep track of multicast records.
+func multicastKey(rr dns.RR, iface *net.Interface) string {
+	name := "?"
+	if iface != nil {
+		name = iface.Name
+	}
+
+	hdr := rr.Header()
+	rdata := strings.TrimPrefix(rr.String(), hdr.String())
+
+	return fmt.Sprintf("%s %s %d %s", name, strings.ToLower(hdr.Name), hdr.Rrtype, rdata)
+}
+
+// setMulticast remembers that rrs were multicast at iface.
+func (r *responder) setMulticast(rrs []dns.RR, iface *net.Interface) {
+	r.multicastMutex.Lock()
+	defer r.multicastMutex.Unlock()
+
+	now := r.clock.Now()
+	for _, rr := range rrs {
+		if rr.Header().Ttl == 0 {
+			delete(r.multicasts, multicastKey(rr, iface))
+			continue
+		}
+		r.multicasts[multicastKey(rr, iface)] = now
+	}
+}
+
+// wereMulticastRecently returns true, if all rrs were multicast at iface
+// within the last quarter of their time-to-live.
+func (r *responder) wereMulticastRecently(rrs []dns.RR, iface *net.Interface) bool {
+	r.multicastMutex.Lock()
+	defer r.multicastMutex.Unlock()
+
+	now := r.clock.Now()
+	for _, rr := range rrs {
+		t, ok := r.multicasts[multicastKey(rr, iface)]
+		if !ok {
+			return false
+		}
+
+		quarter := time.Duration(rr.Header().Ttl) * time.Second / 4
+		if now.Sub(t) > quarter {
+			return false
+		}
+	}
+
+	return true
+}
+
+// observe remembers that rrs were multicast by another responder at iface.
+func (r *responder) observe(rrs []dns.RR, iface *net.Interface) {
+	r.multicastMutex.Lock()
+	defer r.multicastMutex.Unlock()
+
+	now := r.clock.Now()
+	for key, a := range r.observed {
+		if now.Sub(a.time) > time.Second {
+			delete(r.observed, key)
+		}
+	}
+
+	for _, rr := range rrs {
+		r.observed[multicastKey(rr, iface)] = observedAnswer{time: now, ttl: rr.Header().Ttl}
+	}
+}
+
+// suppressDuplicates returns rrs without the answers which another responder
+// multicast at iface within the last second with a time-to-live not less than ours.
+// The suppressed answers are treated as if they were multicast by us. (RFC6762 7.4)
+func (r *responder) suppressDuplicates(rrs []dns.RR, iface *net.Interface) []dns.RR {
+	r.multicastMutex.Lock()
+	defer r.multicastMutex.Unlock()
+
+	now := r.clock.Now()
+	var result []dns.RR
+	for _, rr := range rrs {
+		key := multicastKey(rr, iface)
+		a, ok := r.observed[key]
+		if ok && now.Sub(a.time) <= time.Second && a.ttl >= rr.Header().Ttl {
+			r.multicasts[key] = a.time
+			continue
+		}
+		result = append(result, rr)
+	}
+
+	return result
+}
+
 // announce sends announcement messages including all services.
 func (r *responder) announce(services []*Service) {
 	for _, service := range services {
+		if service.maintenance != MaintenanceOff {
+			continue
+		}
+
 		for _, iface := range service.Interfaces() {
 			service, iface := service, iface
 			go r.announceAtInterface(service, iface)
@@ -139,7 +667,7 @@ func (r *responder) announce(services []*Service) {
 func (r *responder) announceAtInterface(service *Service, iface *net.Interface) {
 	ips := service.IPsAtInterface(iface)
 	if len(ips) == 0 {
-		log.Debug.Printf("No IPs for service %s at %s\n", service.ServiceInstanceName(), iface.Name)
+		r.logger.Debug("No IPs for service", "service", service.ServiceInstanceName(), "iface", iface.Name)
 		return
 	}
 
@@ -153,6 +681,13 @@ func (r *responder) announceAtInterface(service *Service, iface *net.Interface)
 	for _, aaaa := range AAAA(*service, iface) {
 		answer = append(answer, aaaa)
 	}
+	for _, cname := range CNAME(*service) {
+		answer = append(answer, cname)
+	}
+	hosts := extraAddressRecords(*service, iface)
+	for _, name := range service.HostNames() {
+		answer = append(answer, hosts[strings.ToLower(name)]...)
+	}
 	msg := new(dns.Msg)
 	msg.Answer = answer
 	msg.Response = true
@@ -160,47 +695,103 @@ func (r *responder) announceAtInterface(service *Service, iface *net.Interface)
 
 	setAnswerCacheFlushBit(msg)
 
+	r.sendAnnouncement(msg, iface)
+}
+
+// sendAnnouncement sends msg at iface according to the announcement schedule. (RFC6762 8.3)
+func (r *responder) sendAnnouncement(msg *dns.Msg, iface *net.Interface) {
 	resp := &Response{msg: msg, iface: iface}
 
-	log.Debug.Println("Sending 1st announcement", msg)
-	if err := r.conn.SendResponse(resp); err != nil {
-		log.Debug.Println("1st announcement:", err)
-	}
-	time.Sleep(1 * time.Second)
-	log.Debug.Println("Sending 2nd announcement", msg)
-	if err := r.conn.SendResponse(resp); err != nil {
-		log.Debug.Println("2nd announcement:", err)
+	logger := r.logger.With("iface", iface.Name)
+	interval := r.announceInterval
+	for i := 1; i <= r.announcements; i++ {
+		if i > 1 {
+			sleep(r.clock, interval)
+			interval *= 2
+		}
+
+		logger.Debug("Sending announcement", "n", i, "msg", msg)
+		if err := r.sendResponse(nil, resp); err != nil {
+			logger.Debug("Announcement failed", "n", i, "err", err)
+		}
 	}
 }
 
 func (r *responder) register(ctx context.Context, srv Service) (Service, error) {
+	probed, err := r.registerAll(ctx, []Service{srv})
+	if err != nil {
+		return srv, err
+	}
+
+	return probed[0], nil
+}
+
+// registerAll probes srvs and announces them together with all managed services.
+func (r *responder) registerAll(ctx context.Context, srvs []Service) ([]Service, error) {
 	if !r.isRunning {
-		return srv, fmt.Errorf("cannot register service when responder is not responding")
+		return srvs, fmt.Errorf("cannot register service when responder is not responding")
 	}
 
-	log.Debug.Printf("Probing for host %s and service %s…\n", srv.Hostname(), srv.ServiceInstanceName())
-	probed, err := ProbeService(ctx, srv)
-	if err != nil {
-		return srv, err
+	registered := make([]Service, len(srvs))
+	copy(registered, srvs)
+
+	var unprobed []Service
+	var indices []int
+	for i, srv := range srvs {
+		if srv.skipProbe {
+			r.logger.Debug("Skip probing", "host", srv.Hostname(), "service", srv.ServiceInstanceName())
+			continue
+		}
+
+		// Hostnames are only probed once.
+		srv.hostVerified = r.hosts[strings.ToLower(srv.Hostname())]
+		r.logger.Debug("Probing", "host", srv.Hostname(), "service", srv.ServiceInstanceName())
+		r.events.add(srv, StatusProbing)
+		unprobed = append(unprobed, srv)
+		indices = append(indices, i)
 	}
 
-	srvs := []*Service{&probed}
+	if len(unprobed) > 0 {
+		probed, err := ProbeServicesWithConfig(WithClock(WithLogger(ctx, r.logger), r.clock), unprobed, r.probeConfig)
+		if err != nil {
+			return srvs, err
+		}
+
+		for i, srv := range probed {
+			srv.hostVerified = false
+			registered[indices[i]] = srv
+		}
+	}
+
+	for _, srv := range registered {
+		r.hosts[strings.ToLower(srv.Hostname())] = true
+	}
+
+	for i, srv := range registered {
+		r.events.addRenamed(srv, srvs[i])
+		r.events.add(srv, StatusRegistered)
+	}
+
+	announced := []*Service{}
+	for i := range registered {
+		announced = append(announced, &registered[i])
+	}
 	for _, h := range r.managed {
-		srvs = append(srvs, h.service)
+		announced = append(announced, h.service)
 	}
-	go r.announce(srvs)
+	go r.announce(announced)
 
-	return probed, nil
+	return registered, nil
 }
 
 func (r *responder) addManaged(srv Service) ServiceHandle {
-	h := &serviceHandle{&srv}
+	h := &serviceHandle{service: &srv, responder: r}
 	r.managed = append(r.managed, h)
 	return h
 }
 
 func (r *responder) addUnmanaged(srv Service) ServiceHandle {
-	h := &serviceHandle{&srv}
+	h := &serviceHandle{service: &srv, responder: r}
 	r.unmanaged = append(r.unmanaged, h)
 	return h
 }
@@ -212,16 +803,22 @@ func (r *responder) respond(ctx context.Context) error {
 
 	readCtx, readCancel := context.WithCancel(ctx)
 	defer readCancel()
-	ch := r.conn.Read(readCtx)
+
+	// Requests are read and filtered in a separate goroutine, so that reading
+	// from the connection is not blocked while a request is handled.
+	// Responses are sent by the senders of the interfaces.
+	queue := make(chan *Request, requestQueueSize)
+	go r.receive(readCtx, r.conn.Read(readCtx), queue)
 
 	for {
 		select {
-		case req := <-ch:
+		case req := <-queue:
 			r.mutex.Lock()
 			r.handleRequest(req)
-			r.mutex.Unlock()
+			r.unlock()
 
 		case <-ctx.Done():
+			r.stopSenders()
 			r.unannounce(services(r.managed))
 			r.conn.Close()
 			r.isRunning = false
@@ -230,42 +827,151 @@ func (r *responder) respond(ctx context.Context) error {
 	}
 }
 
+// requestQueueSize is the number of received requests,
+// which can wait to be handled by the responder.
+const requestQueueSize = 64
+
+// receive forwards the requests from ch to queue, which are not ignored.
+// If queue is full, requests are dropped instead of blocking the connection.
+// Queriers retransmit unanswered queries. (RFC6762 5.2)
+func (r *responder) receive(ctx context.Context, ch <-chan *Request, queue chan<- *Request) {
+	for {
+		select {
+		case req := <-ch:
+			if req.own {
+				// Ignore our own messages received via multicast loopback.
+				continue
+			}
+
+			if !r.anySubnet && !isFromLocalSubnet(req, r.netns) {
+				r.logger.Debug("Ignoring request from other subnet", "peer", req.from, "iface", req.IfaceName())
+				continue
+			}
+
+			if !r.allow(req, nil) {
+				continue
+			}
+
+			select {
+			case queue <- req:
+			default:
+				r.logger.Debug("Dropping request because the queue is full", "peer", req.from, "iface", req.IfaceName())
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// truncatedTimeout is the minimum duration to wait for the
+// continuation of a truncated query.
+const truncatedTimeout = 400 * time.Millisecond
+
+// truncatedQuery is a truncated query which waits for more known answers.
+type truncatedQuery struct {
+	req *Request
+
+	// stop is closed when the query stops waiting before the timeout.
+	stop chan struct{}
+}
+
+// truncatedKey returns the key of the source of req.
+func truncatedKey(req *Request) string {
+	return fmt.Sprintf("%s %s", req.IfaceName(), req.from)
+}
+
 func (r *responder) handleRequest(req *Request) {
 	if len(r.managed) == 0 {
 		// Ignore requests when no services are managed
 		return
 	}
 
+	key := truncatedKey(req)
+
+	// append request
+	if t, ok := r.truncated[key]; ok {
+		r.logger.Debug("Add answers to truncated message", "peer", req.from)
+		close(t.stop)
+		delete(r.truncated, key)
+
+		msg := mergeMsgs([]*dns.Msg{t.req.msg, req.msg})
+		msg.MsgHdr = t.req.msg.MsgHdr
+		msg.Truncated = req.msg.Truncated
+		req.msg = msg
+	}
+
 	// If messages is truncated, we wait for the next message to come (RFC6762 18.5)
+	// but not longer than 400-500ms. (RFC6762 7.2)
 	if req.msg.Truncated {
-		r.truncated = req
-		log.Debug.Println("Waiting for additional answers...")
-		return
-	}
+		r.logger.Debug("Waiting for additional answers", "peer", req.from)
+		delay := truncatedTimeout + time.Duration(r.random.Intn(100))*time.Millisecond
+		t := &truncatedQuery{req: req, stop: make(chan struct{})}
+		go func() {
+			select {
+			case <-r.clock.After(delay):
+			case <-t.stop:
+				return
+			}
 
-	// append request
-	if r.truncated != nil && r.truncated.from.IP.Equal(req.from.IP) {
-		log.Debug.Println("Add answers to truncated message")
-		msgs := []*dns.Msg{r.truncated.msg, req.msg}
-		r.truncated = nil
-		req.msg = mergeMsgs(msgs)
+			r.mutex.Lock()
+			defer r.unlock()
+
+			if r.truncated[key] != t {
+				return
+			}
+			delete(r.truncated, key)
+
+			r.logger.Debug("Stop waiting for additional answers", "peer", req.from)
+			req.msg.Truncated = false
+			r.handleRequest(req)
+		}()
+		r.truncated[key] = t
+		return
 	}
 
 	if len(req.msg.Question) > 0 {
-		r.handleQuery(req, services(r.managed))
+		if r.paused.Load() {
+			r.logger.Debug("Ignoring query while paused", "peer", req.from, "iface", req.IfaceName())
+			return
+		}
+		r.handleQuery(req, r.managed)
 	} else {
+		if req.msg.Response && req.from != nil {
+			r.observe(req.msg.Answer, req.iface)
+		}
+
 		// Check if the request contains any conflicting records.
-		conflicts := findConflicts(req, r.managed)
+		conflicts := findConflicts(req, r.managed, r.logger)
 		for _, h := range conflicts {
-			log.Debug.Println("Reprobe for", h.service)
-			go r.reprobe(h)
+			r.logger.Debug("Reprobe", "service", h.service.ServiceInstanceName(), "peer", req.from, "iface", req.IfaceName())
+			r.loseConflict(h)
+		}
+	}
+}
 
-			for i, m := range r.managed {
-				if h == m {
-					r.managed = append(r.managed[:i], r.managed[i+1:]...)
-					break
-				}
-			}
+// isManaged returns true, if h is managed by the responder while the mutex is locked.
+func (r *responder) isManaged(h *serviceHandle) bool {
+	for _, m := range r.managed {
+		if h == m {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loseConflict stops responding for the service of h, which names are used by
+// another host, and probes for new names while the mutex is locked.
+func (r *responder) loseConflict(h *serviceHandle) {
+	r.events.add(*h.service, StatusConflictLost)
+	delete(r.hosts, strings.ToLower(h.service.Hostname()))
+	go r.reprobe(h)
+
+	for i, m := range r.managed {
+		if h == m {
+			r.managed = append(r.managed[:i], r.managed[i+1:]...)
+			break
 		}
 	}
 }
@@ -275,7 +981,7 @@ func (r *responder) unannounce(services []*Service) {
 		return
 	}
 
-	log.Debug.Println("Send goodbye for", services)
+	r.logger.Debug("Send goodbye", "services", services)
 
 	// collect records per interface
 	rrsByIfaceName := map[string][]dns.RR{}
@@ -297,189 +1003,381 @@ func (r *responder) unannounce(services []*Service) {
 
 	// send on goodbye packet on every interface
 	for name, rrs := range rrsByIfaceName {
-		iface, err := net.InterfaceByName(name)
+		iface, err := r.netns.interfaceByName(name)
 		if err != nil {
-			log.Debug.Printf("Interface %s not found\n", name)
+			r.logger.Debug("Interface not found", "iface", name)
 			continue
 		}
-		msg := new(dns.Msg)
-		msg.Answer = rrs
-		msg.Response = true
-		msg.Authoritative = true
-		resp := &Response{msg: msg, iface: iface}
-		if err := r.conn.SendResponse(resp); err != nil {
-			log.Debug.Println("1st goodbye:", err)
-		}
-		time.Sleep(250 * time.Millisecond)
-		if err := r.conn.SendResponse(resp); err != nil {
-			log.Debug.Println("2nd goodbye:", err)
-		}
+		r.sendGoodbye(rrs, iface)
 	}
 }
 
-func (r *responder) handleQuery(req *Request, services []*Service) {
+// handleQuery answers all questions of req in at most one unicast and one multicast response.
+func (r *responder) handleQuery(req *Request, hs []*serviceHandle) {
+	logger := r.logger.With("iface", req.IfaceName(), "peer", req.from)
+	legacy := req.isLegacyUnicast()
+
+	var unicast, multicast []*dns.Msg
 	for _, q := range req.msg.Question {
 		msgs := []*dns.Msg{}
-		for _, srv := range services {
-			log.Debug.Printf("%s tries to give response to question %v @%s\n", srv.ServiceInstanceName(), q, req.IfaceName())
-			if msg := r.handleQuestion(q, req, *srv); msg != nil {
+		if isServicesMetaQuestion(q) {
+			if msg := r.handleMetaQuestion(q, req, hs); msg != nil {
 				msgs = append(msgs, msg)
-			} else {
-				log.Debug.Println("No response")
+			}
+		} else {
+			for _, h := range hs {
+				if msg := r.handleQuestion(q, req, h); msg != nil {
+					msgs = append(msgs, msg)
+				}
 			}
 		}
 
 		msg := mergeMsgs(msgs)
-		msg.SetReply(req.msg)
-		msg.Response = true
-		msg.Authoritative = true
+		if len(msg.Answer) == 0 {
+			logger.Debug("No answers", "question", q.Name)
+			continue
+		}
 
-		// Legacy unicast response MUST be a conventional DNS server response (and thus, includes the question).
-		if isLegacyUnicastSource(req.from) {
-			msg.Question = []dns.Question{q}
+		// A unicast response is only sent to a question with the unicast-response bit set,
+		// if the answers were multicast recently on that interface. (RFC6762 5.4)
+		if legacy || (isUnicastQuestion(q) && r.wereMulticastRecently(msg.Answer, req.iface)) {
+			unicast = append(unicast, msg)
 		} else {
-			msg.Question = nil
+			multicast = append(multicast, msg)
 		}
+	}
 
+	if len(unicast) > 0 {
+		msg := r.queryResponse(req, unicast)
+		resp := &Response{msg: msg, addr: req.from, iface: req.iface}
+		r.scheduleResponse(req, resp, r.responseDelay(msg))
+	}
+
+	if len(multicast) > 0 {
+		msg := r.queryResponse(req, multicast)
+		msg.Answer = r.suppressDuplicates(msg.Answer, req.iface)
 		if len(msg.Answer) == 0 {
-			log.Debug.Println("No answers")
-			continue
+			logger.Debug("Answers were already multicast by another responder")
+			return
 		}
 
-		if isUnicastQuestion(q) || isLegacyUnicastSource(req.from) {
-			resp := &Response{msg: msg, addr: req.from, iface: req.iface}
-			log.Debug.Printf("Send unicast response\n%v to %v\n", msg, resp.addr)
-			if err := r.conn.SendResponse(resp); err != nil {
-				log.Debug.Println(err)
-			}
-		} else {
-			resp := &Response{msg: msg, iface: req.iface}
-			log.Debug.Printf("Send multicast response\n%v\n", msg)
-			if err := r.conn.SendResponse(resp); err != nil {
-				log.Debug.Println(err)
+		resp := &Response{msg: msg, iface: req.iface}
+		r.scheduleResponse(req, resp, r.responseDelay(msg))
+	}
+}
+
+// responseDelay returns the random delay of 20-125 msec for a response,
+// which contains shared records. Other responders may answer with records
+// of the same set, so the responses are spread out. (RFC6762 6)
+// Responses with only unique records are sent immediately.
+func (r *responder) responseDelay(msg *dns.Msg) time.Duration {
+	for _, rr := range msg.Answer {
+		if isShared(rr) {
+			return time.Duration(r.random.Intn(105)+20) * time.Millisecond
+		}
+	}
+
+	return 0
+}
+
+// isShared returns true, if rr is a member of a shared record set.
+func isShared(rr dns.RR) bool {
+	_, ok := rr.(*dns.PTR)
+	return ok
+}
+
+// scheduleResponse sends resp to req after delay by the sender of the interface,
+// without blocking the handling of other requests. Multicast answers, which
+// another responder sent in the meantime, are suppressed. (RFC6762 7.4)
+// Scheduled responses are dropped when the responder stops.
+func (r *responder) scheduleResponse(req *Request, resp *Response, delay time.Duration) {
+	logger := r.logger.With("iface", req.IfaceName(), "peer", req.from)
+	send := func() {
+		if resp.addr == nil {
+			resp.msg.Answer = r.suppressDuplicates(resp.msg.Answer, resp.iface)
+			if len(resp.msg.Answer) == 0 {
+				logger.Debug("Answers were already multicast by another responder")
+				return
 			}
 		}
+
+		logger.Debug("Send response", "msg", resp.msg, "unicast", resp.addr != nil)
+		if err := r.sendResponse(req, resp); err != nil {
+			logger.Debug("Sending response failed", "err", err)
+		}
 	}
+
+	if delay > 0 {
+		logger.Debug("Shared record response wait", "delay", delay)
+	}
+	r.senderAt(resp.iface).schedule(delay, send)
+}
+
+// queryResponse merges msgs into one deduplicated response to req.
+func (r *responder) queryResponse(req *Request, msgs []*dns.Msg) *dns.Msg {
+	msg := mergeMsgs(msgs)
+
+	// Records in the answer section are not repeated in the additional section.
+	msg.Extra = remove(msg.Answer, msg.Extra)
+
+	msg.SetReply(req.msg)
+	msg.Response = true
+	msg.Authoritative = true
+
+	// Legacy unicast response MUST be a conventional DNS server response (and thus, includes the question).
+	// The message id is copied from the query by SetReply. (RFC6762 6.7)
+	if req.isLegacyUnicast() {
+		msg.Question = req.msg.Question
+		msg.Answer = copyRecords(msg.Answer)
+		msg.Extra = copyRecords(msg.Extra)
+		prepareLegacyUnicastResponse(msg)
+
+		// OPT record is only included, if the query included one. (RFC6891 7)
+		if req.msg.IsEdns0() != nil {
+			msg = withEDNS0(msg)
+		}
+	} else {
+		msg.Question = nil
+	}
+
+	return msg
+}
+
+// probeContext returns a context for probing while the responder is running,
+// which is canceled when the responder stops.
+func (r *responder) probeContext() (context.Context, context.CancelFunc) {
+	r.stopMutex.Lock()
+	ctx := r.ctx
+	r.stopMutex.Unlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return context.WithCancel(WithClock(WithLogger(ctx, r.logger), r.clock))
 }
 
 func (r *responder) reprobe(h *serviceHandle) {
-	ctx, cancel := context.WithCancel(context.TODO())
+	ctx, cancel := r.probeContext()
 	defer cancel()
 
-	probed, err := ReprobeService(ctx, *h.service)
+	r.mutex.Lock()
+	srv := *h.service
+	r.mutex.Unlock()
+
+	srv.notify(StatusProbing)
+	probed, err := ReprobeServiceWithConfig(ctx, srv, r.probeConfig)
 	if err != nil {
+		r.logger.Debug("Reprobing failed", "service", srv.ServiceInstanceName(), "err", err)
 		return
 	}
-	h.service = &probed
+	probed.notifyRenamed(srv)
 
 	r.mutex.Lock()
+	h.service = &probed
 	managed := append(r.managed, h)
 	r.managed = managed
+	r.hosts[strings.ToLower(probed.Hostname())] = true
 	r.mutex.Unlock()
 
-	log.Debug.Println("Reannouncing services", managed)
+	r.logger.Debug("Reannouncing services", "services", services(managed))
 	go r.announce(services(managed))
+	probed.notify(StatusReannounced)
 }
 
-func (r *responder) handleQuestion(q dns.Question, req *Request, srv Service) *dns.Msg {
-	resp := new(dns.Msg)
-	switch strings.ToLower(q.Name) {
-	case strings.ToLower(srv.ServiceName()):
-		ptr := PTR(srv)
-		resp.Answer = []dns.RR{ptr}
-
-		extra := []dns.RR{SRV(srv), TXT(srv)}
+// handleQuestion returns the response of the service of h to the question q of req,
+// or nil if the question is not about the service. Only records of the requested
+// type are answered; related records are added to the additional section. (RFC6763 12)
+// The records of the service are reused and are only copied, if they are modified.
+func (r *responder) handleQuestion(q dns.Question, req *Request, h *serviceHandle) *dns.Msg {
+	rs := h.recordsAt(req.iface, r.clock.Now())
+	name := strings.ToLower(canonicalName(q.Name))
+
+	// Probes are answered in maintenance to defend the names of the service.
+	maintenance := h.service.maintenance
+	if isProbeQuery(req.msg) {
+		maintenance = MaintenanceOff
+	}
 
-		for _, a := range A(srv, req.iface) {
-			extra = append(extra, a)
+	resp := new(dns.Msg)
+	shared := false
+	switch name {
+	case rs.serviceName:
+		if !isQuestionType(q, dns.TypePTR) || maintenance == MaintenanceSilent {
+			return nil
 		}
+		shared = true
+		resp.Answer = []dns.RR{rs.ptr}
 
-		for _, aaaa := range AAAA(srv, req.iface) {
-			extra = append(extra, aaaa)
-		}
+		extra := make([]dns.RR, 0, 2+len(rs.address))
+		extra = append(extra, rs.srv, rs.txt)
+		extra = append(extra, rs.address...)
+		resp.Extra = extra
 
-		if nsec := NSEC(ptr, srv, req.iface); nsec != nil {
-			extra = append(extra, nsec)
+	case rs.instanceName:
+		if maintenance == MaintenanceSilent {
+			return nil
 		}
 
-		resp.Extra = extra
-
-		// Wait 20-125 msec for shared resource responses
-		delay := time.Duration(r.random.Intn(105)+20) * time.Millisecond
-		log.Debug.Println("Shared record response wait", delay)
-		time.Sleep(delay)
+		switch q.Qtype {
+		case dns.TypeSRV:
+			resp.Answer = []dns.RR{rs.srv}
+			resp.Extra = rs.address
+		case dns.TypeTXT:
+			resp.Answer = []dns.RR{rs.txt}
+		case dns.TypeANY:
+			resp.Answer = []dns.RR{rs.srv, rs.txt}
+			resp.Extra = rs.address
+		}
 
-	case strings.ToLower(srv.EscapedServiceInstanceName()):
-		resp.Answer = []dns.RR{SRV(srv), TXT(srv), PTR(srv)}
+	case rs.hostname:
+		resp.Answer, resp.Extra = splitAddressRecords(rs.address, q.Qtype)
 
-		var extra []dns.RR
+	default:
+		if rrs, ok := rs.hosts[name]; ok {
+			resp.Answer, resp.Extra = splitAddressRecords(rrs, q.Qtype)
+			break
+		}
 
-		for _, a := range A(srv, req.iface) {
-			extra = append(extra, a)
+		cname := rs.cname(q.Name)
+		if cname == nil {
+			return nil
 		}
 
-		for _, aaaa := range AAAA(srv, req.iface) {
-			extra = append(extra, aaaa)
+		// The CNAME record is followed by the address records of the target. (RFC1034 3.6.2)
+		addrs, _ := splitAddressRecords(rs.address, q.Qtype)
+		answer := make([]dns.RR, 0, 1+len(addrs))
+		answer = append(answer, cname)
+		if q.Qtype != dns.TypeCNAME {
+			answer = append(answer, addrs...)
 		}
+		resp.Answer = answer
+	}
 
-		if nsec := NSEC(SRV(srv), srv, req.iface); nsec != nil {
-			extra = append(extra, nsec)
+	// Assert the nonexistence of the requested type. (RFC6762 6.1)
+	var negative dns.RR
+	if len(resp.Answer) == 0 {
+		nsec, ok := rs.nsecs[name]
+		if !ok {
+			return nil
 		}
+		negative = nsec
+		resp.Answer = []dns.RR{nsec}
+	}
 
-		resp.Extra = extra
+	if maintenance == MaintenanceGoodbye {
+		resp.Answer = withGoodbyeTTL(resp.Answer)
+		resp.Extra = withGoodbyeTTL(resp.Extra)
+	}
+
+	if !shared && !req.isLegacyUnicast() {
+		// Set cache flush bit for non-shared records
+		resp.Answer = copyRecords(resp.Answer)
+		setAnswerCacheFlushBit(resp)
+	}
 
-		if !isLegacyUnicastSource(req.from) {
-			// Set cache flush bit for non-shared records
-			setAnswerCacheFlushBit(resp)
+	// Assert the nonexistence of other types for the names in the response. (RFC6762 6.1)
+	extra := append([]dns.RR{}, resp.Extra...)
+	for _, nsec := range referencedNSEC(append(append([]dns.RR{}, resp.Answer...), resp.Extra...), rs.nsecs) {
+		if nsec != negative {
+			extra = append(extra, nsec)
 		}
+	}
+	resp.Extra = extra
 
-	case strings.ToLower(srv.Hostname()):
-		var answer []dns.RR
+	// Supress known answers, unless they are removed from the caches in maintenance.
+	if maintenance != MaintenanceGoodbye {
+		resp.Answer = remove(req.msg.Answer, resp.Answer)
+	}
 
-		for _, a := range A(srv, req.iface) {
-			answer = append(answer, a)
-		}
+	resp.SetReply(req.msg)
+	if !req.isLegacyUnicast() {
+		resp.Question = nil
+	}
+	resp.Response = true
+	resp.Authoritative = true
 
-		for _, aaaa := range AAAA(srv, req.iface) {
-			answer = append(answer, aaaa)
-		}
+	return resp
+}
 
-		resp.Answer = answer
+// isServicesMetaQuestion returns true, if q is a service type
+// enumeration question, e.g. "_services._dns-sd._udp.local.". (RFC6763 9)
+func isServicesMetaQuestion(q dns.Question) bool {
+	return strings.HasPrefix(strings.ToLower(q.Name), "_services._dns-sd._udp.")
+}
 
-		if nsec := NSEC(SRV(srv), srv, req.iface); nsec != nil {
-			resp.Extra = []dns.RR{nsec}
-		}
+// handleMetaQuestion returns the response to the service type enumeration
+// question q of req, which lists every service type of the services of hs
+// in the domain of q once, or nil if there is none. (RFC6763 9)
+// Service types of services in maintenance are only listed,
+// if another service of the same type is not in maintenance.
+func (r *responder) handleMetaQuestion(q dns.Question, req *Request, hs []*serviceHandle) *dns.Msg {
+	if !isQuestionType(q, dns.TypePTR) {
+		return nil
+	}
 
-		if !isLegacyUnicastSource(req.from) {
-			// Set cache flush bit for non-shared records
-			setAnswerCacheFlushBit(resp)
+	name := strings.ToLower(canonicalName(q.Name))
+	types := map[string]bool{}
+	var answer []dns.RR
+	for _, h := range hs {
+		srv := h.service
+		if srv.maintenance != MaintenanceOff || strings.ToLower(srv.ServicesMetaQueryName()) != name {
+			continue
 		}
 
-	case strings.ToLower(srv.ServicesMetaQueryName()):
-		resp.Answer = []dns.RR{DNSSDServicesPTR(srv)}
+		key := strings.ToLower(srv.ServiceName())
+		if types[key] {
+			continue
+		}
+		types[key] = true
+		answer = append(answer, DNSSDServicesPTR(*srv))
+	}
 
-	default:
+	if len(answer) == 0 {
 		return nil
 	}
 
+	resp := new(dns.Msg)
 	// Supress known answers
-	resp.Answer = remove(req.msg.Answer, resp.Answer)
+	resp.Answer = remove(req.msg.Answer, answer)
 
-	resp.SetReply(req.msg)
-	if !isLegacyUnicastSource(req.from) {
-		resp.Question = nil
+	return resp
+}
+
+// isQuestionType returns true, if q asks for records of type t.
+func isQuestionType(q dns.Question, t uint16) bool {
+	return q.Qtype == t || q.Qtype == dns.TypeANY
+}
+
+// splitAddressRecords returns the address records in rrs of type qtype as answer,
+// and the other address records as additional records. (RFC6762 6.2)
+func splitAddressRecords(rrs []dns.RR, qtype uint16) (answer, extra []dns.RR) {
+	switch qtype {
+	case dns.TypeANY:
+		return rrs, nil
+	case dns.TypeA, dns.TypeAAAA:
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == qtype {
+				answer = append(answer, rr)
+			} else {
+				extra = append(extra, rr)
+			}
+		}
 	}
-	resp.Response = true
-	resp.Authoritative = true
 
-	return resp
+	return answer, extra
 }
 
-func findConflicts(req *Request, hs []*serviceHandle) []*serviceHandle {
+func findConflicts(req *Request, hs []*serviceHandle, logger *slog.Logger) []*serviceHandle {
+	// A sleep proxy answers on behalf of this host. (draft-cheshire-edns0-owner-option)
+	if owner := req.Owner(); owner != nil && isLocalHardwareAddr(owner.PrimaryMAC) {
+		return nil
+	}
+
 	var conflicts []*serviceHandle
 	for _, h := range hs {
-		if containsConflictingAnswers(req, h) {
-			log.Debug.Println("Received conflicting record", req.msg)
+		if containsConflictingAnswers(req, h, logger) {
+			logger.Debug("Received conflicting record", "peer", req.from, "iface", req.IfaceName(), "msg", req.msg)
 			conflicts = append(conflicts, h)
 		}
 	}
@@ -503,20 +1401,20 @@ func services(hs []*serviceHandle) []*Service {
 // be used to check for conlict answers for a registered service and not for probing.
 // It is the responsibility of the probed service to find conflicting SRV records
 // and resolve them during probing.
-func containsConflictingAnswers(req *Request, handle *serviceHandle) bool {
+func containsConflictingAnswers(req *Request, handle *serviceHandle, logger *slog.Logger) bool {
 	as := A(*handle.service, req.iface)
 	aaaas := AAAA(*handle.service, req.iface)
 	reqAs, reqAAAAs, _ := splitRecords(filterRecords(req, handle.service))
 
-	if len(reqAs) > 0 && areDenyingAs(reqAs, as) {
-		log.Debug.Printf("%v != %v\n", reqAs, as)
+	if len(reqAs) > 0 && areDenyingAs(reqAs, as, logger) {
+		logger.Debug("Denying A records", "theirs", reqAs, "ours", as)
 		return true
 	}
 
-	if len(reqAAAAs) > 0 && areDenyingAAAAs(reqAAAAs, aaaas) {
-		log.Debug.Printf("%v != %v\n", reqAAAAs, aaaas)
+	if len(reqAAAAs) > 0 && areDenyingAAAAs(reqAAAAs, aaaas, logger) {
+		logger.Debug("Denying AAAA records", "theirs", reqAAAAs, "ours", aaaas)
 		return true
 	}
 
-	return false
+	return len(conflictingHosts(req, *handle.service, logger)) > 0
 }
@@ -2,8 +2,12 @@ package dnssd
 
 import (
 	"context"
+	"fmt"
 	"github.com/miekg/dns"
 	"net"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -35,6 +39,127 @@ func TestRemove(t *testing.T) {
 	}
 }
 
+func TestRemoveReleasesHosts(t *testing.T) {
+	service := func(name string) Service {
+		sv, err := NewService(Config{Name: name, Type: "_asdf._tcp", Host: "Computer", Port: 1234})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sv
+	}
+
+	conn := newTestConn()
+	go func() {
+		for range conn.out {
+		}
+	}()
+	r := newResponder(conn)
+	a := r.addManaged(service("A"))
+	b := r.addManaged(service("B"))
+	r.hosts["computer.local."] = true
+
+	// The hostname is still used by B.
+	r.Remove(a)
+	if !r.hosts["computer.local."] {
+		t.Fatal("expected hostname to be verified")
+	}
+
+	r.RemoveAll([]ServiceHandle{b})
+	if _, ok := r.hosts["computer.local."]; ok {
+		t.Fatal("expected hostname to be removed")
+	}
+}
+
+func TestRemoveKnownAnswerTTL(t *testing.T) {
+	si, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ttl      uint32
+		unknowns int
+	}{
+		{TTLDefault, 0},
+		{TTLDefault / 2, 0},
+		{TTLDefault/2 - 1, 1},
+		{0, 1},
+	}
+
+	for _, test := range tests {
+		known := PTR(si)
+		known.Hdr.Ttl = test.ttl
+		known.Hdr.Name = strings.ToUpper(known.Hdr.Name)
+
+		unknown := remove([]dns.RR{known}, []dns.RR{PTR(si)})
+		if is, want := len(unknown), test.unknowns; is != want {
+			t.Fatalf("ttl=%d is=%v want=%v", test.ttl, is, want)
+		}
+	}
+
+	// TXT records of different instances are not the same.
+	other, err := NewService(Config{
+		Name: "Other",
+		Type: "_asdf._tcp",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(remove([]dns.RR{TXT(other)}, []dns.RR{TXT(si)})), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestSplitMsg(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Question = []dns.Question{
+		{Name: "_asdf._tcp.local.", Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+	}
+	for i := 0; i < 100; i++ {
+		sv, err := NewService(Config{
+			Name: fmt.Sprintf("Test %d", i),
+			Type: "_asdf._tcp",
+			Host: "Computer",
+			Port: 1234,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Answer = append(msg.Answer, PTR(sv))
+	}
+
+	msgs := splitMsg(msg, 512)
+	if len(msgs) < 2 {
+		t.Fatalf("is=%v want > 1", len(msgs))
+	}
+
+	n := 0
+	for i, m := range msgs {
+		if is, want := m.Len() <= 512, true; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+
+		if is, want := m.Truncated, i < len(msgs)-1; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+
+		if is, want := len(m.Question) > 0, i == 0; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+		n += len(m.Answer)
+	}
+
+	if is, want := n, len(msg.Answer); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
 func TestRegisterServiceWithExplicitIP(t *testing.T) {
 	cfg := Config{
 		Host:   "Computer",
@@ -66,7 +191,7 @@ func TestRegisterServiceWithExplicitIP(t *testing.T) {
 		defer lookupCancel()
 		defer cancel()
 
-		srv, err := lookupInstance(lookupCtx, "Test._asdf._tcp.local.", otherConn)
+		srv, err := lookupInstance(lookupCtx, "Test._asdf._tcp.local.", otherConn, WaitNoAddr)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -101,3 +226,1389 @@ func TestRegisterServiceWithExplicitIP(t *testing.T) {
 		r.Respond(ctx)
 	})
 }
+
+func TestAliasQuestion(t *testing.T) {
+	cfg := Config{
+		Name:    "Test",
+		Type:    "_asdf._tcp",
+		Host:    "Computer",
+		Port:    1234,
+		Aliases: []string{"printer"},
+	}
+	sv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	q := dns.Question{
+		Name:   "printer.local.",
+		Qtype:  dns.TypeA,
+		Qclass: dns.ClassINET,
+	}
+	msg := new(dns.Msg)
+	msg.Question = []dns.Question{q}
+	req := &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface}
+
+	r := newResponder(newTestConn())
+	resp := r.handleQuestion(q, req, &serviceHandle{service: &sv})
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+
+	if is, want := len(resp.Answer), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	cname, ok := resp.Answer[0].(*dns.CNAME)
+	if !ok {
+		t.Fatalf("invalid type %T", resp.Answer[0])
+	}
+
+	if is, want := cname.Target, "Computer.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	a, ok := resp.Answer[1].(*dns.A)
+	if !ok {
+		t.Fatalf("invalid type %T", resp.Answer[1])
+	}
+
+	if is, want := a.A.String(), "192.168.0.123"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestExtraHostQuestion(t *testing.T) {
+	cfg := Config{
+		Name:  "Test",
+		Type:  "_asdf._tcp",
+		Host:  "Computer",
+		Port:  1234,
+		Hosts: []string{"scanner"},
+	}
+	sv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	q := dns.Question{
+		Name:   "Scanner.local.",
+		Qtype:  dns.TypeA,
+		Qclass: dns.ClassINET,
+	}
+	msg := new(dns.Msg)
+	msg.Question = []dns.Question{q}
+	req := &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface}
+
+	r := newResponder(newTestConn())
+	resp := r.handleQuestion(q, req, &serviceHandle{service: &sv})
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+
+	if is, want := len(resp.Answer), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	a, ok := resp.Answer[0].(*dns.A)
+	if !ok {
+		t.Fatalf("invalid type %T", resp.Answer[0])
+	}
+
+	if is, want := a.Hdr.Name, "scanner.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := a.A.String(), "192.168.0.123"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestNSECInResponse(t *testing.T) {
+	cfg := Config{
+		Name:    "Test",
+		Type:    "_asdf._tcp",
+		Host:    "Computer",
+		Port:    1234,
+		Aliases: []string{"printer"},
+	}
+	sv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	tests := []struct {
+		question string
+		want     map[string][]uint16
+	}{
+		{"_asdf._tcp.local.", map[string][]uint16{
+			"Test._asdf._tcp.local.": {dns.TypeTXT, dns.TypeSRV},
+			"Computer.local.":        {dns.TypeA},
+		}},
+		{"Test._asdf._tcp.local.", map[string][]uint16{
+			"Test._asdf._tcp.local.": {dns.TypeTXT, dns.TypeSRV},
+			"Computer.local.":        {dns.TypeA},
+		}},
+		{"Computer.local.", map[string][]uint16{
+			"Computer.local.": {dns.TypeA},
+		}},
+		{"printer.local.", map[string][]uint16{
+			"printer.local.":  {dns.TypeCNAME},
+			"Computer.local.": {dns.TypeA},
+		}},
+	}
+
+	r := newResponder(newTestConn())
+	for _, test := range tests {
+		q := dns.Question{Name: test.question, Qtype: dns.TypeANY, Qclass: dns.ClassINET}
+		msg := new(dns.Msg)
+		msg.Question = []dns.Question{q}
+		req := &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface}
+
+		resp := r.handleQuestion(q, req, &serviceHandle{service: &sv})
+		if resp == nil {
+			t.Fatal("expected response", test.question)
+		}
+
+		is := map[string][]uint16{}
+		for _, rr := range resp.Extra {
+			if nsec, ok := rr.(*dns.NSEC); ok {
+				if is, want := nsec.NextDomain, nsec.Hdr.Name; is != want {
+					t.Fatalf("is=%v want=%v", is, want)
+				}
+				is[nsec.Hdr.Name] = nsec.TypeBitMap
+			}
+		}
+
+		if want := test.want; !reflect.DeepEqual(is, want) {
+			t.Fatalf("%s: is=%v want=%v", test.question, is, want)
+		}
+	}
+}
+
+func TestUpdateIPs(t *testing.T) {
+	cfg := Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Port: 1234,
+	}
+	sv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		"lo0": []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	r := newResponder(newTestConn())
+	h := r.addManaged(sv)
+	h.UpdateIPs("lo0", []net.IP{net.IP{192, 168, 0, 124}})
+
+	srv := h.Service()
+	ips := srv.IPsAtInterface(&net.Interface{Name: "lo0"})
+	if is, want := len(ips), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := ips[0].String(), "192.168.0.124"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The previous service is not modified.
+	if is, want := sv.ifaceIPs["lo0"][0].String(), "192.168.0.123"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The addresses of the interface are kept, when the addresses of all interfaces are replaced.
+	h.UpdateIPs("", []net.IP{net.IP{192, 168, 0, 125}})
+	srv = h.Service()
+	if is, want := srv.IPs[0].String(), "192.168.0.125"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srv.ifaceIPs["lo0"][0].String(), "192.168.0.124"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestSetText(t *testing.T) {
+	sv, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newResponder(newTestConn())
+	h := r.addManaged(sv)
+	if err := h.SetText(map[string]string{"key": "value"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.SetText(map[string]string{"": "value"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The deprecated UpdateText ignores invalid TXT records.
+	h.UpdateText(map[string]string{"": "value"})
+
+	if is, want := h.Service().Text, map[string]string{"key": "value"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestResponderServices(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newResponder(newTestConn())
+	r.addUnmanaged(sv)
+
+	if is, want := len(r.Services()), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	sv.Name = "Test (2)"
+	r.addManaged(sv)
+
+	srvs := r.Services()
+	if is, want := len(srvs), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srvs[0].ServiceInstanceName(), "Test (2)._asdf._tcp.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestResponderMiddleware(t *testing.T) {
+	conn := newTestConn()
+	r := newResponder(conn)
+
+	var requests int
+	r.Use(func(req *Request, resp *Response) bool {
+		if resp == nil {
+			requests++
+			return true
+		}
+
+		// Veto unicast responses
+		return resp.To() == nil
+	})
+
+	if !r.allow(&Request{}, nil) {
+		t.Fatal("expected request to be allowed")
+	}
+
+	if is, want := requests, 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	unicast := &Response{msg: new(dns.Msg), addr: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}}
+	if r.allow(nil, unicast) {
+		t.Fatal("expected unicast response to be vetoed")
+	}
+
+	multicast := &Response{msg: new(dns.Msg)}
+	if !r.allow(nil, multicast) {
+		t.Fatal("expected multicast response to be allowed")
+	}
+}
+
+func TestIsFromLocalSubnet(t *testing.T) {
+	tests := []struct {
+		IP     net.IP
+		Result bool
+	}{
+		{net.ParseIP("fe80::1"), true},
+		{net.ParseIP("127.0.0.1"), true},
+		{net.ParseIP("203.0.113.1"), false},
+	}
+
+	lo, _ := LoopbackInterface()
+	if lo == nil {
+		t.Skip("can not find the local interface")
+	}
+
+	for _, test := range tests {
+		req := &Request{msg: new(dns.Msg), from: &net.UDPAddr{IP: test.IP, Port: 5353}, iface: lo}
+		if is, want := isFromLocalSubnet(req, nil), test.Result; is != want {
+			t.Fatalf("%v is=%v want=%v", test.IP, is, want)
+		}
+	}
+}
+
+func TestLegacyUnicastResponse(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.addManaged(sv)
+
+	q := dns.Question{
+		Name:   "Computer.local.",
+		Qtype:  dns.TypeA,
+		Qclass: dns.ClassINET,
+	}
+	msg := new(dns.Msg)
+	msg.Id = 1234
+	msg.Question = []dns.Question{q}
+	req := &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 12345}, iface: testIface}
+
+	r.handleRequest(req)
+
+	var resp *dns.Msg
+	select {
+	case resp = <-conn.out:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	if is, want := resp.Id, msg.Id; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(resp.Question), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	for _, rr := range resp.Answer {
+		if is, want := rr.Header().Ttl, TTLLegacyUnicast; is > want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+
+		if rr.Header().Class&(1<<15) != 0 {
+			t.Fatal("cache-flush bit must not be set")
+		}
+	}
+}
+
+func TestMulticastRecently(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newResponder(newTestConn())
+	rrs := []dns.RR{SRV(sv), TXT(sv)}
+
+	if r.wereMulticastRecently(rrs, testIface) {
+		t.Fatal("records were never multicast")
+	}
+
+	r.setMulticast(rrs, testIface)
+	if !r.wereMulticastRecently(rrs, testIface) {
+		t.Fatal("records were multicast recently")
+	}
+
+	if r.wereMulticastRecently(rrs, &net.Interface{Name: "en0"}) {
+		t.Fatal("records were not multicast at en0")
+	}
+
+	for key := range r.multicasts {
+		r.multicasts[key] = time.Now().Add(-time.Duration(TTLDefault) * time.Second)
+	}
+
+	if r.wereMulticastRecently(rrs, testIface) {
+		t.Fatal("records were multicast more than a quarter of their ttl ago")
+	}
+}
+
+func TestMultiQuestionResponse(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.addManaged(sv)
+
+	msg := new(dns.Msg)
+	msg.Question = []dns.Question{
+		{Name: sv.ServiceName(), Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+		{Name: "Computer.local.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+	}
+	req := &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface}
+
+	r.handleRequest(req)
+
+	var resp *dns.Msg
+	select {
+	case resp = <-conn.out:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	select {
+	case <-conn.out:
+		t.Fatal("unexpected second response")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	var ptr, a int
+	for _, rr := range resp.Answer {
+		switch rr.(type) {
+		case *dns.PTR:
+			ptr++
+		case *dns.A:
+			a++
+		}
+	}
+
+	if is, want := ptr, 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := a, 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	for _, rr := range resp.Extra {
+		if _, ok := rr.(*dns.A); ok {
+			t.Fatal("answer record repeated in additional section")
+		}
+	}
+}
+
+func TestDuplicateAnswerSuppression(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.addManaged(sv)
+
+	from := &net.UDPAddr{IP: net.IP{192, 168, 0, 2}, Port: 5353}
+
+	// another responder multicasts the answer
+	answer := new(dns.Msg)
+	answer.Response = true
+	answer.Answer = []dns.RR{PTR(sv)}
+	r.handleRequest(&Request{msg: answer, from: from, iface: testIface})
+
+	query := new(dns.Msg)
+	query.Question = []dns.Question{
+		{Name: sv.ServiceName(), Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+	}
+	r.handleRequest(&Request{msg: query, from: from, iface: testIface})
+
+	select {
+	case <-conn.out:
+		t.Fatal("duplicate answer should be suppressed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if !r.wereMulticastRecently([]dns.RR{PTR(sv)}, testIface) {
+		t.Fatal("suppressed answer should be treated as multicast")
+	}
+}
+
+// gateClock is a clock, whose timers fire when a time is sent to gate.
+type gateClock struct {
+	gate chan time.Time
+}
+
+func (c *gateClock) Now() time.Time                         { return time.Now() }
+func (c *gateClock) After(d time.Duration) <-chan time.Time { return c.gate }
+
+func TestSharedResponseDelay(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	clock := &gateClock{gate: make(chan time.Time)}
+	r.clock = clock
+	r.addManaged(sv)
+
+	from := &net.UDPAddr{IP: net.IP{192, 168, 0, 2}, Port: 5353}
+
+	// The response to the shared PTR record is delayed
+	// without blocking the handling of other requests.
+	query := new(dns.Msg)
+	query.Question = []dns.Question{
+		{Name: sv.ServiceName(), Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+	}
+	r.handleRequest(&Request{msg: query, from: from, iface: testIface})
+
+	query = new(dns.Msg)
+	query.Question = []dns.Question{
+		{Name: "Computer.local.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+	}
+	r.handleRequest(&Request{msg: query, from: from, iface: testIface})
+
+	select {
+	case resp := <-conn.out:
+		if _, ok := resp.Answer[0].(*dns.A); !ok {
+			t.Fatalf("invalid type %T", resp.Answer[0])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// another responder multicasts the answer during the delay
+	answer := new(dns.Msg)
+	answer.Response = true
+	answer.Answer = []dns.RR{PTR(sv)}
+	r.handleRequest(&Request{msg: answer, from: from, iface: testIface})
+
+	clock.gate <- time.Now()
+
+	select {
+	case <-conn.out:
+		t.Fatal("duplicate answer should be suppressed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTruncatedQueriesPerSource(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.addManaged(sv)
+
+	query := func(truncated bool) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.Truncated = truncated
+		msg.Question = []dns.Question{
+			{Name: sv.ServiceName(), Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+		}
+		return msg
+	}
+
+	a := &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}
+	b := &net.UDPAddr{IP: net.IP{192, 168, 0, 2}, Port: 5353}
+
+	// continuation of a's query contains the known answer
+	known := new(dns.Msg)
+	known.Answer = []dns.RR{PTR(sv)}
+
+	r.mutex.Lock()
+	r.handleRequest(&Request{msg: query(true), from: a, iface: testIface})
+	r.handleRequest(&Request{msg: query(true), from: b, iface: testIface})
+	r.handleRequest(&Request{msg: known, from: a, iface: testIface})
+	r.mutex.Unlock()
+
+	// b's query is answered after the timeout
+	select {
+	case <-conn.out:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	select {
+	case <-conn.out:
+		t.Fatal("unexpected response")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestTruncatedQueryStop(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.clock = &gateClock{gate: make(chan time.Time)}
+	r.addManaged(sv)
+
+	msg := new(dns.Msg)
+	msg.Truncated = true
+	msg.Question = []dns.Question{
+		{Name: sv.ServiceName(), Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+	}
+
+	r.mutex.Lock()
+	r.handleRequest(&Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface})
+	r.mutex.Unlock()
+
+	// The timeout uses the clock of the responder.
+	select {
+	case <-conn.out:
+		t.Fatal("unexpected response")
+	case <-time.After(truncatedTimeout + 200*time.Millisecond):
+	}
+
+	r.stopSenders()
+	if is, want := len(r.truncated), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The waiting query was stopped.
+	select {
+	case r.clock.(*gateClock).gate <- time.Now():
+		t.Fatal("query still waiting")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestResponderOptionsAnnouncements(t *testing.T) {
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{0, 2},
+		{1, 2},
+		{5, 5},
+		{10, 8},
+	}
+
+	for _, test := range tests {
+		r := NewResponderWithConn(newTestConn(), ResponderOptions{Announcements: test.n}).(*responder)
+		if is, want := r.announcements, test.want; is != want {
+			t.Fatalf("%d: is=%v want=%v", test.n, is, want)
+		}
+	}
+}
+
+func TestAnnouncementSchedule(t *testing.T) {
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.announcements = 3
+	r.announceInterval = 10 * time.Millisecond
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	go r.sendAnnouncement(msg, testIface)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-conn.out:
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	select {
+	case <-conn.out:
+		t.Fatal("unexpected announcement")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRegisterSkipProbe(t *testing.T) {
+	sv, err := NewService(Config{
+		Name:      "Test",
+		Type:      "_asdf._tcp",
+		Host:      "Computer",
+		Port:      1234,
+		SkipProbe: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.isRunning = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	srvs, err := r.registerAll(ctx, []Service{sv})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := srvs[0].ServiceInstanceName(), sv.ServiceInstanceName(); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestResponderStop(t *testing.T) {
+	conn := newTestConn()
+	r := newResponder(conn)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- r.Respond(context.Background())
+	}()
+
+	// wait until the responder is running
+	for i := 0; ; i++ {
+		r.stopMutex.Lock()
+		running := r.stop != nil
+		r.stopMutex.Unlock()
+		if running {
+			break
+		}
+		if i > 100 {
+			t.Fatal("responder not running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := r.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if is, want := err, context.Canceled; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Respond should have returned")
+	}
+}
+
+func TestResponderPause(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.addManaged(sv)
+
+	query := func() *Request {
+		msg := new(dns.Msg)
+		msg.Question = []dns.Question{
+			{Name: sv.ServiceName(), Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+		}
+		return &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface}
+	}
+
+	r.Pause()
+	r.handleRequest(query())
+
+	select {
+	case <-conn.out:
+		t.Fatal("paused responder should not answer")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	r.Resume()
+	r.handleRequest(query())
+
+	select {
+	case <-conn.out:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestServiceHandleAnnounce(t *testing.T) {
+	iface, _ := LoopbackInterface()
+	if iface == nil {
+		t.Fatal("can not find the local interface")
+	}
+
+	sv, err := NewService(Config{
+		Name:   "Test",
+		Type:   "_asdf._tcp",
+		Host:   "Computer",
+		Port:   1234,
+		Ifaces: []string{iface.Name},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		iface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.announcements = 1
+	h := r.addManaged(sv)
+
+	h.Announce()
+
+	var msg *dns.Msg
+	select {
+	case msg = <-conn.out:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	for _, rr := range msg.Answer {
+		if rr.Header().Rrtype == dns.TypePTR {
+			continue
+		}
+		if rr.Header().Class&(1<<15) == 0 {
+			t.Fatalf("cache-flush bit not set for %v", rr)
+		}
+	}
+}
+
+func TestLinkUpdate(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.announcements = 1
+	r.addManaged(sv)
+
+	// no changes
+	r.upIfaces = linkState(nil)
+	r.linkUpdate()
+
+	select {
+	case <-conn.out:
+		t.Fatal("unexpected announcement")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if len(r.upIfaces) == 0 {
+		t.Skip("no multicast interfaces")
+	}
+
+	// all interfaces came up
+	r.probeConfig = ProbeConfig{Conn: conn, Delay: -1, Interval: 10 * time.Millisecond}
+	r.upIfaces = map[string]string{}
+	r.linkUpdate()
+
+	// The service is probed before it is announced. (RFC6762 8)
+	var probed bool
+	for {
+		select {
+		case msg := <-conn.out:
+			if isProbeQuery(msg) {
+				probed = true
+				continue
+			}
+
+			if !msg.Response {
+				t.Fatalf("unexpected message %v", msg)
+			}
+
+			if !probed {
+				t.Fatal("service announced before probing")
+			}
+			return
+
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestLinkUpdateMaintenance(t *testing.T) {
+	sv, err := NewService(Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.maintenance = MaintenanceSilent
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	r.announcements = 1
+	r.addManaged(sv)
+
+	if len(linkState(nil)) == 0 {
+		t.Skip("no multicast interfaces")
+	}
+
+	// all interfaces came up
+	r.upIfaces = map[string]string{}
+	r.linkUpdate()
+
+	select {
+	case <-conn.out:
+		t.Fatal("unexpected announcement")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func BenchmarkHandleQuery(b *testing.B) {
+	const n = 1000
+
+	conn := newTestConn()
+	r := newResponder(conn)
+	for i := 0; i < n; i++ {
+		sv, err := NewService(Config{
+			Name: fmt.Sprintf("Test %d", i),
+			Type: "_asdf._tcp",
+			Host: "Computer",
+			Port: 1234,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		sv.ifaceIPs = map[string][]net.IP{
+			testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+		}
+		r.addManaged(sv)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case <-conn.out:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	from := &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}
+	questions := []struct {
+		name     string
+		question string
+	}{
+		{"PTR", "_asdf._tcp.local."},
+		{"SRV", "Test 500._asdf._tcp.local."},
+		{"Hostname", "Computer.local."},
+	}
+
+	for _, q := range questions {
+		b.Run(q.name, func(b *testing.B) {
+			msg := new(dns.Msg)
+			msg.Question = []dns.Question{{Name: q.question, Qtype: dns.TypeANY, Qclass: dns.ClassINET}}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.handleQuery(&Request{msg: msg, from: from, iface: testIface}, r.managed)
+			}
+		})
+	}
+}
+
+func TestQuestionType(t *testing.T) {
+	cfg := Config{
+		Name:    "Test",
+		Type:    "_asdf._tcp",
+		Host:    "Computer",
+		Port:    1234,
+		Aliases: []string{"printer"},
+	}
+	sv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	tests := []struct {
+		name   string
+		qtype  uint16
+		answer []uint16
+		extra  []uint16
+	}{
+		{"_asdf._tcp.local.", dns.TypePTR, []uint16{dns.TypePTR}, []uint16{dns.TypeSRV, dns.TypeTXT, dns.TypeA, dns.TypeNSEC, dns.TypeNSEC}},
+		{"Test._asdf._tcp.local.", dns.TypeSRV, []uint16{dns.TypeSRV}, []uint16{dns.TypeA, dns.TypeNSEC, dns.TypeNSEC}},
+		{"Test._asdf._tcp.local.", dns.TypeTXT, []uint16{dns.TypeTXT}, []uint16{dns.TypeNSEC}},
+		{"Test._asdf._tcp.local.", dns.TypeANY, []uint16{dns.TypeSRV, dns.TypeTXT}, []uint16{dns.TypeA, dns.TypeNSEC, dns.TypeNSEC}},
+		{"Test._asdf._tcp.local.", dns.TypeA, []uint16{dns.TypeNSEC}, nil},
+		{"Computer.local.", dns.TypeA, []uint16{dns.TypeA}, []uint16{dns.TypeNSEC}},
+		{"Computer.local.", dns.TypeAAAA, []uint16{dns.TypeNSEC}, []uint16{dns.TypeA}},
+		{"printer.local.", dns.TypeCNAME, []uint16{dns.TypeCNAME}, []uint16{dns.TypeNSEC, dns.TypeNSEC}},
+		{"printer.local.", dns.TypeA, []uint16{dns.TypeCNAME, dns.TypeA}, []uint16{dns.TypeNSEC, dns.TypeNSEC}},
+	}
+
+	r := newResponder(newTestConn())
+	for _, test := range tests {
+		q := dns.Question{Name: test.name, Qtype: test.qtype, Qclass: dns.ClassINET}
+		msg := new(dns.Msg)
+		msg.Question = []dns.Question{q}
+		req := &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface}
+
+		resp := r.handleQuestion(q, req, &serviceHandle{service: &sv})
+		if resp == nil {
+			t.Fatal("expected response", test.name, dns.TypeToString[test.qtype])
+		}
+
+		if is, want := rrTypes(resp.Answer), test.answer; !reflect.DeepEqual(is, want) {
+			t.Fatalf("%s %s: answer is=%v want=%v", test.name, dns.TypeToString[test.qtype], is, want)
+		}
+
+		if is, want := rrTypes(resp.Extra), test.extra; !reflect.DeepEqual(is, want) {
+			t.Fatalf("%s %s: extra is=%v want=%v", test.name, dns.TypeToString[test.qtype], is, want)
+		}
+	}
+
+	// Shared records are not asserted to not exist.
+	q := dns.Question{Name: "_asdf._tcp.local.", Qtype: dns.TypeSRV, Qclass: dns.ClassINET}
+	msg := new(dns.Msg)
+	msg.Question = []dns.Question{q}
+	req := &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface}
+	if resp := r.handleQuestion(q, req, &serviceHandle{service: &sv}); resp != nil {
+		t.Fatalf("unexpected response %v", resp)
+	}
+}
+
+func rrTypes(rrs []dns.RR) []uint16 {
+	var types []uint16
+	for _, rr := range rrs {
+		types = append(types, rr.Header().Rrtype)
+	}
+
+	return types
+}
+
+func TestMaintenance(t *testing.T) {
+	cfg := Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Host: "Computer",
+		Port: 1234,
+	}
+	sv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{
+		testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+	}
+
+	r := newResponder(newTestConn())
+	request := func(name string, qtype uint16, authority []dns.RR) *Request {
+		msg := new(dns.Msg)
+		msg.Question = []dns.Question{{Name: name, Qtype: qtype, Qclass: dns.ClassINET}}
+		msg.Ns = authority
+		return &Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface}
+	}
+
+	sv.maintenance = MaintenanceSilent
+	h := &serviceHandle{service: &sv}
+
+	req := request("_asdf._tcp.local.", dns.TypePTR, nil)
+	if resp := r.handleQuestion(req.msg.Question[0], req, h); resp != nil {
+		t.Fatalf("unexpected response %v", resp)
+	}
+
+	// Host names are answered.
+	req = request("Computer.local.", dns.TypeA, nil)
+	if resp := r.handleQuestion(req.msg.Question[0], req, h); resp == nil {
+		t.Fatal("expected response")
+	}
+
+	// Probes are answered to defend the service instance name.
+	req = request("Test._asdf._tcp.local.", dns.TypeANY, []dns.RR{SRV(sv)})
+	if resp := r.handleQuestion(req.msg.Question[0], req, h); resp == nil {
+		t.Fatal("expected response")
+	}
+
+	sv.maintenance = MaintenanceGoodbye
+	h = &serviceHandle{service: &sv}
+
+	// Known answers are answered with TTL 0.
+	req = request("_asdf._tcp.local.", dns.TypePTR, nil)
+	req.msg.Answer = []dns.RR{PTR(sv)}
+	resp := r.handleQuestion(req.msg.Question[0], req, h)
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+
+	if is, want := len(resp.Answer), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	for _, rr := range append(resp.Answer, resp.Extra...) {
+		switch rr.(type) {
+		case *dns.PTR, *dns.SRV, *dns.TXT:
+			if is, want := rr.Header().Ttl, uint32(0); is != want {
+				t.Fatalf("%v: is=%v want=%v", rr, is, want)
+			}
+		case *dns.A:
+			if is, want := rr.Header().Ttl, uint32(TTLHostname); is != want {
+				t.Fatalf("%v: is=%v want=%v", rr, is, want)
+			}
+		}
+	}
+
+	// The cached records are not modified.
+	if is, want := h.recordsAt(testIface, r.clock.Now()).ptr.Hdr.Ttl, uint32(TTLDefault); is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+// TestServicesMetaQuery tests the response to a service type enumeration
+// query, as sent by "dns-sd -B _services._dns-sd._udp".
+func TestServicesMetaQuery(t *testing.T) {
+	conn := newTestConn()
+	r := newResponder(conn)
+
+	for _, cfg := range []Config{
+		{Name: "Web", Type: "_http._tcp", Port: 80},
+		{Name: "Admin", Type: "_HTTP._tcp", Port: 8080},
+		{Name: "Printer", Type: "_ipp._tcp", Port: 631},
+		{Name: "Shell", Type: "_ssh._tcp", Port: 22},
+	} {
+		sv, err := NewService(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sv.ifaceIPs = map[string][]net.IP{
+			testIface.Name: []net.IP{net.IP{192, 168, 0, 123}},
+		}
+		if cfg.Name == "Shell" {
+			sv.maintenance = MaintenanceSilent
+		}
+		r.addManaged(sv)
+	}
+
+	query := func(known ...dns.RR) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.Question = []dns.Question{{Name: "_services._dns-sd._udp.local.", Qtype: dns.TypePTR, Qclass: dns.ClassINET}}
+		msg.Answer = known
+		r.handleRequest(&Request{msg: msg, from: &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5353}, iface: testIface})
+
+		select {
+		case resp := <-conn.out:
+			return resp
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		return nil
+	}
+
+	start := time.Now()
+	resp := query()
+
+	// Shared records are answered after a random delay. (RFC6762 6)
+	if is, want := time.Since(start), 20*time.Millisecond; is < want {
+		t.Fatalf("is=%v want>=%v", is, want)
+	}
+
+	var is []string
+	for _, rr := range resp.Answer {
+		ptr, ok := rr.(*dns.PTR)
+		if !ok {
+			t.Fatalf("invalid type %T", rr)
+		}
+
+		if ptr.Hdr.Class&(1<<15) != 0 {
+			t.Fatal("cache-flush bit must not be set")
+		}
+		is = append(is, ptr.Ptr)
+	}
+
+	if want := []string{"_http._tcp.local.", "_ipp._tcp.local."}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(resp.Extra), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// Known answers are suppressed.
+	resp = query(resp.Answer[1])
+	if is, want := len(resp.Answer), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := resp.Answer[0].(*dns.PTR).Ptr, "_http._tcp.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestStatusFuncCallsResponder(t *testing.T) {
+	conn := newTestConn()
+	go func() {
+		for range conn.out {
+		}
+	}()
+
+	r := newResponder(conn)
+	r.isRunning = true
+
+	var mutex sync.Mutex
+	var events []Status
+	sv, err := NewService(Config{
+		Name:      "Test",
+		Type:      "_asdf._tcp",
+		Port:      1234,
+		SkipProbe: true,
+		StatusFunc: func(e StatusEvent) {
+			// The status function can call the responder.
+			r.Services()
+
+			mutex.Lock()
+			events = append(events, e.Status)
+			mutex.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan ServiceHandle)
+	go func() {
+		h, err := r.Add(sv)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- h
+	}()
+
+	var h ServiceHandle
+	select {
+	case h = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("status function deadlocks")
+	}
+
+	r.Reannounce()
+	h.Announce()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if is, want := events, []Status{StatusRegistered, StatusReannounced, StatusReannounced}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+// joinConn is a test connection, which records the joined network interfaces.
+type joinConn struct {
+	*testConn
+	joined []string
+}
+
+func (c *joinConn) joinGroups(ifaces []*net.Interface) {
+	for _, iface := range ifaces {
+		c.joined = append(c.joined, iface.Name)
+	}
+}
+
+func TestJoinExcludedIfaces(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	exclude := ExcludeInterfaceFunc
+	ExcludeInterfaceFunc = func(iface net.Interface) bool { return iface.Name == lo.Name }
+	defer func() { ExcludeInterfaceFunc = exclude }()
+
+	conn := &joinConn{testConn: newTestConn()}
+	r := newResponder(conn)
+
+	// Services at all interfaces don't use the excluded interface.
+	sv, err := NewService(Config{Name: "All", Type: "_asdf._tcp", Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Add(sv); err != nil {
+		t.Fatal(err)
+	}
+
+	if is := conn.joined; len(is) > 0 {
+		t.Fatalf("unexpected joined interfaces %v", is)
+	}
+
+	// The groups are joined at the explicitly named excluded interface.
+	sv, err = NewService(Config{Name: "Explicit", Type: "_asdf._tcp", Port: 1234, Ifaces: []string{lo.Name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Add(sv); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := conn.joined, []string{lo.Name}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package dnssd
+
+import (
+	"syscall"
+)
+
+// reusePort does nothing, because SO_REUSEPORT is not supported.
+func reusePort(c syscall.RawConn) error {
+	return nil
+}
+
+// isAddrInUse returns false, because the error is not known.
+func isAddrInUse(err error) bool {
+	return false
+}
@@ -0,0 +1,20 @@
+package dnssd
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaeaddrinuse is the Windows socket error WSAEADDRINUSE.
+const wsaeaddrinuse = syscall.Errno(10048)
+
+// reusePort does nothing, because multicast sockets
+// already share the port with SO_REUSEADDR on Windows.
+func reusePort(c syscall.RawConn) error {
+	return nil
+}
+
+// isAddrInUse returns true if err is caused by an address, which is already in use.
+func isAddrInUse(err error) bool {
+	return errors.Is(err, wsaeaddrinuse)
+}
@@ -0,0 +1,77 @@
+package dnssd
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// LookupAddr performs a reverse lookup for the given ip address and returns
+// the host name which maps to it, in the form of "<hostname>.<domain>."
+// (Note the trailing dot.)
+//
+// The PTR query for the "in-addr.arpa." or "ip6.arpa." name is sent via mDNS. (RFC6762 4)
+func LookupAddr(ctx context.Context, ip net.IP) (string, error) {
+	conn, err := newMDNSConn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.close()
+
+	return lookupAddr(ctx, ip, conn)
+}
+
+func lookupAddr(ctx context.Context, ip net.IP, conn MDNSConn) (host string, err error) {
+	name, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return
+	}
+
+	m := new(dns.Msg)
+	m.Question = []dns.Question{
+		{
+			Name:   name,
+			Qtype:  dns.TypePTR,
+			Qclass: dns.ClassINET,
+		},
+	}
+
+	readCtx, readCancel := context.WithCancel(ctx)
+	defer readCancel()
+
+	ch := conn.Read(readCtx)
+
+	qs := make(chan *Query)
+	go func() {
+		for _, iface := range MulticastInterfaces() {
+			iface := iface
+			q := &Query{msg: m, iface: iface}
+			select {
+			case qs <- q:
+			case <-readCtx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case q := <-qs:
+			if err := conn.SendQuery(q); err != nil {
+				loggerFrom(ctx).Error("dnssd: sending query failed", "question", name, "iface", q.IfaceName(), "err", err)
+			}
+		case req := <-ch:
+			for _, rr := range filterRecords(req, nil) {
+				if ptr, ok := rr.(*dns.PTR); ok && strings.EqualFold(ptr.Hdr.Name, name) {
+					host = ptr.Ptr
+					return
+				}
+			}
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package dnssd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestLookupAddr(t *testing.T) {
+	conn := newTestConn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		msg := new(dns.Msg)
+		msg.Response = true
+		msg.Answer = []dns.RR{
+			&dns.PTR{
+				Hdr: dns.RR_Header{
+					Name:   "123.0.168.192.in-addr.arpa.",
+					Rrtype: dns.TypePTR,
+					Class:  dns.ClassINET,
+					Ttl:    TTLHostname,
+				},
+				Ptr: "Computer.local.",
+			},
+		}
+		conn.in <- msg
+	}()
+
+	host, err := lookupAddr(ctx, net.IP{192, 168, 0, 123}, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := host, "Computer.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
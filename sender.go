@@ -0,0 +1,177 @@
+package dnssd
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// scheduledResponse is a response, which is sent by calling send at a specific time.
+type scheduledResponse struct {
+	at   time.Time
+	send func()
+}
+
+// sender sends the scheduled responses at one network interface in the order
+// of their due time, so that delayed responses don't block the handling of
+// requests or the responses at other interfaces.
+type sender struct {
+	clock Clock
+
+	mutex   sync.Mutex
+	pending []*scheduledResponse
+
+	// wake is signaled when a response is scheduled.
+	wake chan struct{}
+
+	// quit is closed by stop, and stopped is closed when run returns.
+	quit     chan struct{}
+	quitOnce sync.Once
+	stopped  chan struct{}
+}
+
+// newSender returns a sender, which sends responses until done is closed
+// or the sender is stopped.
+func newSender(clock Clock, done <-chan struct{}) *sender {
+	s := &sender{
+		clock:   clock,
+		wake:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run(done)
+
+	return s
+}
+
+// stop drops the pending responses and waits until
+// a response, which is currently sent, is sent.
+func (s *sender) stop() {
+	s.quitOnce.Do(func() {
+		close(s.quit)
+	})
+	<-s.stopped
+}
+
+// schedule calls send after delay.
+func (s *sender) schedule(delay time.Duration, send func()) {
+	s.mutex.Lock()
+	s.pending = append(s.pending, &scheduledResponse{at: s.clock.Now().Add(delay), send: send})
+	sort.SliceStable(s.pending, func(i, j int) bool {
+		return s.pending[i].at.Before(s.pending[j].at)
+	})
+	s.mutex.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the response, which is due next, or nil.
+func (s *sender) next() *scheduledResponse {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	return s.pending[0]
+}
+
+// pop removes sr from the pending responses.
+func (s *sender) pop(sr *scheduledResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, p := range s.pending {
+		if p == sr {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// run sends the pending responses when they are due, until done or quit is closed.
+func (s *sender) run(done <-chan struct{}) {
+	defer close(s.stopped)
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+
+		var due <-chan time.Time
+		next := s.next()
+		if next != nil {
+			wait := next.at.Sub(s.clock.Now())
+			if wait <= 0 {
+				s.pop(next)
+				next.send()
+				continue
+			}
+			due = s.clock.After(wait)
+		}
+
+		select {
+		case <-due:
+			s.pop(next)
+			next.send()
+		case <-s.wake:
+		case <-done:
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// senderAt returns the sender for responses at iface.
+func (r *responder) senderAt(iface *net.Interface) *sender {
+	name := "?"
+	if iface != nil {
+		name = iface.Name
+	}
+
+	r.stopMutex.Lock()
+	done := r.done
+	r.stopMutex.Unlock()
+
+	r.sendersMutex.Lock()
+	defer r.sendersMutex.Unlock()
+
+	if s, ok := r.senders[name]; ok {
+		return s
+	}
+
+	s := newSender(r.clock, done)
+	r.senders[name] = s
+
+	return s
+}
+
+// stopSenders stops and removes the senders of the responder.
+// Their pending responses and truncated queries are dropped. When stopSenders
+// returns, no more responses are sent, e.g. after goodbye packets.
+// The mutex of the responder must not be locked.
+func (r *responder) stopSenders() {
+	r.mutex.Lock()
+	for key, t := range r.truncated {
+		close(t.stop)
+		delete(r.truncated, key)
+	}
+	r.mutex.Unlock()
+
+	r.sendersMutex.Lock()
+	senders := r.senders
+	r.senders = map[string]*sender{}
+	r.sendersMutex.Unlock()
+
+	for _, s := range senders {
+		s.stop()
+	}
+}
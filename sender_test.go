@@ -0,0 +1,72 @@
+package dnssd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSenderOrder(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	s := newSender(realClock{}, done)
+
+	sent := make(chan string, 3)
+	s.schedule(100*time.Millisecond, func() { sent <- "c" })
+	s.schedule(50*time.Millisecond, func() { sent <- "b" })
+	s.schedule(0, func() { sent <- "a" })
+
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case is := <-sent:
+			if is != want {
+				t.Fatalf("is=%v want=%v", is, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestSenderStop(t *testing.T) {
+	done := make(chan struct{})
+	s := newSender(realClock{}, done)
+
+	sent := make(chan struct{}, 1)
+	s.schedule(50*time.Millisecond, func() { sent <- struct{}{} })
+	close(done)
+
+	select {
+	case <-sent:
+		t.Fatal("response should be dropped")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSenderStopWaits(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	s := newSender(realClock{}, done)
+
+	sending := make(chan struct{})
+	sent := make(chan struct{})
+	s.schedule(0, func() {
+		close(sending)
+		time.Sleep(50 * time.Millisecond)
+		close(sent)
+	})
+	s.schedule(50*time.Millisecond, func() { t.Error("response should be dropped") })
+
+	<-sending
+	s.stop()
+
+	// The response, which was sent while stopping, is sent when stop returns.
+	select {
+	case <-sent:
+	default:
+		t.Fatal("stop returned before the response was sent")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+}
@@ -1,13 +1,14 @@
 package dnssd
 
 import (
-	"bytes"
-
-	"github.com/brutella/dnssd/log"
+	"github.com/miekg/dns"
 
 	"fmt"
+	"log/slog"
 	"net"
+	"net/netip"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
@@ -19,6 +20,15 @@ type Config struct {
 	// Type is the service type, for example "_hap._tcp".
 	Type string
 
+	// StrictType is true, if Type must be a valid service type
+	// according to ValidateServiceType. (RFC6335 5.1)
+	StrictType bool
+
+	// UnregisteredTypeFunc is called by NewService with a valid service type,
+	// whose name is not registered (see IsRegisteredServiceName).
+	// It is only called, if StrictType is true.
+	UnregisteredTypeFunc func(typ string)
+
 	// Domain is the name of the domain, for example "local".
 	// If empty, "local" is used.
 	Domain string
@@ -30,27 +40,92 @@ type Config struct {
 	// Txt records
 	Text map[string]string
 
+	// TextFlags are the keys of boolean attributes, which are
+	// published in the TXT record without value. (RFC6763 6.4)
+	TextFlags []string
+
 	// IP addresses of the service.
-	// This field is deprecated and should not be used.
+	//
+	// Deprecated: Use Addrs.
 	IPs []net.IP
 
+	// Addrs are the IP addresses, which are advertised at every network interface
+	// of the service instead of the addresses of the interface, e.g. a virtual or
+	// NAT-published address. IfaceIPs take precedence for their interfaces.
+	// For proxy services, they are the addresses of Host, which are only
+	// advertised at interfaces attached to the same subnet, unless Ifaces is set.
+	Addrs []netip.Addr
+
 	// Port is the port of the service.
 	Port int
 
-	// Interfaces at which the service should be registered
+	// Interfaces at which the service should be registered.
+	// The names may be patterns, e.g. "en*" or "eth*" (see path.Match).
 	Ifaces []string
+
+	// IfaceFilter returns true, if the service should be registered at the network
+	// interface. It is applied to the interfaces in Ifaces, or to all multicast
+	// interfaces if Ifaces is empty. Virtual interfaces are then not excluded
+	// by ExcludeInterfaceFunc.
+	IfaceFilter func(iface net.Interface) bool
+
+	// IfaceIPs are the IP addresses, which are advertised at the network
+	// interfaces by name, instead of all addresses of the interfaces.
+	// The addresses must be assigned to the interfaces in the network namespace
+	// of the responder, to which the service is added. If Ifaces is empty,
+	// the service is only registered at these interfaces.
+	IfaceIPs map[string][]net.IP
+
+	// Aliases are additional host names (no trailing dot) which are
+	// published as CNAME records pointing to Host, for example "printer".
+	Aliases []string
+
+	// Hosts are additional host names (no trailing dot), e.g. "scanner", which are
+	// published with the same A and AAAA records as Host. Unlike aliases, they are
+	// probed and renamed on conflicts like Host.
+	Hosts []string
+
+	// Proxy is true, if the service is registered on behalf of another
+	// host, which can't run mDNS itself. Host and IPs must be set and
+	// are published instead of the local host name and addresses.
+	Proxy bool
+
+	// StatusFunc is called when the registration status of the service changes.
+	StatusFunc StatusFunc
+
+	// SkipProbe is true, if the service is announced without probing.
+	// Only use this option if the names of the service are guaranteed
+	// to be unique, for example because they are derived from a MAC address.
+	SkipProbe bool
+
+	// AddrPolicy selects the addresses, which are advertised for the service
+	// at a network interface. The policy is applied to the addresses of the
+	// interface, to Addrs and to IfaceIPs. If nil, all addresses are advertised.
+	AddrPolicy AddrPolicy
 }
 
 func (c Config) Copy() Config {
 	return Config{
-		Name:   c.Name,
-		Type:   c.Type,
-		Domain: c.Domain,
-		Host:   c.Host,
-		Text:   c.Text,
-		IPs:    c.IPs,
-		Port:   c.Port,
-		Ifaces: c.Ifaces,
+		Name:                 c.Name,
+		Type:                 c.Type,
+		StrictType:           c.StrictType,
+		UnregisteredTypeFunc: c.UnregisteredTypeFunc,
+		Domain:               c.Domain,
+		Host:                 c.Host,
+		Text:                 c.Text,
+		TextFlags:            c.TextFlags,
+		IPs:                  c.IPs,
+		Addrs:                c.Addrs,
+		Port:                 c.Port,
+		Ifaces:               c.Ifaces,
+		IfaceFilter:          c.IfaceFilter,
+		IfaceIPs:             c.IfaceIPs,
+		Aliases:              c.Aliases,
+		Hosts:                c.Hosts,
+		Proxy:                c.Proxy,
+		StatusFunc:           c.StatusFunc,
+		SkipProbe:            c.SkipProbe,
+		AddrPolicy:           c.AddrPolicy,
 	}
 }
 
@@ -76,18 +151,15 @@ func validHostname(host string) string {
 		}
 		// hostname must start with an alpha [RFC-952 ASSUMPTIONS] or digit [RFC1123 2.1] character.
 		if i == 0 && (!isDigit(r) && !isAlpha(r)) {
-			log.Debug.Printf(`hostname "%s" starts with "%s"`, host, string(r))
 			continue
 		}
 
 		// [RFC-952 ASSUMPTIONS] The last character must not be a minus sign or period.
 		if i == z && (r == '-' || r == '.') {
-			log.Debug.Printf(`hostname "%s" ends with "%s"`, host, string(r))
 			continue
 		}
 
 		if !isDigit(r) && !isAlpha(r) && r != '-' && r != '.' {
-			log.Debug.Printf(`hostname "%s" contains "%s"`, host, string(r))
 			continue
 		}
 
@@ -109,9 +181,52 @@ type Service struct {
 	IPs    []net.IP
 	Ifaces []string
 
+	// Aliases are host names which are published as CNAME records for Host.
+	Aliases []string
+
+	// Hosts are additional host names with the addresses of Host.
+	Hosts []string
+
+	// Proxy is true, if Host and IPs belong to a different machine.
+	Proxy bool
+
+	// TextFlags are the keys of boolean attributes in the TXT record,
+	// which are present without value, e.g. "paper" but not "paper=".
+	TextFlags []string
+
 	// stores ips by interface name for caching purposes
 	ifaceIPs   map[string][]net.IP
 	expiration time.Time
+
+	// records are the received records of a cached service.
+	records []dns.RR
+
+	statusFn  StatusFunc
+	skipProbe bool
+
+	// ifaceFilter selects the network interfaces of the service, and
+	// filtered caches its results, once the service is added to a responder.
+	ifaceFilter func(net.Interface) bool
+	filtered    *filteredIfaces
+
+	// checkIfaceIPs is true, if the ifaceIPs are configured by Config.IfaceIPs
+	// and must be assigned to their interfaces, when the service is added.
+	checkIfaceIPs bool
+
+	// hostVerified is true, if the hostname was already
+	// probed by the responder and is not probed again.
+	hostVerified bool
+
+	// maintenance is the maintenance mode, in which the service is answered.
+	maintenance MaintenanceMode
+
+	addrPolicy AddrPolicy
+
+	// netns is the network namespace of the responder, to which the service was added.
+	netns *netns
+
+	// logger is the logger of the responder, to which the service was added.
+	logger *slog.Logger
 }
 
 // NewService returns a new service for the given config.
@@ -130,6 +245,16 @@ func NewService(cfg Config) (s Service, err error) {
 		return
 	}
 
+	if cfg.StrictType {
+		if err = ValidateServiceType(typ); err != nil {
+			return
+		}
+
+		if fn := cfg.UnregisteredTypeFunc; fn != nil && !IsRegisteredServiceName(serviceTypeName(typ)) {
+			fn(typ)
+		}
+	}
+
 	if port == 0 {
 		err = fmt.Errorf("invalid port \"%d\"", port)
 		return
@@ -140,6 +265,18 @@ func NewService(cfg Config) (s Service, err error) {
 		domain = "local"
 	}
 
+	if cfg.Proxy {
+		if len(cfg.Host) == 0 {
+			err = fmt.Errorf("proxy service requires a host")
+			return
+		}
+
+		if len(cfg.IPs) == 0 && len(cfg.Addrs) == 0 {
+			err = fmt.Errorf("proxy service requires ip addresses")
+			return
+		}
+	}
+
 	host := cfg.Host
 	if len(host) == 0 {
 		host = hostname()
@@ -150,94 +287,241 @@ func NewService(cfg Config) (s Service, err error) {
 		text = map[string]string{}
 	}
 
+	if err = validateText(text, cfg.TextFlags); err != nil {
+		return
+	}
+
 	ips := []net.IP{}
 	var ifaces []string
 
 	if cfg.IPs != nil && len(cfg.IPs) > 0 {
-		ips = cfg.IPs
+		ips = append(ips, cfg.IPs...)
+	}
+
+	for _, addr := range cfg.Addrs {
+		if !addr.IsValid() || addr.IsUnspecified() {
+			err = fmt.Errorf("invalid address %v", addr)
+			return
+		}
+		if ip := net.IP(addr.Unmap().AsSlice()); !containsIP(ips, ip) {
+			ips = append(ips, ip)
+		}
 	}
 
 	if cfg.Ifaces != nil && len(cfg.Ifaces) > 0 {
 		ifaces = cfg.Ifaces
 	}
 
+	ifaceIPs := map[string][]net.IP{}
+	var names []string
+	for name, ips := range cfg.IfaceIPs {
+		if len(cfg.Ifaces) > 0 && !containsIfaces(name, cfg.Ifaces) {
+			err = fmt.Errorf("interface %s is not in Ifaces", name)
+			return
+		}
+		ifaceIPs[name] = append([]net.IP(nil), ips...)
+		names = append(names, name)
+	}
+
+	if len(ifaces) == 0 && len(names) > 0 {
+		sort.Strings(names)
+		ifaces = names
+	}
+
+	var aliases []string
+	for _, alias := range cfg.Aliases {
+		if valid := validHostname(alias); len(valid) > 0 {
+			aliases = append(aliases, valid)
+		}
+	}
+
+	var hosts []string
+	for _, h := range cfg.Hosts {
+		if valid := validHostname(h); len(valid) > 0 {
+			hosts = append(hosts, valid)
+		}
+	}
+
 	return Service{
-		Name:     trimServiceNameSuffixRight(name),
-		Type:     typ,
-		Domain:   domain,
-		Host:     validHostname(host),
-		Text:     text,
-		Port:     port,
-		IPs:      ips,
-		Ifaces:   ifaces,
-		ifaceIPs: map[string][]net.IP{},
+		Name:      trimServiceNameSuffixRight(name),
+		Type:      typ,
+		Domain:    domain,
+		Host:      validHostname(host),
+		Text:      text,
+		Port:      port,
+		IPs:       ips,
+		Ifaces:    ifaces,
+		Aliases:   aliases,
+		Hosts:     hosts,
+		Proxy:     cfg.Proxy,
+		TextFlags: cfg.TextFlags,
+		ifaceIPs:  ifaceIPs,
+		statusFn:  cfg.StatusFunc,
+		skipProbe: cfg.SkipProbe,
+
+		ifaceFilter:   cfg.IfaceFilter,
+		checkIfaceIPs: len(cfg.IfaceIPs) > 0,
+
+		addrPolicy: cfg.AddrPolicy,
 	}, nil
 }
 
+// bind binds the service to the network namespace ns and the logger
+// of a responder, to which it is added.
+func (s *Service) bind(ns *netns, logger *slog.Logger) {
+	s.netns = ns
+	s.logger = logger
+	if s.ifaceFilter != nil {
+		s.filtered = &filteredIfaces{}
+	}
+}
+
+// log returns the logger of the responder, to which
+// the service was added, or the default logger.
+func (s *Service) log() *slog.Logger {
+	if s.logger != nil {
+		return s.logger
+	}
+
+	return defaultLogger
+}
+
+// validateIfaceIPs returns an error, if the configured ifaceIPs are not
+// assigned to their interfaces in the network namespace of the service.
+func (s *Service) validateIfaceIPs() error {
+	if !s.checkIfaceIPs {
+		return nil
+	}
+
+	for name, ips := range s.ifaceIPs {
+		if err := s.netns.validateIfaceIPs(name, ips); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Interfaces returns the network interfaces for which the service is registered,
 // or all multicast network interfaces, if no IP addresses are specified.
 func (s *Service) Interfaces() []*net.Interface {
+	if s.ifaceFilter != nil {
+		return s.netns.filterInterfaces(s.Ifaces, s.ifaceFilter)
+	}
+
 	if len(s.Ifaces) > 0 {
 		ifis := []*net.Interface{}
+		add := func(ifi *net.Interface) {
+			for _, i := range ifis {
+				if i.Index == ifi.Index {
+					return
+				}
+			}
+			ifis = append(ifis, ifi)
+		}
+
 		for _, name := range s.Ifaces {
-			if ifi, err := net.InterfaceByName(name); err == nil {
-				ifis = append(ifis, ifi)
+			if strings.ContainsAny(name, "*?[") {
+				for _, ifi := range s.netns.multicastInterfaces(name) {
+					add(ifi)
+				}
+			} else if ifi, err := s.netns.interfaceByName(name); err == nil {
+				add(ifi)
 			}
 		}
 
 		return ifis
 	}
 
-	return MulticastInterfaces()
+	return s.netns.multicastInterfaces()
 }
 
 // IsVisibleAtInterface returns true, if the service is published
 // at the network interface with name n.
 func (s *Service) IsVisibleAtInterface(n string) bool {
-	if len(s.Ifaces) == 0 {
-		return true
+	if !containsIfaces(n, s.Ifaces) {
+		return false
 	}
 
-	for _, name := range s.Ifaces {
-		if name == n {
-			return true
-		}
+	if s.ifaceFilter != nil {
+		return s.filtered.lookup(n, func() bool {
+			iface, err := s.netns.interfaceByName(n)
+			return err == nil && s.ifaceFilter(*iface)
+		})
 	}
 
-	return false
+	return true
 }
 
-// IPsAtInterface returns the ip address at a specific interface.
+// IPsAtInterface returns the ip addresses, which are advertised at a specific interface.
+// These are the IfaceIPs of the interface, if any. Otherwise these are the addresses of
+// the service (see Config.Addrs) or the addresses of the interface. The AddrPolicy
+// selects from all of them.
 func (s *Service) IPsAtInterface(iface *net.Interface) []net.IP {
 	if iface == nil {
 		return []net.IP{}
 	}
 
+	ips := s.ipsAtInterface(iface)
+	if s.addrPolicy != nil {
+		// The policy may look up the addresses of iface.
+		s.netns.do(func() error {
+			ips = s.addrPolicy(iface, ips)
+			return nil
+		})
+	}
+
+	return ips
+}
+
+// ipsAtInterface returns the ip addresses at iface, before the AddrPolicy is applied.
+func (s *Service) ipsAtInterface(iface *net.Interface) []net.IP {
 	if ips, ok := s.ifaceIPs[iface.Name]; ok {
 		return ips
 	}
 
-	if len(s.IPs) > 0 {
+	if len(s.IPs) > 0 && (!s.Proxy || len(s.Ifaces) > 0) {
 		return s.IPs
 	}
 
-	addrs, err := iface.Addrs()
+	addrs, err := s.netns.addrs(iface)
 	if err != nil {
 		return []net.IP{}
 	}
 
+	if s.Proxy {
+		// The addresses of a proxied host are only published
+		// at interfaces, which are attached to the same subnet.
+		return ipsInSubnets(s.IPs, addrs)
+	}
+
 	ips := []net.IP{}
 	for _, addr := range addrs {
 		if ip, _, err := net.ParseCIDR(addr.String()); err == nil {
 			ips = append(ips, ip)
 		} else {
-			log.Debug.Println(err)
+			s.log().Debug("Invalid interface address", "addr", addr, "err", err)
 		}
 	}
 
 	return ips
 }
 
+// ipsInSubnets returns the ips which are part of the subnets of addrs.
+func ipsInSubnets(ips []net.IP, addrs []net.Addr) []net.IP {
+	result := []net.IP{}
+	for _, ip := range ips {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.Contains(ip) {
+				result = append(result, ip)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
 // HasIPOnAnyInterface returns true, if the service defines
 // the ip address on any network interface.
 func (s *Service) HasIPOnAnyInterface(ip net.IP) bool {
@@ -265,13 +549,55 @@ func (s Service) Copy() *Service {
 		IPs:        s.IPs,
 		Port:       s.Port,
 		Ifaces:     s.Ifaces,
+		Aliases:    s.Aliases,
+		Hosts:      s.Hosts,
+		Proxy:      s.Proxy,
+		TextFlags:  s.TextFlags,
 		ifaceIPs:   s.ifaceIPs,
 		expiration: s.expiration,
+		records:    s.records,
+		statusFn:   s.statusFn,
+		skipProbe:  s.skipProbe,
+
+		ifaceFilter:   s.ifaceFilter,
+		filtered:      s.filtered,
+		checkIfaceIPs: s.checkIfaceIPs,
+
+		hostVerified: s.hostVerified,
+		maintenance:  s.maintenance,
+		addrPolicy:   s.addrPolicy,
+		netns:        s.netns,
+		logger:       s.logger,
 	}
 }
 
+// snapshot returns a copy of the service, which doesn't share
+// the text, addresses and interfaces with s.
+func (s Service) snapshot() Service {
+	c := *s.Copy()
+
+	c.Text = make(map[string]string, len(s.Text))
+	for k, v := range s.Text {
+		c.Text[k] = v
+	}
+	c.TextFlags = append([]string(nil), s.TextFlags...)
+	c.IPs = append([]net.IP(nil), s.IPs...)
+	c.Ifaces = append([]string(nil), s.Ifaces...)
+	c.Aliases = append([]string(nil), s.Aliases...)
+	c.Hosts = append([]string(nil), s.Hosts...)
+
+	c.ifaceIPs = make(map[string][]net.IP, len(s.ifaceIPs))
+	for name, ips := range s.ifaceIPs {
+		c.ifaceIPs[name] = append([]net.IP(nil), ips...)
+	}
+	c.records = append([]dns.RR(nil), s.records...)
+
+	return c
+}
+
+// EscapedName returns the escaped instance name. (RFC6763 4.3)
 func (s Service) EscapedName() string {
-	return escape.Replace(s.Name)
+	return EscapeInstanceName(s.Name)
 }
 
 func incrementHostname(name string, count int) string {
@@ -364,14 +690,39 @@ func (s Service) Hostname() string {
 	return fmt.Sprintf("%s.%s.", s.Host, s.Domain)
 }
 
+// AliasNames returns the alias host names in the
+// form of "<alias>.<domain>."
+// (Note the trailing dot.)
+func (s Service) AliasNames() []string {
+	var names []string
+	for _, alias := range s.Aliases {
+		names = append(names, fmt.Sprintf("%s.%s.", alias, s.Domain))
+	}
+
+	return names
+}
+
+// HostNames returns the additional host names in
+// the form of "<host>.<domain>."
+// (Note the trailing dot.)
+func (s Service) HostNames() []string {
+	var names []string
+	for _, h := range s.Hosts {
+		names = append(names, fmt.Sprintf("%s.%s.", h, s.Domain))
+	}
+
+	return names
+}
+
 // SetHostname sets the service's host name and
 // domain (if specified as "<hostname>.<domain>.").
 // (Note the trailing dot.)
 func (s *Service) SetHostname(hostname string) {
-	name, domain := parseHostname(hostname)
-
-	if domain == s.Domain {
-		s.Host = name
+	// The domain may have multiple labels, e.g. "corp.local".
+	labels := splitLabels(hostname)
+	domain := splitLabels(s.Domain)
+	if n := len(labels) - len(domain); n > 0 && strings.EqualFold(strings.Join(labels[n:], "."), strings.Join(domain, ".")) {
+		s.Host = strings.Join(labels[:n], ".")
 	}
 }
 
@@ -382,15 +733,45 @@ func (s Service) ServicesMetaQueryName() string {
 	return fmt.Sprintf("_services._dns-sd._udp.%s.", s.Domain)
 }
 
+// addIP adds ip, which was received at iface, to the addresses of the service.
+// Addresses, which are received repeatedly, are only added once.
 func (s *Service) addIP(ip net.IP, iface *net.Interface) {
-	s.IPs = append(s.IPs, ip)
-	if iface != nil {
-		ifaceIPs := []net.IP{ip}
-		if ips, ok := s.ifaceIPs[iface.Name]; ok {
-			ifaceIPs = append(ips, ip)
+	if !containsIP(s.IPs, ip) {
+		s.IPs = append(s.IPs, ip)
+	}
+	if iface != nil && !containsIP(s.ifaceIPs[iface.Name], ip) {
+		s.ifaceIPs[iface.Name] = append(s.ifaceIPs[iface.Name], ip)
+	}
+}
+
+// setRecord stores a copy of rr as a received record of the service. It replaces
+// the record with the same name and type, or address records with the same address.
+// Records without TTL are removed. (RFC6762 10.1)
+func (s *Service) setRecord(rr dns.RR) {
+	cp := dns.Copy(rr)
+	cp.Header().Class &^= (1 << 15)
+
+	var rrs []dns.RR
+	for _, r := range s.records {
+		if !isSameRecord(r, cp) {
+			rrs = append(rrs, r)
 		}
-		s.ifaceIPs[iface.Name] = ifaceIPs
 	}
+
+	if cp.Header().Ttl > 0 {
+		rrs = append(rrs, cp)
+	}
+	s.records = rrs
+}
+
+// isSameRecord returns true, if this is replaced by that.
+func isSameRecord(this, that dns.RR) bool {
+	switch that.(type) {
+	case *dns.A, *dns.AAAA:
+		return dns.IsDuplicate(this, that)
+	}
+
+	return this.Header().Rrtype == that.Header().Rrtype && strings.EqualFold(this.Header().Name, that.Header().Name)
 }
 
 func newService(instance string) *Service {
@@ -406,48 +787,40 @@ func newService(instance string) *Service {
 	}
 }
 
-var unescape = strings.NewReplacer("\\", "")
-var escape *strings.Replacer
-
-func init() {
-	specialChars := []byte{'.', ' ', '\'', '@', ';', '(', ')', '"', '\\'}
-	replaces := make([]string, 2*len(specialChars))
-	for i, char := range specialChars {
-		replaces[2*i] = string(char)
-		replaces[2*i+1] = "\\" + string(char)
-	}
-	escape = strings.NewReplacer(replaces...)
+// splitLabels returns the labels of the domain name str.
+// Escaped dots don't separate labels and the labels stay escaped.
+func splitLabels(str string) []string {
+	return dns.SplitDomainName(str)
 }
 
-func reverse(s string) string {
-	r := []rune(s)
-	for i, j := 0, len(r)-1; i < len(r)/2; i, j = i+1, j-1 {
-		r[i], r[j] = r[j], r[i]
-	}
-	return string(r)
+// isProtoLabel returns true, if label is the protocol label of a service type.
+func isProtoLabel(label string) bool {
+	return strings.EqualFold(label, "_tcp") || strings.EqualFold(label, "_udp")
 }
 
 // parseServiceInstanceName parses str to get the instance, service and domain name.
+// The service type is identified by the "_tcp" or "_udp" label, which allows
+// escaped dots in the instance name and domains with multiple labels.
 func parseServiceInstanceName(str string) (name string, service string, domain string) {
-	r := bytes.NewBufferString(reverse(strings.Trim(str, ".")))
-	l, err := r.ReadString('.')
-	if err != nil {
-		return
+	labels := splitLabels(str)
+
+	// The protocol label is the last "_tcp" or "_udp" label.
+	// If there is none, the domain is expected to have one label.
+	proto := len(labels) - 2
+	for i := len(labels) - 1; i >= 2; i-- {
+		if isProtoLabel(labels[i]) {
+			proto = i
+			break
+		}
 	}
-	domain = strings.Trim(l, ".")
-	domain = reverse(domain)
 
-	proto, err := r.ReadString('.')
-	if err != nil {
-		return
-	}
-	typee, err := r.ReadString('.')
-	if err != nil {
+	if proto < 2 {
 		return
 	}
-	service = fmt.Sprintf("%s.%s", strings.Trim(reverse(typee), "."), strings.Trim(reverse(proto), "."))
-	name = reverse(r.String())
-	name = unescape.Replace(name)
+
+	domain = strings.Join(labels[proto+1:], ".")
+	service = fmt.Sprintf("%s.%s", labels[proto-1], labels[proto])
+	name = UnescapeInstanceName(strings.Join(labels[:proto-1], "."))
 
 	return
 }
@@ -465,54 +838,25 @@ func hostname() string {
 }
 
 func parseHostname(str string) (name string, domain string) {
-	trimmed := strings.Trim(str, ".")
-	last := strings.LastIndex(trimmed, ".")
-	if last == -1 {
-		name = trimmed
+	labels := splitLabels(str)
+	switch len(labels) {
+	case 0:
+		return
+	case 1:
+		name = labels[0]
 		return
 	}
 
-	name = strings.Trim(str[:last], ".")
-	domain = strings.Trim(str[last+1:], ".")
+	name = strings.Join(labels[:len(labels)-1], ".")
+	domain = labels[len(labels)-1]
 	return
 }
 
 // MulticastInterfaces returns a list of all active multicast network interfaces.
+// If no filters are specified, interfaces excluded by ExcludeInterfaceFunc are omitted.
 func MulticastInterfaces(filters ...string) []*net.Interface {
-	var tmp []*net.Interface
-	ifaces, err := net.Interfaces()
-	if err != nil {
-		return nil
-	}
-
-	for _, iface := range ifaces {
-		iface := iface
-		if (iface.Flags & net.FlagUp) == 0 {
-			continue
-		}
-
-		if (iface.Flags & net.FlagMulticast) == 0 {
-			continue
-		}
-
-		if !containsIfaces(iface.Name, filters) {
-			continue
-		}
-
-		// check for a valid ip at that interface
-		addrs, err := iface.Addrs()
-		if err != nil {
-			continue
-		}
-		for _, addr := range addrs {
-			if _, _, err := net.ParseCIDR(addr.String()); err == nil {
-				tmp = append(tmp, &iface)
-				break
-			}
-		}
-	}
-
-	return tmp
+	var ns *netns
+	return ns.multicastInterfaces(filters...)
 }
 
 func containsIfaces(iface string, filters []string) bool {
@@ -521,7 +865,7 @@ func containsIfaces(iface string, filters []string) bool {
 	}
 
 	for _, ifn := range filters {
-		if ifn == iface {
+		if ifaceNameMatch(ifn, iface) {
 			return true
 		}
 	}
@@ -2,57 +2,268 @@ package dnssd
 
 import (
 	"net"
-	"time"
 
-	"github.com/brutella/dnssd/log"
 	"github.com/miekg/dns"
 )
 
 // ServiceHandle serves a middleman between a service and a responder.
 type ServiceHandle interface {
-	UpdateText(text map[string]string, r Responder)
+	// UpdateText replaces the TXT records of the service and announces
+	// the new TXT record at every network interface where the service is visible.
+	//
+	// Deprecated: Use SetText, which returns an error if text can't be published.
+	UpdateText(text map[string]string)
+
+	// SetText replaces the TXT records of the service and announces
+	// the new TXT record at every network interface where the service is visible.
+	// An error is returned, if text can't be published as TXT record.
+	SetText(text map[string]string) error
+
+	// UpdateIPs replaces the ip addresses of the service at the network
+	// interface with the name iface, or at all interfaces if iface is empty.
+	// Addresses, which were set for a specific interface, are kept when iface is empty.
+	// If ips is empty, the addresses of the network interface are used again.
+	// Goodbye packets are sent for the old addresses and the new addresses
+	// are announced.
+	UpdateIPs(iface string, ips []net.IP)
+
+	// Announce resends the announcements of the service with the cache-flush
+	// bit set at every network interface, where the service is visible,
+	// e.g. after waking from sleep.
+	Announce()
+
+	// SetMaintenance changes the maintenance mode of the service.
+	// Goodbye packets are sent when entering MaintenanceGoodbye,
+	// and the service is announced again when leaving maintenance.
+	SetMaintenance(mode MaintenanceMode)
+
 	Service() Service
 }
 
 type serviceHandle struct {
-	service *Service
+	service   *Service
+	responder *responder
+
+	// records caches the records of service per network interface name,
+	// which were created for the service recordsOf. (see recordsAt)
+	records   map[string]*serviceRecords
+	recordsOf *Service
+}
+
+func (h *serviceHandle) UpdateText(text map[string]string) {
+	if err := h.SetText(text); err != nil {
+		h.responder.logger.Info("Ignoring TXT records", "service", h.Service().ServiceInstanceName(), "error", err)
+	}
+}
+
+func (h *serviceHandle) SetText(text map[string]string) error {
+	return h.responder.updateTexts([]*serviceHandle{h}, []map[string]string{text})
+}
+
+// checkTextSize logs, if the TXT record of srv exceeds the recommended size.
+func (r *responder) checkTextSize(srv *Service) {
+	if n := textSize(srv.Text, srv.TextFlags); n > recommendedTextSize {
+		r.logger.Info("TXT record exceeds recommended size", "service", srv.ServiceInstanceName(), "size", n, "max", recommendedTextSize)
+	}
+}
+
+// setText replaces the TXT records of the service and returns the changed service.
+// It must be called with the mutex of the responder locked.
+func (h *serviceHandle) setText(text map[string]string) (*Service, error) {
+	if err := validateText(text, h.service.TextFlags); err != nil {
+		return nil, err
+	}
+
+	srv := h.service.Copy()
+	srv.Text = text
+	h.service = srv
+	h.responder.checkTextSize(srv)
+
+	return srv, nil
+}
+
+// updateTexts replaces the TXT records of the services of hs by texts and
+// announces the new TXT records of all services with one message per network
+// interface. No TXT records are replaced, if any of them is invalid.
+func (r *responder) updateTexts(hs []*serviceHandle, texts []map[string]string) error {
+	r.mutex.Lock()
+	for i, h := range hs {
+		if err := validateText(texts[i], h.service.TextFlags); err != nil {
+			r.mutex.Unlock()
+			return err
+		}
+	}
+
+	var srvs []*Service
+	for i, h := range hs {
+		srv, _ := h.setText(texts[i])
+		srvs = append(srvs, srv)
+	}
+	r.mutex.Unlock()
+
+	r.announceText(srvs)
+
+	return nil
+}
+
+// announceText announces the TXT records of srvs at every network interface,
+// where they are visible, with one message per interface.
+func (r *responder) announceText(srvs []*Service) {
+	var ifaces []*net.Interface
+	msgs := map[string]*dns.Msg{}
+	for _, srv := range srvs {
+		if srv.maintenance != MaintenanceOff {
+			// The TXT record is announced when leaving maintenance.
+			continue
+		}
+
+		r.logger.Debug("Reannounce TXT", "service", srv.ServiceInstanceName(), "text", srv.Text)
+
+		for _, iface := range srv.Interfaces() {
+			if len(srv.IPsAtInterface(iface)) == 0 {
+				// The service is not announced at this interface.
+				continue
+			}
+
+			msg, ok := msgs[iface.Name]
+			if !ok {
+				msg = new(dns.Msg)
+				msg.Response = true
+				msg.Authoritative = true
+				msgs[iface.Name] = msg
+				ifaces = append(ifaces, iface)
+			}
+			msg.Answer = append(msg.Answer, TXT(*srv))
+		}
+	}
+
+	for _, iface := range ifaces {
+		msg := msgs[iface.Name]
+		setAnswerCacheFlushBit(msg)
+
+		go r.sendAnnouncement(msg, iface)
+	}
+}
+
+func (h *serviceHandle) Announce() {
+	rr := h.responder
+
+	rr.mutex.Lock()
+	srv := h.service.Copy()
+	rr.mutex.Unlock()
+
+	rr.logger.Debug("Reannounce service", "service", srv.ServiceInstanceName())
+	rr.announce([]*Service{srv})
+	notifyReannounced([]*Service{srv})
+}
+
+func (h *serviceHandle) SetMaintenance(mode MaintenanceMode) {
+	rr := h.responder
+
+	rr.mutex.Lock()
+	if h.service.maintenance == mode {
+		rr.mutex.Unlock()
+		return
+	}
+	srv := h.service.Copy()
+	srv.maintenance = mode
+	h.service = srv
+	rr.mutex.Unlock()
+
+	rr.logger.Debug("Change maintenance mode", "service", srv.ServiceInstanceName(), "mode", mode)
+
+	switch mode {
+	case MaintenanceGoodbye:
+		rr.unannounce([]*Service{srv})
+	case MaintenanceOff:
+		rr.announce([]*Service{srv})
+	}
 }
 
-func (h *serviceHandle) UpdateText(text map[string]string, r Responder) {
-	h.service.Text = text
+func (h *serviceHandle) UpdateIPs(iface string, ips []net.IP) {
+	rr := h.responder
 
-	msg := new(dns.Msg)
-	msg.Answer = []dns.RR{TXT(*h.service)}
-	msg.Response = true
-	msg.Authoritative = true
+	rr.mutex.Lock()
+	old := h.service
+	srv := old.Copy()
+	ifaceIPs := map[string][]net.IP{}
+	for name, ips := range old.ifaceIPs {
+		ifaceIPs[name] = ips
+	}
+	if len(iface) == 0 {
+		srv.IPs = ips
+	} else {
+		if len(ips) > 0 {
+			ifaceIPs[iface] = ips
+		} else {
+			delete(ifaceIPs, iface)
+		}
+	}
+	srv.ifaceIPs = ifaceIPs
+	h.service = srv
+	rr.mutex.Unlock()
 
-	setAnswerCacheFlushBit(msg)
+	rr.logger.Debug("Reannounce IPs", "service", srv.ServiceInstanceName(), "iface", iface, "ips", ips)
+
+	for _, ifi := range srv.Interfaces() {
+		if len(iface) > 0 && ifi.Name != iface {
+			continue
+		}
 
-	log.Debug.Println("Reannounce TXT", text)
+		answer := addressRecords(*srv, ifi)
 
-	rr := r.(*responder)
-	for _, iface := range h.service.Interfaces() {
-		resp := &Response{msg: msg, iface: iface}
-		go func() {
-			if err := rr.conn.SendResponse(resp); err != nil {
-				log.Debug.Println("1st reannounce:", err)
+		// Send goodbye for the addresses, which are not used anymore.
+		newIPs := srv.IPsAtInterface(ifi)
+		for _, record := range addressRecords(*old, ifi) {
+			var ip net.IP
+			switch a := record.(type) {
+			case *dns.A:
+				ip = a.A
+			case *dns.AAAA:
+				ip = a.AAAA
 			}
-			time.Sleep(1 * time.Second)
-			if err := rr.conn.SendResponse(resp); err != nil {
-				log.Debug.Println("2nd reannounce:", err)
+			if !containsIP(newIPs, ip) {
+				record.Header().Ttl = 0
+				answer = append(answer, record)
 			}
-		}()
+		}
+
+		if len(answer) == 0 {
+			continue
+		}
+
+		msg := new(dns.Msg)
+		msg.Answer = answer
+		msg.Response = true
+		msg.Authoritative = true
+
+		setAnswerCacheFlushBit(msg)
+
+		go rr.sendAnnouncement(msg, ifi)
+	}
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
 	}
+
+	return false
 }
 
 func (h *serviceHandle) Service() Service {
+	h.responder.mutex.Lock()
+	defer h.responder.mutex.Unlock()
+
 	return *h.service
 }
 
 func (h *serviceHandle) IPv4s() []net.IP {
 	var result []net.IP
 
-	for _, ip := range h.service.IPs {
+	for _, ip := range h.Service().IPs {
 		if ip.To4() != nil {
 			result = append(result, ip)
 		}
@@ -64,7 +275,7 @@ func (h *serviceHandle) IPv4s() []net.IP {
 func (h *serviceHandle) IPv6s() []net.IP {
 	var result []net.IP
 
-	for _, ip := range h.service.IPs {
+	for _, ip := range h.Service().IPs {
 		if ip.To16() != nil {
 			result = append(result, ip)
 		}
@@ -2,6 +2,8 @@ package dnssd
 
 import (
 	"net"
+	"net/netip"
+	"reflect"
 	"testing"
 )
 
@@ -181,3 +183,423 @@ func TestTrimServiceNameSuffixRight(t *testing.T) {
 		}
 	}
 }
+
+func TestNewProxyService(t *testing.T) {
+	cfg := Config{
+		Name:  "Printer",
+		Type:  "_ipp._tcp",
+		Port:  631,
+		Proxy: true,
+	}
+
+	if _, err := NewService(cfg); err == nil {
+		t.Fatal("expected error for missing host")
+	}
+
+	cfg.Host = "ABCD"
+	if _, err := NewService(cfg); err == nil {
+		t.Fatal("expected error for missing ips")
+	}
+
+	cfg.IPs = []net.IP{net.ParseIP("192.168.1.53")}
+	sv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := sv.Hostname(), "ABCD.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestIPsInSubnets(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.10/24")
+	_, other, _ := net.ParseCIDR("10.0.0.2/8")
+	ips := []net.IP{net.ParseIP("192.168.1.53"), net.ParseIP("172.16.0.1")}
+
+	if is, want := len(ipsInSubnets(ips, []net.Addr{other})), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	result := ipsInSubnets(ips, []net.Addr{other, lan})
+	if is, want := len(result), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := result[0].String(), "192.168.1.53"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestServiceStatusFunc(t *testing.T) {
+	var events []StatusEvent
+	cfg := Config{
+		Name: "Test",
+		Type: "_asdf._tcp",
+		Port: 1234,
+		StatusFunc: func(e StatusEvent) {
+			events = append(events, e)
+		},
+	}
+	sv, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := sv.Copy()
+	renamed.Name = incrementServiceName(sv.Name, 2)
+	renamed.notifyRenamed(sv)
+	renamed.notify(StatusRegistered)
+
+	if is, want := len(events), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := events[0].Status, StatusNameChanged; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := events[0].OldName, "Test._asdf._tcp.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := events[0].Service.ServiceInstanceName(), "Test (2)._asdf._tcp.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := events[1].Status, StatusRegistered; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestAddrPolicies(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("192.168.0.10"),
+		net.ParseIP("169.254.1.1"),
+		net.ParseIP("fe80::1"),
+		net.ParseIP("2001:db8::1"),
+	}
+
+	if is, want := len(ExcludeLinkLocal(nil, ips)), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := len(PreferGlobal(nil, ips)), 3; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// link-local IPv6 addresses are kept without a global address
+	if is, want := len(PreferGlobal(nil, ips[:3])), 3; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	_, subnet, _ := net.ParseCIDR("192.168.0.0/24")
+	selected := Policies(ExcludeLinkLocal, InSubnets(subnet))(nil, ips)
+	if is, want := len(selected), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := selected[0].String(), "192.168.0.10"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestPerInterfacePolicy(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("192.168.0.10"),
+		net.ParseIP("fd00::1"),
+		net.ParseIP("fe80::1"),
+	}
+
+	policy := PerInterface(map[string]AddrPolicy{
+		"eth0":  IPv4Only,
+		"wpan*": IPv6Only,
+	})
+
+	if is, want := policy(&net.Interface{Name: "eth0"}, ips), ips[:1]; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := policy(&net.Interface{Name: "wpan0"}, ips), ips[1:]; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := policy(&net.Interface{Name: "eth1"}, ips), ips; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	// The longest matching pattern is applied.
+	policy = PerInterface(map[string]AddrPolicy{
+		"*":      ExcludeLinkLocal,
+		"wlan*":  IPv4Only,
+		"wlan0*": IPv6Only,
+	})
+
+	for i := 0; i < 10; i++ {
+		if is, want := policy(&net.Interface{Name: "wlan0"}, ips), ips[1:]; !reflect.DeepEqual(is, want) {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+}
+
+func TestTemporaryCache(t *testing.T) {
+	c := &temporaryCache{}
+	iface := &net.Interface{Index: 1000, Name: "test0"}
+	c.lookup(iface)
+	if _, ok := c.addrs[iface.Index]; !ok {
+		t.Fatal("expected cached addresses")
+	}
+
+	c.reset()
+	if is, want := len(c.addrs), 0; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestParseServiceInstanceNameWithMultipleLabels(t *testing.T) {
+	tests := []struct {
+		Instance string
+		Name     string
+		Service  string
+		Domain   string
+	}{
+		{"Test\\.._hap._tcp.local.", "Test.", "_hap._tcp", "local"},
+		{"Test\\\\._hap._tcp.local.", "Test\\", "_hap._tcp", "local"},
+		{"Caf\\195\\169._hap._tcp.local.", "Café", "_hap._tcp", "local"},
+		{"Test._hap._tcp.corp.local.", "Test", "_hap._tcp", "corp.local"},
+		{"Test._hap._udp.local.", "Test", "_hap._udp", "local"},
+	}
+
+	for _, test := range tests {
+		name, service, domain := parseServiceInstanceName(test.Instance)
+		if is, want := name, test.Name; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+		if is, want := service, test.Service; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+		if is, want := domain, test.Domain; is != want {
+			t.Fatalf("is=%v want=%v", is, want)
+		}
+	}
+}
+
+func TestSetHostnameWithMultipleLabels(t *testing.T) {
+	srv := newService("Test._hap._tcp.local.")
+	srv.SetHostname("airport.corpisone.container.local.")
+
+	if is, want := srv.Host, "airport.corpisone.container"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := srv.Hostname(), "airport.corpisone.container.local."; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	text, flags := parseText([]string{"Key=1", "key=2", "paper", "empty=", "=ignored", "PAPER=3", ""})
+
+	if is, want := len(text), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := text["Key"], "1"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if v, ok := text["empty"]; !ok || v != "" {
+		t.Fatalf("is=%v want=%v", v, "")
+	}
+
+	if is, want := len(flags), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := flags[0], "paper"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestTXTWithFlags(t *testing.T) {
+	sv, err := NewService(Config{
+		Name:      "Test",
+		Type:      "_ipp._tcp",
+		Port:      631,
+		Text:      map[string]string{"rp": "printer"},
+		TextFlags: []string{"Color"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txt := TXT(sv)
+	if is, want := len(txt.Txt), 2; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := txt.Txt[1], "Color"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestConfigCopy(t *testing.T) {
+	cfg := Config{
+		Name:                 "Test",
+		Type:                 "_ipp._tcp",
+		StrictType:           true,
+		UnregisteredTypeFunc: func(typ string) {},
+		Domain:               "local",
+		Host:                 "Computer",
+		Text:                 map[string]string{"rp": "printer"},
+		TextFlags:            []string{"Color"},
+		IPs:                  []net.IP{net.IP{192, 168, 0, 1}},
+		Addrs:                []netip.Addr{netip.MustParseAddr("192.168.0.2")},
+		Port:                 631,
+		Ifaces:               []string{"lo0"},
+		IfaceFilter:          func(iface net.Interface) bool { return true },
+		IfaceIPs:             map[string][]net.IP{"lo0": []net.IP{net.IP{127, 0, 0, 1}}},
+		Aliases:              []string{"Alias"},
+		Hosts:                []string{"Other"},
+		Proxy:                true,
+		StatusFunc:           func(e StatusEvent) {},
+		SkipProbe:            true,
+		AddrPolicy:           ExcludeTemporary,
+	}
+
+	// Every field must be copied.
+	v := reflect.ValueOf(cfg.Copy())
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Fatalf("field %s not copied", v.Type().Field(i).Name)
+		}
+	}
+}
+
+func TestNewServiceIfaceIPs(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	ip := net.IPv4(127, 0, 0, 1)
+	srv, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, IfaceIPs: map[string][]net.IP{lo.Name: {ip}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := srv.Ifaces, []string{lo.Name}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := srv.IPsAtInterface(lo), []net.IP{ip}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// The address must be assigned to the interface in the network
+	// namespace of the responder, to which the service is added.
+	r := newResponder(newTestConn())
+	if _, err := r.Add(srv); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, IfaceIPs: map[string][]net.IP{lo.Name: {net.IPv4(192, 0, 2, 1)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Add(invalid); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := r.AddAll([]Service{invalid}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The interface must be in Ifaces.
+	if _, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, Ifaces: []string{"eth0"}, IfaceIPs: map[string][]net.IP{lo.Name: {ip}}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewServiceAddrs(t *testing.T) {
+	lo, err := LoopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	addrs := []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("::ffff:192.0.2.2")}
+	srv, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, Addrs: addrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The addresses are advertised instead of the addresses of the interface.
+	if is, want := srv.IPsAtInterface(lo), []net.IP{net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4()}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, Addrs: []netip.Addr{{}}}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, Host: "Printer", Proxy: true, Addrs: addrs}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewServiceAddrsPerInterface(t *testing.T) {
+	addrs := []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("fd00::1")}
+	srv, err := NewService(Config{
+		Name:  "Test",
+		Type:  "_asdf._tcp",
+		Port:  1234,
+		Addrs: addrs,
+		AddrPolicy: PerInterface(map[string]AddrPolicy{
+			"eth0":  IPv4Only,
+			"wpan0": IPv6Only,
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The policy also selects from the addresses of the service.
+	if is, want := srv.IPsAtInterface(&net.Interface{Name: "eth0"}), []net.IP{net.IPv4(192, 0, 2, 1).To4()}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := srv.IPsAtInterface(&net.Interface{Name: "wpan0"}), []net.IP{net.ParseIP("fd00::1")}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(srv.IPsAtInterface(&net.Interface{Name: "eth1"})), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestAddIP(t *testing.T) {
+	sv, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ifaceIPs = map[string][]net.IP{}
+
+	en0 := &net.Interface{Name: "en0"}
+	en1 := &net.Interface{Name: "en1"}
+	ip := net.IP{192, 168, 0, 123}
+
+	sv.addIP(ip, en0)
+	sv.addIP(ip, en0)
+	sv.addIP(ip, en1)
+
+	if is, want := len(sv.IPs), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	for _, name := range []string{"en0", "en1"} {
+		if is, want := len(sv.ifaceIPs[name]), 1; is != want {
+			t.Fatalf("%s: is=%v want=%v", name, is, want)
+		}
+	}
+}
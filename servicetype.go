@@ -0,0 +1,117 @@
+package dnssd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ServiceTypeError describes why a service type is invalid.
+type ServiceTypeError struct {
+	// Type is the invalid service type.
+	Type string
+
+	// Reason describes the violated rule.
+	Reason string
+}
+
+func (e *ServiceTypeError) Error() string {
+	return fmt.Sprintf("invalid service type \"%s\": %s", e.Type, e.Reason)
+}
+
+// registeredServiceNames contains the names of commonly used service types,
+// which are registered at IANA. It is read-only.
+var registeredServiceNames = map[string]bool{
+	"airplay":         true,
+	"afpovertcp":      true,
+	"companion-link":  true,
+	"daap":            true,
+	"device-info":     true,
+	"ftp":             true,
+	"googlecast":      true,
+	"hap":             true,
+	"http":            true,
+	"https":           true,
+	"ipp":             true,
+	"ipps":            true,
+	"matter":          true,
+	"matterc":         true,
+	"mqtt":            true,
+	"nfs":             true,
+	"pdl-datastream":  true,
+	"printer":         true,
+	"raop":            true,
+	"rfb":             true,
+	"scanner":         true,
+	"sftp-ssh":        true,
+	"smb":             true,
+	"spotify-connect": true,
+	"ssh":             true,
+	"uscan":           true,
+	"uscans":          true,
+	"webdav":          true,
+	"workstation":     true,
+}
+
+// IsRegisteredServiceName returns true, if name is the name of a commonly used
+// service type, which is registered at IANA, e.g. "hap" for "_hap._tcp".
+func IsRegisteredServiceName(name string) bool {
+	return registeredServiceNames[strings.ToLower(name)]
+}
+
+// ValidateServiceType returns a *ServiceTypeError, if typ is not a valid service type
+// in the form of "_<name>._tcp" or "_<name>._udp". The name must be 1-15 characters
+// long and consist of letters, digits and hyphens. It must contain at least one letter
+// and must not begin or end with a hyphen or contain consecutive hyphens. (RFC6335 5.1)
+func ValidateServiceType(typ string) error {
+	fail := func(reason string) error {
+		return &ServiceTypeError{Type: typ, Reason: reason}
+	}
+
+	labels := strings.Split(typ, ".")
+	if len(labels) != 2 {
+		return fail(`expected "_<name>._tcp" or "_<name>._udp"`)
+	}
+
+	if proto := labels[1]; proto != "_tcp" && proto != "_udp" {
+		return fail(`protocol must be "_tcp" or "_udp"`)
+	}
+
+	if !strings.HasPrefix(labels[0], "_") {
+		return fail("name must begin with an underscore")
+	}
+
+	name := labels[0][1:]
+	switch {
+	case len(name) == 0:
+		return fail("name is empty")
+	case len(name) > 15:
+		return fail("name is longer than 15 characters")
+	case strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-"):
+		return fail("name must not begin or end with a hyphen")
+	case strings.Contains(name, "--"):
+		return fail("name must not contain consecutive hyphens")
+	}
+
+	hasLetter := false
+	for _, r := range name {
+		switch {
+		case isAlpha(r):
+			hasLetter = true
+		case isDigit(r) || r == '-':
+		default:
+			return fail(fmt.Sprintf("name contains invalid character %q", r))
+		}
+	}
+
+	if !hasLetter {
+		return fail("name must contain at least one letter")
+	}
+
+	return nil
+}
+
+// serviceTypeName returns the name of the service type typ, e.g. "hap" for "_hap._tcp".
+func serviceTypeName(typ string) string {
+	name, _, _ := strings.Cut(typ, ".")
+	return strings.ToLower(strings.TrimPrefix(name, "_"))
+}
@@ -0,0 +1,69 @@
+package dnssd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateServiceType(t *testing.T) {
+	tests := []struct {
+		Type  string
+		Valid bool
+	}{
+		{"_hap._tcp", true},
+		{"_sftp-ssh._tcp", true},
+		{"_x1._udp", true},
+		{"hap._tcp", false},
+		{"_hap._sctp", false},
+		{"_hap", false},
+		{"_._tcp", false},
+		{"_abcdefghijklmnop._tcp", false},
+		{"_-hap._tcp", false},
+		{"_ha--p._tcp", false},
+		{"_123._tcp", false},
+		{"_my_service._tcp", false},
+	}
+
+	for _, test := range tests {
+		err := ValidateServiceType(test.Type)
+		if is, want := err == nil, test.Valid; is != want {
+			t.Fatalf("%s: is=%v want=%v (%v)", test.Type, is, want, err)
+		}
+
+		var typeErr *ServiceTypeError
+		if err != nil && !errors.As(err, &typeErr) {
+			t.Fatalf("%s: unexpected error type %T", test.Type, err)
+		}
+	}
+}
+
+func TestStrictType(t *testing.T) {
+	if _, err := NewService(Config{Name: "Test", Type: "_my_service._tcp", Port: 1234}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewService(Config{Name: "Test", Type: "_my_service._tcp", Port: 1234, StrictType: true}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestUnregisteredTypeFunc(t *testing.T) {
+	var unregistered []string
+	fn := func(typ string) {
+		unregistered = append(unregistered, typ)
+	}
+
+	for _, typ := range []string{"_hap._tcp", "_HAP._tcp", "_asdf._tcp"} {
+		if _, err := NewService(Config{Name: "Test", Type: typ, Port: 1234, StrictType: true, UnregisteredTypeFunc: fn}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if is, want := len(unregistered), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := unregistered[0], "_asdf._tcp"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
@@ -0,0 +1,157 @@
+package dnssd
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// SharedConn is a mDNS connection, which can be used by a responder and
+// multiple lookups at the same time. Every reader receives all messages.
+// Messages, which a reader doesn't read in time, are dropped for that
+// reader and counted (see Stats), so that a slow reader doesn't block
+// the other readers.
+//
+// Close does nothing, so that responders and lookups don't close the
+// connection when they are done. Use Shutdown to close the connection.
+type SharedConn struct {
+	conn MDNSConn
+
+	mutex   sync.Mutex
+	readers map[*sharedReader]struct{}
+	cancel  context.CancelFunc
+
+	// dropped is the number of messages, which were dropped for readers.
+	dropped atomic.Uint64
+
+	logger *slog.Logger
+}
+
+type sharedReader struct {
+	ctx context.Context
+	ch  chan *Request
+}
+
+// NewSharedConn returns a shared connection, which joins the multicast groups
+// at the network interfaces ifaces, or at all multicast interfaces if none are specified.
+func NewSharedConn(ifaces ...string) (*SharedConn, error) {
+	conn, err := newMDNSConn(ifaces...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ShareConn(conn), nil
+}
+
+// ShareConn returns a shared connection, which reads messages from conn.
+func ShareConn(conn MDNSConn) *SharedConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &SharedConn{
+		conn:    conn,
+		readers: map[*sharedReader]struct{}{},
+		cancel:  cancel,
+		logger:  loggerOf(conn),
+	}
+
+	go c.read(ctx)
+
+	return c
+}
+
+func (c *SharedConn) read(ctx context.Context) {
+	ch := c.conn.Read(ctx)
+	for {
+		select {
+		case req := <-ch:
+			c.mutex.Lock()
+			readers := make([]*sharedReader, 0, len(c.readers))
+			for r := range c.readers {
+				readers = append(readers, r)
+			}
+			c.mutex.Unlock()
+
+			for _, r := range readers {
+				if r.ctx.Err() != nil {
+					continue
+				}
+
+				// Every reader gets its own copy of the request.
+				select {
+				case r.ch <- copyRequest(req):
+				default:
+					c.logger.Debug("Dropping message for a busy reader", "peer", req.from, "iface", req.IfaceName())
+					c.dropped.Add(1)
+				}
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// copyRequest returns a copy of req, which doesn't share the message with req.
+func copyRequest(req *Request) *Request {
+	c := *req
+	if req.msg != nil {
+		c.msg = req.msg.Copy()
+	}
+
+	return &c
+}
+
+// SendQuery sends a mDNS query.
+func (c *SharedConn) SendQuery(q *Query) error {
+	return c.conn.SendQuery(q)
+}
+
+// SendResponse sends a mDNS response.
+func (c *SharedConn) SendResponse(resp *Response) error {
+	return c.conn.SendResponse(resp)
+}
+
+// Read returns a channel, which receives all mDNS messages until ctx is done.
+// Up to DefaultReadBufferSize messages are buffered until they are read.
+func (c *SharedConn) Read(ctx context.Context) <-chan *Request {
+	r := &sharedReader{ctx: ctx, ch: make(chan *Request, DefaultReadBufferSize)}
+
+	c.mutex.Lock()
+	c.readers[r] = struct{}{}
+	c.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mutex.Lock()
+		delete(c.readers, r)
+		c.mutex.Unlock()
+	}()
+
+	return r.ch
+}
+
+// Drain does nothing, because messages are only
+// buffered for readers, until they are done.
+func (c *SharedConn) Drain(ctx context.Context) {}
+
+// Close does nothing. Use Shutdown to close the connection.
+func (c *SharedConn) Close() {}
+
+// namespace returns the network namespace of the shared connection.
+func (c *SharedConn) namespace() *netns {
+	return netnsOf(c.conn)
+}
+
+// joinGroups joins the multicast groups at ifaces, if the shared connection can join them.
+func (c *SharedConn) joinGroups(ifaces []*net.Interface) {
+	if j, ok := c.conn.(groupJoiner); ok {
+		j.joinGroups(ifaces)
+	}
+}
+
+// Shutdown stops reading and closes the connection.
+func (c *SharedConn) Shutdown() {
+	c.cancel()
+	c.conn.Close()
+}
@@ -0,0 +1,91 @@
+package dnssd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSharedConn(t *testing.T) {
+	conn := newTestConn()
+	shared := ShareConn(conn)
+	defer shared.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ch1 := shared.Read(ctx)
+	ch2 := shared.Read(ctx)
+
+	msg := new(dns.Msg)
+	msg.Id = 42
+	conn.in <- msg
+
+	var reqs []*Request
+	for n := 0; n < 2; {
+		select {
+		case req := <-ch1:
+			reqs = append(reqs, req)
+			ch1 = nil
+			if is, want := req.msg.Id, uint16(42); is != want {
+				t.Fatalf("is=%v want=%v", is, want)
+			}
+			n++
+		case req := <-ch2:
+			reqs = append(reqs, req)
+			ch2 = nil
+			if is, want := req.msg.Id, uint16(42); is != want {
+				t.Fatalf("is=%v want=%v", is, want)
+			}
+			n++
+		case <-ctx.Done():
+			t.Fatal("timeout")
+		}
+	}
+
+	// Every reader gets its own request.
+	if reqs[0] == reqs[1] || reqs[0].msg == reqs[1].msg {
+		t.Fatal("readers share the request")
+	}
+}
+
+func TestSharedConnSlowReader(t *testing.T) {
+	conn := newTestConn()
+	shared := ShareConn(conn)
+	defer shared.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The slow reader doesn't read any messages.
+	shared.Read(ctx)
+	ch := shared.Read(ctx)
+
+	n := DefaultReadBufferSize + 10
+	for i := 0; i < n; i++ {
+		msg := new(dns.Msg)
+		msg.Id = uint16(i)
+		conn.in <- msg
+
+		select {
+		case req := <-ch:
+			if is, want := req.msg.Id, uint16(i); is != want {
+				t.Fatalf("is=%v want=%v", is, want)
+			}
+		case <-ctx.Done():
+			t.Fatal("timeout")
+		}
+	}
+
+	// The last message may be dropped for the slow reader after it was read.
+	want := uint64(n - DefaultReadBufferSize)
+	for shared.Stats().Dropped != want {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("is=%v want=%v", shared.Stats().Dropped, want)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
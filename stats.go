@@ -0,0 +1,69 @@
+package dnssd
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReadBufferSize is the default number of received
+// messages, which are buffered until they are read.
+const DefaultReadBufferSize = 32
+
+// LateReadDelay is the duration after which a received message,
+// which was not read yet, is counted as late.
+const LateReadDelay = 100 * time.Millisecond
+
+// ConnStats are the counters of the messages received by a mDNS connection.
+// Dropped or late messages indicate, that the readers of the connection
+// don't keep up, which may lead to missed responses.
+type ConnStats struct {
+	// Received is the number of received packets.
+	Received uint64
+
+	// Dropped is the number of received packets,
+	// which were dropped because the buffers were full.
+	Dropped uint64
+
+	// Late is the number of messages, which were read
+	// later than LateReadDelay after they were received.
+	Late uint64
+}
+
+// StatsConn is implemented by mDNS connections, which count
+// their received messages, like the connections returned by NewMDNSConn.
+type StatsConn interface {
+	// Stats returns the counters of the connection.
+	Stats() ConnStats
+}
+
+type connStats struct {
+	received atomic.Uint64
+	dropped  atomic.Uint64
+	late     atomic.Uint64
+}
+
+func (s *connStats) snapshot() ConnStats {
+	return ConnStats{
+		Received: s.received.Load(),
+		Dropped:  s.dropped.Load(),
+		Late:     s.late.Load(),
+	}
+}
+
+// Stats returns the counters of the received messages.
+func (c *mdnsConn) Stats() ConnStats {
+	return c.stats.snapshot()
+}
+
+// Stats returns the counters of the underlying connection, or zero counters
+// if it doesn't count its messages. Dropped also counts the messages,
+// which were dropped for readers of the shared connection.
+func (c *SharedConn) Stats() ConnStats {
+	var stats ConnStats
+	if sc, ok := c.conn.(StatsConn); ok {
+		stats = sc.Stats()
+	}
+	stats.Dropped += c.dropped.Load()
+
+	return stats
+}
@@ -0,0 +1,120 @@
+package dnssd
+
+import (
+	"strings"
+)
+
+// Status is the registration status of a service.
+type Status int
+
+const (
+	// StatusProbing means that the service instance name and hostname are being probed.
+	StatusProbing Status = iota
+
+	// StatusRegistered means that probing has finished and the service is announced.
+	StatusRegistered
+
+	// StatusNameChanged means that the service was renamed because of a name conflict.
+	StatusNameChanged
+
+	// StatusConflictLost means that another host claimed the names of the service
+	// after registration. The service is probed again.
+	StatusConflictLost
+
+	// StatusReannounced means that the service was announced again.
+	StatusReannounced
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusProbing:
+		return "Probing"
+	case StatusRegistered:
+		return "Registered"
+	case StatusNameChanged:
+		return "NameChanged"
+	case StatusConflictLost:
+		return "ConflictLost"
+	case StatusReannounced:
+		return "Reannounced"
+	default:
+		return "Unknown"
+	}
+}
+
+// StatusEvent describes a change of the registration status of a service.
+type StatusEvent struct {
+	Status Status
+
+	// Service is the service at the time of the event.
+	Service Service
+
+	// OldName is the previous service instance name,
+	// if Status is StatusNameChanged.
+	OldName string
+}
+
+// StatusFunc is called when the registration status of a service changes.
+// The function is called without holding the lock of the responder, so it can
+// call the responder and the service handles. It must not block.
+type StatusFunc func(StatusEvent)
+
+// statusEvent is an event for the status function fn.
+type statusEvent struct {
+	fn    StatusFunc
+	event StatusEvent
+}
+
+// statusEvents collects status events, which are sent
+// after the responder has released its lock.
+type statusEvents []statusEvent
+
+// add adds an event with status for s, if s has a status function.
+func (es *statusEvents) add(s Service, status Status) {
+	if s.statusFn != nil {
+		*es = append(*es, statusEvent{s.statusFn, StatusEvent{Status: status, Service: s}})
+	}
+}
+
+// addRenamed adds an event with StatusNameChanged for s, if the service
+// instance name or hostname of s are different from old.
+func (es *statusEvents) addRenamed(s Service, old Service) {
+	if s.statusFn == nil {
+		return
+	}
+
+	if !isRenamed(s, old) {
+		return
+	}
+
+	*es = append(*es, statusEvent{s.statusFn, StatusEvent{Status: StatusNameChanged, Service: s, OldName: old.ServiceInstanceName()}})
+}
+
+// isRenamed returns true, if the service instance name or hostnames of s are different from old.
+func isRenamed(s Service, old Service) bool {
+	return s.ServiceInstanceName() != old.ServiceInstanceName() || s.Hostname() != old.Hostname() || strings.Join(s.Hosts, ".") != strings.Join(old.Hosts, ".")
+}
+
+// send calls the status functions with the events in order.
+func (es statusEvents) send() {
+	for _, e := range es {
+		e.fn(e.event)
+	}
+}
+
+// notify calls the status function of the service, if any.
+// It must not be called with the lock of the responder held.
+func (s Service) notify(status Status) {
+	var es statusEvents
+	es.add(s, status)
+	es.send()
+}
+
+// notifyRenamed calls the status function of the service with StatusNameChanged,
+// if the service instance name or hostname of s are different from old.
+// It must not be called with the lock of the responder held.
+func (s Service) notifyRenamed(old Service) {
+	var es statusEvents
+	es.addRenamed(s, old)
+	es.send()
+}
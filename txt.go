@@ -0,0 +1,288 @@
+package dnssd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxTextStringLen is the maximum length of a TXT string. (RFC6763 6.1)
+	maxTextStringLen = 255
+
+	// recommendedTextSize is the recommended maximum size of a TXT record,
+	// so that the record fits into one packet with other records. (RFC6763 6.2)
+	recommendedTextSize = 1300
+)
+
+// ParseText returns the attributes in the TXT strings txts, e.g. "key=value",
+// as key/value pairs and the keys of boolean attributes, which are present without "=".
+// Only the first occurrence of a key is used. (RFC6763 6.4)
+func ParseText(txts []string) (text map[string]string, flags []string) {
+	return parseText(txts)
+}
+
+// ParseTextWithFile returns the attributes like ParseText of the TXT strings txts and
+// of the file at path with one TXT string per line, e.g. the values of the -TXT and
+// -TXTFile flags of a command. Attributes in txts take precedence over attributes in
+// the file. Empty lines and lines starting with "#" are ignored. If path is empty,
+// only txts are parsed.
+func ParseTextWithFile(txts []string, path string) (text map[string]string, flags []string, err error) {
+	txts = append([]string{}, txts...)
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, line := range strings.Split(string(b), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				txts = append(txts, line)
+			}
+		}
+	}
+
+	text, flags = ParseText(txts)
+	return text, flags, nil
+}
+
+// TextFlag is a flag.Value, which collects the TXT strings of a repeatable flag, e.g.
+//
+//	var txtFlag dnssd.TextFlag
+//	flag.Var(&txtFlag, "TXT", "TXT record entry key=value (repeatable)")
+type TextFlag []string
+
+func (f *TextFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *TextFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// validateText returns an error, if the attributes text and flags can't be
+// published as TXT record. Keys must consist of at least one printable US-ASCII
+// character except "=", and every key/value pair must not exceed 255 bytes. (RFC6763 6.4)
+func validateText(text map[string]string, flags []string) error {
+	for key, value := range text {
+		if err := validateTextKey(key); err != nil {
+			return err
+		}
+
+		if n := len(key) + 1 + len(value); n > maxTextStringLen {
+			return fmt.Errorf("TXT attribute \"%s\" is %d bytes long (max %d)", key, n, maxTextStringLen)
+		}
+	}
+
+	for _, key := range flags {
+		if err := validateTextKey(key); err != nil {
+			return err
+		}
+
+		if len(key) > maxTextStringLen {
+			return fmt.Errorf("TXT attribute \"%s\" is %d bytes long (max %d)", key, len(key), maxTextStringLen)
+		}
+	}
+
+	return nil
+}
+
+func validateTextKey(key string) error {
+	if len(key) == 0 {
+		return fmt.Errorf("empty TXT key")
+	}
+
+	for _, c := range []byte(key) {
+		if c < 0x20 || c > 0x7e || c == '=' {
+			return fmt.Errorf("invalid character %q in TXT key \"%s\"", c, key)
+		}
+	}
+
+	return nil
+}
+
+// textSize returns the size of the TXT record data for text and flags.
+func textSize(text map[string]string, flags []string) int {
+	n := 0
+	for key, value := range text {
+		n += 1 + len(key) + 1 + len(value)
+	}
+
+	for _, key := range flags {
+		n += 1 + len(key)
+	}
+
+	return n
+}
+
+// TXTVersionKey is the key of the TXT record version, which
+// should be the first attribute of a TXT record. (RFC6763 6.7)
+const TXTVersionKey = "txtvers"
+
+// TXTRecord builds and reads the attributes of a TXT record.
+// Keys are case-insensitive and looked up with LookupText.
+type TXTRecord struct {
+	// Text are the attributes with values.
+	Text map[string]string
+
+	// Flags are the keys of boolean attributes without value.
+	Flags []string
+}
+
+// NewTXTRecord returns an empty TXT record.
+func NewTXTRecord() *TXTRecord {
+	return &TXTRecord{Text: map[string]string{}}
+}
+
+// TXTRecordOf returns a TXT record to read the attributes text and flags,
+// e.g. the Text and TextFlags of a BrowseEntry.
+func TXTRecordOf(text map[string]string, flags []string) *TXTRecord {
+	t := NewTXTRecord()
+	for key, value := range text {
+		t.Text[key] = value
+	}
+	t.Flags = append(t.Flags, flags...)
+
+	return t
+}
+
+// LookupText returns the value of the attribute key in text and true,
+// if it has a value. Keys keep the case in which they were received,
+// but are matched case-insensitive. (RFC6763 6.4)
+// Use LookupText instead of indexing text, e.g. the Text of a BrowseEntry.
+func LookupText(text map[string]string, key string) (string, bool) {
+	if k, ok := textKey(text, key); ok {
+		return text[k], true
+	}
+
+	return "", false
+}
+
+// textKey returns the key in text, which is equal to key ignoring case.
+func textKey(text map[string]string, key string) (string, bool) {
+	if _, ok := text[key]; ok {
+		return key, true
+	}
+
+	for k := range text {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+
+	return "", false
+}
+
+// key returns the key in the record, which is equal to key ignoring case.
+func (t *TXTRecord) key(key string) (string, bool) {
+	return textKey(t.Text, key)
+}
+
+// flag returns the index of key in the flags, or -1 if it is not a flag.
+func (t *TXTRecord) flag(key string) int {
+	for i, f := range t.Flags {
+		if strings.EqualFold(f, key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Delete removes the attribute key.
+func (t *TXTRecord) Delete(key string) *TXTRecord {
+	if k, ok := t.key(key); ok {
+		delete(t.Text, k)
+	}
+
+	if i := t.flag(key); i >= 0 {
+		t.Flags = append(t.Flags[:i], t.Flags[i+1:]...)
+	}
+
+	return t
+}
+
+// Set sets the value of the attribute key.
+func (t *TXTRecord) Set(key string, value string) *TXTRecord {
+	t.Delete(key)
+	t.Text[key] = value
+
+	return t
+}
+
+// SetInt sets the attribute key to the decimal value v.
+func (t *TXTRecord) SetInt(key string, v int) *TXTRecord {
+	return t.Set(key, strconv.Itoa(v))
+}
+
+// SetBool adds key as boolean attribute without value, if v is true,
+// and removes the attribute otherwise. (RFC6763 6.4)
+func (t *TXTRecord) SetBool(key string, v bool) *TXTRecord {
+	t.Delete(key)
+	if v {
+		t.Flags = append(t.Flags, key)
+	}
+
+	return t
+}
+
+// SetVersion sets the version of the TXT record.
+func (t *TXTRecord) SetVersion(v int) *TXTRecord {
+	return t.SetInt(TXTVersionKey, v)
+}
+
+// Has returns true, if the attribute key is present.
+func (t *TXTRecord) Has(key string) bool {
+	_, ok := t.key(key)
+	return ok || t.flag(key) >= 0
+}
+
+// Get returns the value of the attribute key and true, if it has a value.
+func (t *TXTRecord) Get(key string) (string, bool) {
+	return LookupText(t.Text, key)
+}
+
+// GetString returns the value of the attribute key, or def if it has no value.
+func (t *TXTRecord) GetString(key string, def string) string {
+	if v, ok := t.Get(key); ok {
+		return v
+	}
+
+	return def
+}
+
+// GetInt returns the value of the attribute key as integer,
+// or def if it has no value or the value is not an integer.
+func (t *TXTRecord) GetInt(key string, def int) int {
+	if v, ok := t.Get(key); ok {
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+
+	return def
+}
+
+// GetBool returns true, if key is present as boolean attribute without value.
+// If the attribute has a value, it is parsed with strconv.ParseBool.
+// Otherwise def is returned.
+func (t *TXTRecord) GetBool(key string, def bool) bool {
+	if t.flag(key) >= 0 {
+		return true
+	}
+
+	if v, ok := t.Get(key); ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+
+	return def
+}
+
+// Version returns the version of the TXT record, or 0 if it has none.
+func (t *TXTRecord) Version() int {
+	return t.GetInt(TXTVersionKey, 0)
+}
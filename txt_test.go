@@ -0,0 +1,135 @@
+package dnssd
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateText(t *testing.T) {
+	tests := []struct {
+		Text  map[string]string
+		Flags []string
+		Valid bool
+	}{
+		{map[string]string{"key": "value"}, nil, true},
+		{map[string]string{"key": ""}, []string{"flag"}, true},
+		{map[string]string{"": "value"}, nil, false},
+		{map[string]string{"k=y": "value"}, nil, false},
+		{map[string]string{"kéy": "value"}, nil, false},
+		{map[string]string{"key": strings.Repeat("a", 251)}, nil, true},
+		{map[string]string{"key": strings.Repeat("a", 252)}, nil, false},
+		{nil, []string{"fl\tag"}, false},
+	}
+
+	for _, test := range tests {
+		err := validateText(test.Text, test.Flags)
+		if is, want := err == nil, test.Valid; is != want {
+			t.Fatalf("%v %v: is=%v want=%v (%v)", test.Text, test.Flags, is, want, err)
+		}
+	}
+
+	if _, err := NewService(Config{Name: "Test", Type: "_asdf._tcp", Port: 1234, Text: map[string]string{"=": ""}}); err == nil {
+		t.Fatal("expected error for invalid TXT key")
+	}
+}
+
+func TestTXTRecord(t *testing.T) {
+	txt := NewTXTRecord().SetVersion(1).SetInt("Port", 8080).SetBool("Color", true).Set("rp", "printer")
+
+	if is, want := txt.GetInt("port", 0), 8080; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := txt.GetBool("color", false), true; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := txt.GetBool("duplex", false), false; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := txt.GetInt("rp", 7), 7; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	txt.SetBool("color", false)
+	if txt.Has("Color") {
+		t.Fatal("expected Color to be removed")
+	}
+
+	sv, err := NewService(Config{
+		Name:      "Test",
+		Type:      "_ipp._tcp",
+		Port:      631,
+		Text:      txt.Text,
+		TextFlags: txt.Flags,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := TXT(sv).Txt[0], "txtvers=1"; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	read := TXTRecordOf(parseText(TXT(sv).Txt))
+	if is, want := read.Version(), 1; is != want {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+}
+
+func TestParseTextWithFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "txt")
+	data := "# printer\npdl=application/postscript\n\n  Color\nrp=printers/file\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var txts TextFlag
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&txts, "TXT", "")
+	if err := fs.Parse([]string{"-TXT", "rp=printers/flag", "-TXT", "Duplex"}); err != nil {
+		t.Fatal(err)
+	}
+
+	text, flags, err := ParseTextWithFile(txts, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries of the flag take precedence over entries in the file.
+	if is, want := text, map[string]string{"pdl": "application/postscript", "rp": "printers/flag"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if is, want := flags, []string{"Duplex", "Color"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	if _, _, err := ParseTextWithFile(nil, filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLookupText(t *testing.T) {
+	text, _ := parseText([]string{"Path=/admin", "path=/other", "Color"})
+
+	if is, want := text, map[string]string{"Path": "/admin"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("is=%v want=%v", is, want)
+	}
+
+	for _, key := range []string{"Path", "path", "PATH"} {
+		v, ok := LookupText(text, key)
+		if is, want := v, "/admin"; !ok || is != want {
+			t.Fatalf("%s: is=%v want=%v", key, is, want)
+		}
+	}
+
+	if _, ok := LookupText(text, "Color"); ok {
+		t.Fatal("expected no value of flag Color")
+	}
+}